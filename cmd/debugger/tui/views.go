@@ -89,13 +89,16 @@ func renderBytecodePanel(state *vm.VMState, width, height int, scrollPos *int) s
 	var allInstructions []instruction
 	i := 0
 	for i < len(ins) {
-		def, err := code.Lookup(ins[i])
+		op, operands, read, err := code.ReadInstruction(ins[i:])
 		if err != nil {
-			i++
+			i += read
 			continue
 		}
-
-		operands, read := code.ReadOperands(def, ins[i+1:])
+		def, _ := code.Lookup(byte(op))
+		name := def.Name
+		if code.Opcode(ins[i]) == code.OpWide {
+			name = "OpWide " + name
+		}
 
 		// Format instruction
 		var operandStr string
@@ -107,7 +110,7 @@ func renderBytecodePanel(state *vm.VMState, width, height int, scrollPos *int) s
 			operandStr = " " + operandStyle.Render(strings.Join(parts, " "))
 		}
 
-		instrLine := fmt.Sprintf("%04d %s%s", i, def.Name, operandStr)
+		instrLine := fmt.Sprintf("%04d %s%s", i, name, operandStr)
 
 		if i == currentIP {
 			instrLine = currentInstructionStyle.Render(instrLine)
@@ -117,7 +120,7 @@ func renderBytecodePanel(state *vm.VMState, width, height int, scrollPos *int) s
 		}
 
 		allInstructions = append(allInstructions, instruction{offset: i, line: instrLine})
-		i += 1 + read
+		i += read
 	}
 
 	// Find current instruction index
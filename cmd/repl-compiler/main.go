@@ -51,6 +51,7 @@ func main() {
 
 		code := bytes.NewBufferString(line + "\n")
 		handler.hasErrors = false
+		handler.source = line
 
 		replPath := "<repl>"
 		sc := scanner.New(code, &replPath)
@@ -74,7 +75,7 @@ func main() {
 
 		newStmts := lineModule.GetAllStatements()
 
-		comp := compiler.NewWithState(handler, symbolTable)
+		comp := compiler.NewWithState(handler, symbolTable, nil)
 		err = comp.Compile(newStmts[0])
 		if err != nil {
 			color.New(color.FgRed).Fprintf(color.Error, "Compilation error: %v\n", err)
@@ -89,14 +90,18 @@ func main() {
 		}
 
 		machine := vm.New(program)
+		numGlobals := len(machine.GetModuleGlobals(0))
 		for i, g := range globals {
-			if i < len(machine.GetModuleGlobals(0)) {
-				machine.GetModuleGlobals(0)[i] = g
+			if i < numGlobals {
+				machine.SetModuleGlobal(0, i, g)
 			}
 		}
 		err = machine.RunProgram()
 		if err != nil {
 			color.New(color.FgRed).Fprintf(color.Error, "Runtime error: %v\n", err)
+			if vmErr, ok := err.(*objects.VMRuntimeError); ok {
+				fmt.Fprint(color.Error, objects.Snippet(line, vmErr.Line, vmErr.Column, 1))
+			}
 			return
 		}
 
@@ -124,12 +129,14 @@ func main() {
 type replHandler struct {
 	disableWarning bool
 	hasErrors      bool
+	source         string // the input being compiled
 }
 
 var _ objects.DiagnosticHandler = (*replHandler)(nil)
 
 func (h *replHandler) Error(tok token.Token, msg string) {
 	color.New(color.FgRed).Fprintf(color.Error, "Error at line %d: %s\n", tok.Line, msg)
+	fmt.Fprint(color.Error, objects.TokenSnippet(h.source, tok))
 	h.hasErrors = true
 }
 
@@ -138,4 +145,5 @@ func (h *replHandler) Warn(tok token.Token, msg string) {
 		return
 	}
 	color.New(color.FgYellow).Fprintf(color.Error, "Warning at line %d: %s\n", tok.Line, msg)
+	fmt.Fprint(color.Error, objects.TokenSnippet(h.source, tok))
 }
@@ -33,9 +33,9 @@ func main() {
 	banner := figure.NewFigure("Viri", "", true).String()
 	fmt.Printf("\n%s\n\n(type :quit to exit)\n\n", banner)
 
-	interpreter := interp.NewInterpreter(nil)
+	interpreter := interp.NewInterpreter(nil, nil)
 	var programStmts []ast.Stmt
-	handler := &replHandler{disableWarning: !showWarning}
+	handler := &replHandler{disableWarning: !showWarning, sources: make(map[*string]string)}
 
 	executor := func(line string) {
 		if strings.TrimSpace(line) == "" {
@@ -50,6 +50,7 @@ func main() {
 		handler.hasErrors = false
 
 		replPath := "<repl>"
+		handler.sources[&replPath] = line
 		sc := scanner.New(code, &replPath)
 		tokens, err := sc.Scan()
 		if err != nil {
@@ -84,6 +85,9 @@ func main() {
 		results, err := interpreter.Interpret(newStmts)
 		if err != nil {
 			color.New(color.FgRed).Fprintf(color.Error, "Runtime error: %v\n", err)
+			if rtErr, ok := err.(*objects.RuntimeError); ok && rtErr.Token != nil {
+				fmt.Fprint(color.Error, objects.Snippet(handler.sources[rtErr.Token.FilePath], rtErr.Token.Line, rtErr.Token.Column, 1))
+			}
 			programStmts = programStmts[:len(programStmts)-len(newStmts)]
 			return
 		}
@@ -114,12 +118,17 @@ func main() {
 type replHandler struct {
 	disableWarning bool
 	hasErrors      bool
+
+	// Every input is scanned with its own path pointer, so tokens from
+	// earlier inputs still find the line they came from
+	sources map[*string]string
 }
 
 var _ objects.DiagnosticHandler = (*replHandler)(nil)
 
 func (h *replHandler) Error(tok token.Token, msg string) {
 	color.New(color.FgRed).Fprintf(color.Error, "Error at line %d: %s\n", tok.Line, msg)
+	fmt.Fprint(color.Error, objects.TokenSnippet(h.sources[tok.FilePath], tok))
 	h.hasErrors = true
 }
 
@@ -128,4 +137,5 @@ func (h *replHandler) Warn(tok token.Token, msg string) {
 		return
 	}
 	color.New(color.FgYellow).Fprintf(color.Error, "Warning at line %d: %s\n", tok.Line, msg)
+	fmt.Fprint(color.Error, objects.TokenSnippet(h.sources[tok.FilePath], tok))
 }
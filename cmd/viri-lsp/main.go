@@ -0,0 +1,17 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/harshagw/viri/internal/lsp"
+)
+
+// viri-lsp is a language server for Viri. Editors start it and talk to it
+// over stdin and stdout.
+func main() {
+	if err := lsp.NewServer(os.Stdin, os.Stdout).Run(); err != nil {
+		fmt.Fprintln(os.Stderr, "viri-lsp:", err)
+		os.Exit(1)
+	}
+}
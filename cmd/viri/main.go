@@ -11,9 +11,19 @@ import (
 const FILE_EXTENSION = ".viri"
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "fmt" {
+		runFmt(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "build" {
+		runBuild(os.Args[2:])
+		return
+	}
+
 	var fileName string
 	var debugMode bool
 	var statsMode bool
+	var noOptimize bool
 	var engine string = "interpreter" // default to interpreter
 	showWarning := true
 
@@ -25,15 +35,17 @@ func main() {
 			showWarning = false
 		} else if arg == "--stats" {
 			statsMode = true
+		} else if arg == "-O0" {
+			noOptimize = true
 		} else if val, found := strings.CutPrefix(arg, "--engine="); found {
 			engine = val
-		} else if strings.HasSuffix(arg, FILE_EXTENSION) {
+		} else if strings.HasSuffix(arg, FILE_EXTENSION) || strings.HasSuffix(arg, internal.BytecodeExtension) {
 			fileName = arg
 		}
 	}
 
 	if fileName == "" {
-		fmt.Println("Usage: viri [--debug] [--stats] [--engine=interpreter|vm] <file>")
+		fmt.Println("Usage: viri [--debug] [--stats] [--engine=interpreter|vm] [-O0] <file.viri|file.viric>")
 		os.Exit(64) // usage error
 	}
 
@@ -47,6 +59,7 @@ func main() {
 		StatsMode:      statsMode,
 		DisableWarning: !showWarning,
 		Engine:         engine,
+		NoOptimize:     noOptimize,
 	}
 	viri := internal.NewViriRuntime(config)
 
@@ -56,3 +69,69 @@ func main() {
 		os.Exit(70) // syntax error
 	}
 }
+
+// runBuild implements "viri build", which compiles a program to bytecode
+// that the VM runs directly.
+func runBuild(args []string) {
+	var fileName, outName string
+	var noOptimize bool
+	for i := 0; i < len(args); i++ {
+		if args[i] == "-o" && i+1 < len(args) {
+			outName = args[i+1]
+			i++
+		} else if args[i] == "-O0" {
+			noOptimize = true
+		} else if strings.HasSuffix(args[i], FILE_EXTENSION) {
+			fileName = args[i]
+		}
+	}
+
+	if fileName == "" {
+		fmt.Println("Usage: viri build [-O0] <file.viri> [-o <file.viric>]")
+		os.Exit(64) // usage error
+	}
+	if outName == "" {
+		outName = strings.TrimSuffix(fileName, FILE_EXTENSION) + internal.BytecodeExtension
+	}
+
+	viri := internal.NewViriRuntime(&internal.ViriRuntimeConfig{NoOptimize: noOptimize})
+	viri.Build(fileName, outName)
+
+	if viri.HasErrors() {
+		os.Exit(70) // syntax error
+	}
+}
+
+// runFmt implements "viri fmt", which prints, checks or rewrites the
+// canonical formatting of files and directories.
+func runFmt(args []string) {
+	mode := internal.FormatPrint
+	var paths []string
+	for _, arg := range args {
+		if arg == "--check" {
+			mode = internal.FormatCheck
+		} else if arg == "--write" {
+			mode = internal.FormatWrite
+		} else if strings.HasPrefix(arg, "--") {
+			paths = nil
+			break
+		} else {
+			paths = append(paths, arg)
+		}
+	}
+
+	if len(paths) == 0 {
+		fmt.Println("Usage: viri fmt [--check|--write] <file or directory>...")
+		os.Exit(64) // usage error
+	}
+
+	viri := internal.NewViriRuntime(nil)
+	changed := viri.Format(paths, mode)
+
+	if viri.HasErrors() {
+		os.Exit(70) // syntax error
+	}
+	if changed && mode == internal.FormatCheck {
+		os.Exit(1)
+	}
+}
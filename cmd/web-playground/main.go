@@ -7,6 +7,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"syscall/js"
+	"time"
 
 	"github.com/harshagw/viri/internal/ast"
 	"github.com/harshagw/viri/internal/interp"
@@ -46,10 +47,12 @@ func runViri(this js.Value, args []js.Value) (ret interface{}) {
 	input := args[0].String()
 
 	handler := &replHandler{errors: []string{}, warnings: []string{}}
-	interpreter := interp.NewInterpreter(nil)
+	interpreter := interp.NewInterpreter(nil, nil)
 
 	var outBuf bytes.Buffer
 	interpreter.SetStdout(&outBuf)
+	// Keep an endless loop from freezing the page
+	interpreter.SetLimits(objects.Limits{Timeout: 5 * time.Second})
 
 	finalResult := execute(input, interpreter, handler)
 
@@ -26,6 +26,7 @@ func (e *GroupingExpr) GetPrimaryToken() *token.Token { return e.Expr.GetPrimary
 
 type LiteralExpr struct {
 	Value interface{}
+	Token *token.Token // for a string segment of an interpolation, the token spelling it
 }
 
 func (*LiteralExpr) exprNode()                       {}
@@ -105,11 +106,16 @@ func (*SuperExpr) exprNode()                       {}
 func (e *SuperExpr) GetPrimaryToken() *token.Token { return e.Keyword }
 
 type ArrayLiteralExpr struct {
-	Elements []Expr
+	Elements     []Expr
+	Bracket      *token.Token // the opening '['
+	RightBracket *token.Token // the closing ']'
 }
 
 func (*ArrayLiteralExpr) exprNode() {}
 func (e *ArrayLiteralExpr) GetPrimaryToken() *token.Token {
+	if e.Bracket != nil {
+		return e.Bracket
+	}
 	if len(e.Elements) > 0 {
 		return e.Elements[0].GetPrimaryToken()
 	}
@@ -122,8 +128,9 @@ type HashPair struct {
 }
 
 type HashLiteralExpr struct {
-	Pairs []HashPair
-	Brace *token.Token
+	Pairs      []HashPair
+	Brace      *token.Token // the opening '{'
+	RightBrace *token.Token // the closing '}'
 }
 
 func (*HashLiteralExpr) exprNode()                       {}
@@ -138,6 +145,17 @@ type IndexExpr struct {
 func (*IndexExpr) exprNode()                       {}
 func (e *IndexExpr) GetPrimaryToken() *token.Token { return e.Bracket }
 
+// SliceExpr is object[start:end]. Start and End are nil when omitted.
+type SliceExpr struct {
+	Object  Expr
+	Start   Expr
+	End     Expr
+	Bracket *token.Token
+}
+
+func (*SliceExpr) exprNode()                       {}
+func (e *SliceExpr) GetPrimaryToken() *token.Token { return e.Bracket }
+
 type SetIndexExpr struct {
 	Object  Expr
 	Index   Expr
@@ -163,3 +181,14 @@ func (e *FunctionExpr) GetPrimaryToken() *token.Token {
 	}
 	return nil
 }
+
+// InterpolationExpr is a string literal with embedded expressions. Parts holds
+// the string segments as literals and the embedded expressions, in order. The
+// tokens of the segments keep their delimiters: `"a ${`, `} b ${` and `} c"`.
+type InterpolationExpr struct {
+	Parts []Expr
+	Token *token.Token // the first INTERPOLATION token
+}
+
+func (*InterpolationExpr) exprNode()                       {}
+func (e *InterpolationExpr) GetPrimaryToken() *token.Token { return e.Token }
@@ -113,6 +113,26 @@ func (p *Printer) printExpr(expr Expr) {
 			p.writeNode("index")
 			p.withPrefix(p.childPrefix(), true, func() { p.printExpr(n.Index) })
 		})
+	case *SliceExpr:
+		p.writeNode("Slice")
+		newPrefix := p.childPrefix()
+		p.withPrefix(newPrefix, false, func() { p.printExpr(n.Object) })
+		p.withPrefix(newPrefix, false, func() {
+			p.writeNode("start")
+			if n.Start != nil {
+				p.withPrefix(p.childPrefix(), true, func() { p.printExpr(n.Start) })
+			} else {
+				p.withPrefix(p.childPrefix(), true, func() { p.writeNode("nil") })
+			}
+		})
+		p.withPrefix(newPrefix, true, func() {
+			p.writeNode("end")
+			if n.End != nil {
+				p.withPrefix(p.childPrefix(), true, func() { p.printExpr(n.End) })
+			} else {
+				p.withPrefix(p.childPrefix(), true, func() { p.writeNode("nil") })
+			}
+		})
 	case *SetIndexExpr:
 		p.writeNode("SetIndex")
 		newPrefix := p.childPrefix()
@@ -142,6 +162,12 @@ func (p *Printer) printExpr(expr Expr) {
 			p.writeNode("body")
 			p.withPrefix(p.childPrefix(), true, func() { p.printStmt(n.Body) })
 		})
+	case *InterpolationExpr:
+		p.writeNode("Interpolation")
+		newPrefix := p.childPrefix()
+		for i, part := range n.Parts {
+			p.withPrefix(newPrefix, i == len(n.Parts)-1, func() { p.printExpr(part) })
+		}
 	case *HashLiteralExpr:
 		p.writeNode("HashLiteral")
 		newPrefix := p.childPrefix()
@@ -240,6 +266,21 @@ func (p *Printer) printStmt(stmt Stmt) {
 			p.writeNode("body")
 			p.withPrefix(p.childPrefix(), true, func() { p.printStmt(n.Body) })
 		})
+	case *ForInStmt:
+		names := make([]string, len(n.Variables))
+		for i, v := range n.Variables {
+			names[i] = v.Lexeme
+		}
+		p.writeNode("ForIn (" + strings.Join(names, ", ") + ")")
+		newPrefix := p.childPrefix()
+		p.withPrefix(newPrefix, false, func() {
+			p.writeNode("iterable")
+			p.withPrefix(p.childPrefix(), true, func() { p.printExpr(n.Iterable) })
+		})
+		p.withPrefix(newPrefix, true, func() {
+			p.writeNode("body")
+			p.withPrefix(p.childPrefix(), true, func() { p.printStmt(n.Body) })
+		})
 	case *BreakStmt:
 		p.writeNode("Break")
 	case *ContinueStmt:
@@ -275,6 +316,28 @@ func (p *Printer) printStmt(stmt Stmt) {
 				})
 			}
 		})
+	case *TryStmt:
+		p.writeNode("Try")
+		newPrefix := p.childPrefix()
+		p.withPrefix(newPrefix, n.CatchBody == nil && n.FinallyBody == nil, func() {
+			p.writeNode("body")
+			p.withPrefix(p.childPrefix(), true, func() { p.printStmt(n.Body) })
+		})
+		if n.CatchBody != nil {
+			p.withPrefix(newPrefix, n.FinallyBody == nil, func() {
+				p.writeNode("catch (" + n.CatchParam.Lexeme + ")")
+				p.withPrefix(p.childPrefix(), true, func() { p.printStmt(n.CatchBody) })
+			})
+		}
+		if n.FinallyBody != nil {
+			p.withPrefix(newPrefix, true, func() {
+				p.writeNode("finally")
+				p.withPrefix(p.childPrefix(), true, func() { p.printStmt(n.FinallyBody) })
+			})
+		}
+	case *ThrowStmt:
+		p.writeNode("Throw")
+		p.withPrefix(p.childPrefix(), true, func() { p.printExpr(n.Value) })
 	case *ImportStmt:
 		p.writeNode("Import (" + n.Path.Lexeme + ")")
 		if n.Alias != nil {
@@ -34,6 +34,8 @@ func (s *VarDeclStmt) GetPrimaryToken() *token.Token { return s.Name }
 
 type BlockStmt struct {
 	Statements []Stmt
+	LeftBrace  *token.Token // nil for blocks built outside the parser
+	RightBrace *token.Token
 }
 
 func (*BlockStmt) stmtNode() {}
@@ -79,6 +81,17 @@ func (s *ForStmt) GetPrimaryToken() *token.Token {
 	return nil
 }
 
+// ForInStmt is `for (var x in iterable)` or `for (var k, v in iterable)`.
+type ForInStmt struct {
+	Keyword   *token.Token
+	Variables []*token.Token // one or two loop variables
+	Iterable  Expr
+	Body      Stmt
+}
+
+func (*ForInStmt) stmtNode()                       {}
+func (s *ForInStmt) GetPrimaryToken() *token.Token { return s.Keyword }
+
 type BreakStmt struct {
 	Keyword *token.Token
 }
@@ -116,6 +129,8 @@ type ClassStmt struct {
 	SuperClass *VariableExpr
 	Methods    []*FunctionStmt
 	Exported   bool
+	LeftBrace  *token.Token
+	RightBrace *token.Token
 }
 
 func (*ClassStmt) stmtNode()                       {}
@@ -128,3 +143,22 @@ type ImportStmt struct {
 
 func (*ImportStmt) stmtNode()                       {}
 func (s *ImportStmt) GetPrimaryToken() *token.Token { return s.Path }
+
+type TryStmt struct {
+	Keyword     *token.Token
+	Body        *BlockStmt
+	CatchParam  *token.Token // nil when there is no catch clause
+	CatchBody   *BlockStmt
+	FinallyBody *BlockStmt
+}
+
+func (*TryStmt) stmtNode()                       {}
+func (s *TryStmt) GetPrimaryToken() *token.Token { return s.Keyword }
+
+type ThrowStmt struct {
+	Keyword *token.Token
+	Value   Expr
+}
+
+func (*ThrowStmt) stmtNode()                       {}
+func (s *ThrowStmt) GetPrimaryToken() *token.Token { return s.Keyword }
@@ -0,0 +1,128 @@
+package ast
+
+// Inspect traverses the tree rooted at node in depth-first order. It calls
+// fn for each node before its children and skips the children when fn
+// returns false.
+func Inspect(node Node, fn func(Node) bool) {
+	if node == nil || !fn(node) {
+		return
+	}
+
+	switch n := node.(type) {
+	// Statements
+	case *ExprStmt:
+		Inspect(n.Expr, fn)
+	case *PrintStmt:
+		Inspect(n.Expr, fn)
+	case *VarDeclStmt:
+		if n.Initializer != nil {
+			Inspect(n.Initializer, fn)
+		}
+	case *BlockStmt:
+		for _, stmt := range n.Statements {
+			Inspect(stmt, fn)
+		}
+	case *IfStmt:
+		Inspect(n.Condition, fn)
+		Inspect(n.ThenBranch, fn)
+		if n.ElseBranch != nil {
+			Inspect(n.ElseBranch, fn)
+		}
+	case *WhileStmt:
+		Inspect(n.Condition, fn)
+		Inspect(n.Body, fn)
+	case *ForStmt:
+		if n.Initializer != nil {
+			Inspect(n.Initializer, fn)
+		}
+		if n.Condition != nil {
+			Inspect(n.Condition, fn)
+		}
+		if n.Increment != nil {
+			Inspect(n.Increment, fn)
+		}
+		Inspect(n.Body, fn)
+	case *ForInStmt:
+		Inspect(n.Iterable, fn)
+		Inspect(n.Body, fn)
+	case *FunctionStmt:
+		Inspect(n.Body, fn)
+	case *ReturnStmt:
+		if n.Value != nil {
+			Inspect(n.Value, fn)
+		}
+	case *ClassStmt:
+		if n.SuperClass != nil {
+			Inspect(n.SuperClass, fn)
+		}
+		for _, method := range n.Methods {
+			Inspect(method, fn)
+		}
+	case *TryStmt:
+		Inspect(n.Body, fn)
+		if n.CatchBody != nil {
+			Inspect(n.CatchBody, fn)
+		}
+		if n.FinallyBody != nil {
+			Inspect(n.FinallyBody, fn)
+		}
+	case *ThrowStmt:
+		Inspect(n.Value, fn)
+	case *BreakStmt, *ContinueStmt, *ImportStmt:
+
+	// Expressions
+	case *BinaryExpr:
+		Inspect(n.Left, fn)
+		Inspect(n.Right, fn)
+	case *GroupingExpr:
+		Inspect(n.Expr, fn)
+	case *UnaryExpr:
+		Inspect(n.Expr, fn)
+	case *AssignExpr:
+		Inspect(n.Value, fn)
+	case *LogicalExpr:
+		Inspect(n.Left, fn)
+		Inspect(n.Right, fn)
+	case *CallExpr:
+		Inspect(n.Callee, fn)
+		for _, arg := range n.Arguments {
+			Inspect(arg, fn)
+		}
+	case *GetExpr:
+		Inspect(n.Object, fn)
+	case *SetExpr:
+		Inspect(n.Object, fn)
+		Inspect(n.Value, fn)
+	case *ArrayLiteralExpr:
+		for _, el := range n.Elements {
+			Inspect(el, fn)
+		}
+	case *HashLiteralExpr:
+		for _, pair := range n.Pairs {
+			Inspect(pair.Key, fn)
+			Inspect(pair.Value, fn)
+		}
+	case *IndexExpr:
+		Inspect(n.Object, fn)
+		Inspect(n.Index, fn)
+	case *SliceExpr:
+		Inspect(n.Object, fn)
+		if n.Start != nil {
+			Inspect(n.Start, fn)
+		}
+		if n.End != nil {
+			Inspect(n.End, fn)
+		}
+	case *SetIndexExpr:
+		Inspect(n.Object, fn)
+		Inspect(n.Index, fn)
+		Inspect(n.Value, fn)
+	case *FunctionExpr:
+		Inspect(n.Body, fn)
+	case *InterpolationExpr:
+		for _, part := range n.Parts {
+			Inspect(part, fn)
+		}
+	case *LiteralExpr, *VariableExpr, *ThisExpr, *SuperExpr:
+	}
+}
@@ -0,0 +1,452 @@
+// Package bytecode saves compiled programs to the .viric file format and
+// loads them back, so a program can be compiled once and run many times.
+//
+// A file is laid out as:
+//
+//	magic    "VIRC"
+//	version  uint16, big endian
+//	length   uint32, big endian, of the payload
+//	payload  natives, constants, modules and debug info
+//	checksum uint32, big endian, CRC-32 (IEEE) of the payload
+//
+// The payload stores integers as signed varints, strings and byte slices
+// with a varint length prefix, and numbers as their IEEE 754 bits. It starts
+// with the names of the natives the program was compiled against, which
+// Link looks up in the runtime loading it.
+package bytecode
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math"
+
+	"github.com/harshagw/viri/internal/code"
+	"github.com/harshagw/viri/internal/objects"
+)
+
+// Version is the format version written to new files. It changes whenever
+// the layout or the instruction set does, and only files of this version
+// can be loaded.
+const Version = 10
+
+const magic = "VIRC"
+
+const headerSize = len(magic) + 2 + 4
+
+// Constant tags.
+const (
+	tagNumber byte = iota + 1
+	tagString
+	tagFunction
+)
+
+var (
+	ErrBadMagic  = errors.New("not a compiled viri file")
+	ErrVersion   = errors.New("unsupported bytecode version")
+	ErrChecksum  = errors.New("bytecode checksum mismatch")
+	ErrCorrupt   = errors.New("corrupt bytecode")
+	ErrTruncated = errors.New("truncated bytecode")
+	ErrNative    = errors.New("unknown native")
+
+	errUnencodable = errors.New("constant cannot be saved")
+)
+
+// Marshal encodes program in the .viric format.
+func Marshal(program *objects.CompiledProgram) ([]byte, error) {
+	e := &encoder{}
+
+	e.int(len(program.Natives))
+	for _, name := range program.Natives {
+		e.string(name)
+	}
+
+	e.int(len(program.Constants))
+	for i, constant := range program.Constants {
+		if err := e.constant(constant); err != nil {
+			return nil, fmt.Errorf("constant %d (%s): %w", i, constant.Inspect(), err)
+		}
+	}
+
+	e.int(len(program.Modules))
+	for _, mod := range program.Modules {
+		e.bytes(mod.Instructions)
+		e.int(mod.NumGlobals)
+		e.int(mod.NumLocals)
+		e.int(len(mod.Exports))
+		for _, slot := range mod.Exports {
+			e.int(slot)
+		}
+		e.int(mod.DebugInfoIdx)
+	}
+
+	var entries []objects.DebugInfoEntry
+	if program.DebugInfo != nil {
+		entries = program.DebugInfo.Entries
+	}
+	e.int(len(entries))
+	for _, entry := range entries {
+		e.string(entry.FilePath)
+		e.lineTable(entry.LineTable)
+	}
+
+	out := make([]byte, 0, headerSize+len(e.buf)+4)
+	out = append(out, magic...)
+	out = binary.BigEndian.AppendUint16(out, Version)
+	out = binary.BigEndian.AppendUint32(out, uint32(len(e.buf)))
+	out = append(out, e.buf...)
+	out = binary.BigEndian.AppendUint32(out, crc32.ChecksumIEEE(e.buf))
+	return out, nil
+}
+
+// Unmarshal decodes a program saved by Marshal, checking its magic number,
+// version and checksum first.
+func Unmarshal(data []byte) (*objects.CompiledProgram, error) {
+	if len(data) < len(magic) || string(data[:len(magic)]) != magic {
+		return nil, ErrBadMagic
+	}
+	if len(data) < headerSize {
+		return nil, ErrTruncated
+	}
+	if version := binary.BigEndian.Uint16(data[len(magic):]); version != Version {
+		return nil, fmt.Errorf("%w %d, expected %d", ErrVersion, version, Version)
+	}
+	length := int(binary.BigEndian.Uint32(data[len(magic)+2:]))
+	if len(data)-headerSize < length+4 {
+		return nil, ErrTruncated
+	}
+	if len(data)-headerSize > length+4 {
+		return nil, fmt.Errorf("%w: trailing data", ErrCorrupt)
+	}
+	payload := data[headerSize : headerSize+length]
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(data[headerSize+length:]) {
+		return nil, ErrChecksum
+	}
+
+	d := &decoder{buf: payload}
+	program := &objects.CompiledProgram{DebugInfo: objects.NewDebugInfo()}
+
+	numNatives := d.length()
+	for i := 0; i < numNatives && d.err == nil; i++ {
+		program.Natives = append(program.Natives, d.string())
+	}
+
+	numConstants := d.length()
+	for i := 0; i < numConstants && d.err == nil; i++ {
+		program.Constants = append(program.Constants, d.constant())
+	}
+
+	numModules := d.length()
+	for i := 0; i < numModules && d.err == nil; i++ {
+		mod := objects.CompiledModule{
+			Instructions: code.Instructions(d.bytes()),
+			NumGlobals:   d.count(),
+			NumLocals:    d.count(),
+		}
+		numExports := d.length()
+		mod.Exports = make([]int, 0, numExports)
+		for j := 0; j < numExports && d.err == nil; j++ {
+			mod.Exports = append(mod.Exports, d.count())
+		}
+		mod.DebugInfoIdx = d.int()
+		program.Modules = append(program.Modules, mod)
+	}
+
+	numEntries := d.length()
+	for i := 0; i < numEntries && d.err == nil; i++ {
+		filePath := d.string()
+		program.DebugInfo.Add(d.lineTable(), filePath)
+	}
+
+	if d.err == nil && d.pos != len(d.buf) {
+		d.fail("%d unread bytes", len(d.buf)-d.pos)
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	if err := validate(program); err != nil {
+		return nil, err
+	}
+	return program, nil
+}
+
+// validate checks the references between the parts of a decoded program, so
+// a file written by a buggy or foreign tool fails here rather than in the VM.
+func validate(program *objects.CompiledProgram) error {
+	numEntries := len(program.DebugInfo.Entries)
+	checkDebugIdx := func(what string, idx int) error {
+		if idx < -1 || idx >= numEntries {
+			return fmt.Errorf("%w: %s has debug info %d of %d", ErrCorrupt, what, idx, numEntries)
+		}
+		return nil
+	}
+
+	for i, constant := range program.Constants {
+		if fn, ok := constant.(*objects.CompiledFunction); ok {
+			if err := checkDebugIdx(fmt.Sprintf("function %s", fn.Name), fn.DebugInfoIdx); err != nil {
+				return err
+			}
+			if fn.NumParameters > fn.NumLocals {
+				return fmt.Errorf("%w: constant %d has more parameters than locals", ErrCorrupt, i)
+			}
+		}
+	}
+	for i, mod := range program.Modules {
+		if err := checkDebugIdx(fmt.Sprintf("module %d", i), mod.DebugInfoIdx); err != nil {
+			return err
+		}
+		for _, slot := range mod.Exports {
+			if slot >= mod.NumGlobals {
+				return fmt.Errorf("%w: module %d exports slot %d of %d", ErrCorrupt, i, slot, mod.NumGlobals)
+			}
+		}
+	}
+	return nil
+}
+
+// Link points the OpGetNative instructions of a loaded program at the
+// natives of the runtime about to run it, which may order them differently
+// from the one that compiled it. Natives are looked up by the names saved
+// with the program, and Link fails with ErrNative if one is missing. A nil
+// registry means the builtins.
+func Link(program *objects.CompiledProgram, natives *objects.NativeRegistry) error {
+	natives = objects.NativesOrDefault(natives)
+	link := func(ins code.Instructions) error {
+		for offset := 0; offset < len(ins); {
+			op, operands, read, err := code.ReadInstruction(ins[offset:])
+			if err != nil {
+				return fmt.Errorf("%w: %v", ErrCorrupt, err)
+			}
+			if op == code.OpGetNative {
+				if operands[0] >= len(program.Natives) {
+					return fmt.Errorf("%w: native %d of %d", ErrCorrupt, operands[0], len(program.Natives))
+				}
+				name := program.Natives[operands[0]]
+				index, ok := natives.Lookup(name)
+				if !ok {
+					return fmt.Errorf("%w %s: the runtime has no native of that name", ErrNative, name)
+				}
+				linked := code.Make(op, index)
+				if len(linked) != read {
+					return fmt.Errorf("%w %s: its index %d does not fit the instruction", ErrNative, name, index)
+				}
+				copy(ins[offset:], linked)
+			}
+			offset += read
+		}
+		return nil
+	}
+
+	for _, mod := range program.Modules {
+		if err := link(mod.Instructions); err != nil {
+			return err
+		}
+	}
+	for _, constant := range program.Constants {
+		if fn, ok := constant.(*objects.CompiledFunction); ok {
+			if err := link(fn.Instructions); err != nil {
+				return err
+			}
+		}
+	}
+	program.Natives = natives.Names()
+	return nil
+}
+
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) int(v int) {
+	e.buf = binary.AppendVarint(e.buf, int64(v))
+}
+
+func (e *encoder) bytes(b []byte) {
+	e.int(len(b))
+	e.buf = append(e.buf, b...)
+}
+
+func (e *encoder) string(s string) {
+	e.int(len(s))
+	e.buf = append(e.buf, s...)
+}
+
+func (e *encoder) bool(v bool) {
+	if v {
+		e.buf = append(e.buf, 1)
+	} else {
+		e.buf = append(e.buf, 0)
+	}
+}
+
+func (e *encoder) constant(obj objects.Object) error {
+	switch obj := obj.(type) {
+	case *objects.Number:
+		e.buf = append(e.buf, tagNumber)
+		e.buf = binary.BigEndian.AppendUint64(e.buf, math.Float64bits(obj.Value))
+	case *objects.String:
+		e.buf = append(e.buf, tagString)
+		e.string(obj.Value)
+	case *objects.CompiledFunction:
+		e.buf = append(e.buf, tagFunction)
+		e.bytes(obj.Instructions)
+		e.int(obj.NumLocals)
+		e.int(obj.NumParameters)
+		e.string(obj.Name)
+		e.bool(obj.Anonymous)
+		e.int(obj.DebugInfoIdx)
+	default:
+		return errUnencodable
+	}
+	return nil
+}
+
+// lineTable writes a line table as runs of instruction bytes sharing a
+// position, since every operand byte repeats the position of its opcode.
+func (e *encoder) lineTable(table []objects.Position) {
+	var runs int
+	for i := 0; i < len(table); i++ {
+		if i == 0 || table[i] != table[i-1] {
+			runs++
+		}
+	}
+	e.int(runs)
+	for i := 0; i < len(table); {
+		j := i + 1
+		for j < len(table) && table[j] == table[i] {
+			j++
+		}
+		e.int(j - i)
+		e.int(table[i].Line)
+		e.int(table[i].Column)
+		e.int(table[i].Offset)
+		i = j
+	}
+}
+
+// decoder reads a payload, remembering the first error so callers can check
+// once after a series of reads.
+type decoder struct {
+	buf []byte
+	pos int
+	err error
+}
+
+func (d *decoder) fail(format string, args ...interface{}) {
+	if d.err == nil {
+		d.err = fmt.Errorf("%w: %s at byte %d", ErrCorrupt, fmt.Sprintf(format, args...), d.pos)
+	}
+}
+
+func (d *decoder) int() int {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.buf[d.pos:])
+	if n <= 0 || v < math.MinInt32 || v > math.MaxInt32 {
+		d.fail("bad integer")
+		return 0
+	}
+	d.pos += n
+	return int(v)
+}
+
+// count reads a non-negative integer such as an index.
+func (d *decoder) count() int {
+	v := d.int()
+	if v < 0 {
+		d.fail("negative count %d", v)
+		return 0
+	}
+	return v
+}
+
+// length reads the size of a collection or byte slice. Every element takes
+// at least a byte, so a length past the end of the payload is corrupt.
+func (d *decoder) length() int {
+	n := d.count()
+	if n > len(d.buf)-d.pos {
+		d.fail("length %d past the end", n)
+		return 0
+	}
+	return n
+}
+
+func (d *decoder) bytes() []byte {
+	n := d.length()
+	if d.err != nil {
+		return nil
+	}
+	b := make([]byte, n)
+	copy(b, d.buf[d.pos:])
+	d.pos += n
+	return b
+}
+
+func (d *decoder) string() string {
+	return string(d.bytes())
+}
+
+func (d *decoder) byte() byte {
+	if d.err != nil {
+		return 0
+	}
+	if d.pos >= len(d.buf) {
+		d.fail("unexpected end")
+		return 0
+	}
+	b := d.buf[d.pos]
+	d.pos++
+	return b
+}
+
+func (d *decoder) bool() bool {
+	return d.byte() != 0
+}
+
+func (d *decoder) constant() objects.Object {
+	switch tag := d.byte(); tag {
+	case tagNumber:
+		if len(d.buf)-d.pos < 8 {
+			d.fail("unexpected end")
+			return nil
+		}
+		bits := binary.BigEndian.Uint64(d.buf[d.pos:])
+		d.pos += 8
+		return &objects.Number{Value: math.Float64frombits(bits)}
+	case tagString:
+		return &objects.String{Value: d.string()}
+	case tagFunction:
+		return &objects.CompiledFunction{
+			Instructions:  code.Instructions(d.bytes()),
+			NumLocals:     d.count(),
+			NumParameters: d.count(),
+			Name:          d.string(),
+			Anonymous:     d.bool(),
+			DebugInfoIdx:  d.int(),
+		}
+	default:
+		d.fail("unknown constant tag %d", tag)
+		return nil
+	}
+}
+
+// lineTable reads a line table. A table has an entry per instruction byte,
+// so it cannot be longer than the payload holding those instructions.
+func (d *decoder) lineTable() []objects.Position {
+	runs := d.length()
+	var table []objects.Position
+	for i := 0; i < runs && d.err == nil; i++ {
+		n := d.count()
+		pos := objects.Position{Line: d.int(), Column: d.int(), Offset: d.int()}
+		if n > len(d.buf)-len(table) {
+			d.fail("line table too long")
+			return nil
+		}
+		for j := 0; j < n; j++ {
+			table = append(table, pos)
+		}
+	}
+	return table
+}
@@ -0,0 +1,223 @@
+package bytecode
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/harshagw/viri/internal/code"
+	"github.com/harshagw/viri/internal/compiler"
+	"github.com/harshagw/viri/internal/objects"
+	"github.com/harshagw/viri/internal/vm"
+)
+
+func compile(t *testing.T, path string) *objects.CompiledProgram {
+	t.Helper()
+	program, err := compiler.New(&objects.DiagnosticCollector{}).CompileProgram(path)
+	if err != nil {
+		t.Fatalf("CompileProgram(%s) error = %v", path, err)
+	}
+	return program
+}
+
+func TestRoundTrip(t *testing.T) {
+	files, err := filepath.Glob("../../test/testdata/*.viri")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no test programs found: %v", err)
+	}
+
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			program := compile(t, file)
+			data, err := Marshal(program)
+			if err != nil {
+				t.Fatalf("Marshal() error = %v", err)
+			}
+			loaded, err := Unmarshal(data)
+			if err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+
+			if !reflect.DeepEqual(loaded.Constants, program.Constants) {
+				t.Errorf("constants differ:\n%v\nwant\n%v", loaded.Constants, program.Constants)
+			}
+			if !reflect.DeepEqual(loaded.Modules, program.Modules) {
+				t.Errorf("modules differ:\n%+v\nwant\n%+v", loaded.Modules, program.Modules)
+			}
+			if !reflect.DeepEqual(loaded.Natives, program.Natives) {
+				t.Errorf("natives differ: %v, want %v", loaded.Natives, program.Natives)
+			}
+			for i, entry := range program.DebugInfo.Entries {
+				got := loaded.DebugInfo.Entries[i]
+				if got.FilePath != entry.FilePath || len(got.LineTable) != len(entry.LineTable) ||
+					(len(entry.LineTable) > 0 && !reflect.DeepEqual(got.LineTable, entry.LineTable)) {
+					t.Errorf("debug info %d differs: %+v, want %+v", i, got, entry)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadedProgramReportsPositions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "main.viri")
+	src := "fun f(x) {\n    return x - 1;\n}\nf(\"a\");\n"
+	if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	data, err := Marshal(compile(t, path))
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	program, err := Unmarshal(data)
+	if err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+
+	err = vm.New(program).RunProgram()
+	vmErr, ok := err.(*objects.VMRuntimeError)
+	if !ok {
+		t.Fatalf("expected a runtime error, got %v", err)
+	}
+	if vmErr.FilePath != path || vmErr.Line != 2 || vmErr.Column != 14 || len(vmErr.Trace) != 2 {
+		t.Errorf("unexpected error %s:%d:%d with trace %v", vmErr.FilePath, vmErr.Line, vmErr.Column, vmErr.Trace)
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	program := &objects.CompiledProgram{
+		Constants: []objects.Object{&objects.Number{Value: 1.5}, &objects.String{Value: "hi"}},
+		Modules: []objects.CompiledModule{{
+			Instructions: code.Make(code.OpGetConstant, 0),
+			NumGlobals:   1,
+			Exports:      []int{0},
+			DebugInfoIdx: 0,
+		}},
+		DebugInfo: &objects.DebugInfo{Entries: []objects.DebugInfoEntry{{
+			LineTable: []objects.Position{{Line: 1, Column: 1}, {Line: 1, Column: 1}, {Line: 1, Column: 1}},
+			FilePath:  "main.viri",
+		}}},
+	}
+	valid, err := Marshal(program)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+
+	modify := func(change func(data []byte) []byte) []byte {
+		data := append([]byte(nil), valid...)
+		return change(data)
+	}
+	// withPayload replaces the payload, updating the length and checksum
+	withPayload := func(payload []byte) []byte {
+		data := append([]byte(nil), valid[:headerSize]...)
+		binary.BigEndian.PutUint32(data[len(magic)+2:], uint32(len(payload)))
+		data = append(data, payload...)
+		return binary.BigEndian.AppendUint32(data, crc32.ChecksumIEEE(payload))
+	}
+	payload := valid[headerSize : len(valid)-4]
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"empty", nil, ErrBadMagic},
+		{"source file", []byte("print 1;"), ErrBadMagic},
+		{"old version", modify(func(d []byte) []byte { d[len(magic)+1] = 0; return d }), ErrVersion},
+		{"newer version", modify(func(d []byte) []byte { d[len(magic)] = 1; return d }), ErrVersion},
+		{"flipped payload byte", modify(func(d []byte) []byte { d[headerSize+2] ^= 0xff; return d }), ErrChecksum},
+		{"truncated", valid[:len(valid)-1], ErrTruncated},
+		{"truncated header", valid[:headerSize-1], ErrTruncated},
+		{"trailing data", append(append([]byte(nil), valid...), 0), ErrCorrupt},
+		{"payload cut short", withPayload(payload[:len(payload)-2]), ErrCorrupt},
+		{"unknown constant", withPayload([]byte{0, 2, 9}), ErrCorrupt},
+		{"huge length", withPayload(binary.AppendVarint(nil, 1<<30)), ErrCorrupt},
+		{"bad debug index", withPayload(func() []byte {
+			e := &encoder{}
+			e.int(0) // natives
+			e.int(0) // constants
+			e.int(1) // modules
+			e.bytes(nil)
+			e.int(0) // globals
+			e.int(0) // locals
+			e.int(0) // exports
+			e.int(3) // no such debug entry
+			e.int(0) // debug entries
+			return e.buf
+		}()), ErrCorrupt},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Unmarshal(tt.data); !errors.Is(err, tt.want) {
+				t.Errorf("Unmarshal() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	loaded, err := Unmarshal(valid)
+	if err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if !reflect.DeepEqual(loaded, program) {
+		t.Errorf("Unmarshal() = %+v, want %+v", loaded, program)
+	}
+}
+
+func TestLink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "main.viri")
+	if err := os.WriteFile(path, []byte("print str(len([1, 2])) + \"!\";\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	data, err := Marshal(compile(t, path))
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+
+	// The natives of another build, in another order
+	builtins := objects.DefaultNatives().Functions()
+	slices.Reverse(builtins)
+	natives, err := objects.NewNativeRegistry(builtins...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	program, err := Unmarshal(data)
+	if err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if err := Link(program, natives); err != nil {
+		t.Fatalf("Link() error = %v", err)
+	}
+	var out bytes.Buffer
+	machine := vm.NewWithNatives(program, natives)
+	machine.SetStdout(&out)
+	if err := machine.RunProgram(); err != nil {
+		t.Fatalf("RunProgram() error = %v", err)
+	}
+	if out.String() != "2!\n" {
+		t.Errorf("output = %q, want %q", out.String(), "2!\n")
+	}
+
+	// A build without one of them
+	natives.Remove("len")
+	program, err = Unmarshal(data)
+	if err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if err := Link(program, natives); !errors.Is(err, ErrNative) || !strings.Contains(err.Error(), "len") {
+		t.Errorf("Link() error = %v, want %v naming len", err, ErrNative)
+	}
+}
+
+func TestMarshalUnsupportedConstant(t *testing.T) {
+	program := &objects.CompiledProgram{Constants: []objects.Object{&objects.Array{}}}
+	if _, err := Marshal(program); !errors.Is(err, errUnencodable) {
+		t.Errorf("Marshal() error = %v, want %v", err, errUnencodable)
+	}
+}
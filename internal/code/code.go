@@ -16,6 +16,9 @@ const (
 	OpSub
 	OpMul
 	OpDiv
+	OpMod
+	OpFloorDiv
+	OpPow
 	OpTrue
 	OpFalse
 	OpNil
@@ -51,6 +54,29 @@ const (
 	OpSetProperty
 	OpGetSuper
 	OpGetModuleExport
+	OpTry
+	OpEndTry
+	OpThrow
+	OpInterpolate
+	OpIter
+	OpIterNext
+	OpSlice
+	OpLess
+	OpLessEqual
+	OpGreaterEqual
+	OpDefineLocal
+
+	// Superinstructions, which the optimizer fuses common sequences into
+	OpAddLocalConstant
+	OpIncrementLocal
+	OpJumpNotGreater
+	OpJumpNotGreaterEqual
+	OpJumpNotLess
+	OpJumpNotLessEqual
+
+	// OpWide prefixes an instruction whose operands take twice their usual
+	// width, for operands too large for the usual one
+	OpWide
 )
 
 type Definition struct {
@@ -64,6 +90,9 @@ var definitions = map[Opcode]*Definition{
 	OpSub:               {"OpSub", []int{}},
 	OpMul:               {"OpMul", []int{}},
 	OpDiv:               {"OpDiv", []int{}},
+	OpMod:               {"OpMod", []int{}},
+	OpFloorDiv:          {"OpFloorDiv", []int{}},
+	OpPow:               {"OpPow", []int{}},
 	OpTrue:              {"OpTrue", []int{}},
 	OpFalse:             {"OpFalse", []int{}},
 	OpNil:               {"OpNil", []int{}},
@@ -86,9 +115,9 @@ var definitions = map[Opcode]*Definition{
 	OpCall:              {"OpCall", []int{1}},          // operand: number of arguments
 	OpReturnValue:       {"OpReturnValue", []int{}},    // no operands: return value on stack
 	OpReturn:            {"OpReturn", []int{}},         // no operands: return nil
-	OpSetLocal:          {"OpSetLocal", []int{1}},      // operand: local index
+	OpSetLocal:          {"OpSetLocal", []int{1}},      // operand: local index - pops value, assigns it through the local's Cell if it has one
 	OpGetLocal:          {"OpGetLocal", []int{1}},      // operand: local index
-	OpGetNative:         {"OpGetNative", []int{1}},     // operand: native function index
+	OpGetNative:         {"OpGetNative", []int{2}},     // operand: native function index in the registry
 	OpGetClosure:        {"OpGetClosure", []int{2, 1}}, // operand: index on constants to find CompiledFunction, number of free variables used by the compiled function
 	OpGetFree:           {"OpGetFree", []int{1}},       // operand: free variable index
 	OpSetFree:           {"OpSetFree", []int{1}},       // operand: free variable index
@@ -97,8 +126,37 @@ var definitions = map[Opcode]*Definition{
 	OpClass:             {"OpClass", []int{2, 1}},           // operands: name constant index, method count - pops superclass + methods, pushes class
 	OpGetProperty:       {"OpGetProperty", []int{2}},        // operand: property name constant index - pops object, pushes property/bound method
 	OpSetProperty:       {"OpSetProperty", []int{2}},        // operand: property name constant index - pops value, pops object, sets field, pushes value
-	OpGetSuper:          {"OpGetSuper", []int{2}},           // operand: method name constant index - pops instance, pushes bound method from superclass
+	OpGetSuper:          {"OpGetSuper", []int{2}},           // operand: method name constant index - pops instance and superclass, pushes bound method
 	OpGetModuleExport:   {"OpGetModuleExport", []int{2, 2}}, // operands: module index, export index - pushes export value from module globals
+	OpTry:               {"OpTry", []int{2, 1}},             // operands: handler address, handler kind (0 = catch, 1 = finally) - pushes an exception handler
+	OpEndTry:            {"OpEndTry", []int{}},              // no operands: pops the innermost exception handler
+	OpThrow:             {"OpThrow", []int{}},               // no operands: pops value and raises it as an exception
+	OpInterpolate:       {"OpInterpolate", []int{2}},        // operand: number of parts - pops parts, pushes their concatenated string forms
+	OpIter:              {"OpIter", []int{1}},               // operand: number of loop variables - pops iterable, pushes an iterator over it
+	OpIterNext:          {"OpIterNext", []int{2}},           // operand: exit address - jumps there when the iterator on top is done, otherwise pushes its next value(s)
+	OpSlice:             {"OpSlice", []int{}},               // no operands: pops end, start and object, pushes the slice
+	OpLess:              {"OpLess", []int{}},
+	OpLessEqual:         {"OpLessEqual", []int{}},
+	OpGreaterEqual:      {"OpGreaterEqual", []int{}},
+	OpDefineLocal:       {"OpDefineLocal", []int{1}}, // operand: local index - pops value into a new binding of the local, leaving any Cell closures captured
+
+	OpAddLocalConstant:    {"OpAddLocalConstant", []int{1, 2}}, // operands: local index, constant index - pushes the local plus the constant
+	OpIncrementLocal:      {"OpIncrementLocal", []int{1, 2}},   // operands: local index, constant index - adds the constant to the local
+	OpJumpNotGreater:      {"OpJumpNotGreater", []int{2}},      // operand: jump position - pops two operands, jumps unless the first is greater
+	OpJumpNotGreaterEqual: {"OpJumpNotGreaterEqual", []int{2}}, // operand: jump position - as OpJumpNotGreater for >=
+	OpJumpNotLess:         {"OpJumpNotLess", []int{2}},         // operand: jump position - as OpJumpNotGreater for <
+	OpJumpNotLessEqual:    {"OpJumpNotLessEqual", []int{2}},    // operand: jump position - as OpJumpNotGreater for <=
+
+	OpWide: {"OpWide", []int{}}, // no operands: the next instruction has operands of twice their width
+}
+
+// Width returns the number of bytes the operands of the opcode take.
+func (d *Definition) Width() int {
+	width := 0
+	for _, w := range d.OperandWidths {
+		width += w
+	}
+	return width
 }
 
 func Lookup(op byte) (*Definition, error) {
@@ -109,28 +167,63 @@ func Lookup(op byte) (*Definition, error) {
 	return def, nil
 }
 
+// CheckOperands returns an error if an operand does not fit in its width
+// in a wide instruction of op, the largest Make can encode.
+func CheckOperands(op Opcode, operands ...int) error {
+	def, ok := definitions[op]
+	if !ok {
+		return fmt.Errorf("opcode %d undefined", op)
+	}
+	for i, o := range operands {
+		if i >= len(def.OperandWidths) {
+			break
+		}
+		if max := int64(1)<<(16*def.OperandWidths[i]) - 1; o < 0 || int64(o) > max {
+			return fmt.Errorf("%s operand %d is out of range 0-%d", def.Name, o, max)
+		}
+	}
+	return nil
+}
+
+// fits reports whether the operands fit in their usual width.
+func fits(def *Definition, operands []int) bool {
+	for i, o := range operands {
+		if i < len(def.OperandWidths) && (o < 0 || o >= 1<<(8*def.OperandWidths[i])) {
+			return false
+		}
+	}
+	return true
+}
+
+// Make encodes an instruction. If an operand does not fit in its width, the
+// instruction is made wide: prefixed by OpWide, with every operand taking
+// twice its width. Operands too large even for that are truncated, which
+// CheckOperands reports.
 func Make(op Opcode, operands ...int) []byte {
 	def, ok := definitions[op]
 	if !ok {
 		return []byte{}
 	}
-
-	instructionLen := 1
-	for _, w := range def.OperandWidths {
-		instructionLen += w
+	if !fits(def, operands) {
+		return append([]byte{byte(OpWide)}, makeOperands(op, def, 2, operands)...)
 	}
+	return makeOperands(op, def, 1, operands)
+}
 
-	instruction := make([]byte, instructionLen)
+func makeOperands(op Opcode, def *Definition, scale int, operands []int) []byte {
+	instruction := make([]byte, 1+scale*def.Width())
 	instruction[0] = byte(op)
 
 	offset := 1
 	for i, o := range operands {
-		width := def.OperandWidths[i]
+		width := scale * def.OperandWidths[i]
 		switch width {
 		case 1:
 			instruction[offset] = byte(o)
 		case 2:
 			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+		case 4:
+			binary.BigEndian.PutUint32(instruction[offset:], uint32(o))
 		}
 		offset += width
 	}
@@ -138,21 +231,131 @@ func Make(op Opcode, operands ...int) []byte {
 	return instruction
 }
 
+// ReadInstruction decodes the instruction at the start of ins, which may be
+// a wide one. It returns its opcode and operands and the number of bytes it
+// takes, including any OpWide prefix. On an error, the number returned is
+// how many bytes to skip: one for an undefined opcode, or all of them for
+// an instruction cut short.
+func ReadInstruction(ins Instructions) (Opcode, []int, int, error) {
+	prefix, scale := 0, 1
+	if Opcode(ins[0]) == OpWide {
+		prefix, scale = 1, 2
+		if len(ins) == 1 {
+			return 0, nil, 1, fmt.Errorf("OpWide needs an instruction after it")
+		}
+	}
+	def, err := Lookup(ins[prefix])
+	if err != nil {
+		return 0, nil, 1, err
+	}
+	op := Opcode(ins[prefix])
+	if prefix == 1 && def.Width() == 0 {
+		return 0, nil, 1, fmt.Errorf("%s has no wide form", def.Name)
+	}
+	if width := scale * def.Width(); prefix+width >= len(ins) {
+		return 0, nil, len(ins), fmt.Errorf("%s needs %d operand bytes, %d left", def.Name, width, len(ins)-prefix-1)
+	}
+	operands, read := readOperands(def, ins[prefix+1:], scale)
+	return op, operands, prefix + 1 + read, nil
+}
+
+// Widen rewrites ins so that the jumps in far reach their targets. far maps
+// the offset of each jump whose address did not fit in its operand to that
+// address. Widening those jumps moves the code after them, so every address
+// in ins is moved along, and jumps pushed past 64K of code are widened in
+// turn. Widen returns the new instructions and, for each of their bytes, the
+// offset in ins of the instruction it was encoded from.
+func Widen(ins Instructions, far map[int]int) (Instructions, []int) {
+	type instruction struct {
+		offset   int
+		op       Opcode
+		operands []int
+		target   int // the address the operand at index address holds, as an offset in ins
+		address  int // which operand is an address, or -1 if none is
+	}
+
+	var list []instruction
+	offsets := make(map[int]int) // offset in ins -> offset in the result
+	for offset := 0; offset < len(ins); {
+		op, operands, read, err := ReadInstruction(ins[offset:])
+		if err != nil {
+			return ins, nil
+		}
+		in := instruction{offset: offset, op: op, operands: operands, address: Address(op)}
+		if in.address >= 0 {
+			in.target = operands[in.address]
+			if target, ok := far[offset]; ok {
+				in.target = target
+			}
+		}
+		list = append(list, in)
+		offsets[offset] = offset
+		offset += read
+	}
+	offsets[len(ins)] = len(ins)
+
+	// Instructions only grow, moving addresses further, so this settles
+	for changed := true; changed; {
+		changed = false
+		next := 0
+		for _, in := range list {
+			if in.address >= 0 {
+				in.operands[in.address] = offsets[in.target]
+			}
+			if offsets[in.offset] != next {
+				offsets[in.offset] = next
+				changed = true
+			}
+			next += len(Make(in.op, in.operands...))
+		}
+		if offsets[len(ins)] != next {
+			offsets[len(ins)] = next
+			changed = true
+		}
+	}
+
+	var result Instructions
+	var origins []int
+	for _, in := range list {
+		encoded := Make(in.op, in.operands...)
+		result = append(result, encoded...)
+		for range encoded {
+			origins = append(origins, in.offset)
+		}
+	}
+	return result, origins
+}
+
+// Address returns which operand of op is an address, or -1 if none is.
+func Address(op Opcode) int {
+	switch op {
+	case OpJump, OpJumpNotTruthy, OpIterNext, OpTry,
+		OpJumpNotGreater, OpJumpNotGreaterEqual, OpJumpNotLess, OpJumpNotLessEqual:
+		return 0
+	}
+	return -1
+}
+
 func (ins Instructions) String() string {
 	var out bytes.Buffer
 
 	i := 0
 	for i < len(ins) {
-		def, err := Lookup(ins[i])
+		op, operands, read, err := ReadInstruction(ins[i:])
 		if err != nil {
-			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			fmt.Fprintf(&out, "%04d ERROR: %s\n", i, err)
+			i += read
 			continue
 		}
 
-		operands, read := ReadOperands(def, ins[i+1:])
-		fmt.Fprintf(&out, "%04d %s\n", i, ins.fmtInstruction(def, operands))
+		def, _ := Lookup(byte(op))
+		prefix := ""
+		if Opcode(ins[i]) == OpWide {
+			prefix = "OpWide "
+		}
+		fmt.Fprintf(&out, "%04d %s%s\n", i, prefix, ins.fmtInstruction(def, operands))
 
-		i += 1 + read
+		i += read
 	}
 
 	return out.String()
@@ -179,15 +382,23 @@ func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
 }
 
 func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+	return readOperands(def, ins, 1)
+}
+
+// readOperands reads operands scale times their usual width.
+func readOperands(def *Definition, ins Instructions, scale int) ([]int, int) {
 	operands := make([]int, len(def.OperandWidths))
 	offset := 0
 
 	for i, width := range def.OperandWidths {
+		width *= scale
 		switch width {
 		case 1:
 			operands[i] = int(ins[offset])
 		case 2:
 			operands[i] = int(binary.BigEndian.Uint16(ins[offset:]))
+		case 4:
+			operands[i] = int(binary.BigEndian.Uint32(ins[offset:]))
 		}
 
 		offset += width
@@ -1,6 +1,7 @@
 package code
 
 import (
+	"fmt"
 	"testing"
 )
 
@@ -13,6 +14,9 @@ func TestMake(t *testing.T) {
 		{OpGetConstant, []int{65534}, []byte{byte(OpGetConstant), 255, 254}},
 		{OpAdd, []int{}, []byte{byte(OpAdd)}},
 		{OpDup, []int{}, []byte{byte(OpDup)}},
+		{OpGetLocal, []int{300}, []byte{byte(OpWide), byte(OpGetLocal), 1, 44}},
+		{OpGetConstant, []int{65536}, []byte{byte(OpWide), byte(OpGetConstant), 0, 1, 0, 0}},
+		{OpGetClosure, []int{1, 256}, []byte{byte(OpWide), byte(OpGetClosure), 0, 0, 0, 1, 1, 0}},
 	}
 
 	for _, tt := range tests {
@@ -38,12 +42,16 @@ func TestInstructionsString(t *testing.T) {
 		Make(OpAdd),
 		Make(OpGetConstant, 2),
 		Make(OpGetConstant, 65535),
+		Make(OpGetLocal, 300),
+		Make(OpGetConstant, 70000),
 	}
 
 	expected := `0000 OpGetConstant 1
 0003 OpAdd
 0004 OpGetConstant 2
 0007 OpGetConstant 65535
+0010 OpWide OpGetLocal 300
+0014 OpWide OpGetConstant 70000
 `
 
 	concatted := Instructions{}
@@ -57,6 +65,48 @@ func TestInstructionsString(t *testing.T) {
 	}
 }
 
+func TestInstructionsStringMalformed(t *testing.T) {
+	tests := []struct {
+		ins      Instructions
+		expected string
+	}{
+		{Instructions{255, byte(OpAdd)}, "0000 ERROR: opcode 255 undefined\n0001 OpAdd\n"},
+		{Instructions{byte(OpAdd), byte(OpGetConstant), 1}, "0000 OpAdd\n0001 ERROR: OpGetConstant needs 2 operand bytes, 1 left\n"},
+		{Instructions{byte(OpWide), byte(OpGetConstant), 0, 1, 0}, "0000 ERROR: OpGetConstant needs 4 operand bytes, 3 left\n"},
+		{Instructions{byte(OpWide), byte(OpAdd), byte(OpPop)}, "0000 ERROR: OpAdd has no wide form\n0001 OpAdd\n0002 OpPop\n"},
+		{Instructions{byte(OpPop), byte(OpWide)}, "0000 OpPop\n0001 ERROR: OpWide needs an instruction after it\n"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.ins.String(); got != tt.expected {
+			t.Errorf("instructions wrongly formatted.\nwant=%q\ngot=%q", tt.expected, got)
+		}
+	}
+}
+
+func TestCheckOperands(t *testing.T) {
+	tests := []struct {
+		op       Opcode
+		operands []int
+		wantErr  bool
+	}{
+		{OpGetConstant, []int{65536}, false},
+		{OpGetConstant, []int{1<<32 - 1}, false},
+		{OpGetConstant, []int{1 << 32}, true},
+		{OpGetLocal, []int{65535}, false},
+		{OpGetLocal, []int{65536}, true},
+		{OpGetClosure, []int{65535, 65536}, true},
+		{OpGetLocal, []int{-1}, true},
+		{OpAdd, nil, false},
+	}
+
+	for _, tt := range tests {
+		if err := CheckOperands(tt.op, tt.operands...); (err != nil) != tt.wantErr {
+			t.Errorf("CheckOperands(%d, %v) error = %v, wantErr %v", tt.op, tt.operands, err, tt.wantErr)
+		}
+	}
+}
+
 func TestReadOperands(t *testing.T) {
 	tests := []struct {
 		op        Opcode
@@ -85,3 +135,95 @@ func TestReadOperands(t *testing.T) {
 		}
 	}
 }
+
+func TestReadInstruction(t *testing.T) {
+	tests := []struct {
+		op        Opcode
+		operands  []int
+		bytesRead int
+	}{
+		{OpAdd, []int{}, 1},
+		{OpGetConstant, []int{65535}, 3},
+		{OpGetConstant, []int{65536}, 6},
+		{OpTry, []int{70000, 1}, 8},
+		{OpAddLocalConstant, []int{300, 2}, 8},
+	}
+
+	for _, tt := range tests {
+		op, operands, n, err := ReadInstruction(Make(tt.op, tt.operands...))
+		if err != nil {
+			t.Fatalf("ReadInstruction(%d, %v) error = %s", tt.op, tt.operands, err)
+		}
+		if op != tt.op || n != tt.bytesRead {
+			t.Errorf("ReadInstruction(%d, %v) = %d, %d bytes, want %d, %d bytes", tt.op, tt.operands, op, n, tt.op, tt.bytesRead)
+		}
+		for i, want := range tt.operands {
+			if operands[i] != want {
+				t.Errorf("operand wrong. want=%d, got=%d", want, operands[i])
+			}
+		}
+	}
+}
+
+func TestWiden(t *testing.T) {
+	ins := concat(
+		Make(OpJumpNotTruthy, 9999), // 0000
+		Make(OpGetLocal, 300),       // 0003
+		Make(OpJump, 0),             // 0007
+		Make(OpTry, 9999, 1),        // 0010
+		Make(OpPop),                 // 0014
+	)
+
+	got, origins := Widen(ins, map[int]int{0: 14, 10: 15})
+	want := concat(
+		Make(OpJumpNotTruthy, 14),
+		Make(OpGetLocal, 300),
+		Make(OpJump, 0),
+		Make(OpTry, 15, 1),
+		Make(OpPop),
+	)
+	if got.String() != want.String() {
+		t.Errorf("Widen() =\n%swant\n%s", got, want)
+	}
+	wantOrigins := []int{0, 0, 0, 3, 3, 3, 3, 7, 7, 7, 10, 10, 10, 10, 14}
+	if fmt.Sprint(origins) != fmt.Sprint(wantOrigins) {
+		t.Errorf("origins = %v, want %v", origins, wantOrigins)
+	}
+}
+
+func TestWidenMovesFarJumps(t *testing.T) {
+	// Widening the first jump moves the target of the second past 64K, so
+	// it has to be widened in turn
+	var body Instructions
+	for len(body) < 65540 {
+		body = append(body, byte(OpPop))
+	}
+	ins := concat(
+		Make(OpJump, 9999),
+		Make(OpJumpNotTruthy, 65534),
+		body,
+		Make(OpReturn),
+	)
+	end := len(ins) - 1
+
+	got, _ := Widen(ins, map[int]int{0: end})
+	if len(got) != len(ins)+6 {
+		t.Fatalf("len(Widen()) = %d, want %d", len(got), len(ins)+6)
+	}
+	op, operands, n, _ := ReadInstruction(got)
+	if op != OpJump || n != 6 || operands[0] != end+6 {
+		t.Errorf("first jump = %d %v, %d bytes, want a wide OpJump %d", op, operands, n, end+6)
+	}
+	op, operands, n, _ = ReadInstruction(got[6:])
+	if op != OpJumpNotTruthy || n != 6 || operands[0] != 65534+6 {
+		t.Errorf("second jump = %d %v, %d bytes, want a wide OpJumpNotTruthy %d", op, operands, n, 65534+6)
+	}
+}
+
+func concat(parts ...[]byte) Instructions {
+	var ins Instructions
+	for _, part := range parts {
+		ins = append(ins, part...)
+	}
+	return ins
+}
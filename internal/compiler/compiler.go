@@ -6,12 +6,23 @@ import (
 	"github.com/harshagw/viri/internal/ast"
 	"github.com/harshagw/viri/internal/code"
 	"github.com/harshagw/viri/internal/objects"
+	"github.com/harshagw/viri/internal/parser"
 	"github.com/harshagw/viri/internal/token"
 )
 
 type CompilationScope struct {
 	instructions code.Instructions
-	lineTable    []int
+	lineTable    []objects.Position
+	tries        []tryContext // active try statements, innermost last
+	far          map[int]int  // jumps whose address is past 64K, by position, widened by scopeCode
+}
+
+// tryContext tracks an enclosing try statement so that break, continue and
+// return can pop its handler and run its finally block before jumping out.
+type tryContext struct {
+	finally   *ast.BlockStmt // nil when there is nothing to run on exit
+	loopDepth int            // loop nesting depth when the try was entered
+	pending   bool           // true inside a finally block rethrowing an error left on the stack
 }
 
 // ClassCompiler tracks state while compiling a class.
@@ -34,6 +45,7 @@ type Compiler struct {
 
 	classCompiler     *ClassCompiler // nil when not compiling a class
 	diagnosticHandler objects.DiagnosticHandler
+	natives           *objects.NativeRegistry
 
 	// Track highest global index used (for NumGlobals calculation)
 	maxGlobalIndex int
@@ -42,24 +54,43 @@ type Compiler struct {
 	modules       map[string]*ast.Module // path -> parsed module
 	moduleOrder   []string               // topological order
 	moduleIndices map[string]int         // path -> module index
+	loader        parser.ModuleLoader
+	optimize      bool // run the optimizer on modules CompileProgram loads
+
+	// Entry module state, for programs embedding the compiler
+	entryPath    string
+	hostGlobals  []string     // globals set by the host, in slots 0..n-1 of the entry module
+	entrySymbols *SymbolTable // symbol table of the compiled entry module
 
 	// Source location tracking (updated as we compile each node)
-	currentLine     int
+	currentPos      objects.Position
 	currentFilePath string
 
+	// First operand too large for its instruction, returned by Compile
+	operandErr error
+
 	// Debug info output (line tables stored per function/module for VM error reporting)
 	debugInfo *objects.DebugInfo
 }
 
 func New(diagnosticHandler objects.DiagnosticHandler) *Compiler {
-	return NewWithState(diagnosticHandler, nil)
+	return NewWithState(diagnosticHandler, nil, nil)
+}
+
+// NewWithNatives returns a compiler for programs calling the given natives,
+// which they must also run with. A nil registry means the builtins.
+func NewWithNatives(diagnosticHandler objects.DiagnosticHandler, natives *objects.NativeRegistry) *Compiler {
+	return NewWithState(diagnosticHandler, nil, natives)
 }
 
-func NewWithState(diagnosticHandler objects.DiagnosticHandler, symbolTable *SymbolTable) *Compiler {
+func NewWithState(diagnosticHandler objects.DiagnosticHandler, symbolTable *SymbolTable, natives *objects.NativeRegistry) *Compiler {
 	c := &Compiler{
 		diagnosticHandler: diagnosticHandler,
+		natives:           objects.NativesOrDefault(natives),
 		modules:           make(map[string]*ast.Module),
 		moduleIndices:     make(map[string]int),
+		loader:            parser.FileLoader{},
+		optimize:          true,
 		debugInfo:         objects.NewDebugInfo(),
 	}
 	c.reset(symbolTable)
@@ -75,15 +106,15 @@ func (c *Compiler) reset(symbolTable *SymbolTable) {
 
 	c.symbolTable = symbolTable
 	c.loopStack = NewLoopStack()
-	c.scopes = []CompilationScope{{instructions: code.Instructions{}, lineTable: []int{}}}
+	c.scopes = []CompilationScope{{instructions: code.Instructions{}, lineTable: []objects.Position{}}}
 	c.scopeIndex = 0
 	c.classCompiler = nil
 	c.maxGlobalIndex = -1
-	c.currentLine = 1
+	c.currentPos = objects.Position{Line: 1, Column: 1}
 	c.currentFilePath = ""
 
 	// Register native functions
-	for i, nativeFn := range objects.NativeFunctions {
+	for i, nativeFn := range c.natives.Functions() {
 		if _, exists := c.symbolTable.store[nativeFn.Name]; !exists {
 			c.symbolTable.DefineNative(i, nativeFn.Name)
 		}
@@ -95,26 +126,57 @@ func (c *Compiler) SetFilePath(path string) {
 	c.currentFilePath = path
 }
 
+// SetLoader sets how CompileProgram finds and reads modules.
+func (c *Compiler) SetLoader(loader parser.ModuleLoader) {
+	c.loader = loader
+}
+
+// SetOptimize sets whether CompileProgram optimizes the modules it loads
+// before compiling them and the bytecode it compiles them to. It does by
+// default; disabling it compiles every statement as written. Either way it
+// rejects the same programs, as the modules are checked before optimizing.
+func (c *Compiler) SetOptimize(enabled bool) {
+	c.optimize = enabled
+}
+
+// SetHostGlobals declares globals of the entry module that a host program
+// sets before running it. They take the first slots, in the order given.
+func (c *Compiler) SetHostGlobals(names []string) {
+	c.hostGlobals = names
+}
+
+// EntryGlobals returns the global slot of each top-level name in the entry
+// module compiled by CompileProgram.
+func (c *Compiler) EntryGlobals() map[string]int {
+	if c.entrySymbols == nil {
+		return nil
+	}
+	return c.entrySymbols.Globals()
+}
+
 // Result returns the compiled program (for single-file compilation, tests, REPL)
 func (c *Compiler) Result() *objects.CompiledProgram {
 	// Add debug info for the module-level code
-	debugIdx := c.debugInfo.Add(c.currentLineTable(), c.currentFilePath)
+	instructions, lineTable := c.scopeCode()
+	debugIdx := c.debugInfo.Add(lineTable, c.currentFilePath)
 
 	return &objects.CompiledProgram{
 		Modules: []objects.CompiledModule{
 			{
-				Instructions: c.currentInstructions(),
+				Instructions: instructions,
 				NumGlobals:   c.maxGlobalIndex + 1,
+				NumLocals:    c.symbolTable.NumLocals(),
 				Exports:      []int{},
 				DebugInfoIdx: debugIdx,
 			},
 		},
 		Constants: c.constants,
 		DebugInfo: c.debugInfo,
+		Natives:   c.natives.Names(),
 	}
 }
 
-func (c *Compiler) currentLineTable() []int {
+func (c *Compiler) currentLineTable() []objects.Position {
 	return c.scopes[c.scopeIndex].lineTable
 }
 
@@ -125,16 +187,30 @@ func (c *Compiler) currentInstructions() code.Instructions {
 func (c *Compiler) enterScope(functionName string) {
 	scope := CompilationScope{
 		instructions: code.Instructions{},
-		lineTable:    []int{},
+		lineTable:    []objects.Position{},
 	}
 	c.scopes = append(c.scopes, scope)
 	c.scopeIndex++
 	c.symbolTable = NewFunctionScope(c.symbolTable, functionName)
 }
 
-func (c *Compiler) leaveScope() (code.Instructions, []int) {
-	instructions := c.currentInstructions()
-	lineTable := c.currentLineTable()
+// scopeCode returns the instructions of the current scope and their line
+// table, with the jumps whose address did not fit widened.
+func (c *Compiler) scopeCode() (code.Instructions, []objects.Position) {
+	scope := c.scopes[c.scopeIndex]
+	if len(scope.far) == 0 {
+		return scope.instructions, scope.lineTable
+	}
+	instructions, origins := code.Widen(scope.instructions, scope.far)
+	lineTable := make([]objects.Position, len(origins))
+	for i, origin := range origins {
+		lineTable[i] = scope.lineTable[origin]
+	}
+	return instructions, lineTable
+}
+
+func (c *Compiler) leaveScope() (code.Instructions, []objects.Position) {
+	instructions, lineTable := c.scopeCode()
 
 	c.scopes = c.scopes[:len(c.scopes)-1]
 	c.scopeIndex--
@@ -143,18 +219,39 @@ func (c *Compiler) leaveScope() (code.Instructions, []int) {
 	return instructions, lineTable
 }
 
+// leaveBlockScope restores the parent of a block scope. Locals declared in the
+// block keep their slots reserved so the enclosing function allocates enough
+// room for them and later declarations don't reuse slots still captured by
+// closures.
+func (c *Compiler) leaveBlockScope() {
+	inner := c.symbolTable
+	c.symbolTable = inner.Outer
+	if inner.numDefinitions > c.symbolTable.numDefinitions {
+		c.symbolTable.numDefinitions = inner.numDefinitions
+	}
+	if inner.numLocals > c.symbolTable.numLocals {
+		c.symbolTable.numLocals = inner.numLocals
+	}
+}
+
 func (c *Compiler) Compile(node interface{}) error {
+	var err error
 	switch node := node.(type) {
 	case ast.Stmt:
-		return c.compileStatement(node)
+		err = c.compileStatement(node)
 	case ast.Expr:
-		return c.compileExpression(node)
+		err = c.compileExpression(node)
 	default:
 		return fmt.Errorf("unknown node type: %T", node)
 	}
+	if err == nil && c.operandErr != nil {
+		err, c.operandErr = c.operandErr, nil
+	}
+	return err
 }
 
 func (c *Compiler) compileStatement(stmt ast.Stmt) error {
+	defer c.restorePosition(c.currentPos)
 	c.updateLineInfo(stmt)
 
 	switch stmt := stmt.(type) {
@@ -174,7 +271,7 @@ func (c *Compiler) compileStatement(stmt ast.Stmt) error {
 			}
 		}
 		// Restore parent scope
-		c.symbolTable = c.symbolTable.Outer
+		c.leaveBlockScope()
 		return nil
 
 	case *ast.IfStmt:
@@ -224,7 +321,7 @@ func (c *Compiler) compileStatement(stmt ast.Stmt) error {
 			// Check if the initializer is a function expression for recursive support
 			// We don't want to body of the function to create a block scope, so we compile the function directly
 			if fnExpr, ok := stmt.Initializer.(*ast.FunctionExpr); ok {
-				if err := c.compileFunction(fnExpr.Params, fnExpr.Body, stmt.Name.Lexeme); err != nil {
+				if err := c.compileFunction(fnExpr.Params, fnExpr.Body, stmt.Name.Lexeme, true); err != nil {
 					return err
 				}
 			} else {
@@ -236,7 +333,7 @@ func (c *Compiler) compileStatement(stmt ast.Stmt) error {
 			c.emit(code.OpNil) // Default to nil if no initializer
 		}
 
-		c.emitSetSymbol(symbol)
+		c.emitDefineSymbol(symbol)
 		return nil
 
 	case *ast.PrintStmt:
@@ -323,10 +420,16 @@ func (c *Compiler) compileStatement(stmt ast.Stmt) error {
 		c.loopStack.Pop()
 		return nil
 
+	case *ast.ForInStmt:
+		return c.compileForInStmt(stmt)
+
 	case *ast.BreakStmt:
 		if !c.loopStack.IsInLoop() {
 			return c.error(stmt.Keyword, "break statement outside of loop")
 		}
+		if err := c.exitTries(c.loopStack.Depth(), false); err != nil {
+			return err
+		}
 		jumpPos := c.emit(code.OpJump, 9999)
 		c.loopStack.AddBreakJump(jumpPos)
 		return nil
@@ -335,6 +438,9 @@ func (c *Compiler) compileStatement(stmt ast.Stmt) error {
 		if !c.loopStack.IsInLoop() {
 			return c.error(stmt.Keyword, "continue statement outside of loop")
 		}
+		if err := c.exitTries(c.loopStack.Depth(), false); err != nil {
+			return err
+		}
 		if c.loopStack.ContinuePos() == -1 {
 			// For for-loops, continuePos isn't known yet, record jump for patching
 			jumpPos := c.emit(code.OpJump, 9999)
@@ -358,24 +464,33 @@ func (c *Compiler) compileStatement(stmt ast.Stmt) error {
 		}
 
 		// Compile the function body
-		if err := c.compileFunction(stmt.Params, stmt.Body, stmt.Name.Lexeme); err != nil {
+		if err := c.compileFunction(stmt.Params, stmt.Body, stmt.Name.Lexeme, false); err != nil {
 			return err
 		}
 
-		c.emitSetSymbol(symbol)
+		c.emitDefineSymbol(symbol)
 		return nil
 
 	case *ast.ReturnStmt:
 		// In init methods, always return 'this' regardless of what the user wrote
 		if c.classCompiler != nil && c.classCompiler.isCompilingInit {
 			c.emit(code.OpGetLocal, 0) // 'this' is always local 0
+			if err := c.exitTries(0, true); err != nil {
+				return err
+			}
 			c.emit(code.OpReturnValue)
 		} else if stmt.Value != nil {
 			if err := c.compileExpression(stmt.Value); err != nil {
 				return err
 			}
+			if err := c.exitTries(0, true); err != nil {
+				return err
+			}
 			c.emit(code.OpReturnValue)
 		} else {
+			if err := c.exitTries(0, true); err != nil {
+				return err
+			}
 			c.emit(code.OpReturn)
 		}
 		return nil
@@ -383,12 +498,25 @@ func (c *Compiler) compileStatement(stmt ast.Stmt) error {
 	case *ast.ClassStmt:
 		return c.compileClassStmt(stmt)
 
+	case *ast.TryStmt:
+		return c.compileTryStmt(stmt)
+
+	case *ast.ThrowStmt:
+		if err := c.compileExpression(stmt.Value); err != nil {
+			return err
+		}
+		c.emit(code.OpThrow)
+		return nil
+
 	default:
 		return fmt.Errorf("unsupported statement type: %T", stmt)
 	}
 }
 
 func (c *Compiler) compileExpression(node ast.Expr) error {
+	// Once the operands are compiled, the instructions this node emits
+	// report its own position rather than that of its last operand
+	defer c.restorePosition(c.currentPos)
 	c.updateLineInfo(node)
 
 	switch node := node.(type) {
@@ -434,44 +562,6 @@ func (c *Compiler) compileExpression(node ast.Expr) error {
 		return c.compileExpression(node.Expr)
 
 	case *ast.BinaryExpr:
-		// a < b  => swap operands, then b > a
-		if node.Operator.Type == token.LESS {
-			if err := c.compileExpression(node.Right); err != nil {
-				return err
-			}
-			if err := c.compileExpression(node.Left); err != nil {
-				return err
-			}
-			c.emit(code.OpGreaterThan)
-			return nil
-		}
-
-		// a <= b  => !(a > b)
-		if node.Operator.Type == token.LESS_EQUAL {
-			if err := c.compileExpression(node.Left); err != nil {
-				return err
-			}
-			if err := c.compileExpression(node.Right); err != nil {
-				return err
-			}
-			c.emit(code.OpGreaterThan)
-			c.emit(code.OpBang)
-			return nil
-		}
-
-		// a >= b  => !(a < b) => !(b > a)
-		if node.Operator.Type == token.GREATER_EQUAL {
-			if err := c.compileExpression(node.Right); err != nil {
-				return err
-			}
-			if err := c.compileExpression(node.Left); err != nil {
-				return err
-			}
-			c.emit(code.OpGreaterThan)
-			c.emit(code.OpBang)
-			return nil
-		}
-
 		if err := c.compileExpression(node.Left); err != nil {
 			return err
 		}
@@ -488,8 +578,20 @@ func (c *Compiler) compileExpression(node ast.Expr) error {
 			c.emit(code.OpMul)
 		case token.SLASH:
 			c.emit(code.OpDiv)
+		case token.PERCENT:
+			c.emit(code.OpMod)
+		case token.TILDE_SLASH:
+			c.emit(code.OpFloorDiv)
+		case token.STAR_STAR:
+			c.emit(code.OpPow)
 		case token.GREATER:
 			c.emit(code.OpGreaterThan)
+		case token.GREATER_EQUAL:
+			c.emit(code.OpGreaterEqual)
+		case token.LESS:
+			c.emit(code.OpLess)
+		case token.LESS_EQUAL:
+			c.emit(code.OpLessEqual)
 		case token.EQUAL_EQUAL:
 			c.emit(code.OpEqual)
 		case token.BANG_EQUAL:
@@ -555,6 +657,21 @@ func (c *Compiler) compileExpression(node ast.Expr) error {
 		}
 		c.emit(code.OpIndex)
 
+	case *ast.SliceExpr:
+		if err := c.compileExpression(node.Object); err != nil {
+			return err
+		}
+		for _, bound := range []ast.Expr{node.Start, node.End} {
+			if bound == nil {
+				c.emit(code.OpNil)
+				continue
+			}
+			if err := c.compileExpression(bound); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpSlice)
+
 	case *ast.SetIndexExpr:
 		if err := c.compileExpression(node.Object); err != nil {
 			return err
@@ -611,7 +728,7 @@ func (c *Compiler) compileExpression(node ast.Expr) error {
 
 	case *ast.FunctionExpr:
 		// Anonymous function - no name for recursion
-		if err := c.compileFunction(node.Params, node.Body, ""); err != nil {
+		if err := c.compileFunction(node.Params, node.Body, "", true); err != nil {
 			return err
 		}
 
@@ -660,6 +777,14 @@ func (c *Compiler) compileExpression(node ast.Expr) error {
 
 		c.emitGetSymbol(symbol)
 
+	case *ast.InterpolationExpr:
+		for _, part := range node.Parts {
+			if err := c.compileExpression(part); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpInterpolate, len(node.Parts))
+
 	case *ast.SuperExpr:
 		// Validate: must be inside a class
 		if c.classCompiler == nil {
@@ -680,6 +805,13 @@ func (c *Compiler) compileExpression(node ast.Expr) error {
 		// Push 'this' instance (super method will be bound to it)
 		c.emitGetSymbol(symbol)
 
+		// Push the superclass of the class being compiled
+		superSymbol, ok := c.symbolTable.Resolve("super")
+		if !ok {
+			return c.error(node.Keyword, "cannot use 'super' in a class with no superclass")
+		}
+		c.emitGetSymbol(superSymbol)
+
 		// Emit OpGetSuper with method name
 		nameIdx := c.addConstant(&objects.String{Value: node.Method.Lexeme})
 		c.emit(code.OpGetSuper, nameIdx)
@@ -688,28 +820,50 @@ func (c *Compiler) compileExpression(node ast.Expr) error {
 }
 
 func (c *Compiler) emit(op code.Opcode, operands ...int) int {
+	c.checkOperands(op, operands)
 	ins := code.Make(op, operands...)
 	pos := len(c.currentInstructions())
 	c.scopes[c.scopeIndex].instructions = append(c.scopes[c.scopeIndex].instructions, ins...)
 
 	for range ins {
-		c.scopes[c.scopeIndex].lineTable = append(c.scopes[c.scopeIndex].lineTable, c.currentLine)
+		c.scopes[c.scopeIndex].lineTable = append(c.scopes[c.scopeIndex].lineTable, c.currentPos)
 	}
 
 	return pos
 }
 
+// checkOperands records an error, at the node being compiled, for an
+// operand that does not fit even in a wide instruction, such as the index
+// of a local past the 65,536th.
+func (c *Compiler) checkOperands(op code.Opcode, operands []int) {
+	if c.operandErr != nil {
+		return
+	}
+	if err := code.CheckOperands(op, operands...); err != nil {
+		tok := &token.Token{Line: c.currentPos.Line, Column: c.currentPos.Column, Offset: c.currentPos.Offset}
+		if c.currentFilePath != "" {
+			path := c.currentFilePath
+			tok.FilePath = &path
+		}
+		c.operandErr = c.error(tok, "program too large to compile: "+err.Error())
+	}
+}
+
 func (c *Compiler) updateLineInfo(node ast.Node) {
 	tok := node.GetPrimaryToken()
 	if tok == nil {
 		return
 	}
-	c.currentLine = tok.Line
+	c.currentPos = objects.Position{Line: tok.Line, Column: tok.Column, Offset: tok.Offset}
 	if c.currentFilePath == "" && tok.FilePath != nil {
 		c.currentFilePath = *tok.FilePath
 	}
 }
 
+func (c *Compiler) restorePosition(pos objects.Position) {
+	c.currentPos = pos
+}
+
 func (c *Compiler) addConstant(obj objects.Object) int {
 	c.constants = append(c.constants, obj)
 	return len(c.constants) - 1
@@ -717,9 +871,21 @@ func (c *Compiler) addConstant(obj objects.Object) int {
 
 func (c *Compiler) changeOperand(opPos int, operands ...int) {
 	op := code.Opcode(c.currentInstructions()[opPos])
+	c.checkOperands(op, operands)
 	newInstruction := code.Make(op, operands...)
+	scope := &c.scopes[c.scopeIndex]
+	if code.Opcode(newInstruction[0]) == code.OpWide {
+		// A jump past 64K does not fit where it was emitted, so it is
+		// widened, moving the code after it, once the scope is done
+		if scope.far == nil {
+			scope.far = make(map[int]int)
+		}
+		scope.far[opPos] = operands[code.Address(op)]
+		return
+	}
+	delete(scope.far, opPos)
 	for i := 0; i < len(newInstruction); i++ {
-		c.scopes[c.scopeIndex].instructions[opPos+i] = newInstruction[i]
+		scope.instructions[opPos+i] = newInstruction[i]
 	}
 }
 
@@ -751,6 +917,18 @@ func (c *Compiler) emitSetSymbol(s Symbol) {
 	}
 }
 
+// emitDefineSymbol stores the value on top of the stack in a variable being
+// declared. Unlike an assignment, it gives a local a new binding, so closures
+// that captured an earlier binding of it, in a previous iteration of a loop,
+// keep theirs.
+func (c *Compiler) emitDefineSymbol(s Symbol) {
+	if s.Scope == LocalScope {
+		c.emit(code.OpDefineLocal, s.Index)
+		return
+	}
+	c.emitSetSymbol(s)
+}
+
 // trackGlobal updates maxGlobalIndex if needed
 func (c *Compiler) trackGlobal(index int) {
 	if index > c.maxGlobalIndex {
@@ -758,7 +936,10 @@ func (c *Compiler) trackGlobal(index int) {
 	}
 }
 
-func (c *Compiler) compileFunction(params []*token.Token, body *ast.BlockStmt, functionName string) error {
+// compileFunction compiles a function. An anonymous function written as the
+// initializer of a variable is named after the variable, so it can call
+// itself and appears in traces under that name.
+func (c *Compiler) compileFunction(params []*token.Token, body *ast.BlockStmt, functionName string, anonymous bool) error {
 	c.enterScope(functionName)
 
 	// Define parameters as local variables
@@ -791,6 +972,7 @@ func (c *Compiler) compileFunction(params []*token.Token, body *ast.BlockStmt, f
 		NumLocals:     numLocals,
 		NumParameters: len(params),
 		Name:          functionName,
+		Anonymous:     anonymous,
 		DebugInfoIdx:  debugIdx,
 	}
 
@@ -813,6 +995,217 @@ func (c *Compiler) emitClosure(fn *objects.CompiledFunction, freeSymbols []Symbo
 	c.emit(code.OpGetClosure, constIdx, len(freeSymbols))
 }
 
+// compileTryStmt lays out a try statement as:
+//
+//	OpTry catch         ; handler kind is finally when there is no catch clause
+//	<body>
+//	OpEndTry
+//	<finally>
+//	OpJump end
+//	catch:              ; error value on the stack
+//	OpTry rethrow       ; only when there is a finally clause
+//	<bind error, catch body>
+//	OpEndTry
+//	<finally>
+//	OpJump end
+//	rethrow:            ; pending error on the stack
+//	<finally>
+//	OpThrow
+//	end:
+func (c *Compiler) compileTryStmt(stmt *ast.TryStmt) error {
+	hasCatch := stmt.CatchBody != nil
+	hasFinally := stmt.FinallyBody != nil
+
+	tryKind := 0
+	if !hasCatch {
+		tryKind = 1
+	}
+	tryPos := c.emit(code.OpTry, 9999, tryKind)
+
+	var endJumps []int
+	var rethrowTries []int
+
+	if err := c.compileProtected(stmt.Body, nil, stmt.FinallyBody); err != nil {
+		return err
+	}
+	c.emit(code.OpEndTry)
+	if hasFinally {
+		if err := c.compileStatement(stmt.FinallyBody); err != nil {
+			return err
+		}
+	}
+	endJumps = append(endJumps, c.emit(code.OpJump, 9999))
+
+	if hasCatch {
+		c.changeOperand(tryPos, len(c.currentInstructions()), tryKind)
+
+		if hasFinally {
+			rethrowTries = append(rethrowTries, c.emit(code.OpTry, 9999, 1))
+		}
+
+		// The exception variable is scoped to the catch body
+		c.symbolTable = NewBlockScope(c.symbolTable)
+		symbol, ok := c.symbolTable.Define(stmt.CatchParam.Lexeme, false)
+		if !ok {
+			return c.error(stmt.CatchParam, "cannot declare variable with this name again")
+		}
+		c.emitDefineSymbol(symbol)
+
+		if hasFinally {
+			if err := c.compileProtected(stmt.CatchBody, stmt.CatchBody.Statements, stmt.FinallyBody); err != nil {
+				return err
+			}
+		} else {
+			// The handler was popped when the error was caught
+			for _, s := range stmt.CatchBody.Statements {
+				if err := c.compileStatement(s); err != nil {
+					return err
+				}
+			}
+		}
+		c.leaveBlockScope()
+
+		if hasFinally {
+			c.emit(code.OpEndTry)
+			if err := c.compileStatement(stmt.FinallyBody); err != nil {
+				return err
+			}
+		}
+		endJumps = append(endJumps, c.emit(code.OpJump, 9999))
+	} else {
+		rethrowTries = append(rethrowTries, tryPos)
+	}
+
+	if hasFinally {
+		rethrowPos := len(c.currentInstructions())
+		for _, pos := range rethrowTries {
+			c.changeOperand(pos, rethrowPos, 1)
+		}
+
+		scope := &c.scopes[c.scopeIndex]
+		scope.tries = append(scope.tries, tryContext{loopDepth: c.loopStack.Depth(), pending: true})
+		if err := c.compileStatement(stmt.FinallyBody); err != nil {
+			return err
+		}
+		scope = &c.scopes[c.scopeIndex]
+		scope.tries = scope.tries[:len(scope.tries)-1]
+		c.emit(code.OpThrow)
+	}
+
+	end := len(c.currentInstructions())
+	for _, pos := range endJumps {
+		c.changeOperand(pos, end)
+	}
+	return nil
+}
+
+// compileProtected compiles a block covered by an exception handler. When
+// statements is non-nil they are compiled in the current scope instead of
+// opening a new block scope.
+func (c *Compiler) compileProtected(block *ast.BlockStmt, statements []ast.Stmt, finally *ast.BlockStmt) error {
+	// An error in a nested function leaves its scope entered, so the try is
+	// popped from the scope it was pushed to rather than the current one.
+	index := c.scopeIndex
+	scope := &c.scopes[index]
+	scope.tries = append(scope.tries, tryContext{finally: finally, loopDepth: c.loopStack.Depth()})
+
+	var err error
+	if statements == nil {
+		err = c.compileStatement(block)
+	} else {
+		for _, s := range statements {
+			if err = c.compileStatement(s); err != nil {
+				break
+			}
+		}
+	}
+
+	scope = &c.scopes[index]
+	scope.tries = scope.tries[:len(scope.tries)-1]
+	return err
+}
+
+// exitTries emits the cleanup needed to jump out of every try statement
+// entered at or below the given loop depth: handlers are popped and finally
+// blocks are inlined. Returns leave the frame, so pending errors left on the
+// stack by a finally block only need popping for break and continue.
+func (c *Compiler) exitTries(loopDepth int, forReturn bool) error {
+	saved := c.scopes[c.scopeIndex].tries
+	defer func() { c.scopes[c.scopeIndex].tries = saved }()
+
+	for i := len(saved) - 1; i >= 0; i-- {
+		try := saved[i]
+		if try.loopDepth < loopDepth {
+			break
+		}
+		if try.pending {
+			if !forReturn {
+				c.emit(code.OpPop)
+			}
+			continue
+		}
+		c.emit(code.OpEndTry)
+		if try.finally != nil {
+			// A jump inside the finally block only sees the enclosing tries
+			c.scopes[c.scopeIndex].tries = saved[:i:i]
+			if err := c.compileStatement(try.finally); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// compileForInStmt compiles a for-in loop. The iterator stays on the stack
+// for the duration of the loop:
+//
+//	<iterable>
+//	OpIter n
+//	loop:     OpIterNext exit    ; pushes n values, or jumps to exit when done
+//	          <set loop variables>
+//	          <body>
+//	          OpJump loop
+//	exit:     OpPop              ; discard the iterator (break jumps here too)
+func (c *Compiler) compileForInStmt(stmt *ast.ForInStmt) error {
+	if err := c.compileExpression(stmt.Iterable); err != nil {
+		return err
+	}
+	c.emit(code.OpIter, len(stmt.Variables))
+
+	loopStart := len(c.currentInstructions())
+	c.loopStack.Push(loopStart)
+	exitJump := c.emit(code.OpIterNext, 9999)
+
+	// The loop variables live in their own scope wrapping the body
+	c.symbolTable = NewBlockScope(c.symbolTable)
+	symbols := make([]Symbol, len(stmt.Variables))
+	for i, variable := range stmt.Variables {
+		symbol, ok := c.symbolTable.Define(variable.Lexeme, false)
+		if !ok {
+			return c.error(variable, "cannot declare variable with this name again")
+		}
+		symbols[i] = symbol
+	}
+	// Values are pushed in order, so the last variable is on top
+	for i := len(symbols) - 1; i >= 0; i-- {
+		c.emitDefineSymbol(symbols[i])
+	}
+
+	if err := c.compileStatement(stmt.Body); err != nil {
+		return err
+	}
+	c.leaveBlockScope()
+
+	c.emit(code.OpJump, loopStart)
+
+	loopEnd := len(c.currentInstructions())
+	c.changeOperand(exitJump, loopEnd)
+	c.patchBreakJumps(loopEnd)
+	c.loopStack.Pop()
+	c.emit(code.OpPop)
+	return nil
+}
+
 func (c *Compiler) patchBreakJumps(loopEnd int) {
 	for _, jumpPos := range c.loopStack.BreakJumps() {
 		c.changeOperand(jumpPos, loopEnd)
@@ -846,6 +1239,12 @@ func (c *Compiler) compileClassStmt(stmt *ast.ClassStmt) error {
 	if !ok {
 		return c.error(stmt.Name, "cannot declare variable with this name again")
 	}
+	if symbol.Scope == LocalScope {
+		// Methods capture the local before the class is stored in it, so it
+		// starts a new binding now and the class is assigned to it below
+		c.emit(code.OpNil)
+		c.emitDefineSymbol(symbol)
+	}
 
 	// Enter class compilation context
 	enclosingClass := c.classCompiler
@@ -864,6 +1263,15 @@ func (c *Compiler) compileClassStmt(stmt *ast.ClassStmt) error {
 		if stmt.SuperClass.Name.Lexeme == className {
 			return c.error(stmt.SuperClass.Name, "a class cannot inherit from itself")
 		}
+
+		// Keep the superclass in a scope of its own around the methods, so
+		// super finds the superclass of the class the method is defined in
+		// rather than that of the instance
+		c.symbolTable = NewBlockScope(c.symbolTable)
+		defer c.leaveBlockScope()
+		superSymbol, _ := c.symbolTable.Define("super", true)
+		c.emitDefineSymbol(superSymbol)
+		c.emitGetSymbol(superSymbol)
 	} else {
 		c.emit(code.OpNil)
 	}
@@ -2,16 +2,19 @@ package compiler
 
 import (
 	"fmt"
+	"strings"
 	"testing"
+	"testing/fstest"
 
 	"github.com/harshagw/viri/internal/ast"
 	"github.com/harshagw/viri/internal/code"
 	"github.com/harshagw/viri/internal/objects"
+	"github.com/harshagw/viri/internal/parser"
 	"github.com/harshagw/viri/internal/token"
 )
 
 type compilerTestCase struct {
-	input                interface{} // Can be ast.Expr or ast.Stmt
+	input                interface{} // ast.Expr, ast.Stmt or []ast.Stmt for module-level code
 	expectedConstants    []interface{}
 	expectedInstructions []code.Instructions
 }
@@ -57,6 +60,45 @@ func TestIntegerArithmetic(t *testing.T) {
 				code.Make(code.OpMul),
 			},
 		},
+		{
+			input: &ast.BinaryExpr{
+				Left:     &ast.LiteralExpr{Value: 7},
+				Right:    &ast.LiteralExpr{Value: 3},
+				Operator: &token.Token{Type: token.PERCENT},
+			},
+			expectedConstants: []interface{}{7, 3},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpGetConstant, 0),
+				code.Make(code.OpGetConstant, 1),
+				code.Make(code.OpMod),
+			},
+		},
+		{
+			input: &ast.BinaryExpr{
+				Left:     &ast.LiteralExpr{Value: 7},
+				Right:    &ast.LiteralExpr{Value: 2},
+				Operator: &token.Token{Type: token.TILDE_SLASH},
+			},
+			expectedConstants: []interface{}{7, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpGetConstant, 0),
+				code.Make(code.OpGetConstant, 1),
+				code.Make(code.OpFloorDiv),
+			},
+		},
+		{
+			input: &ast.BinaryExpr{
+				Left:     &ast.LiteralExpr{Value: 2},
+				Right:    &ast.LiteralExpr{Value: 8},
+				Operator: &token.Token{Type: token.STAR_STAR},
+			},
+			expectedConstants: []interface{}{2, 8},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpGetConstant, 0),
+				code.Make(code.OpGetConstant, 1),
+				code.Make(code.OpPow),
+			},
+		},
 	}
 
 	runCompilerTests(t, tests)
@@ -324,14 +366,22 @@ func runCompilerTests(t *testing.T, tests []compilerTestCase) {
 
 	for _, tt := range tests {
 		compiler := New(nil)
-		err := compiler.Compile(tt.input)
-		if err != nil {
-			t.Fatalf("compiler error: %s", err)
+		inputs := []interface{}{tt.input}
+		if stmts, ok := tt.input.([]ast.Stmt); ok {
+			inputs = inputs[:0]
+			for _, stmt := range stmts {
+				inputs = append(inputs, stmt)
+			}
+		}
+		for _, input := range inputs {
+			if err := compiler.Compile(input); err != nil {
+				t.Fatalf("compiler error: %s", err)
+			}
 		}
 
 		program := compiler.Result()
 
-		err = testInstructions(tt.expectedInstructions, program.Modules[0].Instructions)
+		err := testInstructions(tt.expectedInstructions, program.Modules[0].Instructions)
 		if err != nil {
 			t.Fatalf("testInstructions failed: %s", err)
 		}
@@ -454,18 +504,16 @@ func TestVarStatements(t *testing.T) {
 		},
 		{
 			// var one = 1; var two = 2;
-			input: &ast.BlockStmt{
-				Statements: []ast.Stmt{
-					&ast.VarDeclStmt{
-						Name:        &token.Token{Type: token.IDENTIFIER, Lexeme: "one"},
-						Initializer: &ast.LiteralExpr{Value: 1},
-						IsConst:     false,
-					},
-					&ast.VarDeclStmt{
-						Name:        &token.Token{Type: token.IDENTIFIER, Lexeme: "two"},
-						Initializer: &ast.LiteralExpr{Value: 2},
-						IsConst:     false,
-					},
+			input: []ast.Stmt{
+				&ast.VarDeclStmt{
+					Name:        &token.Token{Type: token.IDENTIFIER, Lexeme: "one"},
+					Initializer: &ast.LiteralExpr{Value: 1},
+					IsConst:     false,
+				},
+				&ast.VarDeclStmt{
+					Name:        &token.Token{Type: token.IDENTIFIER, Lexeme: "two"},
+					Initializer: &ast.LiteralExpr{Value: 2},
+					IsConst:     false,
 				},
 			},
 			expectedConstants: []interface{}{1, 2},
@@ -478,17 +526,15 @@ func TestVarStatements(t *testing.T) {
 		},
 		{
 			// var one = 1; one;
-			input: &ast.BlockStmt{
-				Statements: []ast.Stmt{
-					&ast.VarDeclStmt{
-						Name:        &token.Token{Type: token.IDENTIFIER, Lexeme: "one"},
-						Initializer: &ast.LiteralExpr{Value: 1},
-						IsConst:     false,
-					},
-					&ast.ExprStmt{
-						Expr: &ast.VariableExpr{
-							Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "one"},
-						},
+			input: []ast.Stmt{
+				&ast.VarDeclStmt{
+					Name:        &token.Token{Type: token.IDENTIFIER, Lexeme: "one"},
+					Initializer: &ast.LiteralExpr{Value: 1},
+					IsConst:     false,
+				},
+				&ast.ExprStmt{
+					Expr: &ast.VariableExpr{
+						Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "one"},
 					},
 				},
 			},
@@ -502,24 +548,22 @@ func TestVarStatements(t *testing.T) {
 		},
 		{
 			// var one = 1; var two = one; two;
-			input: &ast.BlockStmt{
-				Statements: []ast.Stmt{
-					&ast.VarDeclStmt{
-						Name:        &token.Token{Type: token.IDENTIFIER, Lexeme: "one"},
-						Initializer: &ast.LiteralExpr{Value: 1},
-						IsConst:     false,
+			input: []ast.Stmt{
+				&ast.VarDeclStmt{
+					Name:        &token.Token{Type: token.IDENTIFIER, Lexeme: "one"},
+					Initializer: &ast.LiteralExpr{Value: 1},
+					IsConst:     false,
+				},
+				&ast.VarDeclStmt{
+					Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "two"},
+					Initializer: &ast.VariableExpr{
+						Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "one"},
 					},
-					&ast.VarDeclStmt{
+					IsConst: false,
+				},
+				&ast.ExprStmt{
+					Expr: &ast.VariableExpr{
 						Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "two"},
-						Initializer: &ast.VariableExpr{
-							Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "one"},
-						},
-						IsConst: false,
-					},
-					&ast.ExprStmt{
-						Expr: &ast.VariableExpr{
-							Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "two"},
-						},
 					},
 				},
 			},
@@ -536,23 +580,21 @@ func TestVarStatements(t *testing.T) {
 		// Local scope tests (inside functions)
 		{
 			// var num = 55; fun() { return num; }  (accessing global from function)
-			input: &ast.BlockStmt{
-				Statements: []ast.Stmt{
-					&ast.VarDeclStmt{
-						Name:        &token.Token{Type: token.IDENTIFIER, Lexeme: "num"},
-						Initializer: &ast.LiteralExpr{Value: 55},
-						IsConst:     false,
-					},
-					&ast.ExprStmt{
-						Expr: &ast.FunctionExpr{
-							Params: []*token.Token{},
-							Body: &ast.BlockStmt{
-								Statements: []ast.Stmt{
-									&ast.ReturnStmt{
-										Keyword: &token.Token{Type: token.RETURN},
-										Value: &ast.VariableExpr{
-											Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "num"},
-										},
+			input: []ast.Stmt{
+				&ast.VarDeclStmt{
+					Name:        &token.Token{Type: token.IDENTIFIER, Lexeme: "num"},
+					Initializer: &ast.LiteralExpr{Value: 55},
+					IsConst:     false,
+				},
+				&ast.ExprStmt{
+					Expr: &ast.FunctionExpr{
+						Params: []*token.Token{},
+						Body: &ast.BlockStmt{
+							Statements: []ast.Stmt{
+								&ast.ReturnStmt{
+									Keyword: &token.Token{Type: token.RETURN},
+									Value: &ast.VariableExpr{
+										Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "num"},
 									},
 								},
 							},
@@ -599,7 +641,7 @@ func TestVarStatements(t *testing.T) {
 				55,
 				[]code.Instructions{
 					code.Make(code.OpGetConstant, 0),
-					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpDefineLocal, 0),
 					code.Make(code.OpGetLocal, 0),
 					code.Make(code.OpReturnValue),
 					code.Make(code.OpReturn),
@@ -645,9 +687,9 @@ func TestVarStatements(t *testing.T) {
 				77,
 				[]code.Instructions{
 					code.Make(code.OpGetConstant, 0),
-					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpDefineLocal, 0),
 					code.Make(code.OpGetConstant, 1),
-					code.Make(code.OpSetLocal, 1),
+					code.Make(code.OpDefineLocal, 1),
 					code.Make(code.OpGetLocal, 0),
 					code.Make(code.OpGetLocal, 1),
 					code.Make(code.OpAdd),
@@ -723,6 +765,23 @@ func TestStringExpressions(t *testing.T) {
 				code.Make(code.OpGetConstant, 0),
 			},
 		},
+		{
+			// "a ${1} b"
+			input: &ast.InterpolationExpr{
+				Parts: []ast.Expr{
+					&ast.LiteralExpr{Value: "a "},
+					&ast.LiteralExpr{Value: 1},
+					&ast.LiteralExpr{Value: " b"},
+				},
+			},
+			expectedConstants: []interface{}{"a ", 1, " b"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpGetConstant, 0),
+				code.Make(code.OpGetConstant, 1),
+				code.Make(code.OpGetConstant, 2),
+				code.Make(code.OpInterpolate, 3),
+			},
+		},
 	}
 
 	runCompilerTests(t, tests)
@@ -875,6 +934,27 @@ func TestIndexExpressions(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
+func TestSliceExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			// "abc"[1:]
+			input: &ast.SliceExpr{
+				Object: &ast.LiteralExpr{Value: "abc"},
+				Start:  &ast.LiteralExpr{Value: 1},
+			},
+			expectedConstants: []interface{}{"abc", 1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpGetConstant, 0),
+				code.Make(code.OpGetConstant, 1),
+				code.Make(code.OpNil),
+				code.Make(code.OpSlice),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
 func TestSetIndexExpressions(t *testing.T) {
 	tests := []compilerTestCase{
 		{
@@ -977,18 +1057,16 @@ func TestGlobalAssignmentStatements(t *testing.T) {
 	tests := []compilerTestCase{
 		{
 			// var x = 1; x = 2;
-			input: &ast.BlockStmt{
-				Statements: []ast.Stmt{
-					&ast.VarDeclStmt{
-						Name:        &token.Token{Type: token.IDENTIFIER, Lexeme: "x"},
-						Initializer: &ast.LiteralExpr{Value: 1},
-						IsConst:     false,
-					},
-					&ast.ExprStmt{
-						Expr: &ast.AssignExpr{
-							Name:  &token.Token{Type: token.IDENTIFIER, Lexeme: "x"},
-							Value: &ast.LiteralExpr{Value: 2},
-						},
+			input: []ast.Stmt{
+				&ast.VarDeclStmt{
+					Name:        &token.Token{Type: token.IDENTIFIER, Lexeme: "x"},
+					Initializer: &ast.LiteralExpr{Value: 1},
+					IsConst:     false,
+				},
+				&ast.ExprStmt{
+					Expr: &ast.AssignExpr{
+						Name:  &token.Token{Type: token.IDENTIFIER, Lexeme: "x"},
+						Value: &ast.LiteralExpr{Value: 2},
 					},
 				},
 			},
@@ -1094,6 +1172,52 @@ func TestWhileStatements(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
+func TestForInStatements(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			// for (var k, v in [1]) { v; break; }
+			input: &ast.ForInStmt{
+				Keyword: &token.Token{Type: token.FOR, Lexeme: "for"},
+				Variables: []*token.Token{
+					{Type: token.IDENTIFIER, Lexeme: "k"},
+					{Type: token.IDENTIFIER, Lexeme: "v"},
+				},
+				Iterable: &ast.ArrayLiteralExpr{Elements: []ast.Expr{&ast.LiteralExpr{Value: 1}}},
+				Body: &ast.BlockStmt{
+					Statements: []ast.Stmt{
+						&ast.ExprStmt{Expr: &ast.VariableExpr{Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "v"}}},
+						&ast.BreakStmt{Keyword: &token.Token{Type: token.BREAK, Lexeme: "break"}},
+					},
+				},
+			},
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				// 0000: iterable
+				code.Make(code.OpGetConstant, 0),
+				code.Make(code.OpArray, 1),
+				// 0006: OpIter with two loop variables
+				code.Make(code.OpIter, 2),
+				// 0008: OpIterNext -> 24 (exit loop)
+				code.Make(code.OpIterNext, 24),
+				// 0011: value is on top, then key
+				code.Make(code.OpDefineLocal, 1),
+				code.Make(code.OpDefineLocal, 0),
+				// 0015: v;
+				code.Make(code.OpGetLocal, 1),
+				code.Make(code.OpPop),
+				// 0018: break -> 24
+				code.Make(code.OpJump, 24),
+				// 0021: OpJump -> 8 (next iteration)
+				code.Make(code.OpJump, 8),
+				// 0024: discard the iterator
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
 func TestForStatements(t *testing.T) {
 	tests := []compilerTestCase{
 		{
@@ -1129,12 +1253,12 @@ func TestForStatements(t *testing.T) {
 				code.Make(code.OpGetConstant, 0),
 				// 0003: OpSetGlobal 0 (i)
 				code.Make(code.OpSetGlobal, 0),
-				// 0006: OpGetConstant 1 (10) - condition: i < 10 (compiled as 10 > i)
-				code.Make(code.OpGetConstant, 1),
-				// 0009: OpGetGlobal 0 (i)
+				// 0006: OpGetGlobal 0 (i) - condition: i < 10
 				code.Make(code.OpGetGlobal, 0),
-				// 0012: OpGreaterThan
-				code.Make(code.OpGreaterThan),
+				// 0009: OpGetConstant 1 (10)
+				code.Make(code.OpGetConstant, 1),
+				// 0012: OpLess
+				code.Make(code.OpLess),
 				// 0013: OpJumpNotTruthy -> 37 (exit loop)
 				code.Make(code.OpJumpNotTruthy, 37),
 				// 0016: OpGetConstant 2 (5) - body
@@ -1161,32 +1285,30 @@ func TestForStatements(t *testing.T) {
 		{
 			// No initializer: for (; i < 10; i = i + 1) { 5; }
 			// Assumes i is already defined (index 0)
-			input: &ast.BlockStmt{
-				Statements: []ast.Stmt{
-					&ast.VarDeclStmt{
-						Name:        &token.Token{Type: token.IDENTIFIER, Lexeme: "i"},
-						Initializer: &ast.LiteralExpr{Value: 0},
-						IsConst:     false,
-					},
-					&ast.ForStmt{
-						Initializer: nil, // No initializer
-						Condition: &ast.BinaryExpr{
+			input: []ast.Stmt{
+				&ast.VarDeclStmt{
+					Name:        &token.Token{Type: token.IDENTIFIER, Lexeme: "i"},
+					Initializer: &ast.LiteralExpr{Value: 0},
+					IsConst:     false,
+				},
+				&ast.ForStmt{
+					Initializer: nil, // No initializer
+					Condition: &ast.BinaryExpr{
+						Left:     &ast.VariableExpr{Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "i"}},
+						Right:    &ast.LiteralExpr{Value: 10},
+						Operator: &token.Token{Type: token.LESS},
+					},
+					Increment: &ast.AssignExpr{
+						Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "i"},
+						Value: &ast.BinaryExpr{
 							Left:     &ast.VariableExpr{Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "i"}},
-							Right:    &ast.LiteralExpr{Value: 10},
-							Operator: &token.Token{Type: token.LESS},
-						},
-						Increment: &ast.AssignExpr{
-							Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "i"},
-							Value: &ast.BinaryExpr{
-								Left:     &ast.VariableExpr{Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "i"}},
-								Right:    &ast.LiteralExpr{Value: 1},
-								Operator: &token.Token{Type: token.PLUS},
-							},
+							Right:    &ast.LiteralExpr{Value: 1},
+							Operator: &token.Token{Type: token.PLUS},
 						},
-						Body: &ast.BlockStmt{
-							Statements: []ast.Stmt{
-								&ast.ExprStmt{Expr: &ast.LiteralExpr{Value: 5}},
-							},
+					},
+					Body: &ast.BlockStmt{
+						Statements: []ast.Stmt{
+							&ast.ExprStmt{Expr: &ast.LiteralExpr{Value: 5}},
 						},
 					},
 				},
@@ -1198,9 +1320,9 @@ func TestForStatements(t *testing.T) {
 				code.Make(code.OpSetGlobal, 0),
 				// for loop starts here (no initializer)
 				// 0006: condition
-				code.Make(code.OpGetConstant, 1),
 				code.Make(code.OpGetGlobal, 0),
-				code.Make(code.OpGreaterThan),
+				code.Make(code.OpGetConstant, 1),
+				code.Make(code.OpLess),
 				code.Make(code.OpJumpNotTruthy, 37),
 				// body
 				code.Make(code.OpGetConstant, 2),
@@ -1242,12 +1364,12 @@ func TestForStatements(t *testing.T) {
 				code.Make(code.OpGetConstant, 0),
 				// 0003:
 				code.Make(code.OpSetGlobal, 0),
-				// 0006: condition: i < 3 (compiled as 3 > i)
-				code.Make(code.OpGetConstant, 1),
-				// 0009:
+				// 0006: condition: i < 3
 				code.Make(code.OpGetGlobal, 0),
+				// 0009:
+				code.Make(code.OpGetConstant, 1),
 				// 0012:
-				code.Make(code.OpGreaterThan),
+				code.Make(code.OpLess),
 				// 0013: jump to 23 if false
 				code.Make(code.OpJumpNotTruthy, 23),
 				// 0016: body: 5;
@@ -1394,6 +1516,125 @@ func TestContinueStatement(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
+func TestTryStatements(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			// try { 1; } catch (e) { 2; }
+			input: &ast.TryStmt{
+				Keyword: &token.Token{Type: token.TRY},
+				Body: &ast.BlockStmt{
+					Statements: []ast.Stmt{
+						&ast.ExprStmt{Expr: &ast.LiteralExpr{Value: 1}},
+					},
+				},
+				CatchParam: &token.Token{Type: token.IDENTIFIER, Lexeme: "e"},
+				CatchBody: &ast.BlockStmt{
+					Statements: []ast.Stmt{
+						&ast.ExprStmt{Expr: &ast.LiteralExpr{Value: 2}},
+					},
+				},
+			},
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				// 0000: OpTry -> 12 (catch)
+				code.Make(code.OpTry, 12, 0),
+				code.Make(code.OpGetConstant, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpEndTry),
+				// 0009: OpJump -> 21 (end)
+				code.Make(code.OpJump, 21),
+				// 0012: catch - bind the error to e
+				code.Make(code.OpDefineLocal, 0),
+				code.Make(code.OpGetConstant, 1),
+				code.Make(code.OpPop),
+				// 0018: OpJump -> 21 (end)
+				code.Make(code.OpJump, 21),
+				// 0021: end
+			},
+		},
+		{
+			// try { 1; } finally { 2; }
+			input: &ast.TryStmt{
+				Keyword: &token.Token{Type: token.TRY},
+				Body: &ast.BlockStmt{
+					Statements: []ast.Stmt{
+						&ast.ExprStmt{Expr: &ast.LiteralExpr{Value: 1}},
+					},
+				},
+				FinallyBody: &ast.BlockStmt{
+					Statements: []ast.Stmt{
+						&ast.ExprStmt{Expr: &ast.LiteralExpr{Value: 2}},
+					},
+				},
+			},
+			expectedConstants: []interface{}{1, 2, 2},
+			expectedInstructions: []code.Instructions{
+				// 0000: OpTry -> 16 (finally, rethrow)
+				code.Make(code.OpTry, 16, 1),
+				code.Make(code.OpGetConstant, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpEndTry),
+				// 0009: finally on the normal path
+				code.Make(code.OpGetConstant, 1),
+				code.Make(code.OpPop),
+				// 0013: OpJump -> 21 (end)
+				code.Make(code.OpJump, 21),
+				// 0016: finally on the error path
+				code.Make(code.OpGetConstant, 2),
+				code.Make(code.OpPop),
+				code.Make(code.OpThrow),
+				// 0021: end
+			},
+		},
+		{
+			// while (true) { try { break; } finally { 1; } }
+			input: &ast.WhileStmt{
+				Condition: &ast.LiteralExpr{Value: true},
+				Body: &ast.TryStmt{
+					Keyword: &token.Token{Type: token.TRY},
+					Body: &ast.BlockStmt{
+						Statements: []ast.Stmt{
+							&ast.BreakStmt{Keyword: &token.Token{Type: token.BREAK}},
+						},
+					},
+					FinallyBody: &ast.BlockStmt{
+						Statements: []ast.Stmt{
+							&ast.ExprStmt{Expr: &ast.LiteralExpr{Value: 1}},
+						},
+					},
+				},
+			},
+			expectedConstants: []interface{}{1, 1, 1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTrue),
+				// 0001: OpJumpNotTruthy -> 32 (exit loop)
+				code.Make(code.OpJumpNotTruthy, 32),
+				// 0004: OpTry -> 24 (finally, rethrow)
+				code.Make(code.OpTry, 24, 1),
+				// 0008: break pops the handler and runs finally first
+				code.Make(code.OpEndTry),
+				code.Make(code.OpGetConstant, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpJump, 32),
+				// 0016: end of try body
+				code.Make(code.OpEndTry),
+				code.Make(code.OpGetConstant, 1),
+				code.Make(code.OpPop),
+				code.Make(code.OpJump, 29),
+				// 0024: finally on the error path
+				code.Make(code.OpGetConstant, 2),
+				code.Make(code.OpPop),
+				code.Make(code.OpThrow),
+				// 0029: OpJump -> 0 (back to condition)
+				code.Make(code.OpJump, 0),
+				// 0032: end
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
 func TestBreakOutsideLoop(t *testing.T) {
 	input := &ast.BreakStmt{Keyword: &token.Token{Type: token.BREAK, Lexeme: "break"}}
 
@@ -1832,7 +2073,7 @@ func TestClosures(t *testing.T) {
 				// Outer function
 				[]code.Instructions{
 					code.Make(code.OpGetConstant, 0),   // push 10
-					code.Make(code.OpSetLocal, 0),      // set local 'x'
+					code.Make(code.OpDefineLocal, 0),   // set local 'x'
 					code.Make(code.OpMakeCell, 0),      // wrap 'x' in Cell for closure
 					code.Make(code.OpGetClosure, 1, 1), // create closure with 1 free variable
 					code.Make(code.OpReturnValue),
@@ -1884,30 +2125,28 @@ func TestFunctionCalls(t *testing.T) {
 		},
 		{
 			// var noArg = fun() { return 24; }; noArg();
-			input: &ast.BlockStmt{
-				Statements: []ast.Stmt{
-					&ast.VarDeclStmt{
-						Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "noArg"},
-						Initializer: &ast.FunctionExpr{
-							Params: []*token.Token{},
-							Body: &ast.BlockStmt{
-								Statements: []ast.Stmt{
-									&ast.ReturnStmt{
-										Keyword: &token.Token{Type: token.RETURN},
-										Value:   &ast.LiteralExpr{Value: 24},
-									},
+			input: []ast.Stmt{
+				&ast.VarDeclStmt{
+					Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "noArg"},
+					Initializer: &ast.FunctionExpr{
+						Params: []*token.Token{},
+						Body: &ast.BlockStmt{
+							Statements: []ast.Stmt{
+								&ast.ReturnStmt{
+									Keyword: &token.Token{Type: token.RETURN},
+									Value:   &ast.LiteralExpr{Value: 24},
 								},
 							},
 						},
-						IsConst: false,
 					},
-					&ast.ExprStmt{
-						Expr: &ast.CallExpr{
-							Callee: &ast.VariableExpr{
-								Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "noArg"},
-							},
-							Arguments: []ast.Expr{},
+					IsConst: false,
+				},
+				&ast.ExprStmt{
+					Expr: &ast.CallExpr{
+						Callee: &ast.VariableExpr{
+							Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "noArg"},
 						},
+						Arguments: []ast.Expr{},
 					},
 				},
 			},
@@ -1929,35 +2168,33 @@ func TestFunctionCalls(t *testing.T) {
 		},
 		{
 			// var oneArg = fun(a) { return a; }; oneArg(24);
-			input: &ast.BlockStmt{
-				Statements: []ast.Stmt{
-					&ast.VarDeclStmt{
-						Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "oneArg"},
-						Initializer: &ast.FunctionExpr{
-							Params: []*token.Token{
-								{Type: token.IDENTIFIER, Lexeme: "a"},
-							},
-							Body: &ast.BlockStmt{
-								Statements: []ast.Stmt{
-									&ast.ReturnStmt{
-										Keyword: &token.Token{Type: token.RETURN},
-										Value: &ast.VariableExpr{
-											Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "a"},
-										},
+			input: []ast.Stmt{
+				&ast.VarDeclStmt{
+					Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "oneArg"},
+					Initializer: &ast.FunctionExpr{
+						Params: []*token.Token{
+							{Type: token.IDENTIFIER, Lexeme: "a"},
+						},
+						Body: &ast.BlockStmt{
+							Statements: []ast.Stmt{
+								&ast.ReturnStmt{
+									Keyword: &token.Token{Type: token.RETURN},
+									Value: &ast.VariableExpr{
+										Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "a"},
 									},
 								},
 							},
 						},
-						IsConst: false,
 					},
-					&ast.ExprStmt{
-						Expr: &ast.CallExpr{
-							Callee: &ast.VariableExpr{
-								Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "oneArg"},
-							},
-							Arguments: []ast.Expr{
-								&ast.LiteralExpr{Value: 24},
-							},
+					IsConst: false,
+				},
+				&ast.ExprStmt{
+					Expr: &ast.CallExpr{
+						Callee: &ast.VariableExpr{
+							Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "oneArg"},
+						},
+						Arguments: []ast.Expr{
+							&ast.LiteralExpr{Value: 24},
 						},
 					},
 				},
@@ -1981,51 +2218,49 @@ func TestFunctionCalls(t *testing.T) {
 		},
 		{
 			// var manyArg = fun(a, b, c) { return a + b + c; }; manyArg(24, 25, 26);
-			input: &ast.BlockStmt{
-				Statements: []ast.Stmt{
-					&ast.VarDeclStmt{
-						Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "manyArg"},
-						Initializer: &ast.FunctionExpr{
-							Params: []*token.Token{
-								{Type: token.IDENTIFIER, Lexeme: "a"},
-								{Type: token.IDENTIFIER, Lexeme: "b"},
-								{Type: token.IDENTIFIER, Lexeme: "c"},
-							},
-							Body: &ast.BlockStmt{
-								Statements: []ast.Stmt{
-									&ast.ReturnStmt{
-										Keyword: &token.Token{Type: token.RETURN},
-										Value: &ast.BinaryExpr{
-											Left: &ast.BinaryExpr{
-												Left: &ast.VariableExpr{
-													Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "a"},
-												},
-												Right: &ast.VariableExpr{
-													Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "b"},
-												},
-												Operator: &token.Token{Type: token.PLUS},
+			input: []ast.Stmt{
+				&ast.VarDeclStmt{
+					Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "manyArg"},
+					Initializer: &ast.FunctionExpr{
+						Params: []*token.Token{
+							{Type: token.IDENTIFIER, Lexeme: "a"},
+							{Type: token.IDENTIFIER, Lexeme: "b"},
+							{Type: token.IDENTIFIER, Lexeme: "c"},
+						},
+						Body: &ast.BlockStmt{
+							Statements: []ast.Stmt{
+								&ast.ReturnStmt{
+									Keyword: &token.Token{Type: token.RETURN},
+									Value: &ast.BinaryExpr{
+										Left: &ast.BinaryExpr{
+											Left: &ast.VariableExpr{
+												Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "a"},
 											},
 											Right: &ast.VariableExpr{
-												Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "c"},
+												Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "b"},
 											},
 											Operator: &token.Token{Type: token.PLUS},
 										},
+										Right: &ast.VariableExpr{
+											Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "c"},
+										},
+										Operator: &token.Token{Type: token.PLUS},
 									},
 								},
 							},
 						},
-						IsConst: false,
 					},
-					&ast.ExprStmt{
-						Expr: &ast.CallExpr{
-							Callee: &ast.VariableExpr{
-								Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "manyArg"},
-							},
-							Arguments: []ast.Expr{
-								&ast.LiteralExpr{Value: 24},
-								&ast.LiteralExpr{Value: 25},
-								&ast.LiteralExpr{Value: 26},
-							},
+					IsConst: false,
+				},
+				&ast.ExprStmt{
+					Expr: &ast.CallExpr{
+						Callee: &ast.VariableExpr{
+							Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "manyArg"},
+						},
+						Arguments: []ast.Expr{
+							&ast.LiteralExpr{Value: 24},
+							&ast.LiteralExpr{Value: 25},
+							&ast.LiteralExpr{Value: 26},
 						},
 					},
 				},
@@ -2295,19 +2530,17 @@ func TestClassInheritanceCompiler(t *testing.T) {
 		{
 			// class Animal {}
 			// class Dog < Animal {}
-			input: &ast.BlockStmt{
-				Statements: []ast.Stmt{
-					&ast.ClassStmt{
-						Name:    &token.Token{Type: token.IDENTIFIER, Lexeme: "Animal"},
-						Methods: []*ast.FunctionStmt{},
-					},
-					&ast.ClassStmt{
-						Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "Dog"},
-						SuperClass: &ast.VariableExpr{
-							Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "Animal"},
-						},
-						Methods: []*ast.FunctionStmt{},
+			input: []ast.Stmt{
+				&ast.ClassStmt{
+					Name:    &token.Token{Type: token.IDENTIFIER, Lexeme: "Animal"},
+					Methods: []*ast.FunctionStmt{},
+				},
+				&ast.ClassStmt{
+					Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "Dog"},
+					SuperClass: &ast.VariableExpr{
+						Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "Animal"},
 					},
+					Methods: []*ast.FunctionStmt{},
 				},
 			},
 			expectedConstants: []interface{}{
@@ -2315,10 +2548,12 @@ func TestClassInheritanceCompiler(t *testing.T) {
 				"Dog",
 			},
 			expectedInstructions: []code.Instructions{
-				code.Make(code.OpNil),          // Animal: no superclass
-				code.Make(code.OpClass, 0, 0),  // Animal class
-				code.Make(code.OpSetGlobal, 0), // store Animal
-				code.Make(code.OpGetGlobal, 0), // Dog: get Animal as superclass
+				code.Make(code.OpNil),            // Animal: no superclass
+				code.Make(code.OpClass, 0, 0),    // Animal class
+				code.Make(code.OpSetGlobal, 0),   // store Animal
+				code.Make(code.OpGetGlobal, 0),   // Dog: get Animal as superclass
+				code.Make(code.OpDefineLocal, 0), // keep it for super
+				code.Make(code.OpGetLocal, 0),
 				code.Make(code.OpClass, 1, 0),  // Dog class
 				code.Make(code.OpSetGlobal, 1), // store Dog
 			},
@@ -2337,45 +2572,43 @@ func TestClassSuperCompiler(t *testing.T) {
 			// class Dog < Animal {
 			//   fn speak() { return super.speak(); }
 			// }
-			input: &ast.BlockStmt{
-				Statements: []ast.Stmt{
-					&ast.ClassStmt{
-						Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "Animal"},
-						Methods: []*ast.FunctionStmt{
-							{
-								Name:   &token.Token{Type: token.IDENTIFIER, Lexeme: "speak"},
-								Params: []*token.Token{},
-								Body: &ast.BlockStmt{
-									Statements: []ast.Stmt{
-										&ast.ReturnStmt{
-											Keyword: &token.Token{Type: token.RETURN},
-											Value:   &ast.LiteralExpr{Value: "generic"},
-										},
+			input: []ast.Stmt{
+				&ast.ClassStmt{
+					Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "Animal"},
+					Methods: []*ast.FunctionStmt{
+						{
+							Name:   &token.Token{Type: token.IDENTIFIER, Lexeme: "speak"},
+							Params: []*token.Token{},
+							Body: &ast.BlockStmt{
+								Statements: []ast.Stmt{
+									&ast.ReturnStmt{
+										Keyword: &token.Token{Type: token.RETURN},
+										Value:   &ast.LiteralExpr{Value: "generic"},
 									},
 								},
 							},
 						},
 					},
-					&ast.ClassStmt{
-						Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "Dog"},
-						SuperClass: &ast.VariableExpr{
-							Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "Animal"},
-						},
-						Methods: []*ast.FunctionStmt{
-							{
-								Name:   &token.Token{Type: token.IDENTIFIER, Lexeme: "speak"},
-								Params: []*token.Token{},
-								Body: &ast.BlockStmt{
-									Statements: []ast.Stmt{
-										&ast.ReturnStmt{
-											Keyword: &token.Token{Type: token.RETURN},
-											Value: &ast.CallExpr{
-												Callee: &ast.SuperExpr{
-													Keyword: &token.Token{Type: token.SUPER, Lexeme: "super"},
-													Method:  &token.Token{Type: token.IDENTIFIER, Lexeme: "speak"},
-												},
-												Arguments: []ast.Expr{},
+				},
+				&ast.ClassStmt{
+					Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "Dog"},
+					SuperClass: &ast.VariableExpr{
+						Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "Animal"},
+					},
+					Methods: []*ast.FunctionStmt{
+						{
+							Name:   &token.Token{Type: token.IDENTIFIER, Lexeme: "speak"},
+							Params: []*token.Token{},
+							Body: &ast.BlockStmt{
+								Statements: []ast.Stmt{
+									&ast.ReturnStmt{
+										Keyword: &token.Token{Type: token.RETURN},
+										Value: &ast.CallExpr{
+											Callee: &ast.SuperExpr{
+												Keyword: &token.Token{Type: token.SUPER, Lexeme: "super"},
+												Method:  &token.Token{Type: token.IDENTIFIER, Lexeme: "speak"},
 											},
+											Arguments: []ast.Expr{},
 										},
 									},
 								},
@@ -2397,6 +2630,7 @@ func TestClassSuperCompiler(t *testing.T) {
 				// Dog.speak method
 				[]code.Instructions{
 					code.Make(code.OpGetLocal, 0), // this
+					code.Make(code.OpGetFree, 0),  // superclass
 					code.Make(code.OpGetSuper, 3), // super.speak (method name at constant 3)
 					code.Make(code.OpCall, 0),     // call super.speak()
 					code.Make(code.OpReturnValue),
@@ -2410,7 +2644,10 @@ func TestClassSuperCompiler(t *testing.T) {
 				code.Make(code.OpClass, 2, 1),      // Animal class
 				code.Make(code.OpSetGlobal, 0),     // store Animal
 				code.Make(code.OpGetGlobal, 0),     // Dog: get Animal as superclass
-				code.Make(code.OpGetClosure, 4, 0), // Dog.speak method
+				code.Make(code.OpDefineLocal, 0),   // keep it for super
+				code.Make(code.OpGetLocal, 0),
+				code.Make(code.OpMakeCell, 0),      // captured by Dog.speak
+				code.Make(code.OpGetClosure, 4, 1), // Dog.speak method
 				code.Make(code.OpClass, 5, 1),      // Dog class
 				code.Make(code.OpSetGlobal, 1),     // store Dog
 			},
@@ -2426,28 +2663,26 @@ func TestPropertyAccessCompiler(t *testing.T) {
 			// class Animal {}
 			// var a = Animal();
 			// a.name;
-			input: &ast.BlockStmt{
-				Statements: []ast.Stmt{
-					&ast.ClassStmt{
-						Name:    &token.Token{Type: token.IDENTIFIER, Lexeme: "Animal"},
-						Methods: []*ast.FunctionStmt{},
-					},
-					&ast.VarDeclStmt{
-						Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "a"},
-						Initializer: &ast.CallExpr{
-							Callee: &ast.VariableExpr{
-								Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "Animal"},
-							},
-							Arguments: []ast.Expr{},
+			input: []ast.Stmt{
+				&ast.ClassStmt{
+					Name:    &token.Token{Type: token.IDENTIFIER, Lexeme: "Animal"},
+					Methods: []*ast.FunctionStmt{},
+				},
+				&ast.VarDeclStmt{
+					Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "a"},
+					Initializer: &ast.CallExpr{
+						Callee: &ast.VariableExpr{
+							Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "Animal"},
 						},
+						Arguments: []ast.Expr{},
 					},
-					&ast.ExprStmt{
-						Expr: &ast.GetExpr{
-							Object: &ast.VariableExpr{
-								Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "a"},
-							},
-							Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "name"},
+				},
+				&ast.ExprStmt{
+					Expr: &ast.GetExpr{
+						Object: &ast.VariableExpr{
+							Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "a"},
 						},
+						Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "name"},
 					},
 				},
 			},
@@ -2478,29 +2713,27 @@ func TestPropertySetCompiler(t *testing.T) {
 			// class Animal {}
 			// var a = Animal();
 			// a.name = "Dog";
-			input: &ast.BlockStmt{
-				Statements: []ast.Stmt{
-					&ast.ClassStmt{
-						Name:    &token.Token{Type: token.IDENTIFIER, Lexeme: "Animal"},
-						Methods: []*ast.FunctionStmt{},
-					},
-					&ast.VarDeclStmt{
-						Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "a"},
-						Initializer: &ast.CallExpr{
-							Callee: &ast.VariableExpr{
-								Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "Animal"},
-							},
-							Arguments: []ast.Expr{},
+			input: []ast.Stmt{
+				&ast.ClassStmt{
+					Name:    &token.Token{Type: token.IDENTIFIER, Lexeme: "Animal"},
+					Methods: []*ast.FunctionStmt{},
+				},
+				&ast.VarDeclStmt{
+					Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "a"},
+					Initializer: &ast.CallExpr{
+						Callee: &ast.VariableExpr{
+							Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "Animal"},
 						},
+						Arguments: []ast.Expr{},
 					},
-					&ast.ExprStmt{
-						Expr: &ast.SetExpr{
-							Object: &ast.VariableExpr{
-								Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "a"},
-							},
-							Name:  &token.Token{Type: token.IDENTIFIER, Lexeme: "name"},
-							Value: &ast.LiteralExpr{Value: "Dog"},
+				},
+				&ast.ExprStmt{
+					Expr: &ast.SetExpr{
+						Object: &ast.VariableExpr{
+							Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "a"},
 						},
+						Name:  &token.Token{Type: token.IDENTIFIER, Lexeme: "name"},
+						Value: &ast.LiteralExpr{Value: "Dog"},
 					},
 				},
 			},
@@ -2794,3 +3027,129 @@ func TestClassInitReturnsThis(t *testing.T) {
 
 	runCompilerTests(t, tests)
 }
+
+func TestProgramTooLarge(t *testing.T) {
+	var locals strings.Builder
+	locals.WriteString("fun f() {\n")
+	for i := 0; i < 65600; i++ {
+		fmt.Fprintf(&locals, "  var v%d;\n", i)
+	}
+	locals.WriteString("}\n")
+
+	tests := []struct {
+		name string
+		src  string
+		line int
+	}{
+		{"locals", locals.String(), 65538},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diagnostics := &objects.DiagnosticCollector{}
+			comp := New(diagnostics)
+			comp.SetLoader(parser.FSLoader{FS: fstest.MapFS{"main.viri": &fstest.MapFile{Data: []byte(tt.src)}}})
+			if _, err := comp.CompileProgram("main.viri"); err == nil {
+				t.Fatal("CompileProgram() succeeded")
+			}
+			if len(diagnostics.Errors) != 1 {
+				t.Fatalf("diagnostics = %v, want one", diagnostics.Errors)
+			}
+			d := diagnostics.Errors[0]
+			if !strings.HasPrefix(d.Message, "program too large to compile") || d.Token.Line != tt.line {
+				t.Errorf("diagnostic at line %d: %s", d.Token.Line, d.Message)
+			}
+		})
+	}
+}
+
+func TestWideOperands(t *testing.T) {
+	var locals, jumps strings.Builder
+	locals.WriteString("fun f() {\n")
+	for i := 0; i < 300; i++ {
+		fmt.Fprintf(&locals, "  var v%d = %d;\n", i, i)
+	}
+	locals.WriteString("  return v299 + v0;\n}\n")
+
+	// More than 64K of code inside the if, so its jump has to be widened
+	jumps.WriteString("var x = true;\nif (x) {\n")
+	for i := 0; i < 17000; i++ {
+		jumps.WriteString("  print x;\n")
+	}
+	jumps.WriteString("}\nprint !x;\n")
+
+	t.Run("locals", func(t *testing.T) {
+		program := compileSource(t, locals.String())
+		fn := program.Constants[len(program.Constants)-1].(*objects.CompiledFunction)
+		got := fn.Instructions.String()
+		for _, want := range []string{"OpWide OpDefineLocal 299\n", "OpWide OpGetLocal 299\n", "OpGetLocal 0\n"} {
+			if !strings.Contains(got, want) {
+				t.Errorf("instructions have no %q", want)
+			}
+		}
+	})
+
+	t.Run("jumps", func(t *testing.T) {
+		program := compileSource(t, jumps.String())
+		ins := program.Modules[0].Instructions
+		lines := program.DebugInfo.Get(program.Modules[0].DebugInfoIdx).LineTable
+		if len(lines) != len(ins) {
+			t.Fatalf("%d positions for %d bytes of instructions", len(lines), len(ins))
+		}
+
+		var target int
+		for offset := 0; offset < len(ins); {
+			op, operands, read, err := code.ReadInstruction(ins[offset:])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if op == code.OpJumpNotTruthy {
+				if code.Opcode(ins[offset]) != code.OpWide {
+					t.Errorf("jump at %d is not wide", offset)
+				}
+				target = operands[0]
+			}
+			offset += read
+		}
+		if line := lines[target].Line; line != 17004 {
+			t.Errorf("jump lands on line %d, want 17004", line)
+		}
+	})
+}
+
+func compileSource(t *testing.T, src string) *objects.CompiledProgram {
+	t.Helper()
+	diagnostics := &objects.DiagnosticCollector{}
+	comp := New(diagnostics)
+	comp.SetOptimize(false)
+	comp.SetLoader(parser.FSLoader{FS: fstest.MapFS{"main.viri": &fstest.MapFile{Data: []byte(src)}}})
+	program, err := comp.CompileProgram("main.viri")
+	if err != nil || len(diagnostics.Errors) > 0 {
+		t.Fatalf("compile failed: %v %v", err, diagnostics.Errors)
+	}
+	return program
+}
+
+func TestSetOptimize(t *testing.T) {
+	tests := []struct {
+		optimize  bool
+		constants int
+	}{
+		{true, 1},
+		{false, 3},
+	}
+
+	for _, tt := range tests {
+		diagnostics := &objects.DiagnosticCollector{}
+		comp := New(diagnostics)
+		comp.SetOptimize(tt.optimize)
+		comp.SetLoader(parser.FSLoader{FS: fstest.MapFS{"main.viri": &fstest.MapFile{Data: []byte("print 1 + 2 * 3;\n")}}})
+		program, err := comp.CompileProgram("main.viri")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(program.Constants) != tt.constants {
+			t.Errorf("optimize %v: constants = %v, want %d", tt.optimize, program.Constants, tt.constants)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package compiler
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/harshagw/viri/internal/objects"
+	"github.com/harshagw/viri/internal/parser"
+	"github.com/harshagw/viri/internal/testutil"
+)
+
+// FuzzCompile compiles programs without resolving them first, as the VM
+// runs them, so the compiler must reject on its own what the resolver would.
+func FuzzCompile(f *testing.F) {
+	files := testutil.Seed(f)
+	f.Add("return 1;")
+	f.Add("break;")
+	f.Add("print this;")
+	f.Add("class A < A {}")
+	f.Add("fun f() { super.f(); }")
+
+	f.Fuzz(func(t *testing.T, src string) {
+		fsys := fstest.MapFS{"main.viri": &fstest.MapFile{Data: []byte(src)}}
+		for name, file := range files {
+			if name != "main.viri" {
+				fsys[name] = file
+			}
+		}
+
+		comp := New(&objects.DiagnosticCollector{})
+		comp.SetLoader(parser.FSLoader{FS: fsys})
+		program, err := comp.CompileProgram("main.viri")
+		if err != nil {
+			return
+		}
+		for _, mod := range program.Modules {
+			_ = mod.Instructions.String()
+		}
+		for _, constant := range program.Constants {
+			if fn, ok := constant.(*objects.CompiledFunction); ok {
+				_ = fn.Instructions.String()
+			}
+		}
+	})
+}
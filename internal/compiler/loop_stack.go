@@ -40,6 +40,11 @@ func (ls *LoopStack) IsInLoop() bool {
 	return len(ls.stack) > 0
 }
 
+// Depth returns the number of enclosing loops
+func (ls *LoopStack) Depth() int {
+	return len(ls.stack)
+}
+
 // current returns the innermost loop context, or nil if not in a loop
 func (ls *LoopStack) current() *loopContext {
 	if len(ls.stack) == 0 {
@@ -2,16 +2,18 @@ package compiler
 
 import (
 	"fmt"
-	"path/filepath"
 	"slices"
 
 	"github.com/harshagw/viri/internal/ast"
 	"github.com/harshagw/viri/internal/objects"
+	"github.com/harshagw/viri/internal/optimize"
 	"github.com/harshagw/viri/internal/parser"
 )
 
 // CompileProgram compiles a program starting from the entry module
 func (c *Compiler) CompileProgram(entryPath string) (*objects.CompiledProgram, error) {
+	c.entryPath = entryPath
+
 	// Load all modules and build dependency graph
 	if err := c.loadModule(entryPath, []string{}); err != nil {
 		return nil, err
@@ -29,6 +31,17 @@ func (c *Compiler) CompileProgram(entryPath string) (*objects.CompiledProgram, e
 		c.moduleIndices[path] = i
 	}
 
+	if c.optimize {
+		// Removed code must still be checked, or optimizing would accept
+		// programs that compiling them as written rejects.
+		if err := c.check(); err != nil {
+			return nil, err
+		}
+		for _, path := range c.moduleOrder {
+			optimize.Module(c.modules[path])
+		}
+	}
+
 	// Compile all modules using shared constants table
 	compiledModules := make([]objects.CompiledModule, len(c.moduleOrder))
 
@@ -40,11 +53,36 @@ func (c *Compiler) CompileProgram(entryPath string) (*objects.CompiledProgram, e
 		compiledModules[i] = mod
 	}
 
-	return &objects.CompiledProgram{
+	program := &objects.CompiledProgram{
 		Modules:   compiledModules,
 		Constants: c.constants, // shared constants table
 		DebugInfo: c.debugInfo,
-	}, nil
+		Natives:   c.natives.Names(),
+	}
+	if c.optimize {
+		optimize.Program(program)
+	}
+	return program, nil
+}
+
+// check compiles the loaded modules as written, before they are
+// optimized, reporting the errors compiling them without optimizing would.
+// The bytecode it compiles is thrown away.
+func (c *Compiler) check() error {
+	checker := NewWithNatives(c.diagnosticHandler, c.natives)
+	checker.loader = c.loader
+	checker.optimize = false
+	checker.entryPath = c.entryPath
+	checker.hostGlobals = c.hostGlobals
+	checker.modules = c.modules
+	checker.moduleOrder = c.moduleOrder
+	checker.moduleIndices = c.moduleIndices
+	for _, path := range checker.moduleOrder {
+		if _, err := checker.compileModule(path); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // compileModule compiles a single module using the shared constants table
@@ -56,6 +94,14 @@ func (c *Compiler) compileModule(path string) (objects.CompiledModule, error) {
 
 	c.SetFilePath(path)
 
+	if path == c.entryPath {
+		for _, name := range c.hostGlobals {
+			symbol, _ := c.symbolTable.Define(name, false)
+			c.trackGlobal(symbol.Index)
+		}
+		c.entrySymbols = c.symbolTable
+	}
+
 	// Register imports - we need to know what each imported module exports
 	for _, importStmt := range mod.Imports {
 		importPath, ok := importStmt.Path.Literal.(string)
@@ -63,7 +109,7 @@ func (c *Compiler) compileModule(path string) (objects.CompiledModule, error) {
 			return objects.CompiledModule{}, fmt.Errorf("import path must be a string")
 		}
 
-		targetPath, err := parser.ResolveModulePath(filepath.Dir(path), importPath)
+		targetPath, err := c.loader.ResolveImport(path, importPath)
 		if err != nil {
 			return objects.CompiledModule{}, err
 		}
@@ -115,11 +161,13 @@ func (c *Compiler) compileModule(path string) (objects.CompiledModule, error) {
 	}
 
 	// Add debug info for module-level code
-	debugIdx := c.debugInfo.Add(c.currentLineTable(), path)
+	instructions, lineTable := c.scopeCode()
+	debugIdx := c.debugInfo.Add(lineTable, path)
 
 	return objects.CompiledModule{
-		Instructions: c.currentInstructions(),
+		Instructions: instructions,
 		NumGlobals:   c.maxGlobalIndex + 1,
+		NumLocals:    c.symbolTable.NumLocals(),
 		Exports:      exports,
 		DebugInfoIdx: debugIdx,
 	}, nil
@@ -165,7 +213,7 @@ func (c *Compiler) loadModule(path string, stack []string) error {
 		return fmt.Errorf("circular dependency detected: %v -> %s", stack, path)
 	}
 
-	mod, err := parser.LoadModuleFile(path, c.diagnosticHandler)
+	mod, err := parser.LoadModule(c.loader, path, c.diagnosticHandler)
 	if err != nil {
 		return err
 	}
@@ -180,7 +228,7 @@ func (c *Compiler) loadModule(path string, stack []string) error {
 			return fmt.Errorf("import path must be a string")
 		}
 
-		targetPath, err := parser.ResolveModulePath(filepath.Dir(path), importPath)
+		targetPath, err := c.loader.ResolveImport(path, importPath)
 		if err != nil {
 			return err
 		}
@@ -210,7 +258,7 @@ func (c *Compiler) topologicalSort() ([]string, error) {
 			if !ok {
 				continue
 			}
-			targetPath, err := parser.ResolveModulePath(filepath.Dir(path), importPath)
+			targetPath, err := c.loader.ResolveImport(path, importPath)
 			if err != nil {
 				return nil, err
 			}
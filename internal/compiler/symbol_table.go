@@ -33,6 +33,12 @@ type SymbolTable struct {
 	numDefinitions int
 	functionName   string
 	frameDepth     int // function nesting level (0 = global)
+
+	// Variables declared in blocks of module-level code are locals of the
+	// module's frame rather than globals, so that closures capture each
+	// binding of them as they do in functions. numLocals counts their slots.
+	block     bool
+	numLocals int
 }
 
 func NewSymbolTable() *SymbolTable {
@@ -70,6 +76,8 @@ func NewBlockScope(outer *SymbolTable) *SymbolTable {
 		functionName:   outer.functionName,
 		frameDepth:     outer.frameDepth,     // same frame
 		numDefinitions: outer.numDefinitions, // inherit counter
+		block:          true,
+		numLocals:      outer.numLocals,
 	}
 }
 
@@ -112,14 +120,20 @@ func (s *SymbolTable) Define(name string, isConst bool) (Symbol, bool) {
 		FrameDepth: s.frameDepth,
 	}
 
-	if s.frameDepth == 0 {
-		symbol.Scope = GlobalScope
-	} else {
+	switch {
+	case s.frameDepth > 0:
+		symbol.Scope = LocalScope
+		s.numDefinitions++
+	case s.block:
 		symbol.Scope = LocalScope
+		symbol.Index = s.numLocals
+		s.numLocals++
+	default:
+		symbol.Scope = GlobalScope
+		s.numDefinitions++
 	}
 
 	s.store[name] = symbol
-	s.numDefinitions++
 	return symbol, true
 }
 
@@ -152,11 +166,28 @@ func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
 	return obj, ok
 }
 
+// Globals returns the slot of each global defined in this table, by name.
+func (s *SymbolTable) Globals() map[string]int {
+	globals := make(map[string]int)
+	for name, symbol := range s.store {
+		if symbol.Scope == GlobalScope {
+			globals[name] = symbol.Index
+		}
+	}
+	return globals
+}
+
 // NumDefinitions returns the number of definitions in this scope
 func (s *SymbolTable) NumDefinitions() int {
 	return s.numDefinitions
 }
 
+// NumLocals returns the number of slots the module's frame needs for the
+// variables declared in blocks of module-level code.
+func (s *SymbolTable) NumLocals() int {
+	return s.numLocals
+}
+
 // DefineImport registers an import alias with its module index and exports
 func (s *SymbolTable) DefineImport(alias string, moduleIndex int, exports map[string]int) {
 	s.imports[alias] = &ImportInfo{
@@ -0,0 +1,182 @@
+// Package difftest runs programs on both the interpreter and the VM and
+// reports where they disagree. Both engines must print the same output and
+// stop with the same runtime error, at the same line, for every program,
+// and the VM must do so whether or not the compiler optimizes it.
+package difftest
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/harshagw/viri/internal/compiler"
+	"github.com/harshagw/viri/internal/interp"
+	"github.com/harshagw/viri/internal/objects"
+	"github.com/harshagw/viri/internal/parser"
+	"github.com/harshagw/viri/internal/vm"
+)
+
+// Engine selects how a program runs.
+type Engine string
+
+const (
+	Interpreter   Engine = "interpreter"
+	VM            Engine = "vm"
+	UnoptimizedVM Engine = "vm -O0"
+)
+
+// limits bounds every run, so a program that does not terminate, such as
+// one a shrinking step broke, cannot hang the harness. Programs stopped by
+// them are not compared: the engines count steps differently and may stop
+// at different points.
+var limits = objects.Limits{MaxSteps: 1_000_000, Timeout: 5 * time.Second}
+
+// Outcome is what a program did when it ran.
+type Outcome struct {
+	Stdout  string
+	Error   string // message of the uncaught runtime error, "" if the program finished
+	Line    int    // line of that error
+	Stopped bool   // the run was stopped for exceeding its limits
+}
+
+func (o Outcome) String() string {
+	switch {
+	case o.Stopped:
+		return fmt.Sprintf("%sstopped: %s", o.Stdout, o.Error)
+	case o.Error != "":
+		return fmt.Sprintf("%serror at line %d: %s", o.Stdout, o.Line, o.Error)
+	}
+	return o.Stdout
+}
+
+// Run runs the program at path, reading it and its imports with loader. It
+// returns an error if engine rejects the program before running it. A
+// panic in the engine is reported as the error the program stopped with.
+func Run(engine Engine, loader parser.ModuleLoader, path string) (outcome Outcome, err error) {
+	var stdout bytes.Buffer
+	defer func() {
+		if r := recover(); r != nil {
+			outcome = Outcome{Stdout: stdout.String(), Error: fmt.Sprintf("panic: %v", r)}
+		}
+	}()
+	diagnostics := &objects.DiagnosticCollector{}
+
+	switch engine {
+	case Interpreter:
+		mod, loadErr := parser.LoadModule(loader, path, diagnostics)
+		if loadErr != nil || len(diagnostics.Errors) > 0 {
+			return Outcome{}, compileError(engine, diagnostics, loadErr)
+		}
+		res := parser.NewResolver(diagnostics)
+		res.SetLoader(loader)
+		locals, resolveErr := res.Resolve(mod)
+		if resolveErr != nil || len(diagnostics.Errors) > 0 {
+			return Outcome{}, compileError(engine, diagnostics, resolveErr)
+		}
+
+		interpreter := interp.NewInterpreter(nil, nil)
+		interpreter.SetStdout(&stdout)
+		interpreter.SetLimits(limits)
+		interpreter.SetLoader(loader)
+		interpreter.SetLocals(locals)
+		interpreter.SetResolvedModules(res.GetResolvedModules())
+		interpreter.SetCurrentModule(mod.Path)
+		_, err = interpreter.Interpret(mod.GetAllStatements())
+	case VM, UnoptimizedVM:
+		comp := compiler.New(diagnostics)
+		comp.SetLoader(loader)
+		comp.SetOptimize(engine == VM)
+		program, compileErr := comp.CompileProgram(path)
+		if compileErr != nil || len(diagnostics.Errors) > 0 {
+			return Outcome{}, compileError(engine, diagnostics, compileErr)
+		}
+
+		machine := vm.New(program)
+		machine.SetStdout(&stdout)
+		machine.SetLimits(limits)
+		err = machine.RunProgram()
+	default:
+		return Outcome{}, fmt.Errorf("unknown engine %q", engine)
+	}
+
+	outcome = Outcome{Stdout: stdout.String()}
+	switch err := err.(type) {
+	case nil:
+	case *objects.RuntimeError:
+		outcome.Error = err.Message
+		if err.Token != nil {
+			outcome.Line = err.Token.Line
+		}
+	case *objects.VMRuntimeError:
+		outcome.Error, outcome.Line = err.Message, err.Line
+	default:
+		outcome.Error = err.Error()
+		outcome.Stopped = objects.IsLimitError(err)
+	}
+	return outcome, nil
+}
+
+func compileError(engine Engine, diagnostics *objects.DiagnosticCollector, err error) error {
+	if len(diagnostics.Errors) > 0 {
+		d := diagnostics.Errors[0]
+		return fmt.Errorf("%s rejected the program: line %d: %s", engine, d.Token.Line, d.Message)
+	}
+	return fmt.Errorf("%s rejected the program: %w", engine, err)
+}
+
+// Divergence is a program the engines disagree on.
+type Divergence struct {
+	Interpreter   Outcome
+	VM            Outcome
+	UnoptimizedVM Outcome
+}
+
+func (d *Divergence) String() string {
+	return fmt.Sprintf("interpreter:\n%s\nvm:\n%s\nvm -O0:\n%s", d.Interpreter, d.VM, d.UnoptimizedVM)
+}
+
+// Compare runs the program at path on each engine. It returns the outcomes
+// if they differ and nil if they agree or a limit stopped any run. It
+// returns an error if an engine rejects the program.
+func Compare(loader parser.ModuleLoader, path string) (*Divergence, error) {
+	var outcomes [3]Outcome
+	for n, engine := range []Engine{Interpreter, VM, UnoptimizedVM} {
+		outcome, err := Run(engine, loader, path)
+		if err != nil {
+			return nil, err
+		}
+		if outcome.Stopped {
+			return nil, nil
+		}
+		outcomes[n] = outcome
+	}
+	if outcomes[0] == outcomes[1] && outcomes[1] == outcomes[2] {
+		return nil, nil
+	}
+	return &Divergence{Interpreter: outcomes[0], VM: outcomes[1], UnoptimizedVM: outcomes[2]}, nil
+}
+
+// SourcePath is the path programs given as source are run as.
+const SourcePath = "<source>"
+
+// CompareSource is like Compare for a program given as source, which
+// cannot import other modules.
+func CompareSource(src string) (*Divergence, error) {
+	return Compare(sourceLoader{src: []byte(src)}, SourcePath)
+}
+
+// sourceLoader loads a program given as source.
+type sourceLoader struct {
+	src []byte
+}
+
+func (sourceLoader) ResolveImport(fromPath, importPath string) (string, error) {
+	return "", fmt.Errorf("cannot import '%s' from a program given as source", importPath)
+}
+
+func (l sourceLoader) ReadModule(path string) ([]byte, error) {
+	if path != SourcePath {
+		return nil, fmt.Errorf("no module '%s'", path)
+	}
+	return l.src, nil
+}
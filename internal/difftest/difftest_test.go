@@ -0,0 +1,357 @@
+package difftest
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/harshagw/viri/internal/parser"
+)
+
+func TestTestdata(t *testing.T) {
+	paths, err := filepath.Glob("../../test/testdata/*.viri")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Fatal("no testdata programs found")
+	}
+
+	for _, path := range paths {
+		// Modules are only run through the programs importing them.
+		if strings.HasPrefix(filepath.Base(path), "module_") {
+			continue
+		}
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			d, err := Compare(parser.FileLoader{}, path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d != nil {
+				t.Errorf("engines disagree\n%s", d)
+			}
+		})
+	}
+}
+
+// TestPrograms covers divergences the generator found.
+func TestPrograms(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+	}{
+		{"super through two subclasses", `
+class A { speak() { return "a"; } }
+class B < A { speak() { return "b" + super.speak(); } }
+class C < B { speak() { return "c" + super.speak(); } }
+print C().speak();
+`},
+		{"anonymous function in a variable", `
+var f = fun(n) { if (n > 0) return f(n - 1); return n; };
+print f;
+print f(3);
+`},
+		{"type names in errors", `
+class C {}
+fun f() {}
+try { len(C); } catch (e) { print e.message; }
+try { len(f); } catch (e) { print e.message; }
+try { len(C()); } catch (e) { print e.message; }
+len(C().init);
+`},
+		{"undefined property", `
+class C {}
+try { C().missing; } catch (e) { print e.message; }
+try { nil(); } catch (e) { e.missing; }
+`},
+		{"evaluation order", `
+var log = [];
+fun at(x) { log.push(x); return x; }
+print at(1) - at(2);
+var a = [1, 2];
+a[at(0)] = at(3);
+print log;
+`},
+		{"comparisons", `
+var log = [];
+fun at(x) { log.push(x); return x; }
+print at(1) < at(2);
+print at(2) <= at(1);
+print at(3) >= at(3);
+print log;
+var nan = (-1) ** 0.5;
+print [nan < 1, nan <= 1, nan > 1, nan >= 1, nan <= nan];
+for (var i = 0; i < 3; i = i + 1) { if (i >= 1) print i; }
+`},
+		{"errors in fused instructions", `
+fun f(x) {
+  var y = x
+    + 1;
+  return y;
+}
+print f(1);
+try { f(nil); } catch (e) { print e.message; }
+fun g(n) {
+  while (n
+    < "a") { n = n + 1; }
+}
+try { g(0); } catch (e) { print e.message; }
+f([]);
+`},
+		{"numbers leaving the stack", `
+var n = 0.5 + 0.5;
+fun counter() {
+  var i = n;
+  fun next() { i = i + 1; return i; }
+  return next;
+}
+var next = counter();
+next();
+var a = [n, next(), -n];
+var h = {n: "one", 2: "two"};
+print [a, h[1], h[a[1] - 1], a[n], str(n * 3), "${n / 4}"];
+print [n == 1, 1 == n, n == "1", a[0] == a[2] * -1, !n, !(n - 1)];
+print [a.map(fun(x) { return x * n; }), len(a) + n, n < len(a)];
+`},
+		{"call errors", `
+class A { init(x) {} m() {} }
+class B {}
+fun f(x) {}
+var a = [1, 2];
+try { f(1, 2); } catch (e) { print e.message; }
+try { a.slice(1); } catch (e) { print e.message; }
+try { len(); } catch (e) { print e.message; }
+try { A(); } catch (e) { print e.message; }
+try { A(1).m(2); } catch (e) { print e.message; }
+try { B(1); } catch (e) { print e.message; }
+try { var n = 1; n(); } catch (e) { print e.message; }
+var n = 1;
+class C < n {}
+`},
+		{"iterator protocol errors", `
+class Empty {}
+class Wide { hasNext(x) { return true; } next() { return 1; } }
+class Counter {
+  init() { this.n = 0; }
+  hasNext() { return this.n < 2; }
+  next(step) { this.n = this.n + 1; return this.n; }
+}
+class Maker { iterator(x) { return Counter(); } }
+try { for (var x in Empty()) {} } catch (e) { print e.message; }
+try { for (var x in Wide()) {} } catch (e) { print e.message; }
+try { for (var x in Counter()) {} } catch (e) { print e.message; }
+try { for (var x in Maker()) {} } catch (e) { print e.message; }
+try { for (var k, v in Counter()) {} } catch (e) { print e.message; }
+try { for (var x in 1) {} } catch (e) { print e.message; }
+for (var x in Wide()) {}
+`},
+		{"captured variables as values", `
+fun f() {
+  var v = 1;
+  var inc = fun () { v = v + 1; return v; };
+  inc();
+  fun show(x) { return x; }
+  print [v, show(v), {v: v}];
+  var h = {"v": v};
+  print h["v"] + inc();
+}
+f();
+`},
+		{"captured variables assigned after capture", `
+var x = 1;
+var g = fun () { return x; };
+x = 2;
+print g();
+fun h() {
+  var y = 1;
+  var k = fun () { return y; };
+  y = 2;
+  print k();
+  var n = 0;
+  var count = fun () { return n; };
+  while (n < 3) n = n + 1;
+  print count();
+}
+h();
+fun make() {
+  class C { same() { return C; } }
+  return C().same() == C;
+}
+print make();
+`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := CompareSource(tt.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d != nil {
+				t.Errorf("engines disagree\n%s", d)
+			}
+		})
+	}
+
+	// The compiler rejects variables it cannot resolve, which the
+	// interpreter only looks up when it runs them, so programs it rejects
+	// are compared on the VM with and without optimizing.
+	rejected := []struct {
+		name string
+		src  string
+	}{
+		{"variable in a removed branch", `if (false) { print nope; }`},
+		{"variable in a removed function branch", `fun f() { if (false) { print nope; } } f();`},
+		{"variable after a constant or", `print 1 or undefinedThing;`},
+		{"variable after a constant and", `false and undefinedThing;`},
+		{"break in a removed branch", `if (false) break;`},
+		{"continue in a removed loop", `while (false) {} if (false) { continue; }`},
+	}
+
+	for _, tt := range rejected {
+		t.Run(tt.name, func(t *testing.T) {
+			_, unoptimized := Run(UnoptimizedVM, sourceLoader{src: []byte(tt.src)}, SourcePath)
+			if unoptimized == nil {
+				t.Fatalf("%s accepted the program", UnoptimizedVM)
+			}
+			_, err := Run(VM, sourceLoader{src: []byte(tt.src)}, SourcePath)
+			if err == nil {
+				t.Fatalf("%s accepted the program", VM)
+			}
+			want := strings.Replace(unoptimized.Error(), string(UnoptimizedVM), string(VM), 1)
+			if err.Error() != want {
+				t.Errorf("got %q, want %q", err, want)
+			}
+		})
+	}
+}
+
+// TestLargePrograms covers programs past the limits of narrow operands:
+// more than 256 locals, more than 65,536 constants and more than 64K of
+// code to jump over.
+func TestLargePrograms(t *testing.T) {
+	var locals strings.Builder
+	locals.WriteString("fun f() {\n")
+	for i := 0; i < 300; i++ {
+		fmt.Fprintf(&locals, "  var v%d = %d;\n", i, i)
+	}
+	locals.WriteString(`  v280 = v280 + 1;
+  fun get() { return v280; }
+  for (var i = 0; i < 3; i = i + 1) v290 = v290 + 1;
+  var total = 0;
+  for (var x in [v0, v150, v299]) total = total + x;
+  class C { init() { this.v = v299; } }
+  print [get(), v290, total, C().v];
+  return v298 + nil;
+}
+try { f(); } catch (e) { print e.message; }
+`)
+
+	var constants strings.Builder
+	constants.WriteString("fun run(n) {\n  var s = 0;\n  while (n > 0) {\n    try {\n")
+	for i := 0; i < 70000; i++ {
+		fmt.Fprintf(&constants, "      s = s + %d;\n", i)
+	}
+	constants.WriteString(`      if (n == 1) throw "done";
+    } catch (e) {
+      print e;
+    }
+    n = n - 1;
+  }
+  return s;
+}
+print run(2);
+print run(0) + nil;
+`)
+
+	tests := []struct {
+		name string
+		src  string
+	}{
+		{"locals", locals.String()},
+		{"constants and jumps", constants.String()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := CompareSource(tt.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d != nil {
+				t.Errorf("engines disagree\n%s", d)
+			}
+		})
+	}
+}
+
+func TestGenerated(t *testing.T) {
+	seeds := int64(500)
+	if testing.Short() {
+		seeds = 50
+	}
+
+	for seed := int64(0); seed < seeds; seed++ {
+		src := NewGenerator(seed).Program()
+		d, err := CompareSource(src)
+		if err != nil {
+			t.Fatalf("seed %d: %s\n%s", seed, err, src)
+		}
+		if d == nil {
+			continue
+		}
+		small := Shrink(src, func(src string) bool {
+			d, err := CompareSource(src)
+			return err == nil && d != nil
+		})
+		d, _ = CompareSource(small)
+		t.Errorf("seed %d: engines disagree on\n%s\n%s", seed, small, d)
+	}
+}
+
+func TestGeneratorIsDeterministic(t *testing.T) {
+	if NewGenerator(7).Program() != NewGenerator(7).Program() {
+		t.Error("the same seed wrote different programs")
+	}
+}
+
+func TestShrink(t *testing.T) {
+	src := `
+var a = 1;
+fun f(x) {
+  print x;
+  while (a < 3) {
+    a = a + 1;
+    print [a, "needle" + str(a)];
+  }
+}
+f(a);
+print "done";
+`
+	got := Shrink(src, func(src string) bool {
+		return strings.Contains(src, `"needle"`)
+	})
+	want := "fun f(x) {\n    print \"needle\";\n}\n"
+	if got != want {
+		t.Errorf("Shrink() = %q, want %q", got, want)
+	}
+}
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "main.viri")
+	if err := os.WriteFile(path, []byte("print 1;\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, engine := range []Engine{Interpreter, VM, UnoptimizedVM} {
+		outcome, err := Run(engine, parser.FileLoader{}, path)
+		if err != nil {
+			t.Fatalf("%s: %s", engine, err)
+		}
+		if outcome != (Outcome{Stdout: "1\n"}) {
+			t.Errorf("%s: got %+v", engine, outcome)
+		}
+	}
+}
@@ -0,0 +1,535 @@
+package difftest
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+)
+
+// Generator writes random programs from the grammar of the language. The
+// programs only use the variables, functions and classes they declare, so
+// the resolver and the compiler accept them, and their loops and calls are
+// bounded, so they terminate. The values they compute with are random and
+// often have the wrong type, and calls sometimes pass the wrong number of
+// arguments, which exercises the error paths of the engines as much as the
+// rest.
+//
+// Functions declare functions and closures of their own, which read and
+// assign the variables around them.
+type Generator struct {
+	rand *rand.Rand
+	buf  strings.Builder
+
+	indent  int
+	names   int
+	depth   int      // statements enclosing the current one
+	scopes  []scope  // names in scope, innermost last
+	classes []string // classes declared so far
+
+	inFunction bool
+	nesting    int // functions enclosing the current statement
+	loops      int // loops enclosing the current statement in its function
+}
+
+// scope holds the variables and functions a block declares.
+type scope struct {
+	vars  []variable
+	funcs []function
+}
+
+type variable struct {
+	name  string
+	fixed bool // never assigned: a loop counter, so the loop ends, or a closure, so calls to it stay calls
+}
+
+type function struct {
+	name  string
+	arity int
+}
+
+const (
+	maxDepth     = 3 // nesting of statements and expressions
+	maxBlockSize = 4
+	maxNesting   = 3 // nesting of functions
+)
+
+// NewGenerator returns a generator drawing from the given seed, so each
+// program can be written again from its seed.
+func NewGenerator(seed int64) *Generator {
+	return &Generator{rand: rand.New(rand.NewSource(seed))}
+}
+
+// Program writes a new random program.
+func (g *Generator) Program() string {
+	g.buf.Reset()
+	g.indent, g.names, g.depth, g.nesting = 0, 0, 0, 0
+	g.scopes = []scope{{}}
+	g.classes = nil
+
+	for n := 5 + g.rand.Intn(15); n > 0; n-- {
+		switch g.rand.Intn(8) {
+		case 0:
+			g.function()
+		case 1:
+			g.class()
+		default:
+			g.stmt()
+		}
+	}
+	for _, v := range g.scopes[0].vars {
+		g.line("print %s;", v.name)
+	}
+	return g.buf.String()
+}
+
+func (g *Generator) line(format string, args ...interface{}) {
+	g.buf.WriteString(strings.Repeat("    ", g.indent))
+	fmt.Fprintf(&g.buf, format, args...)
+	g.buf.WriteByte('\n')
+}
+
+func (g *Generator) name(prefix string) string {
+	g.names++
+	return fmt.Sprintf("%s%d", prefix, g.names)
+}
+
+func (g *Generator) declare(name string, fixed bool) {
+	inner := &g.scopes[len(g.scopes)-1]
+	inner.vars = append(inner.vars, variable{name, fixed})
+}
+
+func (g *Generator) declareFunction(name string, arity int) {
+	inner := &g.scopes[len(g.scopes)-1]
+	inner.funcs = append(inner.funcs, function{name, arity})
+}
+
+func (g *Generator) variables(assignable bool) []string {
+	var names []string
+	for _, scope := range g.scopes {
+		for _, v := range scope.vars {
+			if !assignable || !v.fixed {
+				names = append(names, v.name)
+			}
+		}
+	}
+	return names
+}
+
+// functions returns the functions in scope.
+func (g *Generator) functions() []function {
+	var funcs []function
+	for _, scope := range g.scopes {
+		funcs = append(funcs, scope.funcs...)
+	}
+	return funcs
+}
+
+func (g *Generator) pick(options []string) string {
+	return options[g.rand.Intn(len(options))]
+}
+
+// block writes the statements of a block between the braces its caller
+// opened and closes, declaring names in its scope first.
+func (g *Generator) block(body func()) {
+	g.indent++
+	g.depth++
+	g.scopes = append(g.scopes, scope{})
+	body()
+	g.scopes = g.scopes[:len(g.scopes)-1]
+	g.depth--
+	g.indent--
+}
+
+func (g *Generator) stmts() {
+	for n := 1 + g.rand.Intn(maxBlockSize); n > 0; n-- {
+		g.stmt()
+	}
+}
+
+func (g *Generator) stmt() {
+	if g.depth >= maxDepth {
+		g.simpleStmt()
+		return
+	}
+	switch g.rand.Intn(12) {
+	case 0:
+		g.line("if (%s) {", g.expr(2))
+		g.block(g.stmts)
+		if g.rand.Intn(2) == 0 {
+			g.line("} else {")
+			g.block(g.stmts)
+		}
+		g.line("}")
+	case 1:
+		counter := g.name("i")
+		g.line("for (var %s = 0; %s < %d; %s = %s + 1) {", counter, counter, g.rand.Intn(5), counter, counter)
+		g.loop(func() {
+			g.declare(counter, true)
+			g.stmts()
+		})
+	case 2:
+		counter := g.name("w")
+		g.line("var %s = 0;", counter)
+		g.declare(counter, true)
+		g.line("while (%s < %d) {", counter, g.rand.Intn(5))
+		g.loop(func() {
+			g.line("%s = %s + 1;", counter, counter)
+			g.stmts()
+		})
+	case 3:
+		key, value := g.name("k"), g.name("x")
+		if g.rand.Intn(2) == 0 {
+			g.line("for (var %s in %s) {", value, g.iterable())
+			g.loop(func() {
+				g.declare(value, true)
+				g.stmts()
+			})
+		} else {
+			g.line("for (var %s, %s in %s) {", key, value, g.iterable())
+			g.loop(func() {
+				g.declare(key, true)
+				g.declare(value, true)
+				g.stmts()
+			})
+		}
+	case 4:
+		g.line("try {")
+		g.block(g.stmts)
+		caught := g.name("e")
+		g.line("} catch (%s) {", caught)
+		g.block(func() {
+			g.declare(caught, false)
+			g.line("print %s;", caught)
+			if g.rand.Intn(2) == 0 {
+				g.stmts()
+			}
+		})
+		if g.rand.Intn(3) == 0 {
+			g.line("} finally {")
+			g.block(g.stmts)
+		}
+		g.line("}")
+	case 5:
+		g.line("{")
+		g.block(g.stmts)
+		g.line("}")
+	case 6:
+		if g.inFunction && g.nesting < maxNesting {
+			g.closure()
+			return
+		}
+		g.simpleStmt()
+	default:
+		g.simpleStmt()
+	}
+}
+
+// loop writes the body of a loop, whose header its caller wrote.
+func (g *Generator) loop(body func()) {
+	g.loops++
+	g.block(body)
+	g.loops--
+	g.line("}")
+}
+
+func (g *Generator) simpleStmt() {
+	switch g.rand.Intn(12) {
+	case 0, 1:
+		name := g.name("v")
+		g.line("var %s = %s;", name, g.expr(maxDepth))
+		g.declare(name, false)
+	case 2:
+		if names := g.variables(true); len(names) > 0 {
+			g.line("%s = %s;", g.pick(names), g.expr(maxDepth))
+			return
+		}
+		g.line("print %s;", g.expr(maxDepth))
+	case 3:
+		g.line("%s[%s] = %s;", g.receiver(), g.expr(1), g.expr(2))
+	case 4:
+		// Parenthesized so a hash literal is not read as a block
+		g.line("(%s);", g.expr(maxDepth))
+	case 5:
+		if g.rand.Intn(3) == 0 {
+			g.line("throw %s;", g.expr(1))
+			return
+		}
+		if g.inFunction {
+			g.line("return %s;", g.expr(2))
+			return
+		}
+		g.line("print %s;", g.expr(maxDepth))
+	case 6:
+		if g.loops > 0 {
+			g.line("if (%s) %s;", g.expr(1), g.pick([]string{"break", "continue"}))
+			return
+		}
+		g.line("print %s;", g.expr(maxDepth))
+	default:
+		g.line("print %s;", g.expr(maxDepth))
+	}
+}
+
+func (g *Generator) function() {
+	name := g.name("f")
+	params := g.params()
+	g.line("fun %s(%s) {", name, strings.Join(params, ", "))
+	g.functionBody(params, "")
+	g.line("}")
+	g.declareFunction(name, len(params))
+}
+
+// closure writes a function declared in the current one, named or assigned
+// to a variable, which can be called for as long as it is in scope. Half
+// of them start by assigning a variable from outside, which they then
+// share with the function declaring it, and half are called right away.
+func (g *Generator) closure() {
+	params := g.params()
+	first := ""
+	if names := g.variables(true); len(names) > 0 && g.rand.Intn(2) == 0 {
+		name := g.pick(names)
+		first = fmt.Sprintf("%s = [%s];", name, name)
+	}
+
+	var name string
+	if g.rand.Intn(2) == 0 {
+		name = g.name("f")
+		g.line("fun %s(%s) {", name, strings.Join(params, ", "))
+		g.functionBody(params, first)
+		g.line("}")
+	} else {
+		name = g.name("c")
+		g.line("var %s = fun (%s) {", name, strings.Join(params, ", "))
+		g.functionBody(params, first)
+		g.line("};")
+		g.declare(name, true)
+	}
+	g.declareFunction(name, len(params))
+
+	if g.rand.Intn(2) == 0 {
+		g.line("print %s(%s);", name, g.args(g.arity(len(params)), 1))
+	}
+}
+
+func (g *Generator) params() []string {
+	params := make([]string, g.rand.Intn(3))
+	for i := range params {
+		params[i] = g.name("p")
+	}
+	return params
+}
+
+// functionBody writes the body of a function, whose header its caller
+// wrote and whose closing brace it writes, starting with the statement
+// first unless it is empty.
+func (g *Generator) functionBody(params []string, first string) {
+	inFunction, loops, depth := g.inFunction, g.loops, g.depth
+	g.inFunction, g.loops, g.depth = true, 0, 0
+	g.nesting++
+	g.block(func() {
+		for _, param := range params {
+			g.declare(param, false)
+		}
+		if first != "" {
+			g.line("%s", first)
+		}
+		g.stmts()
+		g.line("return %s;", g.expr(2))
+	})
+	g.nesting--
+	g.inFunction, g.loops, g.depth = inFunction, loops, depth
+}
+
+func (g *Generator) class() {
+	name := g.name("C")
+	superclass := ""
+	if len(g.classes) > 0 && g.rand.Intn(2) == 0 {
+		superclass = g.pick(g.classes)
+		g.line("class %s < %s {", name, superclass)
+	} else {
+		g.line("class %s {", name)
+	}
+	g.indent++
+
+	field := g.name("p")
+	g.line("init(%s) {", field)
+	g.indent++
+	if superclass != "" {
+		g.line("super.init(%s);", field)
+	}
+	g.line("this.value = %s;", field)
+	g.indent--
+	g.line("}")
+
+	param := g.name("p")
+	g.line("method(%s) {", param)
+	inFunction, loops, depth := g.inFunction, g.loops, g.depth
+	g.inFunction, g.loops, g.depth = true, 0, 0
+	g.nesting++
+	g.block(func() {
+		g.declare(param, false)
+		g.declare("this.value", true)
+		if superclass != "" {
+			g.declare("super.method(0)", true)
+		}
+		g.stmts()
+		g.line("return %s;", g.expr(2))
+	})
+	g.nesting--
+	g.inFunction, g.loops, g.depth = inFunction, loops, depth
+	g.line("}")
+
+	g.indent--
+	g.line("}")
+	g.classes = append(g.classes, name)
+}
+
+func (g *Generator) iterable() string {
+	switch g.rand.Intn(4) {
+	case 0:
+		return g.hash(1)
+	case 1:
+		return g.operand()
+	default:
+		return g.array(1)
+	}
+}
+
+// operand returns a variable if there is one, and a literal otherwise.
+func (g *Generator) operand() string {
+	if names := g.variables(false); len(names) > 0 && g.rand.Intn(4) > 0 {
+		return g.pick(names)
+	}
+	return g.literal()
+}
+
+// receiver returns an operand to index or call a method on, with literals
+// parenthesized so they are read whole.
+func (g *Generator) receiver() string {
+	if names := g.variables(false); len(names) > 0 && g.rand.Intn(4) > 0 {
+		return g.pick(names)
+	}
+	return "(" + g.literal() + ")"
+}
+
+var (
+	numbers = []string{"0", "1", "2", "3", "-1", "0.5", "2.5", "10", "100"}
+	strs    = []string{`""`, `"a"`, `"ab"`, `"héllo"`, `"x y"`, `"1"`, `"a,b"`}
+	others  = []string{"true", "false", "nil"}
+
+	binaryOperators = []string{"+", "+", "-", "*", "/", "%", "~/", "**", ">", ">=", "<", "<=", "==", "!="}
+	methods         = []string{
+		"push(%s)", "pop()", "slice(0, %s)", "sort()", "reduce(fun (a, b) { return a + b; }, %s)",
+		"map(fun (x) { return x + %s; })", "filter(fun (x) { return x != %s; })",
+		"upper()", "split(%s)", "contains(%s)", "indexOf(%s)", "repeat(2)", "chars()",
+		"keys()", "values()", "has(%s)", "get(%s, 0)",
+	}
+)
+
+func (g *Generator) literal() string {
+	switch g.rand.Intn(5) {
+	case 0, 1:
+		return g.pick(numbers)
+	case 2, 3:
+		return g.pick(strs)
+	default:
+		return g.pick(others)
+	}
+}
+
+func (g *Generator) expr(depth int) string {
+	if depth <= 0 {
+		return g.operand()
+	}
+	switch g.rand.Intn(20) {
+	case 0, 1, 2:
+		return g.operand()
+	case 3, 4, 5:
+		return fmt.Sprintf("%s %s %s", g.expr(depth-1), g.pick(binaryOperators), g.expr(depth-1))
+	case 6:
+		return fmt.Sprintf("(%s %s %s)", g.expr(depth-1), g.pick([]string{"and", "or"}), g.expr(depth-1))
+	case 7:
+		return fmt.Sprintf("%s(%s)", g.pick([]string{"-", "!"}), g.expr(depth-1))
+	case 8:
+		return g.array(depth - 1)
+	case 9:
+		return g.hash(depth - 1)
+	case 10:
+		return fmt.Sprintf("%s[%s]", g.receiver(), g.expr(depth-1))
+	case 11:
+		return fmt.Sprintf("%s[%s:%s]", g.receiver(), g.pick(numbers), g.pick(append(numbers, "")))
+	case 12:
+		return fmt.Sprintf("%s(%s)", g.pick([]string{"len", "str", "num"}), g.expr(depth-1))
+	case 13:
+		method := g.pick(methods)
+		if strings.Contains(method, "%s") {
+			method = fmt.Sprintf(method, g.expr(depth-1))
+		}
+		return fmt.Sprintf("%s.%s", g.receiver(), method)
+	case 14:
+		return fmt.Sprintf(`"<${%s}>"`, g.operand())
+	case 15, 16:
+		if funcs := g.functions(); len(funcs) > 0 {
+			f := funcs[g.rand.Intn(len(funcs))]
+			return fmt.Sprintf("%s(%s)", f.name, g.args(g.arity(f.arity), depth-1))
+		}
+	case 17, 18:
+		if len(g.classes) > 0 {
+			instance := fmt.Sprintf("%s(%s)", g.pick(g.classes), g.args(g.arity(1), depth-1))
+			if g.rand.Intn(2) == 0 {
+				return instance + ".value"
+			}
+			return fmt.Sprintf("%s.method(%s)", instance, g.args(g.arity(1), depth-1))
+		}
+	case 19:
+		// Functions, classes and methods as values
+		var values []string
+		for _, f := range g.functions() {
+			values = append(values, f.name)
+		}
+		for _, class := range g.classes {
+			values = append(values, class, class+"(0)", class+"(0).method")
+		}
+		values = append(values, "fun (x) { return x; }", "len", "[].push")
+		return g.pick(values)
+	}
+	return fmt.Sprintf("(%s)", g.expr(depth-1))
+}
+
+// arity returns the number of arguments to call a function taking n with:
+// n, and now and then one more or one fewer.
+func (g *Generator) arity(n int) int {
+	switch g.rand.Intn(20) {
+	case 0:
+		return n + 1
+	case 1:
+		if n > 0 {
+			return n - 1
+		}
+	}
+	return n
+}
+
+func (g *Generator) args(n, depth int) string {
+	args := make([]string, n)
+	for i := range args {
+		args[i] = g.expr(depth)
+	}
+	return strings.Join(args, ", ")
+}
+
+func (g *Generator) array(depth int) string {
+	return "[" + g.args(g.rand.Intn(4), depth) + "]"
+}
+
+func (g *Generator) hash(depth int) string {
+	pairs := make([]string, g.rand.Intn(4))
+	for i := range pairs {
+		key := g.pick(strs)
+		if g.rand.Intn(3) == 0 {
+			key = g.pick(numbers)
+		}
+		pairs[i] = key + ": " + g.expr(depth)
+	}
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
@@ -0,0 +1,279 @@
+package difftest
+
+import (
+	"bytes"
+
+	"github.com/harshagw/viri/internal/ast"
+	"github.com/harshagw/viri/internal/format"
+	"github.com/harshagw/viri/internal/objects"
+	"github.com/harshagw/viri/internal/parser"
+	"github.com/harshagw/viri/internal/scanner"
+)
+
+// Shrink returns the smallest program it finds on which fails holds, given
+// a program src on which it does. It repeatedly removes statements and
+// replaces statements and expressions with their parts, keeping each change
+// that leaves fails true, until no change does.
+func Shrink(src string, fails func(string) bool) string {
+	if formatted := printModule(parse(src)); formatted != "" && fails(formatted) {
+		src = formatted
+	}
+	for {
+		smaller, ok := shrinkOnce(src, fails)
+		if !ok {
+			return src
+		}
+		src = smaller
+	}
+}
+
+// shrinkOnce returns the first edit of src that is shorter and still fails.
+// Each edit is applied to a fresh parse, as edits change the tree in place.
+func shrinkOnce(src string, fails func(string) bool) (string, bool) {
+	for i := 0; ; i++ {
+		mod := parse(src)
+		if mod == nil {
+			return "", false
+		}
+		edits := collectEdits(mod)
+		if i >= len(edits) {
+			return "", false
+		}
+		edits[i]()
+		if candidate := printModule(mod); len(candidate) < len(src) && fails(candidate) {
+			return candidate, true
+		}
+	}
+}
+
+func parse(src string) *ast.Module {
+	sc := scanner.New(bytes.NewBufferString(src), nil)
+	tokens, err := sc.Scan()
+	if err != nil {
+		return nil
+	}
+	diagnostics := &objects.DiagnosticCollector{}
+	mod, err := parser.ParseModule(tokens, SourcePath, diagnostics)
+	if err != nil || len(diagnostics.Errors) > 0 {
+		return nil
+	}
+	return mod
+}
+
+func printModule(mod *ast.Module) string {
+	if mod == nil {
+		return ""
+	}
+	return string(format.Module(mod, nil))
+}
+
+// collectEdits returns the edits that shrink mod, largest first: removing
+// whole statements, then replacing statements with the statements they
+// hold, then replacing expressions with their operands.
+func collectEdits(mod *ast.Module) []func() {
+	var lists []*[]ast.Stmt
+	var slots []*ast.Expr
+	lists = append(lists, &mod.Statements)
+	for _, stmt := range mod.Statements {
+		collect(stmt, &lists, &slots)
+	}
+
+	var edits []func()
+	for _, list := range lists {
+		for j := range *list {
+			list, j := list, j
+			edits = append(edits, func() { *list = splice(*list, j, nil) })
+		}
+	}
+	for _, list := range lists {
+		for j, stmt := range *list {
+			for _, inner := range innerStatements(stmt) {
+				list, j, inner := list, j, inner
+				edits = append(edits, func() { *list = splice(*list, j, inner) })
+			}
+		}
+	}
+	for _, slot := range slots {
+		for _, operand := range exprFields(*slot) {
+			slot, operand := slot, *operand
+			edits = append(edits, func() { *slot = operand })
+		}
+	}
+	return edits
+}
+
+// splice returns list with its jth statement replaced by stmts.
+func splice(list []ast.Stmt, j int, stmts []ast.Stmt) []ast.Stmt {
+	result := make([]ast.Stmt, 0, len(list)-1+len(stmts))
+	result = append(result, list[:j]...)
+	result = append(result, stmts...)
+	return append(result, list[j+1:]...)
+}
+
+// innerStatements returns the statement lists stmt could be replaced with.
+func innerStatements(stmt ast.Stmt) [][]ast.Stmt {
+	var inner [][]ast.Stmt
+	add := func(s ast.Stmt) {
+		if block, ok := s.(*ast.BlockStmt); ok {
+			inner = append(inner, block.Statements)
+		} else if s != nil {
+			inner = append(inner, []ast.Stmt{s})
+		}
+	}
+	switch s := stmt.(type) {
+	case *ast.BlockStmt:
+		add(s)
+	case *ast.IfStmt:
+		add(s.ThenBranch)
+		add(s.ElseBranch)
+	case *ast.WhileStmt:
+		add(s.Body)
+	case *ast.ForStmt:
+		add(s.Body)
+	case *ast.ForInStmt:
+		add(s.Body)
+	case *ast.TryStmt:
+		add(s.Body)
+		if s.CatchBody != nil {
+			add(s.CatchBody)
+		}
+		if s.FinallyBody != nil {
+			add(s.FinallyBody)
+		}
+	}
+	return inner
+}
+
+// collect gathers the statement lists and expression slots under node.
+func collect(node ast.Node, lists *[]*[]ast.Stmt, slots *[]*ast.Expr) {
+	if block, ok := node.(*ast.BlockStmt); ok && block != nil {
+		*lists = append(*lists, &block.Statements)
+	}
+	for _, slot := range exprFields(node) {
+		*slots = append(*slots, slot)
+		collect(*slot, lists, slots)
+	}
+	for _, stmt := range childStatements(node) {
+		collect(stmt, lists, slots)
+	}
+}
+
+// childStatements returns the statements directly under node.
+func childStatements(node ast.Node) []ast.Stmt {
+	var stmts []ast.Stmt
+	add := func(s ast.Stmt) {
+		if s != nil {
+			stmts = append(stmts, s)
+		}
+	}
+	switch n := node.(type) {
+	case *ast.BlockStmt:
+		stmts = append(stmts, n.Statements...)
+	case *ast.IfStmt:
+		add(n.ThenBranch)
+		add(n.ElseBranch)
+	case *ast.WhileStmt:
+		add(n.Body)
+	case *ast.ForStmt:
+		add(n.Initializer)
+		add(n.Body)
+	case *ast.ForInStmt:
+		add(n.Body)
+	case *ast.FunctionStmt:
+		add(n.Body)
+	case *ast.ClassStmt:
+		for _, method := range n.Methods {
+			add(method)
+		}
+	case *ast.TryStmt:
+		add(n.Body)
+		if n.CatchBody != nil {
+			add(n.CatchBody)
+		}
+		if n.FinallyBody != nil {
+			add(n.FinallyBody)
+		}
+	case *ast.FunctionExpr:
+		add(n.Body)
+	}
+	return stmts
+}
+
+// exprFields returns the expressions directly under node, as the fields
+// holding them so they can be replaced.
+func exprFields(node ast.Node) []*ast.Expr {
+	var fields []*ast.Expr
+	add := func(e *ast.Expr) {
+		if *e != nil {
+			fields = append(fields, e)
+		}
+	}
+	switch n := node.(type) {
+	case *ast.ExprStmt:
+		add(&n.Expr)
+	case *ast.PrintStmt:
+		add(&n.Expr)
+	case *ast.VarDeclStmt:
+		add(&n.Initializer)
+	case *ast.IfStmt:
+		add(&n.Condition)
+	case *ast.WhileStmt:
+		add(&n.Condition)
+	case *ast.ForStmt:
+		add(&n.Condition)
+		add(&n.Increment)
+	case *ast.ForInStmt:
+		add(&n.Iterable)
+	case *ast.ReturnStmt:
+		add(&n.Value)
+	case *ast.ThrowStmt:
+		add(&n.Value)
+	case *ast.BinaryExpr:
+		add(&n.Left)
+		add(&n.Right)
+	case *ast.LogicalExpr:
+		add(&n.Left)
+		add(&n.Right)
+	case *ast.GroupingExpr:
+		add(&n.Expr)
+	case *ast.UnaryExpr:
+		add(&n.Expr)
+	case *ast.AssignExpr:
+		add(&n.Value)
+	case *ast.CallExpr:
+		add(&n.Callee)
+		for i := range n.Arguments {
+			add(&n.Arguments[i])
+		}
+	case *ast.GetExpr:
+		add(&n.Object)
+	case *ast.SetExpr:
+		add(&n.Object)
+		add(&n.Value)
+	case *ast.ArrayLiteralExpr:
+		for i := range n.Elements {
+			add(&n.Elements[i])
+		}
+	case *ast.HashLiteralExpr:
+		for i := range n.Pairs {
+			add(&n.Pairs[i].Key)
+			add(&n.Pairs[i].Value)
+		}
+	case *ast.IndexExpr:
+		add(&n.Object)
+		add(&n.Index)
+	case *ast.SliceExpr:
+		add(&n.Object)
+		add(&n.Start)
+		add(&n.End)
+	case *ast.SetIndexExpr:
+		add(&n.Object)
+		add(&n.Index)
+		add(&n.Value)
+	case *ast.InterpolationExpr:
+		for i := range n.Parts {
+			add(&n.Parts[i])
+		}
+	}
+	return fields
+}
@@ -2,10 +2,13 @@ package internal
 
 import (
 	"fmt"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/fatih/color"
 	"github.com/harshagw/viri/internal/ast"
+	"github.com/harshagw/viri/internal/bytecode"
 	"github.com/harshagw/viri/internal/compiler"
 	"github.com/harshagw/viri/internal/interp"
 	"github.com/harshagw/viri/internal/objects"
@@ -14,16 +17,21 @@ import (
 	"github.com/harshagw/viri/internal/vm"
 )
 
+// BytecodeExtension is the file extension of programs saved by Build.
+const BytecodeExtension = ".viric"
+
 type ViriRuntimeConfig struct {
 	DebugMode      bool
 	StatsMode      bool
 	DisableWarning bool
 	Engine         string // "interpreter" or "vm"
+	NoOptimize     bool   // compile without the optimization pass
 }
 
 type Viri struct {
 	hasErrors bool
 	config    *ViriRuntimeConfig
+	sources   map[string]string // file path -> contents, read for error snippets
 }
 
 var _ objects.DiagnosticHandler = (*Viri)(nil)
@@ -39,6 +47,7 @@ func NewViriRuntime(config *ViriRuntimeConfig) *Viri {
 	return &Viri{
 		hasErrors: false,
 		config:    config,
+		sources:   make(map[string]string),
 	}
 }
 
@@ -52,6 +61,7 @@ func (v *Viri) Error(tok token.Token, message string) {
 	} else {
 		color.New(color.FgRed).Fprintf(color.Error, "Error at line %d: %s\n", tok.Line, message)
 	}
+	v.printTokenSnippet(tok)
 	v.hasErrors = true
 }
 
@@ -64,9 +74,38 @@ func (v *Viri) Warn(tok token.Token, message string) {
 	} else {
 		color.New(color.FgYellow).Fprintf(color.Error, "Warning at line %d: %s\n", tok.Line, message)
 	}
+	v.printTokenSnippet(tok)
+}
+
+// source returns the contents of filePath, or "" if it cannot be read.
+func (v *Viri) source(filePath string) string {
+	if src, ok := v.sources[filePath]; ok {
+		return src
+	}
+	data, _ := os.ReadFile(filePath)
+	v.sources[filePath] = string(data)
+	return v.sources[filePath]
 }
 
-func printRuntimeError(filePath string, line int, message string) {
+// printTokenSnippet prints the source line holding tok with tok underlined.
+func (v *Viri) printTokenSnippet(tok token.Token) {
+	if tok.FilePath == nil {
+		return
+	}
+	fmt.Fprint(color.Error, objects.TokenSnippet(v.source(*tok.FilePath), tok))
+}
+
+// printRuntimeError reports an uncaught runtime error, preceded by its stack
+// trace with the most recent call last and followed by the offending line.
+func (v *Viri) printRuntimeError(filePath string, line, column int, message string, trace []objects.StackFrame) {
+	if len(trace) > 0 {
+		red := color.New(color.FgRed)
+		red.Fprintln(color.Error, "Traceback (most recent call last):")
+		for _, frame := range trace {
+			red.Fprintf(color.Error, "  File \"%s\", line %d, in %s\n", frame.FilePath, frame.Line, frame.Function)
+		}
+	}
+
 	if filePath != "" && line > 0 {
 		color.New(color.FgRed).Fprintf(color.Error, "Runtime error in %s at line %d: %s\n", filePath, line, message)
 	} else if line > 0 {
@@ -74,31 +113,89 @@ func printRuntimeError(filePath string, line int, message string) {
 	} else {
 		color.New(color.FgRed).Fprintln(color.Error, "Runtime error:", message)
 	}
+
+	if filePath != "" {
+		fmt.Fprint(color.Error, objects.Snippet(v.source(filePath), line, column, 1))
+	}
 }
 
 func (v *Viri) Run(filePath string) {
-	if v.config.Engine == "vm" {
+	if strings.HasSuffix(filePath, BytecodeExtension) {
+		v.runBytecode(filePath)
+	} else if v.config.Engine == "vm" {
 		v.runWithVM(filePath)
 	} else {
 		v.runWithInterpreter(filePath)
 	}
 }
 
-func (v *Viri) runWithVM(filePath string) {
+// Build compiles the program at filePath and saves its bytecode to outPath,
+// to be run later without recompiling.
+func (v *Viri) Build(filePath, outPath string) {
+	program := v.compile(filePath)
+	if program == nil {
+		return
+	}
+
+	data, err := bytecode.Marshal(program)
+	if err == nil {
+		err = os.WriteFile(outPath, data, 0o644)
+	}
+	if err != nil {
+		color.New(color.FgRed).Fprintln(color.Error, "Build error:", err)
+		v.hasErrors = true
+	}
+}
+
+// compile compiles the program at filePath, returning nil after reporting
+// any errors.
+func (v *Viri) compile(filePath string) *objects.CompiledProgram {
 	comp := compiler.New(v)
+	comp.SetOptimize(!v.config.NoOptimize)
 	program, err := comp.CompileProgram(filePath)
 	if err != nil {
 		if !v.hasErrors {
 			color.New(color.FgRed).Fprintln(color.Error, "Compilation error:", err)
 		}
 		v.hasErrors = true
-		return
+		return nil
 	}
 
 	if v.hasErrors {
+		return nil
+	}
+	return program
+}
+
+func (v *Viri) runWithVM(filePath string) {
+	if program := v.compile(filePath); program != nil {
+		v.execute(program)
+	}
+}
+
+// runBytecode runs a program saved by Build.
+func (v *Viri) runBytecode(filePath string) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		color.New(color.FgRed).Fprintln(color.Error, "Error:", err)
+		v.hasErrors = true
+		return
+	}
+
+	program, err := bytecode.Unmarshal(data)
+	if err == nil {
+		err = bytecode.Link(program, nil)
+	}
+	if err != nil {
+		color.New(color.FgRed).Fprintf(color.Error, "Error loading %s: %v\n", filePath, err)
+		v.hasErrors = true
 		return
 	}
+	v.execute(program)
+}
 
+// execute runs a compiled program on the VM.
+func (v *Viri) execute(program *objects.CompiledProgram) {
 	if v.config.DebugMode {
 		for i, compiledMod := range program.Modules {
 			fmt.Printf("Module %d:\n", i)
@@ -110,9 +207,9 @@ func (v *Viri) runWithVM(filePath string) {
 	machine := vm.New(program)
 	if err := machine.RunProgram(); err != nil {
 		if vmErr, ok := err.(*objects.VMRuntimeError); ok {
-			printRuntimeError(vmErr.FilePath, vmErr.Line, vmErr.Message)
+			v.printRuntimeError(vmErr.FilePath, vmErr.Line, vmErr.Column, vmErr.Message, vmErr.Trace)
 		} else {
-			printRuntimeError("", 0, err.Error())
+			v.printRuntimeError("", 0, 0, err.Error(), nil)
 		}
 		v.hasErrors = true
 		return
@@ -121,6 +218,7 @@ func (v *Viri) runWithVM(filePath string) {
 	elapsed := time.Since(startTime)
 	if v.config.StatsMode {
 		fmt.Printf("Time taken: %s\n", elapsed)
+		printMemoryStats(machine.MemoryStats())
 	}
 }
 
@@ -149,7 +247,7 @@ func (v *Viri) runWithInterpreter(filePath string) {
 		return
 	}
 
-	interpreter := interp.NewInterpreter(nil)
+	interpreter := interp.NewInterpreter(nil, nil)
 	interpreter.SetLocals(locals)
 	interpreter.SetResolvedModules(res.GetResolvedModules())
 	interpreter.SetCurrentModule(mod.Path)
@@ -158,16 +256,16 @@ func (v *Viri) runWithInterpreter(filePath string) {
 	if _, err := interpreter.Interpret(mod.GetAllStatements()); err != nil {
 		if runtimeErr, ok := err.(*objects.RuntimeError); ok {
 			filePath := ""
-			line := 0
+			line, column := 0, 0
 			if runtimeErr.Token != nil {
-				line = runtimeErr.Token.Line
+				line, column = runtimeErr.Token.Line, runtimeErr.Token.Column
 				if runtimeErr.Token.FilePath != nil {
 					filePath = *runtimeErr.Token.FilePath
 				}
 			}
-			printRuntimeError(filePath, line, runtimeErr.Message)
+			v.printRuntimeError(filePath, line, column, runtimeErr.Message, runtimeErr.Trace)
 		} else {
-			printRuntimeError("", 0, err.Error())
+			v.printRuntimeError("", 0, 0, err.Error(), nil)
 		}
 		v.hasErrors = true
 		return
@@ -175,5 +273,11 @@ func (v *Viri) runWithInterpreter(filePath string) {
 	elapsed := time.Since(startTime)
 	if v.config.StatsMode {
 		fmt.Printf("Time taken: %s\n", elapsed)
+		printMemoryStats(interpreter.MemoryStats())
 	}
 }
+
+// printMemoryStats prints the allocations of a run for --stats.
+func printMemoryStats(stats objects.MemoryStats) {
+	fmt.Printf("Allocated: %d bytes in %d allocations\n", stats.Bytes, stats.Allocations)
+}
@@ -0,0 +1,382 @@
+// Package format pretty-prints Viri source in its canonical style: four
+// space indentation, braces on the same line, one statement per line and at
+// most one blank line between statements. Comments are preserved, and those
+// at the end of a line stay there.
+package format
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/harshagw/viri/internal/ast"
+	"github.com/harshagw/viri/internal/objects"
+	"github.com/harshagw/viri/internal/parser"
+	"github.com/harshagw/viri/internal/scanner"
+	"github.com/harshagw/viri/internal/token"
+)
+
+const indentation = "    "
+
+// Source formats a Viri source file. Syntax errors are reported to
+// diagnosticHandler and the source is returned unformatted with an error.
+func Source(src []byte, path string, diagnosticHandler objects.DiagnosticHandler) ([]byte, error) {
+	var filePathPtr *string
+	if path != "" {
+		filePathPtr = &path
+	}
+
+	sc := scanner.New(bytes.NewBuffer(src), filePathPtr)
+	tokens, err := sc.Scan()
+	if err != nil {
+		line, _ := sc.Position()
+		return src, fmt.Errorf("failed to scan '%s' at line %d: %w", path, line, err)
+	}
+
+	mod, err := parser.ParseModule(tokens, path, diagnosticHandler)
+	if err != nil {
+		return src, err
+	}
+	return Module(mod, sc.Comments()), nil
+}
+
+// Module prints mod as canonical source, placing comments, as returned by
+// the scanner, back between the statements they were found around.
+func Module(mod *ast.Module, comments []token.Token) []byte {
+	p := &printer{comments: comments, used: make([]bool, len(comments)), end: -1}
+	for _, stmt := range mod.GetAllStatements() {
+		p.statement(stmt, func() { p.stmt(stmt) })
+	}
+	p.flushComments(-1)
+	return []byte(p.buf.String())
+}
+
+type printer struct {
+	buf    strings.Builder
+	indent int
+
+	comments []token.Token
+	used     []bool
+
+	// lastLine is the source line the last printed statement or comment
+	// ended on, used to keep blank lines. It is 0 at the start of a block,
+	// where blank lines are dropped.
+	lastLine int
+
+	// end is the offset of the closing brace of the block being printed, or
+	// -1 outside blocks. Comments after it do not end its statements' lines.
+	end int
+}
+
+func (p *printer) write(s string) {
+	p.buf.WriteString(s)
+}
+
+func (p *printer) newline() {
+	p.buf.WriteByte('\n')
+}
+
+func (p *printer) writeIndent() {
+	p.write(strings.Repeat(indentation, p.indent))
+}
+
+// separate writes a blank line if the source had one before line.
+func (p *printer) separate(line int) {
+	if p.lastLine > 0 && line > p.lastLine+1 {
+		p.newline()
+	}
+}
+
+// statement prints a statement, or a class method, on its own lines. Its
+// comments that are not inside one of its blocks, or at the end of a line it
+// is broken into, cannot be kept in place on a single line, so they are
+// moved above it, except for a comment at the end of its last line which
+// stays there.
+func (p *printer) statement(node ast.Node, print func()) {
+	first, last := span(node)
+	if first == nil {
+		p.writeIndent()
+		print()
+		p.newline()
+		return
+	}
+
+	start := startLine(first)
+	kept := append(blockRanges(node), lineRanges(node)...)
+	for i, comment := range p.comments {
+		if p.used[i] || comment.Offset > last.Offset || inRanges(comment.Offset, kept) {
+			continue
+		}
+		if comment.Offset < first.Offset {
+			p.comment(i, comment.Line)
+		} else {
+			p.comment(i, start)
+		}
+	}
+
+	p.separate(start)
+	p.writeIndent()
+	print()
+	p.lastLine = last.Line
+	p.trailing(last.Line, p.end)
+	p.newline()
+}
+
+// comment prints the ith comment on its own line, as if it were found on
+// line.
+func (p *printer) comment(i, line int) {
+	p.separate(line)
+	p.writeIndent()
+	p.write(p.comments[i].Lexeme)
+	p.newline()
+	p.lastLine = line
+	p.used[i] = true
+}
+
+// trailing prints the next comment at the end of the current line if it was
+// found at the end of line, before offset unless offset is negative.
+func (p *printer) trailing(line, offset int) {
+	i := p.nextComment()
+	if i < 0 || p.comments[i].Line != line || (offset >= 0 && p.comments[i].Offset >= offset) {
+		return
+	}
+	p.write(" " + p.comments[i].Lexeme)
+	p.used[i] = true
+}
+
+// lineBreak ends the current line, which ended on line in the source,
+// keeping the comments before offset: one at the end of line stays there
+// and the others go on lines of their own.
+func (p *printer) lineBreak(line, offset int) {
+	p.trailing(line, offset)
+	p.newline()
+	for i := p.nextComment(); i >= 0 && p.comments[i].Offset < offset; i = p.nextComment() {
+		p.writeIndent()
+		p.write(p.comments[i].Lexeme)
+		p.newline()
+		p.used[i] = true
+	}
+}
+
+// nextComment returns the index of the first comment not yet printed, or -1.
+func (p *printer) nextComment() int {
+	for i := range p.comments {
+		if !p.used[i] {
+			return i
+		}
+	}
+	return -1
+}
+
+// flushComments prints the remaining comments before offset, or all of them
+// when offset is negative.
+func (p *printer) flushComments(offset int) {
+	for i := p.nextComment(); i >= 0; i = p.nextComment() {
+		if offset >= 0 && p.comments[i].Offset >= offset {
+			return
+		}
+		p.comment(i, p.comments[i].Line)
+	}
+}
+
+// hasCommentsBefore reports whether a comment before offset is left to print.
+func (p *printer) hasCommentsBefore(offset int) bool {
+	i := p.nextComment()
+	return i >= 0 && p.comments[i].Offset < offset
+}
+
+// body prints the members of a block or class body, then the comments left
+// before its closing brace. A comment after the opening brace stays on its
+// line.
+func (p *printer) body(leftBrace, rightBrace *token.Token, members int, print func(i int)) {
+	if members == 0 && (rightBrace == nil || !p.hasCommentsBefore(rightBrace.Offset)) {
+		p.write("{}")
+		return
+	}
+
+	end := p.end
+	p.end = -1
+	if rightBrace != nil {
+		p.end = rightBrace.Offset
+	}
+	p.write("{")
+	if leftBrace != nil {
+		p.trailing(leftBrace.Line, p.end)
+	}
+	p.newline()
+	p.indent++
+	p.lastLine = 0
+	for i := 0; i < members; i++ {
+		print(i)
+	}
+	if rightBrace != nil {
+		p.flushComments(rightBrace.Offset)
+	}
+	p.indent--
+	p.writeIndent()
+	p.write("}")
+	p.end = end
+}
+
+func (p *printer) block(block *ast.BlockStmt) {
+	p.body(block.LeftBrace, block.RightBrace, len(block.Statements), func(i int) {
+		stmt := block.Statements[i]
+		p.statement(stmt, func() { p.stmt(stmt) })
+	})
+}
+
+// span returns the first and last tokens of node in the source.
+func span(node ast.Node) (first, last *token.Token) {
+	ast.Inspect(node, func(n ast.Node) bool {
+		for _, tok := range nodeTokens(n) {
+			if tok == nil {
+				continue
+			}
+			if first == nil || tok.Offset < first.Offset {
+				first = tok
+			}
+			if last == nil || tok.Offset > last.Offset {
+				last = tok
+			}
+		}
+		return true
+	})
+	return first, last
+}
+
+// startLine returns the line tok starts on. Token lines are the line a token
+// ends on, which differs for multi-line strings.
+func startLine(tok *token.Token) int {
+	return tok.Line - strings.Count(tok.Lexeme, "\n")
+}
+
+// blockRanges returns the offsets enclosed by the outermost blocks and class
+// bodies in node, whose comments are printed with their contents.
+func blockRanges(node ast.Node) [][2]int {
+	var ranges [][2]int
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.BlockStmt:
+			if n.LeftBrace != nil && n.RightBrace != nil {
+				ranges = append(ranges, [2]int{n.LeftBrace.Offset, n.RightBrace.Offset})
+				return false
+			}
+		case *ast.ClassStmt:
+			if n.RightBrace != nil {
+				start := n.Name.Offset
+				if n.SuperClass != nil {
+					start = n.SuperClass.Name.Offset
+				}
+				ranges = append(ranges, [2]int{start, n.RightBrace.Offset})
+				return false
+			}
+		}
+		return true
+	})
+	return ranges
+}
+
+// lineRanges returns the offsets enclosed by the lists in node, and between
+// the branches of its if statements whose then branch is not a block, where
+// the statement is broken into lines to keep the comments found there.
+func lineRanges(node ast.Node) [][2]int {
+	var ranges [][2]int
+	add := func(from, to *token.Token) {
+		if from != nil && to != nil {
+			ranges = append(ranges, [2]int{from.Offset, to.Offset})
+		}
+	}
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.ArrayLiteralExpr:
+			add(n.Bracket, n.RightBracket)
+		case *ast.HashLiteralExpr:
+			add(n.Brace, n.RightBrace)
+		case *ast.CallExpr:
+			_, last := span(n.Callee)
+			add(last, n.ClosingParen)
+		case *ast.IfStmt:
+			if _, ok := n.ThenBranch.(*ast.BlockStmt); !ok && n.ElseBranch != nil {
+				_, last := span(n.ThenBranch)
+				first, _ := span(n.ElseBranch)
+				add(last, first)
+			}
+		}
+		return true
+	})
+	return ranges
+}
+
+func inRanges(offset int, ranges [][2]int) bool {
+	for _, r := range ranges {
+		if offset > r[0] && offset < r[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// nodeTokens returns the tokens held directly by n, some of which may be nil.
+func nodeTokens(n ast.Node) []*token.Token {
+	switch n := n.(type) {
+	case *ast.VarDeclStmt:
+		return []*token.Token{n.Name}
+	case *ast.BlockStmt:
+		return []*token.Token{n.LeftBrace, n.RightBrace}
+	case *ast.ForInStmt:
+		return append([]*token.Token{n.Keyword}, n.Variables...)
+	case *ast.BreakStmt:
+		return []*token.Token{n.Keyword}
+	case *ast.ContinueStmt:
+		return []*token.Token{n.Keyword}
+	case *ast.FunctionStmt:
+		return append([]*token.Token{n.Name}, n.Params...)
+	case *ast.ReturnStmt:
+		return []*token.Token{n.Keyword}
+	case *ast.ClassStmt:
+		return []*token.Token{n.Name, n.LeftBrace, n.RightBrace}
+	case *ast.ImportStmt:
+		return []*token.Token{n.Path, n.Alias}
+	case *ast.TryStmt:
+		return []*token.Token{n.Keyword, n.CatchParam}
+	case *ast.ThrowStmt:
+		return []*token.Token{n.Keyword}
+	case *ast.BinaryExpr:
+		return []*token.Token{n.Operator}
+	case *ast.LiteralExpr:
+		return []*token.Token{n.Token}
+	case *ast.UnaryExpr:
+		return []*token.Token{n.Operator}
+	case *ast.VariableExpr:
+		return []*token.Token{n.Name}
+	case *ast.AssignExpr:
+		return []*token.Token{n.Name}
+	case *ast.LogicalExpr:
+		return []*token.Token{n.Operator}
+	case *ast.CallExpr:
+		return []*token.Token{n.ClosingParen}
+	case *ast.GetExpr:
+		return []*token.Token{n.Name}
+	case *ast.SetExpr:
+		return []*token.Token{n.Name}
+	case *ast.ThisExpr:
+		return []*token.Token{n.Keyword}
+	case *ast.SuperExpr:
+		return []*token.Token{n.Keyword, n.Method}
+	case *ast.ArrayLiteralExpr:
+		return []*token.Token{n.Bracket, n.RightBracket}
+	case *ast.HashLiteralExpr:
+		return []*token.Token{n.Brace, n.RightBrace}
+	case *ast.IndexExpr:
+		return []*token.Token{n.Bracket}
+	case *ast.SliceExpr:
+		return []*token.Token{n.Bracket}
+	case *ast.SetIndexExpr:
+		return []*token.Token{n.Bracket}
+	case *ast.FunctionExpr:
+		return n.Params
+	case *ast.InterpolationExpr:
+		return []*token.Token{n.Token}
+	}
+	return nil
+}
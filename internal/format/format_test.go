@@ -0,0 +1,179 @@
+package format
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/harshagw/viri/internal/ast"
+	"github.com/harshagw/viri/internal/objects"
+	"github.com/harshagw/viri/internal/parser"
+	"github.com/harshagw/viri/internal/scanner"
+)
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			"spacing and indentation",
+			"var  x=1;\nfun add(a,b){\n\treturn a+b;}\nprint add( x ,2 );",
+			"var x = 1;\nfun add(a, b) {\n    return a + b;\n}\nprint add(x, 2);\n",
+		},
+		{
+			"blank lines",
+			"\n\nvar a = 1;\n\n\n\nvar b = 2;\n{\n\n  print a;\n\n}\n",
+			"var a = 1;\n\nvar b = 2;\n{\n    print a;\n}\n",
+		},
+		{
+			"comments",
+			"// header\n\nvar a = 1; // one\n{ // opens\n  print a;\n  // last\n}\n// footer",
+			"// header\n\nvar a = 1; // one\n{ // opens\n    print a;\n    // last\n}\n// footer\n",
+		},
+		{
+			"comment after a closing brace",
+			"while (x) { print 1; } // loop\nfun f() { return 1; } // f\nclass A { m() {} } // A\n",
+			"while (x) {\n    print 1;\n} // loop\nfun f() {\n    return 1;\n} // f\nclass A {\n    m() {}\n} // A\n",
+		},
+		{
+			"comment after an opening brace",
+			"class A { // A\n  m() { // m\n  }\n}\n{ // empty\n}",
+			"class A { // A\n    m() { // m\n    }\n}\n{ // empty\n}\n",
+		},
+		{
+			"comments inside an expression",
+			"var a = [1, // one\n  2,\n  3]; // end\nvar b = 2 + // two\n  1;\n",
+			"var a = [\n    1, // one\n    2,\n    3\n]; // end\n// two\nvar b = 2 + 1;\n",
+		},
+		{
+			"comments among hash entries and arguments",
+			"f({\"a\": 1, // a\n  \"b\": 2}, // hash\n  // last\n  3);\nf(fun(x) {\n  // in a block\n  return x; }, 2);",
+			"f(\n    {\n        \"a\": 1, // a\n        \"b\": 2\n    }, // hash\n    // last\n    3\n);\nf(fun(x) {\n    // in a block\n    return x;\n}, 2);\n",
+		},
+		{
+			"if else chain",
+			"if (a) { print 1; }\nelse if (b) print 2;\nelse { print 3; }\nif (a) print 1; // one\nelse print 2;",
+			"if (a) {\n    print 1;\n} else if (b) print 2;\nelse {\n    print 3;\n}\nif (a) print 1; // one\nelse print 2;\n",
+		},
+		{
+			"loops",
+			"for(;;){break;}\nfor (var i=0;i<3;i=i+1) print i;\nfor(;i<3;) continue;\nfor (var k,v in {\"a\": 1}) {}\nwhile(true){}",
+			"for (;;) {\n    break;\n}\nfor (var i = 0; i < 3; i = i + 1) print i;\nfor (; i < 3;) continue;\nfor (var k, v in {\"a\": 1}) {}\nwhile (true) {}\n",
+		},
+		{
+			"classes",
+			"export class B < A {\n  init(x) { super.init(x); this.x = x; }\n\n\n  get() { return this.x; }\n}\nclass E {}",
+			"export class B < A {\n    init(x) {\n        super.init(x);\n        this.x = x;\n    }\n\n    get() {\n        return this.x;\n    }\n}\nclass E {}\n",
+		},
+		{
+			"expressions",
+			"var f = fun(x){return -(x ** 2) % 3 ~/ 1;};\nprint !a and b or c[0];\nh[\"k\"] = [];",
+			"var f = fun(x) {\n    return -(x ** 2) % 3 ~/ 1;\n};\nprint !a and b or c[0];\nh[\"k\"] = [];\n",
+		},
+		{
+			"literals keep their spelling",
+			"print 1.50 + 7;\nprint \"tab\\t\\u{1F600}\";\nprint \"a\\\"${x + 1}\\${b}\\n${\"c\"}\";\nprint \"${x} \\u{1F600}\\u00e9 ${y}\";\nprint nil == false;",
+			"print 1.50 + 7;\nprint \"tab\\t\\u{1F600}\";\nprint \"a\\\"${x + 1}\\${b}\\n${\"c\"}\";\nprint \"${x} \\u{1F600}\\u00e9 ${y}\";\nprint nil == false;\n",
+		},
+		{
+			"modules and exceptions",
+			"import \"./m.viri\" as m;\nexport const PI=3;\ntry{throw m.err;}catch(e){print e;}finally{}",
+			"import \"./m.viri\" as m;\nexport const PI = 3;\ntry {\n    throw m.err;\n} catch (e) {\n    print e;\n} finally {}\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Source([]byte(tt.input), "", &objects.DiagnosticCollector{})
+			if err != nil {
+				t.Fatalf("Source() error = %v", err)
+			}
+			if string(got) != tt.expected {
+				t.Errorf("Source() =\n%s\nwant\n%s", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSourceSyntaxError(t *testing.T) {
+	diagnostics := &objects.DiagnosticCollector{}
+	src := []byte("print 1 +;\n")
+	got, err := Source(src, "", diagnostics)
+	if err != parser.ErrParse {
+		t.Fatalf("Source() error = %v, want %v", err, parser.ErrParse)
+	}
+	if !bytes.Equal(got, src) || len(diagnostics.Errors) != 1 {
+		t.Errorf("expected the source back and one diagnostic, got %q and %v", got, diagnostics.Errors)
+	}
+
+	if _, err := Source([]byte("print \"open;\n"), "", diagnostics); err == nil {
+		t.Errorf("expected a scan error")
+	}
+}
+
+// TestCorpus formats every test program, checking that formatting is
+// idempotent and changes neither the program nor its comments.
+func TestCorpus(t *testing.T) {
+	files, err := filepath.Glob("../../test/testdata/*.viri")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no test programs found: %v", err)
+	}
+
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			src, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			formatted, err := Source(src, file, &objects.DiagnosticCollector{})
+			if err != nil {
+				t.Fatalf("Source() error = %v", err)
+			}
+
+			again, err := Source(formatted, file, &objects.DiagnosticCollector{})
+			if err != nil {
+				t.Fatalf("formatted source does not parse: %v\n%s", err, formatted)
+			}
+			if !bytes.Equal(formatted, again) {
+				t.Errorf("formatting is not idempotent:\n%s\nformatted again:\n%s", formatted, again)
+			}
+
+			wantTree, wantComments := parse(t, src)
+			gotTree, gotComments := parse(t, formatted)
+			if gotTree != wantTree {
+				t.Errorf("formatting changed the program:\n%s\nwant\n%s", gotTree, wantTree)
+			}
+			if len(gotComments) != len(wantComments) {
+				t.Fatalf("formatting kept %d of %d comments", len(gotComments), len(wantComments))
+			}
+			for i := range wantComments {
+				if gotComments[i] != wantComments[i] {
+					t.Errorf("comment[%d] = %q, want %q", i, gotComments[i], wantComments[i])
+				}
+			}
+		})
+	}
+}
+
+// parse returns the debug tree and the comments of a program.
+func parse(t *testing.T, src []byte) (string, []string) {
+	t.Helper()
+	sc := scanner.New(bytes.NewBuffer(src), nil)
+	tokens, err := sc.Scan()
+	if err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	mod, err := parser.ParseModule(tokens, "", &objects.DiagnosticCollector{})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	var comments []string
+	for _, comment := range sc.Comments() {
+		comments = append(comments, comment.Lexeme)
+	}
+	return ast.NewPrinter().PrintStatements(mod.GetAllStatements()), comments
+}
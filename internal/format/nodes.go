@@ -0,0 +1,417 @@
+package format
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/harshagw/viri/internal/ast"
+	"github.com/harshagw/viri/internal/token"
+)
+
+// stmt prints a statement without its indentation or final newline. Blocks
+// span several lines and end at their closing brace.
+func (p *printer) stmt(stmt ast.Stmt) {
+	switch s := stmt.(type) {
+	case *ast.ExprStmt:
+		p.expr(s.Expr)
+		p.write(";")
+	case *ast.PrintStmt:
+		p.write("print ")
+		p.expr(s.Expr)
+		p.write(";")
+	case *ast.VarDeclStmt:
+		if s.Exported {
+			p.write("export ")
+		}
+		if s.IsConst {
+			p.write("const ")
+		} else {
+			p.write("var ")
+		}
+		p.write(s.Name.Lexeme)
+		if s.Initializer != nil {
+			p.write(" = ")
+			p.expr(s.Initializer)
+		}
+		p.write(";")
+	case *ast.BlockStmt:
+		p.block(s)
+	case *ast.IfStmt:
+		p.ifStmt(s)
+	case *ast.WhileStmt:
+		p.write("while (")
+		p.expr(s.Condition)
+		p.write(") ")
+		p.stmt(s.Body)
+	case *ast.ForStmt:
+		p.write("for (")
+		if s.Initializer != nil {
+			p.stmt(s.Initializer)
+		} else {
+			p.write(";")
+		}
+		if s.Condition != nil {
+			p.write(" ")
+			p.expr(s.Condition)
+		}
+		p.write(";")
+		if s.Increment != nil {
+			p.write(" ")
+			p.expr(s.Increment)
+		}
+		p.write(") ")
+		p.stmt(s.Body)
+	case *ast.ForInStmt:
+		p.write("for (var ")
+		p.write(joinTokens(s.Variables))
+		p.write(" in ")
+		p.expr(s.Iterable)
+		p.write(") ")
+		p.stmt(s.Body)
+	case *ast.BreakStmt:
+		p.write("break;")
+	case *ast.ContinueStmt:
+		p.write("continue;")
+	case *ast.FunctionStmt:
+		if s.Exported {
+			p.write("export ")
+		}
+		p.write("fun ")
+		p.function(s)
+	case *ast.ReturnStmt:
+		p.write("return")
+		if s.Value != nil {
+			p.write(" ")
+			p.expr(s.Value)
+		}
+		p.write(";")
+	case *ast.ClassStmt:
+		p.class(s)
+	case *ast.ImportStmt:
+		p.write("import ")
+		p.write(quote(s.Path.Literal.(string)))
+		p.write(" as " + s.Alias.Lexeme + ";")
+	case *ast.TryStmt:
+		p.write("try ")
+		p.block(s.Body)
+		if s.CatchBody != nil {
+			p.write(" catch (" + s.CatchParam.Lexeme + ") ")
+			p.block(s.CatchBody)
+		}
+		if s.FinallyBody != nil {
+			p.write(" finally ")
+			p.block(s.FinallyBody)
+		}
+	case *ast.ThrowStmt:
+		p.write("throw ")
+		p.expr(s.Value)
+		p.write(";")
+	default:
+		panic(fmt.Sprintf("format: unexpected statement %T", stmt))
+	}
+}
+
+// ifStmt prints an if statement, chaining "else if" on the closing brace.
+// After a then branch that is not a block, else starts a new line.
+func (p *printer) ifStmt(s *ast.IfStmt) {
+	p.write("if (")
+	p.expr(s.Condition)
+	p.write(") ")
+	p.stmt(s.ThenBranch)
+	if s.ElseBranch == nil {
+		return
+	}
+	_, last := span(s.ThenBranch)
+	first, _ := span(s.ElseBranch)
+	if _, ok := s.ThenBranch.(*ast.BlockStmt); ok {
+		p.write(" ")
+	} else if last != nil && first != nil {
+		p.lineBreak(last.Line, first.Offset)
+		p.writeIndent()
+	} else {
+		p.newline()
+		p.writeIndent()
+	}
+	p.write("else ")
+	p.stmt(s.ElseBranch)
+}
+
+// function prints the name, parameters and body of a function or method.
+func (p *printer) function(s *ast.FunctionStmt) {
+	p.write(s.Name.Lexeme + "(" + joinTokens(s.Params) + ") ")
+	p.block(s.Body)
+}
+
+func (p *printer) class(s *ast.ClassStmt) {
+	if s.Exported {
+		p.write("export ")
+	}
+	p.write("class " + s.Name.Lexeme + " ")
+	if s.SuperClass != nil {
+		p.write("< " + s.SuperClass.Name.Lexeme + " ")
+	}
+	p.body(s.LeftBrace, s.RightBrace, len(s.Methods), func(i int) {
+		method := s.Methods[i]
+		p.statement(method, func() { p.function(method) })
+	})
+}
+
+// expr prints an expression on the current line. Parentheses come from
+// grouping nodes, so the printed source parses back to the same tree.
+func (p *printer) expr(expr ast.Expr) {
+	switch e := expr.(type) {
+	case *ast.BinaryExpr:
+		p.expr(e.Left)
+		p.write(" " + e.Operator.Lexeme + " ")
+		p.expr(e.Right)
+	case *ast.LogicalExpr:
+		p.expr(e.Left)
+		p.write(" " + e.Operator.Lexeme + " ")
+		p.expr(e.Right)
+	case *ast.GroupingExpr:
+		p.write("(")
+		p.expr(e.Expr)
+		p.write(")")
+	case *ast.LiteralExpr:
+		// Numbers and strings keep their spelling, such as escape sequences
+		if e.Token != nil && (e.Token.Type == token.NUMBER || isString(e.Token)) {
+			p.write(e.Token.Lexeme)
+		} else {
+			p.write(literal(e.Value))
+		}
+	case *ast.UnaryExpr:
+		p.write(e.Operator.Lexeme)
+		p.expr(e.Expr)
+	case *ast.VariableExpr:
+		p.write(e.Name.Lexeme)
+	case *ast.AssignExpr:
+		p.write(e.Name.Lexeme + " = ")
+		p.expr(e.Value)
+	case *ast.CallExpr:
+		p.expr(e.Callee)
+		_, last := span(e.Callee)
+		elements := make([][]ast.Expr, len(e.Arguments))
+		for i, arg := range e.Arguments {
+			elements[i] = []ast.Expr{arg}
+		}
+		p.list("(", ")", last, e.ClosingParen, elements, func(i int) { p.expr(e.Arguments[i]) })
+	case *ast.GetExpr:
+		p.expr(e.Object)
+		p.write("." + e.Name.Lexeme)
+	case *ast.SetExpr:
+		p.expr(e.Object)
+		p.write("." + e.Name.Lexeme + " = ")
+		p.expr(e.Value)
+	case *ast.ThisExpr:
+		p.write("this")
+	case *ast.SuperExpr:
+		p.write("super." + e.Method.Lexeme)
+	case *ast.ArrayLiteralExpr:
+		elements := make([][]ast.Expr, len(e.Elements))
+		for i, element := range e.Elements {
+			elements[i] = []ast.Expr{element}
+		}
+		p.list("[", "]", e.Bracket, e.RightBracket, elements, func(i int) { p.expr(e.Elements[i]) })
+	case *ast.HashLiteralExpr:
+		elements := make([][]ast.Expr, len(e.Pairs))
+		for i, pair := range e.Pairs {
+			elements[i] = []ast.Expr{pair.Key, pair.Value}
+		}
+		p.list("{", "}", e.Brace, e.RightBrace, elements, func(i int) {
+			p.expr(e.Pairs[i].Key)
+			p.write(": ")
+			p.expr(e.Pairs[i].Value)
+		})
+	case *ast.IndexExpr:
+		p.expr(e.Object)
+		p.write("[")
+		p.expr(e.Index)
+		p.write("]")
+	case *ast.SliceExpr:
+		p.expr(e.Object)
+		p.write("[")
+		if e.Start != nil {
+			p.expr(e.Start)
+		}
+		p.write(":")
+		if e.End != nil {
+			p.expr(e.End)
+		}
+		p.write("]")
+	case *ast.SetIndexExpr:
+		p.expr(e.Object)
+		p.write("[")
+		p.expr(e.Index)
+		p.write("] = ")
+		p.expr(e.Value)
+	case *ast.FunctionExpr:
+		p.write("fun(" + joinTokens(e.Params) + ") ")
+		p.block(e.Body)
+	case *ast.InterpolationExpr:
+		p.write(`"`)
+		for _, part := range e.Parts {
+			if text, ok := segment(part); ok {
+				p.write(text)
+				continue
+			}
+			p.write("${")
+			p.expr(part)
+			p.write("}")
+		}
+		p.write(`"`)
+	default:
+		panic(fmt.Sprintf("format: unexpected expression %T", expr))
+	}
+}
+
+// list prints the elements of an array, hash or call between open and
+// close, which are spelled by the tokens from and to, or whose last token
+// comes just before open. Each element is made of one or more expressions
+// print(i) prints. The elements go on one line, unless comments are found
+// among them: then each goes on a line of its own and the comments stay at
+// the end of the lines they were found on.
+func (p *printer) list(open, close string, from, to *token.Token, elements [][]ast.Expr, print func(i int)) {
+	p.write(open)
+	if !p.hasListComments(from, to, elements) {
+		for i := range elements {
+			if i > 0 {
+				p.write(", ")
+			}
+			print(i)
+		}
+		p.write(close)
+		return
+	}
+
+	p.indent++
+	line := from.Line
+	for i, element := range elements {
+		first, _ := span(element[0])
+		_, last := span(element[len(element)-1])
+		p.lineBreak(line, first.Offset)
+		p.writeIndent()
+		print(i)
+		if i < len(elements)-1 {
+			p.write(",")
+		}
+		line = last.Line
+	}
+	p.lineBreak(line, to.Offset)
+	p.indent--
+	p.writeIndent()
+	p.write(close)
+}
+
+// hasListComments reports whether comments are left to print among the
+// elements of a list between from and to, other than in their blocks, which
+// print their own.
+func (p *printer) hasListComments(from, to *token.Token, elements [][]ast.Expr) bool {
+	if from == nil || to == nil {
+		return false
+	}
+	var blocks [][2]int
+	for _, element := range elements {
+		for _, expr := range element {
+			if first, _ := span(expr); first == nil {
+				return false
+			}
+			blocks = append(blocks, blockRanges(expr)...)
+		}
+	}
+	for i, comment := range p.comments {
+		if !p.used[i] && comment.Offset > from.Offset && comment.Offset < to.Offset && !inRanges(comment.Offset, blocks) {
+			return true
+		}
+	}
+	return false
+}
+
+func joinTokens(tokens []*token.Token) string {
+	names := make([]string, len(tokens))
+	for i, tok := range tokens {
+		names[i] = tok.Lexeme
+	}
+	return strings.Join(names, ", ")
+}
+
+// isString reports whether tok spells a whole string literal, rather than a
+// segment of an interpolation.
+func isString(tok *token.Token) bool {
+	return tok.Type == token.STRING && strings.HasPrefix(tok.Lexeme, `"`)
+}
+
+// segment returns the source of part if it is a string segment of an
+// interpolation, as spelled by its token without the delimiters.
+func segment(part ast.Expr) (string, bool) {
+	lit, ok := part.(*ast.LiteralExpr)
+	if !ok {
+		return "", false
+	}
+	text, ok := lit.Value.(string)
+	if !ok {
+		return "", false
+	}
+	switch {
+	case lit.Token == nil:
+		return escape(text), true
+	case lit.Token.Type == token.INTERPOLATION:
+		// "a ${ or } a ${
+		return lit.Token.Lexeme[1 : len(lit.Token.Lexeme)-2], true
+	case lit.Token.Type == token.STRING && !isString(lit.Token):
+		// } a"
+		return lit.Token.Lexeme[1 : len(lit.Token.Lexeme)-1], true
+	}
+	return "", false
+}
+
+func literal(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "nil"
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case string:
+		return quote(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func quote(s string) string {
+	return `"` + escape(s) + `"`
+}
+
+// escape writes s as string literal content, using escape sequences for
+// quotes, backslashes, control characters and "${".
+func escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == '"' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '$' && strings.HasPrefix(s[i+1:], "{"):
+			b.WriteString(`\$`)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == 0:
+			b.WriteString(`\0`)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&b, `\u{%X}`, r)
+		default:
+			// Invalid UTF-8 is copied through byte for byte
+			b.WriteString(s[i : i+size])
+		}
+		i += size
+	}
+	return b.String()
+}
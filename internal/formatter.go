@@ -0,0 +1,107 @@
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/harshagw/viri/internal/format"
+	"github.com/harshagw/viri/internal/parser"
+)
+
+// FormatMode selects what Format does with formatted source.
+type FormatMode int
+
+const (
+	FormatPrint FormatMode = iota // write formatted source to stdout
+	FormatCheck                   // list files that are not formatted
+	FormatWrite                   // rewrite files that are not formatted
+)
+
+// Format formats the given files and the .viri files under the given
+// directories. It reports whether any file was not already formatted.
+func (v *Viri) Format(paths []string, mode FormatMode) bool {
+	files, err := viriFiles(paths)
+	if err != nil {
+		color.New(color.FgRed).Fprintln(color.Error, "Error:", err)
+		v.hasErrors = true
+		return false
+	}
+
+	changed := false
+	for _, path := range files {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			color.New(color.FgRed).Fprintln(color.Error, "Error:", err)
+			v.hasErrors = true
+			continue
+		}
+		v.sources[path] = string(src)
+
+		out, err := format.Source(src, path, v)
+		if err != nil {
+			// Parse errors have already been reported with their snippets
+			if !errors.Is(err, parser.ErrParse) {
+				color.New(color.FgRed).Fprintln(color.Error, "Error:", err)
+			}
+			v.hasErrors = true
+			continue
+		}
+
+		if mode == FormatPrint {
+			os.Stdout.Write(out)
+		}
+		if bytes.Equal(src, out) {
+			continue
+		}
+		changed = true
+
+		switch mode {
+		case FormatCheck:
+			fmt.Println(path)
+		case FormatWrite:
+			info, err := os.Stat(path)
+			if err == nil {
+				err = os.WriteFile(path, out, info.Mode().Perm())
+			}
+			if err != nil {
+				color.New(color.FgRed).Fprintln(color.Error, "Error:", err)
+				v.hasErrors = true
+			}
+		}
+	}
+	return changed
+}
+
+// viriFiles expands directories in paths to the .viri files they contain.
+func viriFiles(paths []string) ([]string, error) {
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		err = filepath.WalkDir(path, func(file string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && strings.HasSuffix(file, ".viri") {
+				files = append(files, file)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
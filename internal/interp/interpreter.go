@@ -1,12 +1,12 @@
 package interp
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"os"
-	"path/filepath"
-	"strconv"
+	"strings"
 
 	"github.com/harshagw/viri/internal/ast"
 	"github.com/harshagw/viri/internal/objects"
@@ -22,15 +22,29 @@ type Interpreter struct {
 	currentModule   string
 	moduleExports   map[string]objects.Object
 	resolvedModules map[string]*ast.Module
+	loader          parser.ModuleLoader
 	stdout          io.Writer
+	callStack       []callFrame
+	callSite        *token.Token // the call being made, for natives calling back into the program
+	limits          objects.Limits
+	checker         objects.LimitChecker
 }
 
-func NewInterpreter(globals *objects.Environment) *Interpreter {
+// callFrame records an active function call for stack traces.
+type callFrame struct {
+	function string       // name of the called function
+	call     *token.Token // call site in the caller
+}
+
+// NewInterpreter returns an interpreter defining the given natives in
+// globals. Nil globals means a new environment, and a nil registry the
+// builtins.
+func NewInterpreter(globals *objects.Environment, natives *objects.NativeRegistry) *Interpreter {
 	if globals == nil {
 		globals = objects.NewEnvironment(nil)
 	}
 	// Define all native functions
-	for _, nativeFn := range objects.NativeFunctions {
+	for _, nativeFn := range objects.NativesOrDefault(natives).Functions() {
 		globals.Define(nativeFn.Name, nativeFn)
 	}
 	return &Interpreter{
@@ -39,6 +53,7 @@ func NewInterpreter(globals *objects.Environment) *Interpreter {
 		locals:        make(map[ast.Expr]int),
 		moduleCache:   objects.NewModuleCache(),
 		moduleExports: make(map[string]objects.Object),
+		loader:        parser.FileLoader{},
 		stdout:        os.Stdout,
 	}
 }
@@ -47,6 +62,22 @@ func (i *Interpreter) SetStdout(w io.Writer) {
 	i.stdout = w
 }
 
+// MemoryStats returns the allocations of the current or last run.
+func (i *Interpreter) MemoryStats() objects.MemoryStats {
+	return i.checker.MemoryStats()
+}
+
+// SetLimits bounds the resources of the runs started afterwards.
+func (i *Interpreter) SetLimits(limits objects.Limits) {
+	i.limits = limits
+}
+
+// SetLoader sets how import paths are resolved. It must match the loader
+// the modules were resolved with.
+func (i *Interpreter) SetLoader(loader parser.ModuleLoader) {
+	i.loader = loader
+}
+
 func (i *Interpreter) SetModuleCache(cache *objects.ModuleCache) {
 	i.moduleCache = cache
 }
@@ -64,6 +95,14 @@ func (i *Interpreter) SetLocals(locals map[ast.Expr]int) {
 }
 
 func (i *Interpreter) Interpret(stmts []ast.Stmt) ([]objects.Object, error) {
+	return i.InterpretContext(context.Background(), stmts)
+}
+
+// InterpretContext runs stmts, stopping with a *objects.CanceledError once
+// ctx is done or with another limit error once a limit set by SetLimits is
+// exceeded.
+func (i *Interpreter) InterpretContext(ctx context.Context, stmts []ast.Stmt) ([]objects.Object, error) {
+	i.checker.Start(ctx, i.limits)
 	results := make([]objects.Object, 0, len(stmts))
 	for _, stmt := range stmts {
 		result, err := i.evalStmt(stmt)
@@ -75,6 +114,81 @@ func (i *Interpreter) Interpret(stmts []ast.Stmt) ([]objects.Object, error) {
 	return results, nil
 }
 
+// Call calls callee with args from outside any Viri code, letting a Go
+// program embedding the interpreter call back into a program that has run.
+func (i *Interpreter) Call(callee objects.Object, args []objects.Object) (objects.Object, error) {
+	return i.CallContext(context.Background(), callee, args)
+}
+
+// CallContext is like Call but stops once ctx is done, as InterpretContext
+// does. The call gets limits of its own, apart from the program's run.
+func (i *Interpreter) CallContext(ctx context.Context, callee objects.Object, args []objects.Object) (objects.Object, error) {
+	i.checker.Start(ctx, i.limits)
+	return i.call(callee, args, nil)
+}
+
+// CallValue calls fn from native code, such as the callback given to an
+// array's map method.
+func (i *Interpreter) CallValue(fn objects.Object, args ...objects.Object) (objects.Object, error) {
+	return i.call(fn, args, i.callSite)
+}
+
+// Alloc accounts for bytes allocated by native code, raising a runtime
+// error at the native's call once the allocation limit is exceeded.
+func (i *Interpreter) Alloc(bytes int64) error {
+	return i.alloc(i.callSite, bytes)
+}
+
+// call calls callee with args. site is the closing parenthesis of the call,
+// nil for calls made from Go.
+func (i *Interpreter) call(callee objects.Object, args []objects.Object, site *token.Token) (objects.Object, error) {
+	callable, ok := callee.(objects.Callable)
+	if !ok {
+		return nil, i.callError(site, objects.ErrNotCallable.Error())
+	}
+	if err := objects.CheckArity(callable.Arity(), len(args)); err != nil {
+		return nil, i.callError(site, err.Error())
+	}
+	if name, ok := frameName(callable); ok {
+		i.callStack = append(i.callStack, callFrame{function: name, call: site})
+		defer func() { i.callStack = i.callStack[:len(i.callStack)-1] }()
+		if err := i.checker.CallDepth(len(i.callStack)); err != nil {
+			return nil, err
+		}
+	}
+	if _, ok := callable.(*objects.Class); ok {
+		if err := i.alloc(site, objects.InstanceSize); err != nil {
+			return nil, err
+		}
+	}
+
+	// Natives calling back into the program report errors at this call
+	previousSite := i.callSite
+	i.callSite = site
+	defer func() { i.callSite = previousSite }()
+
+	result, err := callable.Call(i, args)
+	if err != nil {
+		if rtErr, ok := err.(*objects.RuntimeError); ok {
+			return nil, rtErr
+		}
+		if objects.IsLimitError(err) {
+			return nil, err
+		}
+		return nil, i.callError(site, err.Error())
+	}
+	return result, nil
+}
+
+// callError reports a failed call. Calls made from Go have no call site,
+// so their errors have no position or stack trace.
+func (i *Interpreter) callError(site *token.Token, message string) error {
+	if site == nil {
+		return &objects.RuntimeError{Message: message}
+	}
+	return i.runtimeError(site, message)
+}
+
 // ExecuteBlock executes a block in a provided environment.
 func (i *Interpreter) ExecuteBlock(block *ast.BlockStmt, env *objects.Environment) (objects.Object, error) {
 	previous := i.environment
@@ -92,6 +206,9 @@ func (i *Interpreter) ExecuteBlock(block *ast.BlockStmt, env *objects.Environmen
 // Statements
 
 func (i *Interpreter) evalStmt(stmt ast.Stmt) (objects.Object, error) {
+	if err := i.checker.Step(); err != nil {
+		return nil, err
+	}
 	switch s := stmt.(type) {
 	case *ast.ImportStmt:
 		return i.visitImportStmt(s)
@@ -116,10 +233,16 @@ func (i *Interpreter) evalStmt(stmt ast.Stmt) (objects.Object, error) {
 		return i.visitWhileStmt(s)
 	case *ast.ForStmt:
 		return i.visitForStmt(s)
+	case *ast.ForInStmt:
+		return i.visitForInStmt(s)
 	case *ast.BreakStmt:
 		return nil, &objects.BreakError{}
 	case *ast.ContinueStmt:
 		return nil, &objects.ContinueError{}
+	case *ast.TryStmt:
+		return i.visitTryStmt(s)
+	case *ast.ThrowStmt:
+		return i.visitThrowStmt(s)
 	default:
 		return nil, errors.New("invalid statement")
 	}
@@ -131,8 +254,7 @@ func (i *Interpreter) visitImportStmt(stmt *ast.ImportStmt) (objects.Object, err
 		return nil, i.runtimeError(stmt.Path, "Import path must be a string.")
 	}
 
-	baseDir := filepath.Dir(i.currentModule)
-	targetPath, err := parser.ResolveModulePath(baseDir, importPath)
+	targetPath, err := i.loader.ResolveImport(i.currentModule, importPath)
 	if err != nil {
 		return nil, i.runtimeError(stmt.Path, fmt.Sprintf("Failed to resolve import path: %s", err.Error()))
 	}
@@ -185,7 +307,7 @@ func (i *Interpreter) visitClass(class *ast.ClassStmt) (objects.Object, error) {
 			return nil, err
 		}
 		if superclass.Type() != objects.TypeClass {
-			return nil, i.runtimeError(class.SuperClass.Name, "Superclass must be a class.")
+			return nil, i.runtimeError(class.SuperClass.Name, objects.ErrSuperclass.Error())
 		}
 	}
 
@@ -227,9 +349,57 @@ func (i *Interpreter) visitReturnStmt(ret *ast.ReturnStmt) (objects.Object, erro
 	return value, &objects.ReturnError{Value: value}
 }
 
+func (i *Interpreter) visitTryStmt(tryStmt *ast.TryStmt) (objects.Object, error) {
+	_, err := i.evalStmt(tryStmt.Body)
+
+	if rtErr, ok := err.(*objects.RuntimeError); ok && tryStmt.CatchBody != nil {
+		catchEnv := objects.NewEnvironment(i.environment)
+		catchEnv.Define(tryStmt.CatchParam.Lexeme, errorValue(rtErr))
+		_, err = i.ExecuteBlock(tryStmt.CatchBody, catchEnv)
+	}
+
+	if tryStmt.FinallyBody != nil && !objects.IsLimitError(err) {
+		// An error or jump out of the finally block replaces the pending one.
+		if _, finallyErr := i.evalStmt(tryStmt.FinallyBody); finallyErr != nil {
+			return nil, finallyErr
+		}
+	}
+	return nil, err
+}
+
+func (i *Interpreter) visitThrowStmt(throwStmt *ast.ThrowStmt) (objects.Object, error) {
+	value, err := i.evalExpr(throwStmt.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	// Rethrowing a caught error keeps its original location and stack.
+	if caught, ok := value.(*objects.Error); ok {
+		filePath := caught.FilePath
+		tok := token.New(throwStmt.Keyword.Type, throwStmt.Keyword.Lexeme, nil, caught.Line, &filePath)
+		tok.Column = caught.Column
+		return nil, &objects.RuntimeError{
+			Token:   &tok,
+			Message: caught.Message,
+			Trace:   caught.Trace,
+		}
+	}
+
+	return nil, &objects.RuntimeError{
+		Token:   throwStmt.Keyword,
+		Message: "Uncaught exception: " + objects.Stringify(value),
+		Thrown:  value,
+		Trace:   i.stackTrace(throwStmt.Keyword),
+	}
+}
+
 func (i *Interpreter) visitVarDeclStmt(decl *ast.VarDeclStmt) (objects.Object, error) {
 	var val objects.Object
-	if decl.Initializer != nil {
+	if fnExpr, ok := decl.Initializer.(*ast.FunctionExpr); ok {
+		// Like the compiler, name the function after its variable for stack traces
+		val = objects.NewFunction(decl.Name.Lexeme, fnExpr.Params, fnExpr.Body, i.environment, false, objects.FunctionTypeAnonymous)
+		i.environment.Define(decl.Name.Lexeme, val)
+	} else if decl.Initializer != nil {
 		v, err := i.evalExpr(decl.Initializer)
 		if err != nil {
 			return nil, err
@@ -340,9 +510,132 @@ func (i *Interpreter) visitForStmt(forStmt *ast.ForStmt) (objects.Object, error)
 	return nil, nil
 }
 
+func (i *Interpreter) visitForInStmt(forIn *ast.ForInStmt) (objects.Object, error) {
+	iterable, err := i.evalExpr(forIn.Iterable)
+	if err != nil {
+		return nil, err
+	}
+	next, err := i.iterator(forIn, iterable)
+	if err != nil {
+		return nil, err
+	}
+
+	previous := i.environment
+	defer func() { i.environment = previous }()
+
+	for {
+		key, value, ok, err := next()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+
+		// Each iteration gets a fresh environment so closures capture that iteration's values
+		loopEnv := objects.NewEnvironment(previous)
+		if len(forIn.Variables) == 2 {
+			loopEnv.Define(forIn.Variables[0].Lexeme, key)
+			loopEnv.Define(forIn.Variables[1].Lexeme, value)
+		} else {
+			loopEnv.Define(forIn.Variables[0].Lexeme, value)
+		}
+		i.environment = loopEnv
+
+		if _, err := i.evalStmt(forIn.Body); err != nil {
+			switch err.(type) {
+			case *objects.BreakError:
+				return nil, nil
+			case *objects.ContinueError:
+				continue
+			default:
+				return nil, err
+			}
+		}
+	}
+	return nil, nil
+}
+
+// iterator returns a function producing the successive key/value pairs of a
+// for-in loop. Instances are iterated through their hasNext() and next()
+// methods, after calling iterator() first if they define it.
+func (i *Interpreter) iterator(forIn *ast.ForInStmt, iterable objects.Object) (func() (objects.Object, objects.Object, bool, error), error) {
+	pairs := len(forIn.Variables) == 2
+
+	if instance, ok := iterable.(*objects.ClassInstance); ok {
+		if _, ok := instance.BoundMethod("iterator"); ok {
+			result, err := i.callIteratorMethod(forIn.Keyword, instance, "iterator")
+			if err != nil {
+				return nil, err
+			}
+			iterable = result
+		}
+	}
+
+	instance, ok := iterable.(*objects.ClassInstance)
+	if !ok {
+		it, ok := objects.NewIterator(iterable, pairs)
+		if !ok {
+			return nil, i.runtimeError(forIn.Keyword, objects.ErrNotIterable.Error())
+		}
+		return func() (objects.Object, objects.Object, bool, error) {
+			key, value, ok := it.Next()
+			return key, value, ok, nil
+		}, nil
+	}
+
+	_, hasNext := instance.BoundMethod("hasNext")
+	_, hasValue := instance.BoundMethod("next")
+	if !hasNext || !hasValue {
+		return nil, i.runtimeError(forIn.Keyword, objects.ErrIteratorMethods.Error())
+	}
+	if pairs {
+		return nil, i.runtimeError(forIn.Keyword, objects.ErrIteratorPairs.Error())
+	}
+
+	return func() (objects.Object, objects.Object, bool, error) {
+		more, err := i.callIteratorMethod(forIn.Keyword, instance, "hasNext")
+		if err != nil || !objects.IsTruthy(more) {
+			return nil, nil, false, err
+		}
+		value, err := i.callIteratorMethod(forIn.Keyword, instance, "next")
+		if err != nil {
+			return nil, nil, false, err
+		}
+		return nil, value, true, nil
+	}, nil
+}
+
+// callIteratorMethod calls one of the zero-argument iterator protocol methods.
+func (i *Interpreter) callIteratorMethod(tok *token.Token, instance *objects.ClassInstance, name string) (objects.Object, error) {
+	method, _ := instance.BoundMethod(name)
+	if err := objects.CheckIteratorMethod(name, method.Arity()); err != nil {
+		return nil, i.runtimeError(tok, err.Error())
+	}
+	i.callStack = append(i.callStack, callFrame{function: name, call: tok})
+	defer func() { i.callStack = i.callStack[:len(i.callStack)-1] }()
+	if err := i.checker.CallDepth(len(i.callStack)); err != nil {
+		return nil, err
+	}
+	result, err := method.Call(i, nil)
+	if err != nil {
+		if rtErr, ok := err.(*objects.RuntimeError); ok {
+			return nil, rtErr
+		}
+		if objects.IsLimitError(err) {
+			return nil, err
+		}
+		return nil, i.runtimeError(tok, err.Error())
+	}
+	return result, nil
+}
+
 // Expressions
 
 func (i *Interpreter) evalExpr(expr ast.Expr) (objects.Object, error) {
+	if err := i.checker.Step(); err != nil {
+		return nil, err
+	}
 	switch e := expr.(type) {
 	case *ast.BinaryExpr:
 		return i.visitBinaryExpr(e)
@@ -374,74 +667,75 @@ func (i *Interpreter) evalExpr(expr ast.Expr) (objects.Object, error) {
 		return i.visitSetExpr(e)
 	case *ast.IndexExpr:
 		return i.visitIndexExpr(e)
+	case *ast.SliceExpr:
+		return i.visitSliceExpr(e)
 	case *ast.ThisExpr:
 		return i.visitThisExpr(e)
 	case *ast.SuperExpr:
 		return i.visitSuperExpr(e)
+	case *ast.InterpolationExpr:
+		return i.visitInterpolationExpr(e)
 	default:
 		return nil, errors.New("invalid expression")
 	}
 }
 
+// binaryOperators maps the arithmetic and comparison tokens to the
+// operators they apply.
+var binaryOperators = map[token.Type]objects.Operator{
+	token.PLUS:          objects.Add,
+	token.MINUS:         objects.Subtract,
+	token.STAR:          objects.Multiply,
+	token.SLASH:         objects.Divide,
+	token.PERCENT:       objects.Modulo,
+	token.TILDE_SLASH:   objects.FloorDivide,
+	token.STAR_STAR:     objects.Power,
+	token.GREATER:       objects.Greater,
+	token.GREATER_EQUAL: objects.GreaterEqual,
+	token.LESS:          objects.Less,
+	token.LESS_EQUAL:    objects.LessEqual,
+}
+
 func (i *Interpreter) visitBinaryExpr(exp *ast.BinaryExpr) (objects.Object, error) {
-	right, err := i.evalExpr(exp.Right)
+	left, err := i.evalExpr(exp.Left)
 	if err != nil {
 		return nil, err
 	}
-	left, err := i.evalExpr(exp.Left)
+	right, err := i.evalExpr(exp.Right)
 	if err != nil {
 		return nil, err
 	}
 	switch exp.Operator.Type {
-	case token.PLUS:
-		switch l := left.(type) {
-		case *objects.Number:
-			if r, ok := right.(*objects.Number); ok {
-				return objects.NewNumber(l.Value + r.Value), nil
-			}
-			if r, ok := right.(*objects.String); ok {
-				return objects.NewString(fmt.Sprintf("%g%s", l.Value, r.Value)), nil
-			}
-		case *objects.String:
-			if r, ok := right.(*objects.String); ok {
-				return objects.NewString(l.Value + r.Value), nil
-			}
-			if r, ok := right.(*objects.Number); ok {
-				return objects.NewString(l.Value + fmt.Sprintf("%g", r.Value)), nil
-			}
-		}
-		return nil, i.runtimeError(exp.Operator, fmt.Sprintf("Operands to '+' must both be numbers or both be strings or one string and other number (left: %T, right: %T).", left, right))
-	case token.MINUS, token.STAR, token.SLASH, token.GREATER, token.GREATER_EQUAL, token.LESS, token.LESS_EQUAL:
-		lf, lok := left.(*objects.Number)
-		rf, rok := right.(*objects.Number)
-		if !lok || !rok {
-			return nil, i.runtimeError(exp.Operator, "Operands must be numbers.")
-		}
-		switch exp.Operator.Type {
-		case token.MINUS:
-			return objects.NewNumber(lf.Value - rf.Value), nil
-		case token.STAR:
-			return objects.NewNumber(lf.Value * rf.Value), nil
-		case token.SLASH:
-			if rf.Value == 0 {
-				return nil, i.runtimeError(exp.Operator, "Division by zero.")
-			}
-			return objects.NewNumber(lf.Value / rf.Value), nil
-		case token.GREATER:
-			return objects.NewBool(lf.Value > rf.Value), nil
-		case token.GREATER_EQUAL:
-			return objects.NewBool(lf.Value >= rf.Value), nil
-		case token.LESS:
-			return objects.NewBool(lf.Value < rf.Value), nil
-		case token.LESS_EQUAL:
-			return objects.NewBool(lf.Value <= rf.Value), nil
-		}
 	case token.EQUAL_EQUAL:
 		return objects.NewBool(objects.IsEqual(left, right)), nil
 	case token.BANG_EQUAL:
 		return objects.NewBool(!objects.IsEqual(left, right)), nil
 	}
-	return nil, i.runtimeError(exp.Operator, "Invalid operator.")
+	op, ok := binaryOperators[exp.Operator.Type]
+	if !ok {
+		return nil, i.runtimeError(exp.Operator, "Invalid operator.")
+	}
+
+	previousSite := i.callSite
+	i.callSite = exp.Operator
+	result, err := objects.Binary(i, op, left, right)
+	i.callSite = previousSite
+	if err != nil {
+		return nil, i.nativeError(exp.Operator, err)
+	}
+	return result, nil
+}
+
+func (i *Interpreter) visitInterpolationExpr(interp *ast.InterpolationExpr) (objects.Object, error) {
+	var sb strings.Builder
+	for _, part := range interp.Parts {
+		value, err := i.evalExpr(part)
+		if err != nil {
+			return nil, err
+		}
+		sb.WriteString(objects.Stringify(value))
+	}
+	return i.newString(interp.Token, sb.String())
 }
 
 func (i *Interpreter) visitUnaryExpr(unary *ast.UnaryExpr) (objects.Object, error) {
@@ -451,11 +745,11 @@ func (i *Interpreter) visitUnaryExpr(unary *ast.UnaryExpr) (objects.Object, erro
 	}
 	switch unary.Operator.Type {
 	case token.MINUS:
-		num, ok := right.(*objects.Number)
-		if !ok {
-			return nil, i.runtimeError(unary.Operator, "Operand must be a number.")
+		result, err := objects.Negate(right)
+		if err != nil {
+			return nil, i.runtimeError(unary.Operator, err.Error())
 		}
-		return objects.NewNumber(-num.Value), nil
+		return result, nil
 	case token.BANG:
 		return objects.NewBool(!objects.IsTruthy(right)), nil
 	}
@@ -509,6 +803,9 @@ func (i *Interpreter) visitAssignExpr(assign *ast.AssignExpr) (objects.Object, e
 }
 
 func (i *Interpreter) visitArrayLiteralExpr(array *ast.ArrayLiteralExpr) (objects.Object, error) {
+	if err := i.alloc(array.Bracket, objects.ArraySize(len(array.Elements))); err != nil {
+		return nil, err
+	}
 	items := make([]objects.Object, 0, len(array.Elements))
 	for _, el := range array.Elements {
 		val, err := i.evalExpr(el)
@@ -521,21 +818,27 @@ func (i *Interpreter) visitArrayLiteralExpr(array *ast.ArrayLiteralExpr) (object
 }
 
 func (i *Interpreter) visitHashLiteralExpr(hash *ast.HashLiteralExpr) (objects.Object, error) {
+	if err := i.alloc(hash.Brace, objects.HashSize); err != nil {
+		return nil, err
+	}
 	table := objects.NewHash()
 	for _, pair := range hash.Pairs {
 		keyVal, err := i.evalExpr(pair.Key)
 		if err != nil {
 			return nil, err
 		}
-		keyStr, ok := keyVal.(*objects.String)
-		if !ok {
-			return nil, i.runtimeError(hash.Brace, "Hash map keys must be strings.")
+		k, err := i.hashKey(hash.Brace, keyVal)
+		if err != nil {
+			return nil, err
 		}
 		valueVal, err := i.evalExpr(pair.Value)
 		if err != nil {
 			return nil, err
 		}
-		table.Set(keyStr.Value, valueVal)
+		if err := i.allocEntry(hash.Brace, table, k, keyVal); err != nil {
+			return nil, err
+		}
+		table.Set(k, keyVal, valueVal)
 	}
 	return table, nil
 }
@@ -545,42 +848,43 @@ func (i *Interpreter) visitIndexExpr(idx *ast.IndexExpr) (objects.Object, error)
 	if err != nil {
 		return nil, err
 	}
-	switch target := obj.(type) {
-	case *objects.Array:
-		indexVal, err := i.evalExpr(idx.Index)
-		if err != nil {
-			return nil, err
-		}
-		indexNum, ok := indexVal.(*objects.Number)
-		if !ok {
-			return nil, i.runtimeError(idx.Bracket, "Index must be a number.")
-		}
-		intIndex := int(indexNum.Value)
-		if float64(intIndex) != indexNum.Value {
-			return nil, i.runtimeError(idx.Bracket, "Index must be an integer.")
-		}
-		val, err := target.Get(intIndex)
-		if err != nil {
-			return nil, i.runtimeError(idx.Bracket, err.Error())
+	index, err := i.evalExpr(idx.Index)
+	if err != nil {
+		return nil, err
+	}
+
+	previousSite := i.callSite
+	i.callSite = idx.Bracket
+	result, err := objects.Index(i, obj, index)
+	i.callSite = previousSite
+	if err != nil {
+		return nil, i.nativeError(idx.Bracket, err)
+	}
+	return result, nil
+}
+
+func (i *Interpreter) visitSliceExpr(slice *ast.SliceExpr) (objects.Object, error) {
+	obj, err := i.evalExpr(slice.Object)
+	if err != nil {
+		return nil, err
+	}
+	bounds := [2]objects.Object{objects.NilValue, objects.NilValue}
+	for n, bound := range []ast.Expr{slice.Start, slice.End} {
+		if bound == nil {
+			continue
 		}
-		return val, nil
-	case *objects.Hash:
-		keyVal, err := i.evalExpr(idx.Index)
-		if err != nil {
+		if bounds[n], err = i.evalExpr(bound); err != nil {
 			return nil, err
 		}
-		key, ok := keyVal.(*objects.String)
-		if !ok {
-			return nil, i.runtimeError(idx.Bracket, "Hash map keys must be strings.")
-		}
-		val, ok := target.Get(key.Value)
-		if !ok {
-			return nil, i.runtimeError(idx.Bracket, "Key '"+key.Value+"' not found in hash map.")
-		}
-		return val, nil
-	default:
-		return nil, i.runtimeError(idx.Bracket, "Indexing target must be an array or hash map.")
 	}
+	result, err := objects.Slice(obj, bounds[0], bounds[1])
+	if err != nil {
+		return nil, i.runtimeError(slice.Bracket, err.Error())
+	}
+	if err := i.alloc(slice.Bracket, objects.SizeOf(result)); err != nil {
+		return nil, err
+	}
+	return result, nil
 }
 
 func (i *Interpreter) visitSetIndexExpr(setIdx *ast.SetIndexExpr) (objects.Object, error) {
@@ -588,46 +892,23 @@ func (i *Interpreter) visitSetIndexExpr(setIdx *ast.SetIndexExpr) (objects.Objec
 	if err != nil {
 		return nil, err
 	}
-	switch target := obj.(type) {
-	case *objects.Array:
-		indexVal, err := i.evalExpr(setIdx.Index)
-		if err != nil {
-			return nil, err
-		}
-		indexNum, ok := indexVal.(*objects.Number)
-		if !ok {
-			return nil, i.runtimeError(setIdx.Bracket, "Index must be a number.")
-		}
-		intIndex := int(indexNum.Value)
-		if float64(intIndex) != indexNum.Value {
-			return nil, i.runtimeError(setIdx.Bracket, "Index must be an integer.")
-		}
-		val, err := i.evalExpr(setIdx.Value)
-		if err != nil {
-			return nil, err
-		}
-		if err := target.Set(intIndex, val); err != nil {
-			return nil, i.runtimeError(setIdx.Bracket, err.Error())
-		}
-		return val, nil
-	case *objects.Hash:
-		keyVal, err := i.evalExpr(setIdx.Index)
-		if err != nil {
-			return nil, err
-		}
-		key, ok := keyVal.(*objects.String)
-		if !ok {
-			return nil, i.runtimeError(setIdx.Bracket, "Hash map keys must be strings.")
-		}
-		val, err := i.evalExpr(setIdx.Value)
-		if err != nil {
-			return nil, err
-		}
-		target.Set(key.Value, val)
-		return val, nil
-	default:
-		return nil, i.runtimeError(setIdx.Bracket, "Index assignment target must be an array or hash map.")
+	index, err := i.evalExpr(setIdx.Index)
+	if err != nil {
+		return nil, err
+	}
+	val, err := i.evalExpr(setIdx.Value)
+	if err != nil {
+		return nil, err
 	}
+
+	previousSite := i.callSite
+	i.callSite = setIdx.Bracket
+	err = objects.SetIndex(i, obj, index, val)
+	i.callSite = previousSite
+	if err != nil {
+		return nil, i.nativeError(setIdx.Bracket, err)
+	}
+	return val, nil
 }
 
 func (i *Interpreter) visitLogicalExpr(logical *ast.LogicalExpr) (objects.Object, error) {
@@ -655,18 +936,7 @@ func (i *Interpreter) visitCallExpr(call *ast.CallExpr) (objects.Object, error)
 		}
 		args = append(args, val)
 	}
-	callable, ok := callee.(objects.Callable)
-	if !ok {
-		return nil, i.runtimeError(call.ClosingParen, "Can only call functions or classes.")
-	}
-	if callable.Arity() != len(args) {
-		return nil, i.runtimeError(call.ClosingParen, "Expected "+strconv.Itoa(callable.Arity())+" arguments but got "+strconv.Itoa(len(args))+".")
-	}
-	result, err := callable.Call(i, args)
-	if err != nil {
-		return nil, i.runtimeError(call.ClosingParen, err.Error())
-	}
-	return result, nil
+	return i.call(callee, args, call.ClosingParen)
 }
 
 func (i *Interpreter) visitGetExpr(get *ast.GetExpr) (objects.Object, error) {
@@ -684,6 +954,23 @@ func (i *Interpreter) visitGetExpr(get *ast.GetExpr) (objects.Object, error) {
 		return value, nil
 	}
 
+	// Handle caught error access
+	if errObj, ok := object.(*objects.Error); ok {
+		value, ok := errObj.Get(get.Name.Lexeme)
+		if !ok {
+			return nil, i.runtimeError(get.Name, "Undefined property '"+get.Name.Lexeme+"'.")
+		}
+		return value, nil
+	}
+
+	// Handle methods of built-in types, such as push on arrays
+	if method, ok := objects.Method(object, get.Name.Lexeme); ok {
+		return method, nil
+	}
+	if objects.HasMethods(object) {
+		return nil, i.runtimeError(get.Name, "Undefined method '"+get.Name.Lexeme+"'.")
+	}
+
 	// Handle class instance access
 	instance, ok := object.(*objects.ClassInstance)
 	if !ok {
@@ -709,6 +996,11 @@ func (i *Interpreter) visitSetExpr(set *ast.SetExpr) (objects.Object, error) {
 	if err != nil {
 		return nil, err
 	}
+	if !instance.HasField(set.Name.Lexeme) {
+		if err := i.alloc(set.Name, objects.EntrySize(set.Name.Lexeme)); err != nil {
+			return nil, err
+		}
+	}
 	if err := instance.Set(set.Name, value); err != nil {
 		return nil, i.runtimeError(set.Name, err.Error())
 	}
@@ -726,7 +1018,7 @@ func (i *Interpreter) visitSuperExpr(super *ast.SuperExpr) (objects.Object, erro
 	}
 	superclass, ok := superClassObject.(*objects.Class)
 	if !ok {
-		return nil, i.runtimeError(super.Keyword, "Superclass must be a class.")
+		return nil, i.runtimeError(super.Keyword, objects.ErrSuperclass.Error())
 	}
 	method, ok := superclass.LookupMethod(super.Method.Lexeme)
 	if !ok {
@@ -780,9 +1072,126 @@ func literalToObject(v interface{}) objects.Object {
 	}
 }
 
+// alloc accounts for bytes allocated by the program, raising a runtime
+// error at tok once the allocation limit is exceeded.
+func (i *Interpreter) alloc(tok *token.Token, bytes int64) error {
+	if err := i.checker.Alloc(bytes); err != nil {
+		rtErr := i.runtimeError(tok, err.Error()).(*objects.RuntimeError)
+		rtErr.Err = err
+		return rtErr
+	}
+	return nil
+}
+
+// allocEntry accounts for setting key, which k identifies, in hash if it
+// adds an entry.
+func (i *Interpreter) allocEntry(tok *token.Token, hash *objects.Hash, k objects.HashKey, key objects.Object) error {
+	if _, ok := hash.Get(k); ok {
+		return nil
+	}
+	return i.alloc(tok, objects.KeySize(key))
+}
+
+// hashKey returns the hash key of value. A hash method it calls reports
+// errors at tok.
+func (i *Interpreter) hashKey(tok *token.Token, value objects.Object) (objects.HashKey, error) {
+	previousSite := i.callSite
+	i.callSite = tok
+	defer func() { i.callSite = previousSite }()
+
+	k, err := objects.HashKeyOf(i, value)
+	if err != nil {
+		return k, i.nativeError(tok, err)
+	}
+	return k, nil
+}
+
+// nativeError turns an error from Go code into a runtime error at tok.
+// Errors raised by program code that Go code called back into are kept as
+// they are.
+func (i *Interpreter) nativeError(tok *token.Token, err error) error {
+	if _, ok := err.(*objects.RuntimeError); ok || objects.IsLimitError(err) {
+		return err
+	}
+	return i.runtimeError(tok, err.Error())
+}
+
+// newString returns a string built by the program, accounting for it.
+func (i *Interpreter) newString(tok *token.Token, value string) (objects.Object, error) {
+	if err := i.alloc(tok, objects.StringSize(value)); err != nil {
+		return nil, err
+	}
+	return objects.NewString(value), nil
+}
+
 func (i *Interpreter) runtimeError(tok *token.Token, message string) error {
 	return &objects.RuntimeError{
 		Token:   tok,
 		Message: message,
+		Trace:   i.stackTrace(tok),
+	}
+}
+
+// stackTrace returns the active calls, outermost first, with the innermost
+// frame positioned at tok.
+func (i *Interpreter) stackTrace(tok *token.Token) []objects.StackFrame {
+	trace := make([]objects.StackFrame, 0, len(i.callStack)+1)
+	function := "<script>"
+	for _, frame := range i.callStack {
+		// Calls made by Call have no call site in Viri code
+		if frame.call != nil {
+			trace = append(trace, stackFrame(function, frame.call))
+		}
+		function = frame.function
+	}
+	return append(trace, stackFrame(function, tok))
+}
+
+func stackFrame(function string, tok *token.Token) objects.StackFrame {
+	frame := objects.StackFrame{Function: function}
+	if tok != nil {
+		frame.Line = tok.Line
+		if tok.FilePath != nil {
+			frame.FilePath = *tok.FilePath
+		}
+	}
+	return frame
+}
+
+// frameName returns the stack trace name for calling a callable. Natives and
+// classes without an initializer don't run any code of their own, so they
+// get no frame.
+func frameName(callable objects.Callable) (string, bool) {
+	switch fn := callable.(type) {
+	case *objects.Function:
+		if fn.Name() == "" {
+			return "<anonymous>", true
+		}
+		return fn.Name(), true
+	case *objects.Class:
+		if _, ok := fn.LookupMethod("init"); ok {
+			return "init", true
+		}
+	}
+	return "", false
+}
+
+// errorValue returns the value a catch clause binds for the given error.
+func errorValue(err *objects.RuntimeError) objects.Object {
+	if err.Thrown != nil {
+		return err.Thrown
+	}
+	line, filePath := 0, ""
+	if err.Token != nil {
+		line = err.Token.Line
+		if err.Token.FilePath != nil {
+			filePath = *err.Token.FilePath
+		}
+	}
+	errValue := objects.NewError(err.Message, filePath, line)
+	if err.Token != nil {
+		errValue.Column = err.Token.Column
 	}
+	errValue.Trace = err.Trace
+	return errValue
 }
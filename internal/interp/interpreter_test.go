@@ -1,7 +1,9 @@
 package interp
 
 import (
+	"context"
 	"testing"
+	"time"
 
 	"github.com/harshagw/viri/internal/ast"
 	"github.com/harshagw/viri/internal/objects"
@@ -9,7 +11,7 @@ import (
 )
 
 func TestInterpreter_EvalLiteral(t *testing.T) {
-	i := NewInterpreter(nil)
+	i := NewInterpreter(nil, nil)
 
 	tests := []struct {
 		name     string
@@ -58,7 +60,7 @@ func TestInterpreter_EvalLiteral(t *testing.T) {
 }
 
 func TestInterpreter_EvalBinary(t *testing.T) {
-	i := NewInterpreter(nil)
+	i := NewInterpreter(nil, nil)
 
 	plusTok := token.New(token.PLUS, "+", nil, 1, nil)
 
@@ -83,9 +85,95 @@ func TestInterpreter_EvalBinary(t *testing.T) {
 	}
 }
 
+func TestInterpreter_EvalArithmeticOperators(t *testing.T) {
+	i := NewInterpreter(nil, nil)
+
+	tests := []struct {
+		name     string
+		op       token.Type
+		left     float64
+		right    float64
+		expected float64
+	}{
+		{"modulo", token.PERCENT, 7, 3, 1},
+		{"modulo negative dividend", token.PERCENT, -7, 3, 2},
+		{"modulo negative divisor", token.PERCENT, 7, -3, -2},
+		{"floor division", token.TILDE_SLASH, 7, 2, 3},
+		{"floor division negative", token.TILDE_SLASH, -7, 2, -4},
+		{"exponent", token.STAR_STAR, 2, 10, 1024},
+		{"negative exponent", token.STAR_STAR, 2, -1, 0.5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opTok := token.New(tt.op, "", nil, 1, nil)
+			expr := &ast.BinaryExpr{
+				Left:     &ast.LiteralExpr{Value: tt.left},
+				Operator: &opTok,
+				Right:    &ast.LiteralExpr{Value: tt.right},
+			}
+
+			result, err := i.evalExpr(expr)
+			if err != nil {
+				t.Fatalf("evalExpr() error = %v", err)
+			}
+			num, ok := result.(*objects.Number)
+			if !ok {
+				t.Fatalf("expected Number, got %T", result)
+			}
+			if num.Value != tt.expected {
+				t.Errorf("got %v, want %v", num.Value, tt.expected)
+			}
+		})
+	}
+
+	t.Run("modulo by zero", func(t *testing.T) {
+		opTok := token.New(token.PERCENT, "%", nil, 1, nil)
+		expr := &ast.BinaryExpr{
+			Left:     &ast.LiteralExpr{Value: 1.0},
+			Operator: &opTok,
+			Right:    &ast.LiteralExpr{Value: 0.0},
+		}
+		if _, err := i.evalExpr(expr); err == nil || err.Error() != "Division by zero." {
+			t.Errorf("expected division by zero error, got %v", err)
+		}
+	})
+}
+
+func TestInterpreter_EvalInterpolation(t *testing.T) {
+	i := NewInterpreter(nil, nil)
+
+	// "n = ${1 + 2}, ok = ${true}"
+	plusTok := token.New(token.PLUS, "+", nil, 1, nil)
+	expr := &ast.InterpolationExpr{
+		Parts: []ast.Expr{
+			&ast.LiteralExpr{Value: "n = "},
+			&ast.BinaryExpr{
+				Left:     &ast.LiteralExpr{Value: 1.0},
+				Operator: &plusTok,
+				Right:    &ast.LiteralExpr{Value: 2.0},
+			},
+			&ast.LiteralExpr{Value: ", ok = "},
+			&ast.LiteralExpr{Value: true},
+		},
+	}
+
+	result, err := i.evalExpr(expr)
+	if err != nil {
+		t.Fatalf("evalExpr() error = %v", err)
+	}
+	str, ok := result.(*objects.String)
+	if !ok {
+		t.Fatalf("expected String, got %T", result)
+	}
+	if str.Value != "n = 3, ok = true" {
+		t.Errorf("got %q, want %q", str.Value, "n = 3, ok = true")
+	}
+}
+
 func TestInterpreter_EvalVarDecl(t *testing.T) {
 	globals := objects.NewEnvironment(nil)
-	i := NewInterpreter(globals)
+	i := NewInterpreter(globals, nil)
 
 	nameTok := token.New(token.IDENTIFIER, "x", nil, 1, nil)
 
@@ -112,7 +200,7 @@ func TestInterpreter_EvalVarDecl(t *testing.T) {
 
 func TestInterpreter_EvalIf(t *testing.T) {
 	globals := objects.NewEnvironment(nil)
-	i := NewInterpreter(globals)
+	i := NewInterpreter(globals, nil)
 
 	// x = 0; if (true) x = 1;
 	xTok := token.New(token.IDENTIFIER, "x", nil, 1, nil)
@@ -141,7 +229,7 @@ func TestInterpreter_EvalIf(t *testing.T) {
 
 func TestInterpreter_EvalFunction(t *testing.T) {
 	globals := objects.NewEnvironment(nil)
-	i := NewInterpreter(globals)
+	i := NewInterpreter(globals, nil)
 
 	// fun add(a, b) { return a + b; }
 	// add(1, 2)
@@ -198,9 +286,46 @@ func TestInterpreter_EvalFunction(t *testing.T) {
 	}
 }
 
+func TestInterpreter_Natives(t *testing.T) {
+	natives, err := objects.NewNativeRegistry(&objects.NativeFunction{
+		Name:    "count",
+		NumArgs: -1,
+		Fn: func(rt objects.Runtime, args ...objects.Object) (objects.Object, error) {
+			return objects.NewNumber(float64(len(args))), nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := NewInterpreter(nil, natives)
+
+	call := func(name string, args ...ast.Expr) (objects.Object, error) {
+		nameTok := token.New(token.IDENTIFIER, name, nil, 1, nil)
+		parenTok := token.New(token.RIGHT_PAREN, ")", nil, 1, nil)
+		return i.evalExpr(&ast.CallExpr{
+			Callee:       &ast.VariableExpr{Name: &nameTok},
+			ClosingParen: &parenTok,
+			Arguments:    args,
+		})
+	}
+
+	result, err := call("count", &ast.LiteralExpr{Value: 1.0}, &ast.LiteralExpr{Value: "a"}, &ast.LiteralExpr{Value: nil})
+	if err != nil {
+		t.Fatalf("count() error = %v", err)
+	}
+	if num, ok := result.(*objects.Number); !ok || num.Value != 3 {
+		t.Errorf("count() = %v, want 3", result)
+	}
+
+	// Only the natives of the registry are defined
+	if _, err := call("len", &ast.LiteralExpr{Value: "a"}); err == nil {
+		t.Errorf("expected len to be undefined")
+	}
+}
+
 func TestInterpreter_EvalClass(t *testing.T) {
 	globals := objects.NewEnvironment(nil)
-	i := NewInterpreter(globals)
+	i := NewInterpreter(globals, nil)
 
 	// class Point { init(x, y) { this.x = x; this.y = y; } }
 	// var p = Point(1, 2); p.x
@@ -288,7 +413,7 @@ func TestInterpreter_EvalClass(t *testing.T) {
 }
 
 func TestInterpreter_EvalCollections(t *testing.T) {
-	i := NewInterpreter(nil)
+	i := NewInterpreter(nil, nil)
 
 	// [1, 2, 3]
 	arrExpr := &ast.ArrayLiteralExpr{
@@ -315,13 +440,13 @@ func TestInterpreter_EvalCollections(t *testing.T) {
 	}
 	result, _ = i.evalExpr(hashExpr)
 	hash := result.(*objects.Hash)
-	if len(hash.Pairs) != 1 {
-		t.Errorf("got %d pairs, want 1", len(hash.Pairs))
+	if hash.Len() != 1 {
+		t.Errorf("got %d pairs, want 1", hash.Len())
 	}
 }
 
 func TestInterpreter_EvalIndexing(t *testing.T) {
-	i := NewInterpreter(nil)
+	i := NewInterpreter(nil, nil)
 
 	// var a = [10, 20]; a[0] = 30; a[0]
 	aTok := token.New(token.IDENTIFIER, "a", nil, 1, nil)
@@ -353,7 +478,7 @@ func TestInterpreter_EvalIndexing(t *testing.T) {
 
 func TestInterpreter_EvalLoopControl(t *testing.T) {
 	globals := objects.NewEnvironment(nil)
-	i := NewInterpreter(globals)
+	i := NewInterpreter(globals, nil)
 
 	// var x = 0; while (true) { x = x + 1; break; }
 	xTok := token.New(token.IDENTIFIER, "x", nil, 1, nil)
@@ -391,7 +516,7 @@ func TestInterpreter_EvalLoopControl(t *testing.T) {
 }
 
 func TestInterpreter_EvalUnary(t *testing.T) {
-	i := NewInterpreter(nil)
+	i := NewInterpreter(nil, nil)
 
 	minusTok := token.New(token.MINUS, "-", nil, 1, nil)
 	bangTok := token.New(token.BANG, "!", nil, 1, nil)
@@ -451,7 +576,7 @@ func TestInterpreter_EvalUnary(t *testing.T) {
 }
 
 func TestInterpreter_EvalLogical(t *testing.T) {
-	i := NewInterpreter(nil)
+	i := NewInterpreter(nil, nil)
 
 	andTok := token.New(token.AND, "and", nil, 1, nil)
 	orTok := token.New(token.OR, "or", nil, 1, nil)
@@ -532,7 +657,7 @@ func TestInterpreter_EvalLogical(t *testing.T) {
 
 func TestInterpreter_EvalWhile(t *testing.T) {
 	globals := objects.NewEnvironment(nil)
-	i := NewInterpreter(globals)
+	i := NewInterpreter(globals, nil)
 
 	// var x = 0; while (x < 3) { x = x + 1; }
 	xTok := token.New(token.IDENTIFIER, "x", nil, 1, nil)
@@ -570,9 +695,145 @@ func TestInterpreter_EvalWhile(t *testing.T) {
 	}
 }
 
+func TestInterpreter_EvalForIn(t *testing.T) {
+	globals := objects.NewEnvironment(nil)
+	i := NewInterpreter(globals, nil)
+
+	// var total = 0; for (var i, v in [10, 20, 30]) { if (i == 2) break; total = total + i + v; }
+	totalTok := token.New(token.IDENTIFIER, "total", nil, 1, nil)
+	iTok := token.New(token.IDENTIFIER, "i", nil, 1, nil)
+	vTok := token.New(token.IDENTIFIER, "v", nil, 1, nil)
+	forTok := token.New(token.FOR, "for", nil, 1, nil)
+	breakTok := token.New(token.BREAK, "break", nil, 1, nil)
+	plusTok := token.New(token.PLUS, "+", nil, 1, nil)
+	equalTok := token.New(token.EQUAL_EQUAL, "==", nil, 1, nil)
+	globals.Define("total", objects.NewNumber(0))
+
+	iCondExpr := &ast.VariableExpr{Name: &iTok}
+	iSumExpr := &ast.VariableExpr{Name: &iTok}
+	vSumExpr := &ast.VariableExpr{Name: &vTok}
+	stmt := &ast.ForInStmt{
+		Keyword:   &forTok,
+		Variables: []*token.Token{&iTok, &vTok},
+		Iterable: &ast.ArrayLiteralExpr{Elements: []ast.Expr{
+			&ast.LiteralExpr{Value: 10.0},
+			&ast.LiteralExpr{Value: 20.0},
+			&ast.LiteralExpr{Value: 30.0},
+		}},
+		Body: &ast.BlockStmt{
+			Statements: []ast.Stmt{
+				&ast.IfStmt{
+					Condition: &ast.BinaryExpr{
+						Left:     iCondExpr,
+						Operator: &equalTok,
+						Right:    &ast.LiteralExpr{Value: 2.0},
+					},
+					ThenBranch: &ast.BreakStmt{Keyword: &breakTok},
+				},
+				&ast.ExprStmt{
+					Expr: &ast.AssignExpr{
+						Name: &totalTok,
+						Value: &ast.BinaryExpr{
+							Left: &ast.BinaryExpr{
+								Left:     &ast.VariableExpr{Name: &totalTok},
+								Operator: &plusTok,
+								Right:    iSumExpr,
+							},
+							Operator: &plusTok,
+							Right:    vSumExpr,
+						},
+					},
+				},
+			},
+		},
+	}
+	// Loop variables live one scope above the body block
+	i.SetLocals(map[ast.Expr]int{
+		iCondExpr: 1,
+		iSumExpr:  1,
+		vSumExpr:  1,
+	})
+
+	if _, err := i.evalStmt(stmt); err != nil {
+		t.Fatalf("evalStmt() error = %v", err)
+	}
+
+	val, _ := globals.Get("total")
+	if val.(*objects.Number).Value != 31.0 {
+		t.Errorf("got %v, want 31", val.(*objects.Number).Value)
+	}
+
+	// Numbers are not iterable
+	stmt.Iterable = &ast.LiteralExpr{Value: 1.0}
+	if _, err := i.evalStmt(stmt); err == nil {
+		t.Error("expected error iterating over a number")
+	}
+}
+
+func TestInterpreter_RuntimeErrorStackTrace(t *testing.T) {
+	globals := objects.NewEnvironment(nil)
+	i := NewInterpreter(globals, nil)
+
+	// fun fail() {
+	//   return nil - 1;
+	// }
+	// fail();
+	filePath := "trace.viri"
+	failTok := token.New(token.IDENTIFIER, "fail", nil, 1, &filePath)
+	minusTok := token.New(token.MINUS, "-", nil, 2, &filePath)
+	parenTok := token.New(token.RIGHT_PAREN, ")", nil, 4, &filePath)
+	stmts := []ast.Stmt{
+		&ast.FunctionStmt{
+			Name:   &failTok,
+			Params: []*token.Token{},
+			Body: &ast.BlockStmt{
+				Statements: []ast.Stmt{
+					&ast.ReturnStmt{
+						Keyword: &token.Token{Type: token.RETURN, Lexeme: "return"},
+						Value: &ast.BinaryExpr{
+							Left:     &ast.LiteralExpr{Value: nil},
+							Operator: &minusTok,
+							Right:    &ast.LiteralExpr{Value: 1.0},
+						},
+					},
+				},
+			},
+		},
+		&ast.ExprStmt{
+			Expr: &ast.CallExpr{
+				Callee:       &ast.VariableExpr{Name: &failTok},
+				ClosingParen: &parenTok,
+				Arguments:    []ast.Expr{},
+			},
+		},
+	}
+
+	_, err := i.Interpret(stmts)
+	rtErr, ok := err.(*objects.RuntimeError)
+	if !ok {
+		t.Fatalf("expected RuntimeError, got %T (%v)", err, err)
+	}
+
+	want := []objects.StackFrame{
+		{Function: "<script>", FilePath: filePath, Line: 4},
+		{Function: "fail", FilePath: filePath, Line: 2},
+	}
+	if len(rtErr.Trace) != len(want) {
+		t.Fatalf("trace has %d frames, want %d: %v", len(rtErr.Trace), len(want), rtErr.Trace)
+	}
+	for idx, frame := range want {
+		if rtErr.Trace[idx] != frame {
+			t.Errorf("frame %d = %+v, want %+v", idx, rtErr.Trace[idx], frame)
+		}
+	}
+	if len(i.callStack) != 0 {
+		t.Errorf("call stack not unwound: %v", i.callStack)
+	}
+}
+
 func TestInterpreter_EvalFunctionExpr(t *testing.T) {
 	globals := objects.NewEnvironment(nil)
-	i := NewInterpreter(globals)
+	i := NewInterpreter(globals, nil)
 
 	// fun(x) { return x + 1; }
 	xTok := token.New(token.IDENTIFIER, "x", nil, 1, nil)
@@ -626,3 +887,133 @@ func TestInterpreter_EvalFunctionExpr(t *testing.T) {
 		t.Errorf("got %v, want 11.0", num.Value)
 	}
 }
+
+func TestInterpreter_EvalTryCatch(t *testing.T) {
+	globals := objects.NewEnvironment(nil)
+	i := NewInterpreter(globals, nil)
+
+	// var caught; var cleaned = false;
+	// try { [1][5]; } catch (e) { caught = e; } finally { cleaned = true; }
+	caughtTok := token.New(token.IDENTIFIER, "caught", nil, 1, nil)
+	cleanedTok := token.New(token.IDENTIFIER, "cleaned", nil, 1, nil)
+	eTok := token.New(token.IDENTIFIER, "e", nil, 2, nil)
+	tryTok := token.New(token.TRY, "try", nil, 1, nil)
+	bracketTok := token.New(token.RIGHT_BRACKET, "]", nil, 1, nil)
+	globals.Define("caught", objects.NewNil())
+	globals.Define("cleaned", objects.NewBool(false))
+
+	eVarExpr := &ast.VariableExpr{Name: &eTok}
+	stmt := &ast.TryStmt{
+		Keyword: &tryTok,
+		Body: &ast.BlockStmt{
+			Statements: []ast.Stmt{
+				&ast.ExprStmt{
+					Expr: &ast.IndexExpr{
+						Object:  &ast.ArrayLiteralExpr{Elements: []ast.Expr{&ast.LiteralExpr{Value: 1.0}}},
+						Index:   &ast.LiteralExpr{Value: 5.0},
+						Bracket: &bracketTok,
+					},
+				},
+			},
+		},
+		CatchParam: &eTok,
+		CatchBody: &ast.BlockStmt{
+			Statements: []ast.Stmt{
+				&ast.ExprStmt{Expr: &ast.AssignExpr{Name: &caughtTok, Value: eVarExpr}},
+			},
+		},
+		FinallyBody: &ast.BlockStmt{
+			Statements: []ast.Stmt{
+				&ast.ExprStmt{Expr: &ast.AssignExpr{Name: &cleanedTok, Value: &ast.LiteralExpr{Value: true}}},
+			},
+		},
+	}
+
+	i.SetLocals(map[ast.Expr]int{
+		eVarExpr: 0,
+	})
+
+	if _, err := i.evalStmt(stmt); err != nil {
+		t.Fatalf("evalStmt() error = %v", err)
+	}
+
+	caught, _ := globals.Get("caught")
+	errObj, ok := caught.(*objects.Error)
+	if !ok {
+		t.Fatalf("expected Error, got %T", caught)
+	}
+	if errObj.Message != "Index out of bounds." || errObj.Line != 1 {
+		t.Errorf("got %q at line %d, want %q at line 1", errObj.Message, errObj.Line, "Index out of bounds.")
+	}
+
+	cleaned, _ := globals.Get("cleaned")
+	if !objects.IsTruthy(cleaned) {
+		t.Errorf("finally block did not run")
+	}
+}
+
+func TestInterpreter_EvalThrow(t *testing.T) {
+	i := NewInterpreter(nil, nil)
+
+	// try { throw "boom"; } finally { }
+	throwTok := token.New(token.THROW, "throw", nil, 3, nil)
+	tryTok := token.New(token.TRY, "try", nil, 1, nil)
+	stmt := &ast.TryStmt{
+		Keyword: &tryTok,
+		Body: &ast.BlockStmt{
+			Statements: []ast.Stmt{
+				&ast.ThrowStmt{Keyword: &throwTok, Value: &ast.LiteralExpr{Value: "boom"}},
+			},
+		},
+		FinallyBody: &ast.BlockStmt{},
+	}
+
+	_, err := i.evalStmt(stmt)
+	rtErr, ok := err.(*objects.RuntimeError)
+	if !ok {
+		t.Fatalf("expected RuntimeError, got %T (%v)", err, err)
+	}
+	if rtErr.Message != "Uncaught exception: boom" || rtErr.Token.Line != 3 {
+		t.Errorf("got %q at line %d", rtErr.Message, rtErr.Token.Line)
+	}
+	if thrown, ok := rtErr.Thrown.(*objects.String); !ok || thrown.Value != "boom" {
+		t.Errorf("thrown value = %v, want boom", rtErr.Thrown)
+	}
+}
+
+func TestInterpreter_Limits(t *testing.T) {
+	// try { while (true) {} } catch (e) {}
+	spin := []ast.Stmt{&ast.TryStmt{
+		Body: &ast.BlockStmt{
+			Statements: []ast.Stmt{
+				&ast.WhileStmt{
+					Condition: &ast.LiteralExpr{Value: true},
+					Body:      &ast.BlockStmt{},
+				},
+			},
+		},
+		CatchParam: &token.Token{Type: token.IDENTIFIER, Lexeme: "e"},
+		CatchBody:  &ast.BlockStmt{},
+	}}
+
+	i := NewInterpreter(nil, nil)
+	i.SetLimits(objects.Limits{MaxSteps: 5000})
+	_, err := i.Interpret(spin)
+	if stepErr, ok := err.(*objects.StepLimitError); !ok || stepErr.Limit != 5000 {
+		t.Errorf("expected a step limit error, got %v", err)
+	}
+
+	i = NewInterpreter(nil, nil)
+	i.SetLimits(objects.Limits{Timeout: 10 * time.Millisecond})
+	_, err = i.Interpret(spin)
+	if _, ok := err.(*objects.TimeoutError); !ok {
+		t.Errorf("expected a timeout error, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = NewInterpreter(nil, nil).InterpretContext(ctx, spin)
+	if cancelErr, ok := err.(*objects.CanceledError); !ok || cancelErr.Err != context.Canceled {
+		t.Errorf("expected a canceled error, got %v", err)
+	}
+}
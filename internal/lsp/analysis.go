@@ -0,0 +1,589 @@
+package lsp
+
+import (
+	"bytes"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/harshagw/viri/internal/ast"
+	"github.com/harshagw/viri/internal/objects"
+	"github.com/harshagw/viri/internal/parser"
+	"github.com/harshagw/viri/internal/scanner"
+	"github.com/harshagw/viri/internal/token"
+)
+
+type symbolKind int
+
+const (
+	kindVariable symbolKind = iota
+	kindConstant
+	kindFunction
+	kindClass
+	kindMethod
+	kindParameter
+	kindModule // an import alias
+	kindNative
+)
+
+// symbolKey identifies a declaration across analyses, which each parse
+// their own copy of imported files.
+type symbolKey struct {
+	path   string
+	offset int
+	name   string
+}
+
+// symbol is a declared name.
+type symbol struct {
+	name     string
+	kind     symbolKind
+	path     string // declaring file, "" for natives
+	offset   int    // byte offset of the declaring token
+	end      int    // byte offset just past the declaration, for document symbols
+	params   []*token.Token
+	arity    int       // number of arguments for natives, -1 if variadic
+	doc      string    // description of a native
+	class    *symbol   // owning class of a method
+	children []*symbol // methods of a class
+	module   string    // imported file of an import alias
+	detail   string    // import path of an import alias
+	exported bool
+}
+
+func (s *symbol) key() symbolKey {
+	return symbolKey{path: s.path, offset: s.offset, name: s.name}
+}
+
+// reference is an occurrence of a name in the analysed file, either where it
+// is declared or where it is used.
+type reference struct {
+	offset int
+	length int
+	target *symbol
+	decl   bool
+}
+
+// analysis is everything known about one version of a document.
+type analysis struct {
+	path        string
+	text        *text
+	module      *ast.Module
+	parsed      bool // true when the file parsed without errors
+	diagnostics []Diagnostic
+
+	symbols map[*token.Token]*symbol // declaring token -> symbol
+	globals []*symbol                // top-level declarations in source order
+	refs    []reference              // in source order
+	imports map[string]*ast.Module   // imported file path -> module
+	exports map[string]map[string]*symbol
+}
+
+var nativeSymbols = func() map[string]*symbol {
+	builtins := objects.DefaultNatives().Functions()
+	natives := make(map[string]*symbol, len(builtins))
+	for _, fn := range builtins {
+		natives[fn.Name] = &symbol{name: fn.Name, kind: kindNative, arity: fn.NumArgs, doc: fn.Doc}
+	}
+	return natives
+}()
+
+// analyze scans, parses and resolves source as the file at path and indexes
+// its declarations and references.
+func analyze(path, source string) *analysis {
+	a := &analysis{
+		path:    path,
+		text:    newText(source),
+		symbols: make(map[*token.Token]*symbol),
+		imports: make(map[string]*ast.Module),
+		exports: make(map[string]map[string]*symbol),
+	}
+
+	filePath := path
+	sc := scanner.New(bytes.NewBufferString(source), &filePath)
+	tokens, err := sc.Scan()
+	if err != nil {
+		a.diagnostics = append(a.diagnostics, Diagnostic{
+			Range:    a.text.span(sc.Offset(), 0),
+			Severity: SeverityError,
+			Source:   "viri",
+			Message:  err.Error(),
+		})
+		return a
+	}
+
+	parseDiagnostics := &objects.DiagnosticCollector{}
+	mod, err := parser.ParseModule(tokens, path, parseDiagnostics)
+	a.module = mod
+	a.parsed = err == nil
+	a.addDiagnostics(parseDiagnostics)
+
+	// A partial tree still resolves, but its diagnostics would mostly be
+	// noise caused by the parse errors
+	resolveDiagnostics := &objects.DiagnosticCollector{}
+	resolver := parser.NewResolver(resolveDiagnostics)
+	resolver.Resolve(mod)
+	if a.parsed {
+		a.addDiagnostics(resolveDiagnostics)
+	}
+	a.imports = resolver.GetResolvedModules()
+
+	a.index(resolver.GetDeclarations())
+	return a
+}
+
+func (a *analysis) addDiagnostics(collector *objects.DiagnosticCollector) {
+	add := func(diagnostics []objects.Diagnostic, severity DiagnosticSeverity) {
+		for _, d := range diagnostics {
+			// Problems inside imported files are reported on their import
+			if d.Token.FilePath == nil || *d.Token.FilePath != a.path {
+				continue
+			}
+			a.diagnostics = append(a.diagnostics, Diagnostic{
+				Range:    a.text.span(d.Token.Offset, len(d.Token.Lexeme)),
+				Severity: severity,
+				Source:   "viri",
+				Message:  d.Message,
+			})
+		}
+	}
+	add(collector.Errors, SeverityError)
+	add(collector.Warnings, SeverityWarning)
+}
+
+// index records every declaration, then links each use of a name to the
+// declaration it refers to.
+func (a *analysis) index(declarations map[*token.Token]*token.Token) {
+	for _, stmt := range a.module.GetAllStatements() {
+		if sym := a.declareStmt(stmt, nil); sym != nil {
+			a.globals = append(a.globals, sym)
+		}
+		ast.Inspect(stmt, a.declareNested)
+	}
+
+	for _, stmt := range a.module.GetAllStatements() {
+		a.linkUses(stmt, nil, declarations)
+	}
+	sort.Slice(a.refs, func(i, j int) bool { return a.refs[i].offset < a.refs[j].offset })
+}
+
+// declareStmt declares the name a statement introduces in its scope.
+func (a *analysis) declareStmt(stmt ast.Stmt, class *symbol) *symbol {
+	switch s := stmt.(type) {
+	case *ast.VarDeclStmt:
+		kind := kindVariable
+		if s.IsConst {
+			kind = kindConstant
+		}
+		sym := a.declare(s.Name, kind)
+		sym.exported = s.Exported
+		return sym
+	case *ast.FunctionStmt:
+		kind := kindFunction
+		if class != nil {
+			kind = kindMethod
+		}
+		sym := a.declare(s.Name, kind)
+		sym.params, sym.class, sym.exported = s.Params, class, s.Exported
+		sym.end = endOf(s.Body)
+		return sym
+	case *ast.ClassStmt:
+		sym := a.declare(s.Name, kindClass)
+		sym.exported = s.Exported
+		for _, method := range s.Methods {
+			m := a.declareStmt(method, sym)
+			sym.children = append(sym.children, m)
+			sym.end = m.end
+		}
+		return sym
+	case *ast.ImportStmt:
+		if s.Alias == nil {
+			return nil
+		}
+		sym := a.declare(s.Alias, kindModule)
+		if importPath, ok := s.Path.Literal.(string); ok {
+			sym.detail = importPath
+			sym.module, _ = parser.ResolveModulePath(filepath.Dir(a.path), importPath)
+		}
+		return sym
+	}
+	return nil
+}
+
+// declareNested declares everything below the top level: locals,
+// parameters, loop and catch variables.
+func (a *analysis) declareNested(node ast.Node) bool {
+	switch n := node.(type) {
+	case *ast.BlockStmt:
+		for _, stmt := range n.Statements {
+			a.declareStmt(stmt, nil)
+		}
+	case *ast.ForStmt:
+		if n.Initializer != nil {
+			a.declareStmt(n.Initializer, nil)
+		}
+	case *ast.FunctionStmt:
+		a.declareParams(n.Params)
+	case *ast.FunctionExpr:
+		a.declareParams(n.Params)
+	case *ast.ForInStmt:
+		for _, variable := range n.Variables {
+			a.declare(variable, kindVariable)
+		}
+	case *ast.TryStmt:
+		if n.CatchParam != nil {
+			a.declare(n.CatchParam, kindVariable)
+		}
+	}
+	return true
+}
+
+func (a *analysis) declareParams(params []*token.Token) {
+	for _, param := range params {
+		a.declare(param, kindParameter)
+	}
+}
+
+func (a *analysis) declare(name *token.Token, kind symbolKind) *symbol {
+	if sym, ok := a.symbols[name]; ok {
+		return sym
+	}
+	sym := &symbol{
+		name:   name.Lexeme,
+		kind:   kind,
+		path:   a.path,
+		offset: name.Offset,
+		end:    name.Offset + len(name.Lexeme),
+	}
+	a.symbols[name] = sym
+	a.refs = append(a.refs, reference{offset: name.Offset, length: len(name.Lexeme), target: sym, decl: true})
+	return sym
+}
+
+// linkUses records a reference for every name used under node. class is
+// the class whose methods are being walked, for resolving this.name.
+func (a *analysis) linkUses(node ast.Node, class *symbol, declarations map[*token.Token]*token.Token) {
+	ast.Inspect(node, func(node ast.Node) bool {
+		switch n := node.(type) {
+		case *ast.ClassStmt:
+			if n.SuperClass != nil {
+				a.linkName(n.SuperClass.Name, declarations)
+			}
+			sym := a.symbols[n.Name]
+			for _, method := range n.Methods {
+				a.linkUses(method, sym, declarations)
+			}
+			return false
+		case *ast.VariableExpr:
+			a.linkName(n.Name, declarations)
+		case *ast.AssignExpr:
+			a.linkName(n.Name, declarations)
+		case *ast.GetExpr:
+			a.linkProperty(n.Object, n.Name, class, declarations)
+		case *ast.SetExpr:
+			a.linkProperty(n.Object, n.Name, class, declarations)
+		}
+		return true
+	})
+}
+
+func (a *analysis) linkName(name *token.Token, declarations map[*token.Token]*token.Token) {
+	target := a.lookup(name, declarations)
+	if target == nil {
+		return
+	}
+	a.refs = append(a.refs, reference{offset: name.Offset, length: len(name.Lexeme), target: target})
+}
+
+// lookup finds the declaration a name refers to: the binding the resolver
+// chose, else a global declared later in the file, else a native.
+func (a *analysis) lookup(name *token.Token, declarations map[*token.Token]*token.Token) *symbol {
+	if decl, ok := declarations[name]; ok {
+		if sym, ok := a.symbols[decl]; ok {
+			return sym
+		}
+	}
+	for _, sym := range a.globals {
+		if sym.name == name.Lexeme {
+			return sym
+		}
+	}
+	return nativeSymbols[name.Lexeme]
+}
+
+// linkProperty links module.export and this.method.
+func (a *analysis) linkProperty(object ast.Expr, name *token.Token, class *symbol, declarations map[*token.Token]*token.Token) {
+	var target *symbol
+	switch obj := object.(type) {
+	case *ast.VariableExpr:
+		if sym := a.lookup(obj.Name, declarations); sym != nil && sym.kind == kindModule {
+			target = a.moduleExports(sym.module)[name.Lexeme]
+		}
+	case *ast.ThisExpr:
+		if class != nil {
+			for _, method := range class.children {
+				if method.name == name.Lexeme {
+					target = method
+				}
+			}
+		}
+	}
+	if target != nil {
+		a.refs = append(a.refs, reference{offset: name.Offset, length: len(name.Lexeme), target: target})
+	}
+}
+
+// moduleExports returns the exported declarations of an imported file.
+func (a *analysis) moduleExports(path string) map[string]*symbol {
+	if exports, ok := a.exports[path]; ok {
+		return exports
+	}
+	exports := make(map[string]*symbol)
+	a.exports[path] = exports
+
+	mod, ok := a.imports[path]
+	if !ok {
+		return exports
+	}
+	imported := &analysis{path: path, symbols: make(map[*token.Token]*symbol)}
+	for _, stmt := range mod.Statements {
+		if sym := imported.declareStmt(stmt, nil); sym != nil && sym.exported {
+			exports[sym.name] = sym
+		}
+	}
+	return exports
+}
+
+// referenceAt returns the symbol named at offset, if any. An offset just
+// past the end of a name still counts, as that is where the cursor sits
+// after typing it.
+func (a *analysis) referenceAt(offset int) *symbol {
+	for _, ref := range a.refs {
+		if ref.offset <= offset && offset <= ref.offset+ref.length {
+			return ref.target
+		}
+	}
+	return nil
+}
+
+// importAt returns the import whose path string contains offset.
+func (a *analysis) importAt(offset int) *ast.ImportStmt {
+	if a.module == nil {
+		return nil
+	}
+	for _, imp := range a.module.Imports {
+		if imp.Path.Offset <= offset && offset < imp.Path.Offset+len(imp.Path.Lexeme) {
+			return imp
+		}
+	}
+	return nil
+}
+
+// visibleAt returns the locals in scope at offset, innermost last. Globals
+// are visible everywhere and are not included.
+func (a *analysis) visibleAt(offset int) []*symbol {
+	var visible []*symbol
+	if a.module == nil {
+		return nil
+	}
+	add := func(names ...*token.Token) {
+		for _, name := range names {
+			if sym, ok := a.symbols[name]; ok && name.Offset < offset {
+				visible = append(visible, sym)
+			}
+		}
+	}
+
+	for _, stmt := range a.module.GetAllStatements() {
+		ast.Inspect(stmt, func(node ast.Node) bool {
+			switch n := node.(type) {
+			case *ast.BlockStmt:
+				if !contains(n, offset) {
+					return false
+				}
+				for _, stmt := range n.Statements {
+					if name := declaredName(stmt); name != nil {
+						add(name)
+					}
+				}
+			case *ast.FunctionStmt:
+				if contains(n.Body, offset) {
+					add(n.Params...)
+				}
+			case *ast.FunctionExpr:
+				if contains(n.Body, offset) {
+					add(n.Params...)
+				}
+			case *ast.ForStmt:
+				if decl, ok := n.Initializer.(*ast.VarDeclStmt); ok && contains(n.Body, offset) {
+					add(decl.Name)
+				}
+			case *ast.ForInStmt:
+				if contains(n.Body, offset) {
+					add(n.Variables...)
+				}
+			case *ast.TryStmt:
+				if n.CatchParam != nil && contains(n.CatchBody, offset) {
+					add(n.CatchParam)
+				}
+			}
+			return true
+		})
+	}
+	return visible
+}
+
+// scopeOf returns the symbols declared in the same scope as sym, sym
+// included, following the scopes the resolver opens.
+func (a *analysis) scopeOf(sym *symbol) []*symbol {
+	if sym.kind == kindMethod && sym.class != nil {
+		return sym.class.children
+	}
+	if a.module == nil {
+		return nil
+	}
+	var scope []*symbol
+	check := func(names []*token.Token) {
+		for _, name := range names {
+			if a.symbols[name] != sym {
+				continue
+			}
+			for _, name := range names {
+				if declared, ok := a.symbols[name]; ok {
+					scope = append(scope, declared)
+				}
+			}
+			return
+		}
+	}
+	// A function's body and a catch body share the scope of their
+	// parameters, so they are checked before their blocks are visited
+	function := func(params []*token.Token, body *ast.BlockStmt) {
+		names := append([]*token.Token(nil), params...)
+		if body != nil {
+			names = append(names, scopeNames(body.Statements)...)
+		}
+		check(names)
+	}
+
+	statements := a.module.GetAllStatements()
+	check(scopeNames(statements))
+	for _, stmt := range statements {
+		ast.Inspect(stmt, func(node ast.Node) bool {
+			if scope != nil {
+				return false
+			}
+			switch n := node.(type) {
+			case *ast.BlockStmt:
+				check(scopeNames(n.Statements))
+			case *ast.FunctionStmt:
+				function(n.Params, n.Body)
+			case *ast.FunctionExpr:
+				function(n.Params, n.Body)
+			case *ast.ForInStmt:
+				check(n.Variables)
+			case *ast.TryStmt:
+				if n.CatchParam != nil {
+					function([]*token.Token{n.CatchParam}, n.CatchBody)
+				}
+			}
+			return true
+		})
+	}
+	return scope
+}
+
+// scopeNames returns the names statements declare in their own scope,
+// including the variables of for loops, which open no scope of their own.
+func scopeNames(statements []ast.Stmt) []*token.Token {
+	var names []*token.Token
+	for _, stmt := range statements {
+		if name := declaredName(stmt); name != nil {
+			names = append(names, name)
+		}
+		if loop, ok := stmt.(*ast.ForStmt); ok {
+			if decl, ok := loop.Initializer.(*ast.VarDeclStmt); ok {
+				names = append(names, decl.Name)
+			}
+		}
+	}
+	return names
+}
+
+// contains reports whether offset is between the braces of a block.
+func contains(node ast.Node, offset int) bool {
+	block, ok := node.(*ast.BlockStmt)
+	if !ok || block == nil || block.LeftBrace == nil || block.RightBrace == nil {
+		return false
+	}
+	return block.LeftBrace.Offset < offset && offset <= block.RightBrace.Offset
+}
+
+func declaredName(stmt ast.Stmt) *token.Token {
+	switch s := stmt.(type) {
+	case *ast.VarDeclStmt:
+		return s.Name
+	case *ast.FunctionStmt:
+		return s.Name
+	case *ast.ClassStmt:
+		return s.Name
+	case *ast.ImportStmt:
+		return s.Alias
+	}
+	return nil
+}
+
+func endOf(block *ast.BlockStmt) int {
+	if block == nil || block.RightBrace == nil {
+		return 0
+	}
+	return block.RightBrace.Offset + 1
+}
+
+// signature describes a symbol the way hover and completion show it.
+func (s *symbol) signature() string {
+	params := func() string {
+		names := make([]string, len(s.params))
+		for i, param := range s.params {
+			names[i] = param.Lexeme
+		}
+		return strings.Join(names, ", ")
+	}
+
+	switch s.kind {
+	case kindConstant:
+		return "const " + s.name
+	case kindFunction:
+		return "fun " + s.name + "(" + params() + ")"
+	case kindMethod:
+		return "fun " + s.class.name + "." + s.name + "(" + params() + ")"
+	case kindClass:
+		return "class " + s.name
+	case kindParameter:
+		return "param " + s.name
+	case kindModule:
+		return "import \"" + s.detail + "\" as " + s.name
+	case kindNative:
+		return "native fun " + s.name
+	}
+	return "var " + s.name
+}
+
+// arityOf returns the number of arguments a call to the symbol takes, or
+// false if it is not callable.
+func (s *symbol) arityOf() (int, bool) {
+	switch s.kind {
+	case kindFunction, kindMethod:
+		return len(s.params), true
+	case kindNative:
+		return s.arity, true
+	case kindClass:
+		for _, method := range s.children {
+			if method.name == "init" {
+				return len(method.params), true
+			}
+		}
+		return 0, true
+	}
+	return 0, false
+}
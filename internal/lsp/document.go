@@ -0,0 +1,93 @@
+package lsp
+
+import (
+	"net/url"
+	"strings"
+	"unicode/utf8"
+)
+
+// text is a source file indexed by line for converting between byte offsets
+// and protocol positions, which count UTF-16 code units.
+type text struct {
+	content    string
+	lineStarts []int
+}
+
+func newText(content string) *text {
+	lineStarts := []int{0}
+	for i := 0; i < len(content); i++ {
+		if content[i] == '\n' {
+			lineStarts = append(lineStarts, i+1)
+		}
+	}
+	return &text{content: content, lineStarts: lineStarts}
+}
+
+// position converts a byte offset to a protocol position.
+func (t *text) position(offset int) Position {
+	if offset > len(t.content) {
+		offset = len(t.content)
+	}
+	line := 0
+	for line+1 < len(t.lineStarts) && t.lineStarts[line+1] <= offset {
+		line++
+	}
+
+	character := 0
+	for _, r := range t.content[t.lineStarts[line]:offset] {
+		character += utf16Len(r)
+	}
+	return Position{Line: line, Character: character}
+}
+
+// offset converts a protocol position to a byte offset, clamping positions
+// past the end of a line or of the file.
+func (t *text) offset(pos Position) int {
+	if pos.Line < 0 {
+		return 0
+	}
+	if pos.Line >= len(t.lineStarts) {
+		return len(t.content)
+	}
+
+	offset := t.lineStarts[pos.Line]
+	character := 0
+	for character < pos.Character && offset < len(t.content) {
+		r, size := utf8.DecodeRuneInString(t.content[offset:])
+		if r == '\n' {
+			break
+		}
+		character += utf16Len(r)
+		offset += size
+	}
+	return offset
+}
+
+// span returns the range of length bytes starting at offset.
+func (t *text) span(offset, length int) Range {
+	return Range{Start: t.position(offset), End: t.position(offset + length)}
+}
+
+func utf16Len(r rune) int {
+	if r >= 0x10000 {
+		return 2
+	}
+	return 1
+}
+
+// uriToPath returns the file path of a file:// URI, or the URI itself for
+// other schemes such as unsaved buffers.
+func uriToPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return uri
+	}
+	return u.Path
+}
+
+func pathToURI(path string) string {
+	if strings.Contains(path, "://") || strings.HasPrefix(path, "untitled:") {
+		return path
+	}
+	return (&url.URL{Scheme: "file", Path: path}).String()
+}
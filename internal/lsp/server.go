@@ -0,0 +1,513 @@
+// Package lsp implements a Language Server Protocol server for Viri on top
+// of the scanner, parser and resolver.
+package lsp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"unicode"
+
+	"github.com/harshagw/viri/internal/parser"
+	"github.com/harshagw/viri/internal/token"
+)
+
+// ErrExitWithoutShutdown is returned by Run when the client sends exit
+// without a shutdown request first.
+var ErrExitWithoutShutdown = errors.New("exit before shutdown")
+
+// document is an open text document.
+type document struct {
+	uri      string
+	analysis *analysis
+	lastGood *analysis // latest version that parsed, for completing broken code
+}
+
+type Server struct {
+	conn     *conn
+	docs     map[string]*document // uri -> open document
+	shutdown bool
+}
+
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		conn: newConn(in, out),
+		docs: make(map[string]*document),
+	}
+}
+
+// Run serves requests until the client sends exit or closes the input.
+func (s *Server) Run() error {
+	for {
+		msg, err := s.conn.read()
+		if err == io.EOF {
+			return nil
+		}
+		if rpcErr, ok := err.(*responseError); ok {
+			if err := s.conn.reply(json.RawMessage("null"), nil, rpcErr); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if msg.Method == "exit" {
+			if !s.shutdown {
+				return ErrExitWithoutShutdown
+			}
+			return nil
+		}
+
+		if msg.ID == nil {
+			s.handleNotification(msg)
+			continue
+		}
+		result, err := s.handleRequest(msg)
+		if err := s.conn.reply(msg.ID, result, err); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Server) handleNotification(msg *message) {
+	switch msg.Method {
+	case "textDocument/didOpen":
+		var params DidOpenTextDocumentParams
+		if json.Unmarshal(msg.Params, &params) == nil {
+			s.update(params.TextDocument.URI, params.TextDocument.Text)
+		}
+	case "textDocument/didChange":
+		var params DidChangeTextDocumentParams
+		if json.Unmarshal(msg.Params, &params) == nil && len(params.ContentChanges) > 0 {
+			// Documents are synced in full, so the last change is the whole text
+			s.update(params.TextDocument.URI, params.ContentChanges[len(params.ContentChanges)-1].Text)
+		}
+	case "textDocument/didClose":
+		var params DidCloseTextDocumentParams
+		if json.Unmarshal(msg.Params, &params) == nil {
+			delete(s.docs, params.TextDocument.URI)
+			s.conn.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{
+				URI:         params.TextDocument.URI,
+				Diagnostics: []Diagnostic{},
+			})
+		}
+	}
+}
+
+func (s *Server) handleRequest(msg *message) (interface{}, error) {
+	if s.shutdown {
+		return nil, &responseError{Code: codeInvalidRequest, Message: "server is shutting down"}
+	}
+
+	switch msg.Method {
+	case "initialize":
+		return s.initialize(), nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+	case "textDocument/definition":
+		var params TextDocumentPositionParams
+		if err := decodeParams(msg, &params); err != nil {
+			return nil, err
+		}
+		return s.definition(params)
+	case "textDocument/references":
+		var params ReferenceParams
+		if err := decodeParams(msg, &params); err != nil {
+			return nil, err
+		}
+		return s.references(params)
+	case "textDocument/documentSymbol":
+		var params DocumentSymbolParams
+		if err := decodeParams(msg, &params); err != nil {
+			return nil, err
+		}
+		return s.documentSymbols(params)
+	case "textDocument/hover":
+		var params TextDocumentPositionParams
+		if err := decodeParams(msg, &params); err != nil {
+			return nil, err
+		}
+		return s.hover(params)
+	case "textDocument/completion":
+		var params TextDocumentPositionParams
+		if err := decodeParams(msg, &params); err != nil {
+			return nil, err
+		}
+		return s.completion(params)
+	case "textDocument/rename":
+		var params RenameParams
+		if err := decodeParams(msg, &params); err != nil {
+			return nil, err
+		}
+		return s.rename(params)
+	}
+	return nil, &responseError{Code: codeMethodNotFound, Message: "method not found: " + msg.Method}
+}
+
+func decodeParams(msg *message, params interface{}) error {
+	if err := json.Unmarshal(msg.Params, params); err != nil {
+		return &responseError{Code: codeInvalidParams, Message: err.Error()}
+	}
+	return nil
+}
+
+func (s *Server) initialize() interface{} {
+	return map[string]interface{}{
+		"capabilities": map[string]interface{}{
+			"textDocumentSync":       1, // full
+			"definitionProvider":     true,
+			"referencesProvider":     true,
+			"documentSymbolProvider": true,
+			"hoverProvider":          true,
+			"renameProvider":         true,
+			"completionProvider": map[string]interface{}{
+				"triggerCharacters": []string{"."},
+			},
+		},
+		"serverInfo": map[string]string{"name": "viri-lsp"},
+	}
+}
+
+// update re-analyses a document and publishes its diagnostics.
+func (s *Server) update(uri, content string) {
+	doc, ok := s.docs[uri]
+	if !ok {
+		doc = &document{uri: uri}
+		s.docs[uri] = doc
+	}
+	doc.analysis = analyze(uriToPath(uri), content)
+	if doc.analysis.parsed {
+		doc.lastGood = doc.analysis
+	}
+
+	diagnostics := doc.analysis.diagnostics
+	if diagnostics == nil {
+		diagnostics = []Diagnostic{}
+	}
+	s.conn.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{URI: uri, Diagnostics: diagnostics})
+}
+
+func (s *Server) document(uri string) (*document, error) {
+	doc, ok := s.docs[uri]
+	if !ok {
+		return nil, &responseError{Code: codeInvalidParams, Message: "document not open: " + uri}
+	}
+	return doc, nil
+}
+
+// symbolAt returns the analysis of a document and the symbol named at pos.
+func (s *Server) symbolAt(params TextDocumentPositionParams) (*analysis, *symbol, error) {
+	doc, err := s.document(params.TextDocument.URI)
+	if err != nil {
+		return nil, nil, err
+	}
+	a := doc.analysis
+	return a, a.referenceAt(a.text.offset(params.Position)), nil
+}
+
+func (s *Server) definition(params TextDocumentPositionParams) (interface{}, error) {
+	a, sym, err := s.symbolAt(params)
+	if err != nil {
+		return nil, err
+	}
+
+	// Jumping from an import path opens the imported file
+	if imp := a.importAt(a.text.offset(params.Position)); imp != nil {
+		if importPath, ok := imp.Path.Literal.(string); ok {
+			return []Location{{URI: pathToURI(resolveImport(a.path, importPath))}}, nil
+		}
+	}
+
+	if sym == nil || sym.kind == kindNative {
+		return nil, nil
+	}
+	loc, ok := s.location(sym.path, sym.offset, len(sym.name))
+	if !ok {
+		return nil, nil
+	}
+	return []Location{loc}, nil
+}
+
+// location returns the location of length bytes at offset in the file at
+// path, reading the file unless it is open.
+func (s *Server) location(path string, offset, length int) (Location, bool) {
+	uri := pathToURI(path)
+	if doc, ok := s.docs[uri]; ok {
+		return Location{URI: uri, Range: doc.analysis.text.span(offset, length)}, true
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return Location{}, false
+	}
+	return Location{URI: uri, Range: newText(string(content)).span(offset, length)}, true
+}
+
+func (s *Server) references(params ReferenceParams) (interface{}, error) {
+	_, sym, err := s.symbolAt(params.TextDocumentPositionParams)
+	if err != nil {
+		return nil, err
+	}
+	if sym == nil {
+		return []Location{}, nil
+	}
+	return s.occurrences(sym, params.Context.IncludeDeclaration), nil
+}
+
+// occurrences finds every reference to sym in the open documents, plus its
+// declaration if asked for and sym is declared in a file that is not open.
+func (s *Server) occurrences(sym *symbol, includeDeclaration bool) []Location {
+	key := sym.key()
+	locations := []Location{}
+	declarationFound := false
+
+	for _, uri := range s.sortedURIs() {
+		a := s.docs[uri].analysis
+		for _, ref := range a.refs {
+			if ref.target.key() != key || (ref.decl && !includeDeclaration) {
+				continue
+			}
+			declarationFound = declarationFound || ref.decl
+			locations = append(locations, Location{URI: uri, Range: a.text.span(ref.offset, ref.length)})
+		}
+	}
+
+	if includeDeclaration && !declarationFound && sym.kind != kindNative {
+		if loc, ok := s.location(sym.path, sym.offset, len(sym.name)); ok {
+			locations = append(locations, loc)
+		}
+	}
+	return locations
+}
+
+func (s *Server) sortedURIs() []string {
+	uris := make([]string, 0, len(s.docs))
+	for uri := range s.docs {
+		uris = append(uris, uri)
+	}
+	sort.Strings(uris)
+	return uris
+}
+
+func (s *Server) documentSymbols(params DocumentSymbolParams) (interface{}, error) {
+	doc, err := s.document(params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	a := doc.analysis
+
+	var convert func(sym *symbol) DocumentSymbol
+	convert = func(sym *symbol) DocumentSymbol {
+		ds := DocumentSymbol{
+			Name:           sym.name,
+			Detail:         sym.signature(),
+			Kind:           symbolKindOf(sym),
+			Range:          Range{Start: a.text.position(sym.offset), End: a.text.position(sym.end)},
+			SelectionRange: a.text.span(sym.offset, len(sym.name)),
+		}
+		for _, child := range sym.children {
+			ds.Children = append(ds.Children, convert(child))
+		}
+		return ds
+	}
+
+	symbols := []DocumentSymbol{}
+	for _, sym := range a.globals {
+		symbols = append(symbols, convert(sym))
+	}
+	return symbols, nil
+}
+
+func symbolKindOf(sym *symbol) SymbolKind {
+	switch sym.kind {
+	case kindConstant:
+		return SymbolConstant
+	case kindFunction:
+		return SymbolFunction
+	case kindClass:
+		return SymbolClass
+	case kindMethod:
+		return SymbolMethod
+	case kindModule:
+		return SymbolModule
+	}
+	return SymbolVariable
+}
+
+func (s *Server) hover(params TextDocumentPositionParams) (interface{}, error) {
+	a, sym, err := s.symbolAt(params)
+	if err != nil || sym == nil {
+		return nil, err
+	}
+
+	value := "```viri\n" + sym.signature() + "\n```"
+	if sym.doc != "" {
+		value += "\n\n" + sym.doc
+	}
+	if arity, ok := sym.arityOf(); ok {
+		if arity < 0 {
+			value += "\n\nTakes any number of arguments."
+		} else {
+			value += fmt.Sprintf("\n\nArity: %d", arity)
+		}
+	}
+
+	hover := Hover{Contents: MarkupContent{Kind: "markdown", Value: value}}
+	offset := a.text.offset(params.Position)
+	for _, ref := range a.refs {
+		if ref.offset <= offset && offset <= ref.offset+ref.length {
+			r := a.text.span(ref.offset, ref.length)
+			hover.Range = &r
+			break
+		}
+	}
+	return hover, nil
+}
+
+func (s *Server) completion(params TextDocumentPositionParams) (interface{}, error) {
+	doc, err := s.document(params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	content := doc.analysis.text.content
+	offset := doc.analysis.text.offset(params.Position)
+
+	// Skip back over the word being typed
+	start := offset
+	for start > 0 && isIdentifierByte(content[start-1]) {
+		start--
+	}
+
+	// Code being edited rarely parses, so scopes come from the last version
+	// that did
+	a := doc.analysis
+	if !a.parsed && doc.lastGood != nil {
+		a = doc.lastGood
+	}
+
+	items := []CompletionItem{}
+	if start > 0 && content[start-1] == '.' {
+		// After "alias." offer what the imported file exports
+		end := start - 1
+		begin := end
+		for begin > 0 && isIdentifierByte(content[begin-1]) {
+			begin--
+		}
+		alias := content[begin:end]
+		for _, sym := range a.globals {
+			if sym.kind == kindModule && sym.name == alias {
+				for _, export := range sortedSymbols(a.moduleExports(sym.module)) {
+					items = append(items, completionItem(export))
+				}
+			}
+		}
+		return items, nil
+	}
+
+	seen := make(map[string]bool)
+	addItem := func(sym *symbol) {
+		if !seen[sym.name] {
+			seen[sym.name] = true
+			items = append(items, completionItem(sym))
+		}
+	}
+
+	// Inner declarations shadow outer ones
+	locals := a.visibleAt(offset)
+	for i := len(locals) - 1; i >= 0; i-- {
+		addItem(locals[i])
+	}
+	for _, sym := range a.globals {
+		addItem(sym)
+	}
+	for _, sym := range sortedSymbols(nativeSymbols) {
+		addItem(sym)
+	}
+	return items, nil
+}
+
+func completionItem(sym *symbol) CompletionItem {
+	kind := CompletionVariable
+	switch sym.kind {
+	case kindConstant:
+		kind = CompletionConstant
+	case kindFunction, kindNative:
+		kind = CompletionFunction
+	case kindMethod:
+		kind = CompletionMethod
+	case kindClass:
+		kind = CompletionClass
+	case kindModule:
+		kind = CompletionModule
+	}
+	return CompletionItem{Label: sym.name, Kind: kind, Detail: sym.signature()}
+}
+
+func sortedSymbols(symbols map[string]*symbol) []*symbol {
+	sorted := make([]*symbol, 0, len(symbols))
+	for _, sym := range symbols {
+		sorted = append(sorted, sym)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].name < sorted[j].name })
+	return sorted
+}
+
+func (s *Server) rename(params RenameParams) (interface{}, error) {
+	a, sym, err := s.symbolAt(params.TextDocumentPositionParams)
+	if err != nil {
+		return nil, err
+	}
+	if sym == nil {
+		return nil, &responseError{Code: codeRequestFailed, Message: "no symbol to rename"}
+	}
+	if sym.kind == kindNative {
+		return nil, &responseError{Code: codeRequestFailed, Message: "cannot rename native function '" + sym.name + "'"}
+	}
+	if !isIdentifier(params.NewName) {
+		return nil, &responseError{Code: codeRequestFailed, Message: "'" + params.NewName + "' is not a valid name"}
+	}
+	for _, other := range a.scopeOf(sym) {
+		if other != sym && other.name == params.NewName {
+			return nil, &responseError{Code: codeRequestFailed, Message: "'" + params.NewName + "' is already declared in this scope"}
+		}
+	}
+
+	edit := WorkspaceEdit{Changes: make(map[string][]TextEdit)}
+	for _, loc := range s.occurrences(sym, true) {
+		edit.Changes[loc.URI] = append(edit.Changes[loc.URI], TextEdit{Range: loc.Range, NewText: params.NewName})
+	}
+	return edit, nil
+}
+
+// resolveImport returns the file an import in the file at path refers to.
+func resolveImport(path, importPath string) string {
+	resolved, err := parser.ResolveModulePath(filepath.Dir(path), importPath)
+	if err != nil {
+		return importPath
+	}
+	return resolved
+}
+
+// isIdentifierByte matches the bytes the scanner accepts in identifiers.
+func isIdentifierByte(c byte) bool {
+	return unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c))
+}
+
+// isIdentifier reports whether name scans as a single identifier.
+func isIdentifier(name string) bool {
+	if name == "" || !unicode.IsLetter(rune(name[0])) || token.LookupKeyword(name) != token.IDENTIFIER {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		if !isIdentifierByte(name[i]) {
+			return false
+		}
+	}
+	return true
+}
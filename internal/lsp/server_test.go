@@ -0,0 +1,529 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const mathSource = `// Helpers imported by main.viri
+export fun add(a, b) {
+    return a + b;
+}
+
+export const PI = 3;
+
+fun helper() {
+    return 1;
+}
+`
+
+const mainSource = `import "./math.viri" as math;
+
+fun greet(name, greeting) {
+    var message = greeting + ", " + name;
+    return message;
+}
+
+class Counter {
+    init(start) {
+        this.count = start;
+    }
+
+    increment() {
+        this.count = this.count + 1;
+        return this.count;
+    }
+}
+
+var total = math.add(1, math.PI);
+print greet("Ana", "Hi");
+print len("abc") + total;
+`
+
+// session scripts a JSON-RPC conversation with the server.
+type session struct {
+	t      *testing.T
+	dir    string
+	input  bytes.Buffer
+	nextID int
+}
+
+// received is a message sent by the server.
+type received struct {
+	ID     *int            `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  *responseError  `json:"error"`
+}
+
+func newSession(t *testing.T) *session {
+	t.Helper()
+	s := &session{t: t, dir: t.TempDir()}
+	if err := os.WriteFile(filepath.Join(s.dir, "math.viri"), []byte(mathSource), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s.request("initialize", map[string]interface{}{"capabilities": map[string]interface{}{}})
+	s.notify("initialized", map[string]interface{}{})
+	return s
+}
+
+func (s *session) uri(name string) string {
+	return pathToURI(filepath.Join(s.dir, name))
+}
+
+func (s *session) send(msg map[string]interface{}) {
+	msg["jsonrpc"] = "2.0"
+	body, err := json.Marshal(msg)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	s.input.WriteString("Content-Length: " + strconv.Itoa(len(body)) + "\r\n\r\n")
+	s.input.Write(body)
+}
+
+func (s *session) request(method string, params interface{}) int {
+	s.nextID++
+	s.send(map[string]interface{}{"id": s.nextID, "method": method, "params": params})
+	return s.nextID
+}
+
+func (s *session) notify(method string, params interface{}) {
+	s.send(map[string]interface{}{"method": method, "params": params})
+}
+
+func (s *session) open(name, text string) {
+	s.notify("textDocument/didOpen", map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": s.uri(name), "languageId": "viri", "version": 1, "text": text},
+	})
+}
+
+// at builds position params for the nth (0-based) occurrence of needle in
+// text, offset by skip bytes into it.
+func (s *session) at(name, text, needle string, nth, skip int) map[string]interface{} {
+	s.t.Helper()
+	offset := -1
+	for i := 0; i <= nth; i++ {
+		next := strings.Index(text[offset+1:], needle)
+		if next < 0 {
+			s.t.Fatalf("occurrence %d of %q not found", nth, needle)
+		}
+		offset += next + 1
+	}
+	return map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": s.uri(name)},
+		"position":     newText(text).position(offset + skip),
+	}
+}
+
+// run shuts the server down and returns everything it sent.
+func (s *session) run() []received {
+	s.t.Helper()
+	s.request("shutdown", nil)
+	s.notify("exit", nil)
+
+	var output bytes.Buffer
+	if err := NewServer(&s.input, &output).Run(); err != nil {
+		s.t.Fatalf("Run() error = %v", err)
+	}
+
+	var messages []received
+	reader := textproto.NewReader(bufio.NewReader(&output))
+	for {
+		header, err := reader.ReadMIMEHeader()
+		if err == io.EOF {
+			return messages
+		}
+		if err != nil {
+			s.t.Fatalf("reading header: %v", err)
+		}
+		length, _ := strconv.Atoi(header.Get("Content-Length"))
+		body := make([]byte, length)
+		if _, err := io.ReadFull(reader.R, body); err != nil {
+			s.t.Fatalf("reading body: %v", err)
+		}
+		var msg received
+		if err := json.Unmarshal(body, &msg); err != nil {
+			s.t.Fatalf("decoding %s: %v", body, err)
+		}
+		messages = append(messages, msg)
+	}
+}
+
+func result(t *testing.T, messages []received, id int, into interface{}) {
+	t.Helper()
+	for _, msg := range messages {
+		if msg.ID != nil && *msg.ID == id {
+			if msg.Error != nil {
+				t.Fatalf("request %d failed: %s", id, msg.Error.Message)
+			}
+			if err := json.Unmarshal(msg.Result, into); err != nil {
+				t.Fatalf("decoding result of request %d: %v", id, err)
+			}
+			return
+		}
+	}
+	t.Fatalf("no response to request %d", id)
+}
+
+func responseErr(t *testing.T, messages []received, id int) *responseError {
+	t.Helper()
+	for _, msg := range messages {
+		if msg.ID != nil && *msg.ID == id {
+			return msg.Error
+		}
+	}
+	t.Fatalf("no response to request %d", id)
+	return nil
+}
+
+func diagnostics(messages []received, uri string) []Diagnostic {
+	var latest []Diagnostic
+	for _, msg := range messages {
+		if msg.Method != "textDocument/publishDiagnostics" {
+			continue
+		}
+		var params PublishDiagnosticsParams
+		if json.Unmarshal(msg.Params, &params) == nil && params.URI == uri {
+			latest = params.Diagnostics
+		}
+	}
+	return latest
+}
+
+func TestInitialize(t *testing.T) {
+	s := newSession(t)
+	messages := s.run()
+
+	var init struct {
+		Capabilities map[string]interface{} `json:"capabilities"`
+	}
+	result(t, messages, 1, &init)
+	for _, capability := range []string{"definitionProvider", "referencesProvider", "documentSymbolProvider", "hoverProvider", "renameProvider", "completionProvider"} {
+		if init.Capabilities[capability] == nil {
+			t.Errorf("missing capability %s", capability)
+		}
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	s := newSession(t)
+	s.open("main.viri", mainSource)
+	broken := "var a = 1;\nprint a +;\n"
+	s.open("broken.viri", broken)
+	s.open("warn.viri", "fun f() {\n    var unused = 1;\n}\nf();\n")
+	s.open("unscannable.viri", "var s = \"😀\"; $\n")
+	s.notify("textDocument/didChange", map[string]interface{}{
+		"textDocument":   map[string]interface{}{"uri": s.uri("main.viri"), "version": 2},
+		"contentChanges": []map[string]interface{}{{"text": mainSource + "print ;\n"}},
+	})
+	messages := s.run()
+
+	if got := diagnostics(messages, s.uri("broken.viri")); len(got) != 1 {
+		t.Fatalf("expected 1 diagnostic for broken.viri, got %v", got)
+	} else {
+		want := Range{Start: Position{Line: 1, Character: 9}, End: Position{Line: 1, Character: 10}}
+		if got[0].Message != "Expect expression." || got[0].Range != want || got[0].Severity != SeverityError {
+			t.Errorf("unexpected diagnostic %+v", got[0])
+		}
+	}
+
+	if got := diagnostics(messages, s.uri("warn.viri")); len(got) != 1 || got[0].Severity != SeverityWarning ||
+		got[0].Message != "Local variable 'unused' is declared but never used." {
+		t.Errorf("expected an unused variable warning, got %v", got)
+	}
+
+	// Scanner errors are positioned in UTF-16 code units too, where the
+	// emoji counts twice
+	if got := diagnostics(messages, s.uri("unscannable.viri")); len(got) != 1 ||
+		got[0].Range.Start != (Position{Line: 0, Character: 15}) {
+		t.Errorf("expected 1 diagnostic after the $, got %v", got)
+	}
+
+	// The change broke main.viri on its last line
+	if got := diagnostics(messages, s.uri("main.viri")); len(got) != 1 || got[0].Range.Start.Line != 21 {
+		t.Errorf("expected 1 diagnostic on line 21 after the change, got %v", got)
+	}
+}
+
+func TestDefinition(t *testing.T) {
+	s := newSession(t)
+	s.open("main.viri", mainSource)
+	local := s.request("textDocument/definition", s.at("main.viri", mainSource, "message;", 0, 0))
+	global := s.request("textDocument/definition", s.at("main.viri", mainSource, "greet(\"Ana\"", 0, 2))
+	imported := s.request("textDocument/definition", s.at("main.viri", mainSource, "add(1", 0, 0))
+	alias := s.request("textDocument/definition", s.at("main.viri", mainSource, "math.add", 0, 1))
+	path := s.request("textDocument/definition", s.at("main.viri", mainSource, "./math.viri", 0, 2))
+	method := s.request("textDocument/definition", s.at("main.viri", mainSource, "increment", 0, 0))
+	native := s.request("textDocument/definition", s.at("main.viri", mainSource, "len(", 0, 0))
+	messages := s.run()
+
+	mainText := newText(mainSource)
+	mathText := newText(mathSource)
+	tests := []struct {
+		name string
+		id   int
+		want Location
+	}{
+		{"local", local, Location{s.uri("main.viri"), mainText.span(strings.Index(mainSource, "message ="), 7)}},
+		{"global", global, Location{s.uri("main.viri"), mainText.span(strings.Index(mainSource, "greet("), 5)}},
+		{"imported", imported, Location{s.uri("math.viri"), mathText.span(strings.Index(mathSource, "add("), 3)}},
+		{"alias", alias, Location{s.uri("main.viri"), mainText.span(strings.Index(mainSource, "math;"), 4)}},
+		{"import path", path, Location{URI: s.uri("math.viri")}},
+		{"method", method, Location{s.uri("main.viri"), mainText.span(strings.Index(mainSource, "increment"), 9)}},
+	}
+	for _, tt := range tests {
+		var got []Location
+		result(t, messages, tt.id, &got)
+		if len(got) != 1 || got[0] != tt.want {
+			t.Errorf("%s: definition = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	var none []Location
+	result(t, messages, native, &none)
+	if none != nil {
+		t.Errorf("natives have no definition, got %v", none)
+	}
+}
+
+func TestReferences(t *testing.T) {
+	s := newSession(t)
+	s.open("main.viri", mainSource)
+	s.open("math.viri", mathSource)
+	count := s.request("textDocument/references", map[string]interface{}{
+		"textDocument": s.at("main.viri", mainSource, "count", 0, 0)["textDocument"],
+		"position":     s.at("main.viri", mainSource, "count", 0, 0)["position"],
+		"context":      map[string]bool{"includeDeclaration": true},
+	})
+	params := s.at("math.viri", mathSource, "add", 0, 0)
+	params["context"] = map[string]bool{"includeDeclaration": false}
+	add := s.request("textDocument/references", params)
+	messages := s.run()
+
+	// this.count is a property, not a variable, so it has no references
+	var got []Location
+	result(t, messages, count, &got)
+	if len(got) != 0 {
+		t.Errorf("expected no references to a property, got %v", got)
+	}
+
+	result(t, messages, add, &got)
+	want := []Location{{URI: s.uri("main.viri"), Range: newText(mainSource).span(strings.Index(mainSource, "add(1"), 3)}}
+	if len(got) != 1 || got[0] != want[0] {
+		t.Errorf("references to add = %v, want %v", got, want)
+	}
+}
+
+func TestReferencesOfLocal(t *testing.T) {
+	s := newSession(t)
+	s.open("main.viri", mainSource)
+	params := s.at("main.viri", mainSource, "greeting", 0, 0)
+	params["context"] = map[string]bool{"includeDeclaration": true}
+	id := s.request("textDocument/references", params)
+	messages := s.run()
+
+	var got []Location
+	result(t, messages, id, &got)
+	var lines []int
+	for _, loc := range got {
+		lines = append(lines, loc.Range.Start.Line)
+	}
+	sort.Ints(lines)
+	if len(lines) != 2 || lines[0] != 2 || lines[1] != 3 {
+		t.Errorf("expected the parameter and its use on lines 2 and 3, got %v", got)
+	}
+}
+
+func TestDocumentSymbols(t *testing.T) {
+	s := newSession(t)
+	s.open("main.viri", mainSource)
+	id := s.request("textDocument/documentSymbol", map[string]interface{}{
+		"textDocument": map[string]string{"uri": s.uri("main.viri")},
+	})
+	messages := s.run()
+
+	var got []DocumentSymbol
+	result(t, messages, id, &got)
+	var names []string
+	for _, sym := range got {
+		names = append(names, sym.Name)
+	}
+	if strings.Join(names, ",") != "math,greet,Counter,total" {
+		t.Fatalf("symbols = %v", names)
+	}
+	counter := got[2]
+	if counter.Kind != SymbolClass || len(counter.Children) != 2 || counter.Children[1].Name != "increment" ||
+		counter.Children[1].Kind != SymbolMethod {
+		t.Errorf("unexpected class symbol %+v", counter)
+	}
+	if counter.Range.End.Line != 15 {
+		t.Errorf("class should end with its last method on line 15, got %+v", counter.Range)
+	}
+}
+
+func TestHover(t *testing.T) {
+	s := newSession(t)
+	s.open("main.viri", mainSource)
+	greet := s.request("textDocument/hover", s.at("main.viri", mainSource, "greet(\"Ana\"", 0, 0))
+	add := s.request("textDocument/hover", s.at("main.viri", mainSource, "add(1", 0, 1))
+	counter := s.request("textDocument/hover", s.at("main.viri", mainSource, "Counter", 0, 0))
+	native := s.request("textDocument/hover", s.at("main.viri", mainSource, "len(", 0, 0))
+	nothing := s.request("textDocument/hover", s.at("main.viri", mainSource, "print", 0, 0))
+	messages := s.run()
+
+	tests := []struct {
+		id   int
+		want string
+	}{
+		{greet, "```viri\nfun greet(name, greeting)\n```\n\nArity: 2"},
+		{add, "```viri\nfun add(a, b)\n```\n\nArity: 2"},
+		{counter, "```viri\nclass Counter\n```\n\nArity: 1"},
+		{native, "```viri\nnative fun len\n```\n\nReturns the length of a string, array or hash.\n\nArity: 1"},
+	}
+	for _, tt := range tests {
+		var got Hover
+		result(t, messages, tt.id, &got)
+		if got.Contents.Value != tt.want {
+			t.Errorf("hover = %q, want %q", got.Contents.Value, tt.want)
+		}
+	}
+
+	var none *Hover
+	result(t, messages, nothing, &none)
+	if none != nil {
+		t.Errorf("expected no hover on a keyword, got %+v", none)
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	s := newSession(t)
+	s.open("main.viri", mainSource)
+	inFunction := s.request("textDocument/completion", s.at("main.viri", mainSource, "return message", 0, 0))
+	topLevel := s.request("textDocument/completion", s.at("main.viri", mainSource, "print len", 0, 0))
+
+	// Completing after "math." in code that no longer parses
+	edited := strings.Replace(mainSource, "+ total;", "+ math.", 1)
+	s.notify("textDocument/didChange", map[string]interface{}{
+		"textDocument":   map[string]interface{}{"uri": s.uri("main.viri"), "version": 2},
+		"contentChanges": []map[string]interface{}{{"text": edited}},
+	})
+	exports := s.request("textDocument/completion", s.at("main.viri", edited, "math.\n", 0, 5))
+	messages := s.run()
+
+	labels := func(id int) []string {
+		var items []CompletionItem
+		result(t, messages, id, &items)
+		var names []string
+		for _, item := range items {
+			names = append(names, item.Label)
+		}
+		return names
+	}
+
+	if got := strings.Join(labels(inFunction), ","); got != "message,greeting,name,math,greet,Counter,total,clock,len,num,str" {
+		t.Errorf("completions in function = %s", got)
+	}
+	if got := strings.Join(labels(topLevel), ","); got != "math,greet,Counter,total,clock,len,num,str" {
+		t.Errorf("completions at top level = %s", got)
+	}
+	if got := strings.Join(labels(exports), ","); got != "PI,add" {
+		t.Errorf("completions after math. = %s", got)
+	}
+}
+
+func TestRename(t *testing.T) {
+	s := newSession(t)
+	s.open("main.viri", mainSource)
+	rename := s.request("textDocument/rename", map[string]interface{}{
+		"textDocument": map[string]string{"uri": s.uri("main.viri")},
+		"position":     s.at("main.viri", mainSource, "total", 1, 0)["position"],
+		"newName":      "sum",
+	})
+	native := s.request("textDocument/rename", map[string]interface{}{
+		"textDocument": map[string]string{"uri": s.uri("main.viri")},
+		"position":     s.at("main.viri", mainSource, "len", 0, 0)["position"],
+		"newName":      "size",
+	})
+	keyword := s.request("textDocument/rename", map[string]interface{}{
+		"textDocument": map[string]string{"uri": s.uri("main.viri")},
+		"position":     s.at("main.viri", mainSource, "total", 0, 0)["position"],
+		"newName":      "while",
+	})
+	messages := s.run()
+
+	var edit WorkspaceEdit
+	result(t, messages, rename, &edit)
+	edits := edit.Changes[s.uri("main.viri")]
+	if len(edit.Changes) != 1 || len(edits) != 2 {
+		t.Fatalf("unexpected edit %+v", edit)
+	}
+	for _, e := range edits {
+		if e.NewText != "sum" || e.Range.End.Character-e.Range.Start.Character != len("total") {
+			t.Errorf("unexpected text edit %+v", e)
+		}
+	}
+
+	if err := responseErr(t, messages, native); err == nil {
+		t.Errorf("expected renaming a native to fail")
+	}
+	if err := responseErr(t, messages, keyword); err == nil {
+		t.Errorf("expected renaming to a keyword to fail")
+	}
+}
+
+func TestRenameConflict(t *testing.T) {
+	s := newSession(t)
+	s.open("main.viri", mainSource)
+	rename := func(needle string, nth int, newName string) int {
+		return s.request("textDocument/rename", map[string]interface{}{
+			"textDocument": map[string]string{"uri": s.uri("main.viri")},
+			"position":     s.at("main.viri", mainSource, needle, nth, 0)["position"],
+			"newName":      newName,
+		})
+	}
+	global := rename("total", 0, "greet")
+	param := rename("message", 0, "name")
+	method := rename("increment", 0, "init")
+	shadowing := rename("message", 0, "total")
+	messages := s.run()
+
+	for name, id := range map[string]int{"global": global, "parameter": param, "method": method} {
+		if err := responseErr(t, messages, id); err == nil || err.Code != codeRequestFailed ||
+			!strings.Contains(err.Message, "already declared") {
+			t.Errorf("%s: expected the rename to be rejected, got %v", name, err)
+		}
+	}
+
+	// A local may still shadow a name declared in an enclosing scope
+	var edit WorkspaceEdit
+	result(t, messages, shadowing, &edit)
+	if edits := edit.Changes[s.uri("main.viri")]; len(edits) != 2 {
+		t.Errorf("unexpected edit %+v", edit)
+	}
+}
+
+func TestUnknownMethodAndExit(t *testing.T) {
+	s := newSession(t)
+	id := s.request("workspace/unknown", map[string]interface{}{})
+	messages := s.run()
+
+	if err := responseErr(t, messages, id); err == nil || err.Code != codeMethodNotFound {
+		t.Errorf("expected method not found, got %v", err)
+	}
+
+	var input bytes.Buffer
+	input.WriteString("Content-Length: 33\r\n\r\n{\"jsonrpc\":\"2.0\",\"method\":\"exit\"}")
+	if err := NewServer(&input, io.Discard).Run(); err != ErrExitWithoutShutdown {
+		t.Errorf("exit without shutdown: Run() = %v", err)
+	}
+}
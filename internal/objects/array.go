@@ -1,9 +1,6 @@
 package objects
 
-import (
-	"fmt"
-	"strings"
-)
+import "strings"
 
 type Array struct {
 	Elements []Object
@@ -34,7 +31,7 @@ func (a *Array) Inspect() string {
 // Get returns the element at the given index with bounds checking.
 func (a *Array) Get(index int) (Object, error) {
 	if index < 0 || index >= len(a.Elements) {
-		return nil, fmt.Errorf("index out of bounds")
+		return nil, errOutOfBounds
 	}
 	return a.Elements[index], nil
 }
@@ -42,7 +39,7 @@ func (a *Array) Get(index int) (Object, error) {
 // Set writes the value at the given index with bounds checking.
 func (a *Array) Set(index int, value Object) error {
 	if index < 0 || index >= len(a.Elements) {
-		return fmt.Errorf("index out of bounds")
+		return errOutOfBounds
 	}
 	a.Elements[index] = value
 	return nil
@@ -0,0 +1,229 @@
+package objects
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// elementSize is the estimated bytes one element adds to an array.
+const elementSize = 16
+
+var arrayMethods = map[string]*builtinMethod{
+	"push":   {arity: 1, doc: "Appends a value to the array and returns its new length.", fn: arrayPush},
+	"pop":    {arity: 0, doc: "Removes and returns the last element.", fn: arrayPop},
+	"insert": {arity: 2, doc: "Inserts a value before the given index.", fn: arrayInsert},
+	"remove": {arity: 1, doc: "Removes and returns the element at the given index.", fn: arrayRemove},
+	"slice":  {arity: 2, doc: "Returns a new array of the elements from start up to end. Negative indices count from the end.", fn: arraySlice},
+	"map":    {arity: 1, doc: "Returns a new array of the results of calling a function on each element.", fn: arrayMap},
+	"filter": {arity: 1, doc: "Returns a new array of the elements for which a function returns a truthy value.", fn: arrayFilter},
+	"reduce": {arity: -1, doc: "Combines the elements from left to right with a function, starting from an optional initial value.", fn: arrayReduce},
+	"sort":   {arity: -1, doc: "Sorts the array in place, with an optional function returning a negative number when its first argument comes first, and returns it.", fn: arraySort},
+}
+
+func arrayPush(rt Runtime, receiver Object, args []Object) (Object, error) {
+	a := receiver.(*Array)
+	if err := rt.Alloc(elementSize); err != nil {
+		return nil, err
+	}
+	a.Elements = append(a.Elements, args[0])
+	return NewNumber(float64(len(a.Elements))), nil
+}
+
+func arrayPop(rt Runtime, receiver Object, args []Object) (Object, error) {
+	a := receiver.(*Array)
+	if len(a.Elements) == 0 {
+		return nil, errors.New("pop() from empty array")
+	}
+	last := a.Elements[len(a.Elements)-1]
+	a.Elements[len(a.Elements)-1] = nil
+	a.Elements = a.Elements[:len(a.Elements)-1]
+	return last, nil
+}
+
+func arrayInsert(rt Runtime, receiver Object, args []Object) (Object, error) {
+	a := receiver.(*Array)
+	index, err := intArg("insert", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	if index < 0 || index > len(a.Elements) {
+		return nil, fmt.Errorf("insert() index out of bounds: %d", index)
+	}
+	if err := rt.Alloc(elementSize); err != nil {
+		return nil, err
+	}
+	a.Elements = append(a.Elements, nil)
+	copy(a.Elements[index+1:], a.Elements[index:])
+	a.Elements[index] = args[1]
+	return NilValue, nil
+}
+
+func arrayRemove(rt Runtime, receiver Object, args []Object) (Object, error) {
+	a := receiver.(*Array)
+	index, err := intArg("remove", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	if index < 0 || index >= len(a.Elements) {
+		return nil, fmt.Errorf("remove() index out of bounds: %d", index)
+	}
+	removed := a.Elements[index]
+	copy(a.Elements[index:], a.Elements[index+1:])
+	a.Elements[len(a.Elements)-1] = nil
+	a.Elements = a.Elements[:len(a.Elements)-1]
+	return removed, nil
+}
+
+func arraySlice(rt Runtime, receiver Object, args []Object) (Object, error) {
+	a := receiver.(*Array)
+	start, err := intArg("slice", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	end, err := intArg("slice", args, 1)
+	if err != nil {
+		return nil, err
+	}
+	start, end = clampRange(start, end, len(a.Elements))
+
+	if err := rt.Alloc(ArraySize(end - start)); err != nil {
+		return nil, err
+	}
+	elements := make([]Object, end-start)
+	copy(elements, a.Elements[start:end])
+	return NewArray(elements), nil
+}
+
+// clampRange resolves negative indices from the end of a sequence of n
+// items and clamps the range to it.
+func clampRange(start, end, n int) (int, int) {
+	if start < 0 {
+		start += n
+	}
+	if end < 0 {
+		end += n
+	}
+	start = max(0, min(start, n))
+	end = max(start, min(end, n))
+	return start, end
+}
+
+func arrayMap(rt Runtime, receiver Object, args []Object) (Object, error) {
+	// Elements added by the callback are not visited
+	elements := receiver.(*Array).Elements
+	if err := rt.Alloc(ArraySize(len(elements))); err != nil {
+		return nil, err
+	}
+	results := make([]Object, len(elements))
+	for i, element := range elements {
+		result, err := rt.CallValue(args[0], element)
+		if err != nil {
+			return nil, err
+		}
+		results[i] = result
+	}
+	return NewArray(results), nil
+}
+
+func arrayFilter(rt Runtime, receiver Object, args []Object) (Object, error) {
+	elements := receiver.(*Array).Elements
+	results := []Object{}
+	for _, element := range elements {
+		keep, err := rt.CallValue(args[0], element)
+		if err != nil {
+			return nil, err
+		}
+		if IsTruthy(keep) {
+			results = append(results, element)
+		}
+	}
+	if err := rt.Alloc(ArraySize(len(results))); err != nil {
+		return nil, err
+	}
+	return NewArray(results), nil
+}
+
+func arrayReduce(rt Runtime, receiver Object, args []Object) (Object, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return nil, fmt.Errorf("reduce() expected 1 or 2 arguments but got %d", len(args))
+	}
+	elements := receiver.(*Array).Elements
+
+	var acc Object
+	if len(args) == 2 {
+		acc = args[1]
+	} else {
+		if len(elements) == 0 {
+			return nil, errors.New("reduce() of empty array with no initial value")
+		}
+		acc, elements = elements[0], elements[1:]
+	}
+	for _, element := range elements {
+		result, err := rt.CallValue(args[0], acc, element)
+		if err != nil {
+			return nil, err
+		}
+		acc = result
+	}
+	return acc, nil
+}
+
+func arraySort(rt Runtime, receiver Object, args []Object) (Object, error) {
+	if len(args) > 1 {
+		return nil, fmt.Errorf("sort() expected 0 or 1 arguments but got %d", len(args))
+	}
+	a := receiver.(*Array)
+
+	// Sort a copy so a failing comparison leaves the array as it was
+	elements := make([]Object, len(a.Elements))
+	copy(elements, a.Elements)
+
+	var sortErr error
+	sort.SliceStable(elements, func(i, j int) bool {
+		if sortErr != nil {
+			return false
+		}
+		var less bool
+		if len(args) == 1 {
+			less, sortErr = callLess(rt, args[0], elements[i], elements[j])
+		} else {
+			less, sortErr = compareLess(elements[i], elements[j])
+		}
+		return less
+	})
+	if sortErr != nil {
+		return nil, sortErr
+	}
+
+	a.Elements = elements
+	return a, nil
+}
+
+// callLess orders two elements with a comparison function.
+func callLess(rt Runtime, fn, a, b Object) (bool, error) {
+	result, err := rt.CallValue(fn, a, b)
+	if err != nil {
+		return false, err
+	}
+	n, ok := result.(*Number)
+	if !ok {
+		return false, fmt.Errorf("sort() comparison must return a number, got %s", Stringify(result))
+	}
+	return n.Value < 0, nil
+}
+
+// compareLess orders two numbers or two strings.
+func compareLess(a, b Object) (bool, error) {
+	switch av := a.(type) {
+	case *Number:
+		if bv, ok := b.(*Number); ok {
+			return av.Value < bv.Value, nil
+		}
+	case *String:
+		if bv, ok := b.(*String); ok {
+			return av.Value < bv.Value, nil
+		}
+	}
+	return false, fmt.Errorf("sort() cannot compare %s and %s", TypeName(a), TypeName(b))
+}
@@ -2,8 +2,20 @@ package objects
 
 import "github.com/harshagw/viri/internal/ast"
 
+// Runtime is what native functions can ask of the engine running them.
+// Both engines pass themselves to the natives they call.
+type Runtime interface {
+	// CallValue calls a function, closure, class or bound method, such as
+	// the callback given to an array's map method.
+	CallValue(fn Object, args ...Object) (Object, error)
+	// Alloc accounts for bytes allocated by a native, returning an error
+	// once the allocation limit is exceeded.
+	Alloc(bytes int64) error
+}
+
 // BlockExecutor executes a block with a provided environment.
 type BlockExecutor interface {
+	Runtime
 	ExecuteBlock(block *ast.BlockStmt, env *Environment) (Object, error)
 }
 
@@ -0,0 +1,23 @@
+package objects
+
+import (
+	"errors"
+	"fmt"
+)
+
+// This file holds the errors raised by calls and class declarations, shared
+// by the interpreter and the VM so that both report them alike.
+
+var (
+	ErrNotCallable = errors.New("Can only call functions or classes.")
+	ErrSuperclass  = errors.New("Superclass must be a class.")
+)
+
+// CheckArity returns an error if a callee taking want arguments is called
+// with got. A negative want accepts any number of arguments.
+func CheckArity(want, got int) error {
+	if want >= 0 && want != got {
+		return fmt.Errorf("Expected %d arguments but got %d.", want, got)
+	}
+	return nil
+}
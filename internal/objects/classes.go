@@ -66,7 +66,22 @@ func (ci *ClassInstance) Get(name *token.Token) (Object, error) {
 	if method, ok := ci.class.LookupMethod(name.Lexeme); ok {
 		return method.Bind(ci), nil
 	}
-	return nil, errors.New("instance does not have field " + name.Lexeme)
+	return nil, errors.New("Undefined property '" + name.Lexeme + "'.")
+}
+
+// BoundMethod looks up a method by name and binds it to the instance.
+func (ci *ClassInstance) BoundMethod(name string) (*Function, bool) {
+	method, ok := ci.class.LookupMethod(name)
+	if !ok {
+		return nil, false
+	}
+	return method.Bind(ci), true
+}
+
+// HasField reports whether the instance has a field with the given name.
+func (ci *ClassInstance) HasField(name string) bool {
+	_, ok := ci.fields[name]
+	return ok
 }
 
 func (ci *ClassInstance) Set(name *token.Token, value Object) error {
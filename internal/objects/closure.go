@@ -17,6 +17,10 @@ func (c *Closure) Type() Type {
 	return TypeClosure
 }
 
+// Inspect shows the closure the way the interpreter shows functions.
 func (c *Closure) Inspect() string {
-	return fmt.Sprintf("closure(%s)", c.Fn.Inspect())
+	if c.Fn.Anonymous || c.Fn.Name == "" {
+		return "<fun anonymous>"
+	}
+	return fmt.Sprintf("<fun %s>", c.Fn.Name)
 }
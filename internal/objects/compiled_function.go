@@ -12,6 +12,7 @@ type CompiledFunction struct {
 	NumLocals     int
 	NumParameters int
 	Name          string
+	Anonymous     bool // written as a function expression, Name is only used in traces
 	DebugInfoIdx  int
 }
 
@@ -7,12 +7,14 @@ type CompiledProgram struct {
 	Modules   []CompiledModule // in topological order (dependencies first)
 	Constants []Object         // global constants table (merged from all modules)
 	DebugInfo *DebugInfo       // debug information (line tables, file paths)
+	Natives   []string         // name of each native, by the index OpGetNative loads it with
 }
 
 // CompiledModule represents a single compiled module.
 type CompiledModule struct {
 	Instructions code.Instructions
 	NumGlobals   int   // slots needed for this module's globals
+	NumLocals    int   // stack slots needed for variables declared in its blocks
 	Exports      []int // export index -> global slot mapping
 	DebugInfoIdx int   // index into DebugInfo.Entries for line table and file path
 }
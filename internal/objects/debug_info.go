@@ -1,9 +1,16 @@
 package objects
 
+// Position is a location in a source file.
+type Position struct {
+	Line   int // 1-based line number
+	Column int // 1-based column, counted in characters
+	Offset int // byte offset from the start of the file
+}
+
 // DebugInfoEntry holds debug information for a single function or module.
 type DebugInfoEntry struct {
-	LineTable []int  // maps bytecode offset -> source line number
-	FilePath  string // source file path
+	LineTable []Position // maps bytecode offset -> source position
+	FilePath  string     // source file path
 }
 
 // DebugInfo holds all debug information for a compiled program.
@@ -17,7 +24,7 @@ func NewDebugInfo() *DebugInfo {
 	}
 }
 
-func (d *DebugInfo) Add(lineTable []int, filePath string) int {
+func (d *DebugInfo) Add(lineTable []Position, filePath string) int {
 	idx := len(d.Entries)
 	d.Entries = append(d.Entries, DebugInfoEntry{
 		LineTable: lineTable,
@@ -34,16 +41,22 @@ func (d *DebugInfo) Get(idx int) *DebugInfoEntry {
 	return &d.Entries[idx]
 }
 
-// GetLine returns the line number for a given debug index and instruction pointer.
-// Returns 0 if not found.
-func (d *DebugInfo) GetLine(idx int, ip int) int {
+// GetPosition returns the source position for a given debug index and
+// instruction pointer. Returns the zero Position if not found.
+func (d *DebugInfo) GetPosition(idx int, ip int) Position {
 	entry := d.Get(idx)
 	if entry == nil || ip < 0 || ip >= len(entry.LineTable) {
-		return 0
+		return Position{}
 	}
 	return entry.LineTable[ip]
 }
 
+// GetLine returns the line number for a given debug index and instruction pointer.
+// Returns 0 if not found.
+func (d *DebugInfo) GetLine(idx int, ip int) int {
+	return d.GetPosition(idx, ip).Line
+}
+
 // GetFilePath returns the file path for a given debug index.
 // Returns empty string if not found.
 func (d *DebugInfo) GetFilePath(idx int) string {
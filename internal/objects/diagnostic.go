@@ -1,6 +1,12 @@
 package objects
 
-import "github.com/harshagw/viri/internal/token"
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/harshagw/viri/internal/token"
+)
 
 // DiagnosticHandler receives parse/type/runtime diagnostics.
 type DiagnosticHandler interface {
@@ -14,6 +20,11 @@ type Diagnostic struct {
 	Message string
 }
 
+// Position returns where the diagnostic points in its source file.
+func (d Diagnostic) Position() Position {
+	return Position{Line: d.Token.Line, Column: d.Token.Column, Offset: d.Token.Offset}
+}
+
 // DiagnosticCollector is a simple in-memory handler useful for tests and plumbing.
 type DiagnosticCollector struct {
 	Errors   []Diagnostic
@@ -27,3 +38,51 @@ func (c *DiagnosticCollector) Error(tok token.Token, msg string) {
 func (c *DiagnosticCollector) Warn(tok token.Token, msg string) {
 	c.Warnings = append(c.Warnings, Diagnostic{Token: tok, Message: msg})
 }
+
+// TokenSnippet renders the source line holding tok with its lexeme underlined.
+func TokenSnippet(source string, tok token.Token) string {
+	width := utf8.RuneCountInString(tok.Lexeme)
+	if i := strings.IndexByte(tok.Lexeme, '\n'); i >= 0 {
+		width = utf8.RuneCountInString(tok.Lexeme[:i])
+	}
+	return Snippet(source, tok.Line, tok.Column, width)
+}
+
+// Snippet renders a line of source with the width characters starting at
+// column underlined, Rust/Clang style:
+//
+//	3 | print count + nil;
+//	  |       ^~~~~
+//
+// It returns "" when the line is not part of source or the column is unknown.
+func Snippet(source string, line, column, width int) string {
+	if line < 1 || column < 1 {
+		return ""
+	}
+	lines := strings.Split(source, "\n")
+	if line > len(lines) {
+		return ""
+	}
+	text := []rune(strings.TrimRight(lines[line-1], "\r"))
+	if column > len(text)+1 {
+		column = len(text) + 1
+	}
+	if width < 1 {
+		width = 1
+	}
+
+	// Pad with the line's own tabs so the caret lines up however they render
+	var pad strings.Builder
+	for _, r := range text[:column-1] {
+		if r == '\t' {
+			pad.WriteRune('\t')
+		} else {
+			pad.WriteRune(' ')
+		}
+	}
+
+	number := fmt.Sprint(line)
+	gutter := strings.Repeat(" ", len(number))
+	return fmt.Sprintf(" %s | %s\n %s | %s^%s\n",
+		number, string(text), gutter, pad.String(), strings.Repeat("~", width-1))
+}
@@ -0,0 +1,30 @@
+package objects
+
+// Error is the value bound to a catch variable when a runtime error is caught.
+type Error struct {
+	Message  string
+	FilePath string
+	Line     int
+	Column   int
+	Trace    []StackFrame // kept so rethrowing reports the original stack
+}
+
+func NewError(message, filePath string, line int) *Error {
+	return &Error{Message: message, FilePath: filePath, Line: line}
+}
+
+func (e *Error) Type() Type      { return TypeError }
+func (e *Error) Inspect() string { return "Error: " + e.Message }
+
+// Get returns one of the error's read-only properties.
+func (e *Error) Get(name string) (Object, bool) {
+	switch name {
+	case "message":
+		return NewString(e.Message), true
+	case "file":
+		return NewString(e.FilePath), true
+	case "line":
+		return NewNumber(float64(e.Line)), true
+	}
+	return nil, false
+}
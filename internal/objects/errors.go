@@ -19,19 +19,37 @@ type ContinueError struct{}
 
 func (e *ContinueError) Error() string { return "continue" }
 
+// StackFrame is one entry in the stack trace of a runtime error.
+type StackFrame struct {
+	Function string // function name, "<script>" for top-level code
+	FilePath string
+	Line     int
+}
+
 // RuntimeError is used for runtime errors (interpreter).
 type RuntimeError struct {
 	Token   *token.Token
 	Message string
+	Thrown  Object       // value passed to throw, nil for built-in errors
+	Trace   []StackFrame // active calls when the error was raised, outermost first
+	Err     error        // cause, such as ErrAllocationLimit; nil for other errors
 }
 
 func (e *RuntimeError) Error() string { return e.Message }
 
+func (e *RuntimeError) Unwrap() error { return e.Err }
+
 // VMRuntimeError is used for runtime errors in the VM.
 type VMRuntimeError struct {
 	Message  string
 	Line     int
+	Column   int
 	FilePath string
+	Thrown   Object       // value passed to throw, nil for built-in errors
+	Trace    []StackFrame // active calls when the error was raised, outermost first
+	Err      error        // cause, such as ErrAllocationLimit; nil for other errors
 }
 
 func (e *VMRuntimeError) Error() string { return e.Message }
+
+func (e *VMRuntimeError) Unwrap() error { return e.Err }
@@ -66,6 +66,11 @@ func (cf *Function) Call(exec BlockExecutor, arguments []Object) (Object, error)
 	return result, nil
 }
 
+// Name returns the function's name, empty for anonymous functions.
+func (cf *Function) Name() string {
+	return cf.name
+}
+
 func (cf *Function) Arity() int {
 	return len(cf.params)
 }
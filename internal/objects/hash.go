@@ -2,18 +2,47 @@ package objects
 
 import (
 	"fmt"
-	"sort"
+	"math"
+	"strconv"
 	"strings"
 )
 
-// Hash represents a string-keyed hash map.
+// Hash represents a hash map. It remembers the order in which keys were
+// first set, and iterates and prints in that order.
 type Hash struct {
-	Pairs map[string]Object
+	entries []hashEntry     // in insertion order; deleted entries have a nil key
+	index   map[HashKey]int // position of each key in entries
+}
+
+type hashEntry struct {
+	k          HashKey
+	key, value Object
+}
+
+// HashEntry is a key and its value.
+type HashEntry struct {
+	Key   Object
+	Value Object
+}
+
+// HashKey identifies a key of a hash. Keys of different types never
+// collide, so 1, "1" and true are three different keys.
+type HashKey struct {
+	typ    Type
+	num    float64
+	str    string
+	ident  Object // an instance keyed by identity
+	hashed bool   // an instance keyed by the result of its hash method
+}
+
+// StringKey returns the key of the string s.
+func StringKey(s string) HashKey {
+	return HashKey{typ: TypeString, str: s}
 }
 
 func NewHash() *Hash {
 	return &Hash{
-		Pairs: make(map[string]Object),
+		index: make(map[HashKey]int),
 	}
 }
 
@@ -22,24 +51,167 @@ func (h *Hash) Type() Type {
 }
 
 func (h *Hash) Inspect() string {
-	keys := make([]string, 0, len(h.Pairs))
-	for k := range h.Pairs {
-		keys = append(keys, k)
+	parts := make([]string, 0, h.Len())
+	for _, entry := range h.Entries() {
+		parts = append(parts, fmt.Sprintf("%s: %s", inspectKey(entry.Key), entry.Value.Inspect()))
 	}
-	sort.Strings(keys)
+	return "{" + strings.Join(parts, ", ") + "}"
+}
 
-	parts := make([]string, 0, len(keys))
-	for _, k := range keys {
-		parts = append(parts, fmt.Sprintf("%s: %s", k, h.Pairs[k].Inspect()))
+// inspectKey quotes string keys so they cannot be mistaken for keys of
+// other types.
+func inspectKey(key Object) string {
+	if s, ok := key.(*String); ok {
+		return strconv.Quote(s.Value)
 	}
-	return "{" + strings.Join(parts, ", ") + "}"
+	return key.Inspect()
 }
 
-func (h *Hash) Get(key string) (Object, bool) {
-	val, ok := h.Pairs[key]
-	return val, ok
+// Len returns the number of entries.
+func (h *Hash) Len() int {
+	return len(h.index)
 }
 
-func (h *Hash) Set(key string, value Object) {
-	h.Pairs[key] = value
+func (h *Hash) Get(k HashKey) (Object, bool) {
+	i, ok := h.index[k]
+	if !ok {
+		return nil, false
+	}
+	return h.entries[i].value, true
+}
+
+// Set sets the value of key, which k identifies. A new key goes after all
+// others; an existing key keeps its place and its first key value.
+func (h *Hash) Set(k HashKey, key, value Object) {
+	if i, ok := h.index[k]; ok {
+		h.entries[i].value = value
+		return
+	}
+	h.index[k] = len(h.entries)
+	h.entries = append(h.entries, hashEntry{k: k, key: key, value: value})
+}
+
+// Delete removes the key k identifies, reporting whether it was present.
+func (h *Hash) Delete(k HashKey) bool {
+	i, ok := h.index[k]
+	if !ok {
+		return false
+	}
+	delete(h.index, k)
+	h.entries[i] = hashEntry{}
+
+	// Compact once most entries are holes
+	if len(h.entries) > 8 && len(h.index) < len(h.entries)/2 {
+		entries := make([]hashEntry, 0, len(h.index))
+		for _, entry := range h.entries {
+			if entry.key != nil {
+				h.index[entry.k] = len(entries)
+				entries = append(entries, entry)
+			}
+		}
+		h.entries = entries
+	}
+	return true
+}
+
+// Keys returns the keys in insertion order.
+func (h *Hash) Keys() []Object {
+	keys := make([]Object, 0, h.Len())
+	for _, entry := range h.live() {
+		keys = append(keys, entry.key)
+	}
+	return keys
+}
+
+// Entries returns the entries in insertion order.
+func (h *Hash) Entries() []HashEntry {
+	entries := make([]HashEntry, 0, h.Len())
+	for _, entry := range h.live() {
+		entries = append(entries, HashEntry{Key: entry.key, Value: entry.value})
+	}
+	return entries
+}
+
+// live returns a snapshot of the entries that have not been deleted.
+func (h *Hash) live() []hashEntry {
+	entries := make([]hashEntry, 0, h.Len())
+	for _, entry := range h.entries {
+		if entry.key != nil {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// Merge returns a new hash with the entries of h followed by those of
+// other. Where both have a key, the value from other wins.
+func (h *Hash) Merge(other *Hash) *Hash {
+	merged := NewHash()
+	for _, source := range []*Hash{h, other} {
+		for _, entry := range source.live() {
+			merged.Set(entry.k, entry.key, entry.value)
+		}
+	}
+	return merged
+}
+
+// HashKeyOf returns the key value stands for. Numbers, strings, booleans,
+// nil and instances can be keys. An instance is its own key unless its class
+// has a hash method, in which case instances whose hash methods return equal
+// values are the same key.
+func HashKeyOf(rt Runtime, value Object) (HashKey, error) {
+	switch v := value.(type) {
+	case *ClassInstance, *CompiledInstance:
+		method, ok := hashMethod(v)
+		if !ok {
+			return HashKey{typ: v.Type(), ident: v}, nil
+		}
+		result, err := rt.CallValue(method)
+		if err != nil {
+			return HashKey{}, err
+		}
+		k, err := primitiveKey(result)
+		if err != nil {
+			return HashKey{}, fmt.Errorf("hash() must return a number, string, boolean or nil, got %s", TypeName(result))
+		}
+		k.hashed = true
+		return k, nil
+	}
+	return primitiveKey(value)
+}
+
+func primitiveKey(value Object) (HashKey, error) {
+	switch v := value.(type) {
+	case *Nil:
+		return HashKey{typ: TypeNil}, nil
+	case *Bool:
+		k := HashKey{typ: TypeBool}
+		if v.Value {
+			k.num = 1
+		}
+		return k, nil
+	case *Number:
+		if math.IsNaN(v.Value) {
+			return HashKey{}, fmt.Errorf("unusable as hash key: NaN")
+		}
+		// Adding zero turns -0 into 0, which it equals
+		return HashKey{typ: TypeNumber, num: v.Value + 0}, nil
+	case *String:
+		return StringKey(v.Value), nil
+	}
+	return HashKey{}, fmt.Errorf("unusable as hash key: %s", TypeName(value))
+}
+
+// hashMethod returns the hash method of an instance bound to it, if its
+// class has one.
+func hashMethod(instance Object) (Object, bool) {
+	switch v := instance.(type) {
+	case *ClassInstance:
+		return v.BoundMethod("hash")
+	case *CompiledInstance:
+		if method, ok := v.Class.LookupMethod("hash"); ok {
+			return NewBoundMethod(v, method), true
+		}
+	}
+	return nil, false
 }
@@ -0,0 +1,78 @@
+package objects
+
+import "fmt"
+
+var hashMethods = map[string]*builtinMethod{
+	"keys":    {arity: 0, doc: "Returns an array of the keys, in insertion order.", fn: hashKeys},
+	"values":  {arity: 0, doc: "Returns an array of the values, in insertion order.", fn: hashValues},
+	"entries": {arity: 0, doc: "Returns an array of [key, value] pairs, in insertion order.", fn: hashEntries},
+	"has":     {arity: 1, doc: "Reports whether the hash has a key.", fn: hashHas},
+	"delete":  {arity: 1, doc: "Removes a key, reporting whether it was present.", fn: hashDelete},
+	"get":     {arity: -1, doc: "Returns the value of a key, or a default (nil if not given) when it is missing.", fn: hashGet},
+}
+
+func hashKeys(rt Runtime, receiver Object, args []Object) (Object, error) {
+	keys := receiver.(*Hash).Keys()
+	if err := rt.Alloc(ArraySize(len(keys))); err != nil {
+		return nil, err
+	}
+	return NewArray(keys), nil
+}
+
+func hashValues(rt Runtime, receiver Object, args []Object) (Object, error) {
+	entries := receiver.(*Hash).Entries()
+	if err := rt.Alloc(ArraySize(len(entries))); err != nil {
+		return nil, err
+	}
+	values := make([]Object, len(entries))
+	for i, entry := range entries {
+		values[i] = entry.Value
+	}
+	return NewArray(values), nil
+}
+
+func hashEntries(rt Runtime, receiver Object, args []Object) (Object, error) {
+	entries := receiver.(*Hash).Entries()
+	if err := rt.Alloc(ArraySize(len(entries)) + int64(len(entries))*ArraySize(2)); err != nil {
+		return nil, err
+	}
+	pairs := make([]Object, len(entries))
+	for i, entry := range entries {
+		pairs[i] = NewArray([]Object{entry.Key, entry.Value})
+	}
+	return NewArray(pairs), nil
+}
+
+func hashHas(rt Runtime, receiver Object, args []Object) (Object, error) {
+	k, err := HashKeyOf(rt, args[0])
+	if err != nil {
+		return nil, err
+	}
+	_, ok := receiver.(*Hash).Get(k)
+	return NewBool(ok), nil
+}
+
+func hashDelete(rt Runtime, receiver Object, args []Object) (Object, error) {
+	k, err := HashKeyOf(rt, args[0])
+	if err != nil {
+		return nil, err
+	}
+	return NewBool(receiver.(*Hash).Delete(k)), nil
+}
+
+func hashGet(rt Runtime, receiver Object, args []Object) (Object, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return nil, fmt.Errorf("get() expected 1 or 2 arguments but got %d", len(args))
+	}
+	k, err := HashKeyOf(rt, args[0])
+	if err != nil {
+		return nil, err
+	}
+	if value, ok := receiver.(*Hash).Get(k); ok {
+		return value, nil
+	}
+	if len(args) == 2 {
+		return args[1], nil
+	}
+	return NilValue, nil
+}
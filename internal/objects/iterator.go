@@ -0,0 +1,102 @@
+package objects
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors raised by for-in loops, shared by the interpreter and the VM.
+var (
+	ErrNotIterable     = errors.New("Can only iterate over arrays, hashes, strings and iterators.")
+	ErrIteratorMethods = errors.New("Iterator must have 'hasNext' and 'next' methods.")
+	ErrIteratorPairs   = errors.New("Iterators yield a single value per iteration.")
+)
+
+// CheckIteratorMethod returns an error unless the iterator protocol method
+// called name, taking arity arguments, can be called with none.
+func CheckIteratorMethod(name string, arity int) error {
+	if arity != 0 {
+		return fmt.Errorf("Iterator method '%s' must take no arguments.", name)
+	}
+	return nil
+}
+
+// Iterator walks an array, hash or string for a for-in loop. With one loop
+// variable it yields array elements, string characters or hash keys; with
+// two it yields index/element, index/character or key/value pairs.
+type Iterator struct {
+	pairs bool
+	next  func() (key, value Object, ok bool)
+}
+
+// NewIterator returns an iterator over a built-in value, or false if the
+// value is not iterable.
+func NewIterator(value Object, pairs bool) (*Iterator, bool) {
+	it := &Iterator{pairs: pairs}
+
+	switch v := value.(type) {
+	case *Array:
+		index := 0
+		it.next = func() (Object, Object, bool) {
+			// Elements appended during the loop are visited too
+			if index >= len(v.Elements) {
+				return nil, nil, false
+			}
+			key, value := NewNumber(float64(index)), v.Elements[index]
+			index++
+			return key, value, true
+		}
+	case *String:
+		runes := []rune(v.Value)
+		index := 0
+		it.next = func() (Object, Object, bool) {
+			if index >= len(runes) {
+				return nil, nil, false
+			}
+			key, value := NewNumber(float64(index)), NewString(string(runes[index]))
+			index++
+			return key, value, true
+		}
+	case *Hash:
+		// Iterate over a snapshot of the keys, in insertion order
+		entries := v.live()
+		index := 0
+		it.next = func() (Object, Object, bool) {
+			for index < len(entries) {
+				entry := entries[index]
+				index++
+				// Skip keys deleted during the loop
+				if value, ok := v.Get(entry.k); ok {
+					return entry.key, value, true
+				}
+			}
+			return nil, nil, false
+		}
+		if !pairs {
+			// With a single variable a hash yields its keys
+			next := it.next
+			it.next = func() (Object, Object, bool) {
+				key, _, ok := next()
+				return nil, key, ok
+			}
+		}
+	default:
+		return nil, false
+	}
+
+	return it, true
+}
+
+func (it *Iterator) Type() Type      { return TypeIterator }
+func (it *Iterator) Inspect() string { return "<iterator>" }
+
+// Next advances the iterator. The key is only meaningful when the iterator
+// was created for two loop variables.
+func (it *Iterator) Next() (key, value Object, ok bool) {
+	return it.next()
+}
+
+// Pairs reports whether the iterator yields key/value pairs.
+func (it *Iterator) Pairs() bool {
+	return it.pairs
+}
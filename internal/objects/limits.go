@@ -0,0 +1,172 @@
+package objects
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Limits bounds the resources a program may use while it runs. A zero field
+// means no limit, except for MaxCallDepth.
+type Limits struct {
+	// MaxSteps is the number of steps a run may take: instructions on the
+	// VM, statements and expressions evaluated in the interpreter.
+	MaxSteps int64
+	// Timeout is the wall-clock time a run may take.
+	Timeout time.Duration
+	// MaxCallDepth is the number of nested calls a run may make,
+	// DefaultMaxCallDepth when zero. The VM never allows more than its
+	// frame limit.
+	MaxCallDepth int
+	// MaxAllocatedBytes is the estimated number of bytes a run may allocate
+	// for arrays, hashes, strings and instances over its whole length. It
+	// is a budget for allocations, not a bound on live memory: values that
+	// are no longer used still count. Unlike the other limits, exceeding it
+	// raises an error programs can catch.
+	MaxAllocatedBytes int64
+}
+
+// DefaultMaxCallDepth is how deeply calls may nest when Limits sets no
+// depth. It is as deep as the frames of the VM go, and stops runaway
+// recursion in the interpreter before it overflows the Go stack.
+const DefaultMaxCallDepth = 1023
+
+// StepLimitError is returned when a program takes more steps than
+// Limits.MaxSteps allows.
+type StepLimitError struct {
+	Limit int64
+}
+
+func (e *StepLimitError) Error() string {
+	return fmt.Sprintf("step limit of %d exceeded", e.Limit)
+}
+
+// TimeoutError is returned when a program runs for longer than
+// Limits.Timeout allows.
+type TimeoutError struct {
+	Timeout time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("timed out after %s", e.Timeout)
+}
+
+func (e *TimeoutError) Unwrap() error { return context.DeadlineExceeded }
+
+// CallDepthError is returned when a program nests more calls than
+// Limits.MaxCallDepth allows.
+type CallDepthError struct {
+	Limit int
+}
+
+func (e *CallDepthError) Error() string {
+	return fmt.Sprintf("maximum call depth of %d exceeded", e.Limit)
+}
+
+// CanceledError is returned when the context a program runs with is done.
+// It wraps the context's error.
+type CanceledError struct {
+	Err error
+}
+
+func (e *CanceledError) Error() string { return "execution canceled: " + e.Err.Error() }
+func (e *CanceledError) Unwrap() error { return e.Err }
+
+// IsLimitError reports whether err stopped a program for exceeding its
+// limits or being canceled. Such errors cannot be caught by try/catch.
+func IsLimitError(err error) bool {
+	switch err.(type) {
+	case *StepLimitError, *TimeoutError, *CallDepthError, *CanceledError:
+		return true
+	}
+	return false
+}
+
+// LimitChecker enforces Limits for one run. Steps are counted in slices:
+// the clock and the context are only consulted between slices of up to
+// checkInterval steps, so counting a step is a compare and a decrement.
+type LimitChecker struct {
+	limits   Limits
+	ctx      context.Context
+	deadline time.Time
+
+	steps int64 // steps taken in earlier slices
+	slice int64 // length of the current slice, used by Step
+	tick  int64 // steps left in the current slice, used by Step
+
+	memory MemoryStats
+}
+
+// checkInterval is the longest slice when there is a clock or a context to
+// check.
+const checkInterval = 1024
+
+// Start resets the checker for a new run under ctx, which may be nil.
+func (c *LimitChecker) Start(ctx context.Context, limits Limits) {
+	if ctx != nil && ctx.Done() == nil {
+		// The context can never be canceled
+		ctx = nil
+	}
+	c.limits = limits
+	c.ctx = ctx
+	c.deadline = time.Time{}
+	if limits.Timeout > 0 {
+		c.deadline = time.Now().Add(limits.Timeout)
+	}
+	c.steps, c.slice, c.tick = 0, 0, 0
+	c.memory = MemoryStats{}
+}
+
+// Step counts one step, returning an error once a limit is exceeded.
+func (c *LimitChecker) Step() error {
+	if c.tick == 0 {
+		n, err := c.Next(c.slice)
+		if err != nil {
+			return err
+		}
+		c.slice, c.tick = n, n
+	}
+	c.tick--
+	return nil
+}
+
+// Next ends a slice in which taken steps were run and checks the limits
+// before the next step. It returns how many steps, counting that one, may
+// run before Next must be called again. Engines with a hot loop keep their
+// own countdown and call Next when it reaches zero.
+func (c *LimitChecker) Next(taken int64) (int64, error) {
+	c.steps += taken
+	if c.limits.MaxSteps > 0 && c.steps >= c.limits.MaxSteps {
+		return 0, &StepLimitError{Limit: c.limits.MaxSteps}
+	}
+	if c.ctx != nil {
+		if err := c.ctx.Err(); err != nil {
+			return 0, &CanceledError{Err: err}
+		}
+	}
+	if !c.deadline.IsZero() && time.Now().After(c.deadline) {
+		return 0, &TimeoutError{Timeout: c.limits.Timeout}
+	}
+
+	n := int64(math.MaxInt64)
+	if c.ctx != nil || !c.deadline.IsZero() {
+		n = checkInterval
+	}
+	if c.limits.MaxSteps > 0 && c.limits.MaxSteps-c.steps < n {
+		n = c.limits.MaxSteps - c.steps
+	}
+	return n, nil
+}
+
+// CallDepth returns an error if depth nested calls exceed the limit.
+func (c *LimitChecker) CallDepth(depth int) error {
+	limit := c.limits.MaxCallDepth
+	if limit <= 0 {
+		limit = DefaultMaxCallDepth
+	}
+	if depth > limit {
+		return &CallDepthError{Limit: limit}
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package objects
+
+import "errors"
+
+// ErrAllocationLimit is raised, as a runtime error programs can catch, once
+// a program allocates more than Limits.MaxAllocatedBytes.
+var ErrAllocationLimit = errors.New("memory limit exceeded")
+
+// Estimated sizes in bytes of the values programs allocate. They follow the
+// layout of the Go values closely enough to bound memory use, without
+// counting allocator overhead or values shared with other objects.
+const (
+	HashSize     = 48 // a Hash and its empty map
+	InstanceSize = 56 // an instance, its class pointer and its empty field map
+)
+
+// StringSize estimates the bytes of a String holding s.
+func StringSize(s string) int64 {
+	return 16 + int64(len(s))
+}
+
+// ArraySize estimates the bytes of an Array of n elements.
+func ArraySize(n int) int64 {
+	return 24 + 16*int64(n)
+}
+
+// SizeOf estimates the bytes of a string, array or hash, not counting the
+// values it holds, or returns 0 for other values.
+func SizeOf(value Object) int64 {
+	switch v := value.(type) {
+	case *String:
+		return StringSize(v.Value)
+	case *Array:
+		return ArraySize(len(v.Elements))
+	case *Hash:
+		size := int64(HashSize)
+		for _, key := range v.Keys() {
+			size += KeySize(key)
+		}
+		return size
+	}
+	return 0
+}
+
+// EntrySize estimates the bytes a hash entry or instance field named key
+// adds to its map.
+func EntrySize(key string) int64 {
+	return 40 + int64(len(key))
+}
+
+// KeySize estimates the bytes an entry with the given key adds to a hash.
+func KeySize(key Object) int64 {
+	if s, ok := key.(*String); ok {
+		return EntrySize(s.Value)
+	}
+	return EntrySize("")
+}
+
+// MemoryStats counts the values a run allocated.
+type MemoryStats struct {
+	Allocations int64 // arrays, hashes, strings and instances created, and entries added
+	Bytes       int64 // estimated size of those allocations
+}
+
+// Alloc accounts for an allocation of bytes, returning ErrAllocationLimit
+// once the run has allocated more than Limits.MaxAllocatedBytes in total.
+// Bytes are never given back when values become unused, so the limit is a
+// budget for all the allocations of a run.
+func (c *LimitChecker) Alloc(bytes int64) error {
+	c.memory.Allocations++
+	c.memory.Bytes += bytes
+	if c.limits.MaxAllocatedBytes > 0 && c.memory.Bytes > c.limits.MaxAllocatedBytes {
+		return ErrAllocationLimit
+	}
+	return nil
+}
+
+// MemoryStats returns the allocations of the current or last run.
+func (c *LimitChecker) MemoryStats() MemoryStats {
+	return c.memory
+}
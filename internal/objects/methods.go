@@ -0,0 +1,49 @@
+package objects
+
+import "fmt"
+
+// builtinMethod is a method of a built-in type, such as push on arrays.
+type builtinMethod struct {
+	arity int // number of arguments, -1 for any number
+	doc   string
+	fn    func(rt Runtime, receiver Object, args []Object) (Object, error)
+}
+
+// methods holds the methods of each built-in type.
+var methods = map[Type]map[string]*builtinMethod{
+	TypeArray:  arrayMethods,
+	TypeHash:   hashMethods,
+	TypeString: stringMethods,
+}
+
+// Method returns the built-in method called name bound to value, as a
+// native function, or false if values of its type have no such method.
+func Method(value Object, name string) (*NativeFunction, bool) {
+	m, ok := methods[value.Type()][name]
+	if !ok {
+		return nil, false
+	}
+	return &NativeFunction{
+		Name:    name,
+		NumArgs: m.arity,
+		Doc:     m.doc,
+		Fn: func(rt Runtime, args ...Object) (Object, error) {
+			return m.fn(rt, value, args)
+		},
+	}, true
+}
+
+// HasMethods reports whether values of value's type have built-in methods.
+func HasMethods(value Object) bool {
+	_, ok := methods[value.Type()]
+	return ok
+}
+
+// intArg returns args[i] as an integer, naming the method in errors.
+func intArg(method string, args []Object, i int) (int, error) {
+	n, ok := args[i].(*Number)
+	if !ok || n.Value != float64(int(n.Value)) {
+		return 0, fmt.Errorf("%s() expects an integer, got %s", method, Stringify(args[i]))
+	}
+	return int(n.Value), nil
+}
@@ -3,14 +3,20 @@ package objects
 import (
 	"errors"
 	"fmt"
+	"math"
+	"strconv"
+	"strings"
 	"time"
 )
 
-type NativeFunctionFn func(args ...Object) (Object, error)
+// NativeFunctionFn implements a native function. It can call back into the
+// program through rt.
+type NativeFunctionFn func(rt Runtime, args ...Object) (Object, error)
 
 type NativeFunction struct {
 	Name    string
-	NumArgs int // -1 means variadic
+	NumArgs int    // -1 means variadic
+	Doc     string // short description, shown by tools such as the language server
 	Fn      NativeFunctionFn
 }
 
@@ -18,7 +24,7 @@ func (n *NativeFunction) Type() Type      { return TypeNativeFun }
 func (n *NativeFunction) Inspect() string { return fmt.Sprintf("<native_fun %s>", n.Name) }
 
 func (n *NativeFunction) Call(exec BlockExecutor, arguments []Object) (Object, error) {
-	return n.Fn(arguments...)
+	return n.Fn(exec, arguments...)
 }
 
 func (n *NativeFunction) Arity() int {
@@ -29,23 +35,19 @@ func (n *NativeFunction) String() string {
 	return n.Inspect()
 }
 
-var NativeFunctions = []*NativeFunction{
-	{Name: "clock", NumArgs: 0, Fn: nativeClock},
-	{Name: "len", NumArgs: 1, Fn: nativeLen},
+// builtins are the native functions of DefaultNatives.
+var builtins = []*NativeFunction{
+	{Name: "clock", NumArgs: 0, Doc: "Returns the current Unix time in seconds.", Fn: nativeClock},
+	{Name: "len", NumArgs: 1, Doc: "Returns the length of a string, array or hash.", Fn: nativeLen},
+	{Name: "num", NumArgs: 1, Doc: "Converts a string to a number.", Fn: nativeNum},
+	{Name: "str", NumArgs: 1, Doc: "Converts a value to its string form.", Fn: nativeStr},
 }
 
-func GetNativeFunctionByIndex(index int) *NativeFunction {
-	if index < 0 || index >= len(NativeFunctions) {
-		return nil
-	}
-	return NativeFunctions[index]
-}
-
-func nativeClock(args ...Object) (Object, error) {
+func nativeClock(rt Runtime, args ...Object) (Object, error) {
 	return NewNumber(float64(time.Now().Unix())), nil
 }
 
-func nativeLen(args ...Object) (Object, error) {
+func nativeLen(rt Runtime, args ...Object) (Object, error) {
 	if len(args) != 1 {
 		return nil, fmt.Errorf("wrong number of arguments. got=%d, want=1", len(args))
 	}
@@ -53,15 +55,36 @@ func nativeLen(args ...Object) (Object, error) {
 	value := args[0]
 	switch value.Type() {
 	case TypeString:
-		return NewNumber(float64(len(value.(*String).Value))), nil
+		return NewNumber(float64(value.(*String).Len())), nil
 	case TypeArray:
 		if arr, ok := value.(*Array); ok {
 			return NewNumber(float64(len(arr.Elements))), nil
 		}
 	case TypeHash:
 		if hash, ok := value.(*Hash); ok {
-			return NewNumber(float64(len(hash.Pairs))), nil
+			return NewNumber(float64(hash.Len())), nil
+		}
+	}
+	return nil, errors.New("invalid argument type for len function: " + TypeName(value))
+}
+
+func nativeNum(rt Runtime, args ...Object) (Object, error) {
+	switch value := args[0].(type) {
+	case *Number:
+		return value, nil
+	case *String:
+		n, err := strconv.ParseFloat(strings.TrimSpace(value.Value), 64)
+		if err != nil || math.IsInf(n, 0) || math.IsNaN(n) {
+			return nil, fmt.Errorf("num() cannot convert '%s' to a number", value.Value)
 		}
+		return NewNumber(n), nil
+	}
+	return nil, errors.New("invalid argument type for num function: " + TypeName(args[0]))
+}
+
+func nativeStr(rt Runtime, args ...Object) (Object, error) {
+	if s, ok := args[0].(*String); ok {
+		return s, nil
 	}
-	return nil, errors.New("invalid argument type for len function: " + string(value.Type()))
+	return newString(rt, Stringify(args[0]))
 }
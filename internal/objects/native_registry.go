@@ -0,0 +1,111 @@
+package objects
+
+import "fmt"
+
+// NativeRegistry is the set of native functions a program can call. The
+// compiler, the VM and the interpreter each receive one, so different hosts
+// can expose different natives. Compiled code refers to natives by their
+// index in the registry, so a program must run with the registry it was
+// compiled with.
+type NativeRegistry struct {
+	functions []*NativeFunction
+	indices   map[string]int // name -> index in functions
+}
+
+// NewNativeRegistry returns a registry holding the given natives, which must
+// have distinct names.
+func NewNativeRegistry(functions ...*NativeFunction) (*NativeRegistry, error) {
+	r := &NativeRegistry{indices: make(map[string]int)}
+	for _, fn := range functions {
+		if err := r.Register(fn); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// DefaultNatives returns a new registry holding the builtin natives, such as
+// len and clock.
+func DefaultNatives() *NativeRegistry {
+	r, err := NewNativeRegistry(builtins...)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+// defaultNatives is used by constructors given a nil registry. It is never
+// handed out, so it cannot be changed.
+var defaultNatives = DefaultNatives()
+
+// NativesOrDefault returns r, or the builtin natives if r is nil.
+func NativesOrDefault(r *NativeRegistry) *NativeRegistry {
+	if r == nil {
+		return defaultNatives
+	}
+	return r
+}
+
+// Register adds fn after the natives already registered.
+func (r *NativeRegistry) Register(fn *NativeFunction) error {
+	if fn == nil || fn.Fn == nil {
+		return fmt.Errorf("native function has no implementation")
+	}
+	if fn.NumArgs < -1 {
+		return fmt.Errorf("native function %s has invalid arity %d", fn.Name, fn.NumArgs)
+	}
+	if _, exists := r.indices[fn.Name]; exists {
+		return fmt.Errorf("native function %s is already registered", fn.Name)
+	}
+	r.indices[fn.Name] = len(r.functions)
+	r.functions = append(r.functions, fn)
+	return nil
+}
+
+// Remove removes the native called name, renumbering the natives after it.
+// It reports whether there was one.
+func (r *NativeRegistry) Remove(name string) bool {
+	index, ok := r.indices[name]
+	if !ok {
+		return false
+	}
+	r.functions = append(r.functions[:index:index], r.functions[index+1:]...)
+	delete(r.indices, name)
+	for i := index; i < len(r.functions); i++ {
+		r.indices[r.functions[i].Name] = i
+	}
+	return true
+}
+
+// Lookup returns the index of the native called name.
+func (r *NativeRegistry) Lookup(name string) (int, bool) {
+	index, ok := r.indices[name]
+	return index, ok
+}
+
+// Get returns the native at index, or nil if there is none.
+func (r *NativeRegistry) Get(index int) *NativeFunction {
+	if index < 0 || index >= len(r.functions) {
+		return nil
+	}
+	return r.functions[index]
+}
+
+// Functions returns the registered natives in index order.
+func (r *NativeRegistry) Functions() []*NativeFunction {
+	return append([]*NativeFunction(nil), r.functions...)
+}
+
+// Names returns the names of the registered natives in index order.
+func (r *NativeRegistry) Names() []string {
+	names := make([]string, len(r.functions))
+	for i, fn := range r.functions {
+		names[i] = fn.Name
+	}
+	return names
+}
+
+// Len returns the number of registered natives.
+func (r *NativeRegistry) Len() int {
+	return len(r.functions)
+}
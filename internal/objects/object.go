@@ -21,6 +21,8 @@ const (
 	TypeCompiledClass    Type = "COMPILED_CLASS"
 	TypeCompiledInstance Type = "COMPILED_INSTANCE"
 	TypeBoundMethod      Type = "BOUND_METHOD"
+	TypeError            Type = "ERROR"
+	TypeIterator         Type = "ITERATOR"
 )
 
 // Object is a runtime value.
@@ -29,46 +31,19 @@ type Object interface {
 	Inspect() string
 }
 
-// IsTruthy implements language truthiness rules.
-func IsTruthy(v Object) bool {
-	if v == nil {
-		return false
-	}
-	switch val := v.(type) {
-	case *Bool:
-		return val.Value
-	case *Nil:
-		return false
-	case *Number:
-		return val.Value != 0
-	case *String:
-		return val.Value != ""
-	case *Array:
-		return len(val.Elements) > 0
-	case *Hash:
-		return len(val.Pairs) > 0
-	default:
-		return true
-	}
-}
-
-// IsEqual implements language equality semantics.
-func IsEqual(a, b Object) bool {
-	switch av := a.(type) {
-	case *Nil:
-		_, isNil := b.(*Nil)
-		return isNil
-	case *Number:
-		bv, ok := b.(*Number)
-		return ok && av.Value == bv.Value
-	case *String:
-		bv, ok := b.(*String)
-		return ok && av.Value == bv.Value
-	case *Bool:
-		bv, ok := b.(*Bool)
-		return ok && av.Value == bv.Value
+// TypeName returns the name error messages use for the type of v. Values
+// the interpreter and the VM represent differently share a name, so a
+// program fails with the same message on both.
+func TypeName(v Object) string {
+	switch t := v.Type(); t {
+	case TypeCompiledFunction, TypeClosure, TypeBoundMethod:
+		return string(TypeFunction)
+	case TypeCompiledClass:
+		return string(TypeClass)
+	case TypeCompiledInstance:
+		return string(TypeInstance)
 	default:
-		return a == b
+		return string(t)
 	}
 }
 
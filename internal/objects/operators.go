@@ -0,0 +1,284 @@
+package objects
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// This file holds the semantics of the operators, shared by the
+// interpreter and the VM so that both behave the same. Errors are returned
+// as plain errors carrying the message programs see; each engine reports
+// them at the position of the operator.
+
+// Operator is a binary arithmetic or comparison operator.
+type Operator byte
+
+const (
+	Add Operator = iota
+	Subtract
+	Multiply
+	Divide
+	Modulo
+	FloorDivide
+	Power
+	Greater
+	GreaterEqual
+	Less
+	LessEqual
+)
+
+var (
+	errOperands       = errors.New("Operands must be numbers.")
+	errAddOperands    = errors.New("Operands to '+' must be two numbers, two strings, a string and a number, or two hashes.")
+	errOperand        = errors.New("Operand must be a number.")
+	errDivideByZero   = errors.New("Division by zero.")
+	errIndexNumber    = errors.New("Index must be a number.")
+	errIndexInteger   = errors.New("Index must be an integer.")
+	errOutOfBounds    = errors.New("Index out of bounds.")
+	errIndexTarget    = errors.New("Indexing target must be an array, string or hash map.")
+	errSetIndexTarget = errors.New("Index assignment target must be an array or hash map.")
+	errSliceBounds    = errors.New("Slice bounds must be integers.")
+	errSliceTarget    = errors.New("Only strings and arrays can be sliced.")
+)
+
+// Binary applies op to two operands. rt accounts for the strings and
+// hashes that + builds.
+func Binary(rt Runtime, op Operator, left, right Object) (Object, error) {
+	if l, ok := left.(*Number); ok {
+		if r, ok := right.(*Number); ok {
+			return arithmetic(op, l.Value, r.Value)
+		}
+	}
+	if op == Add {
+		return add(rt, left, right)
+	}
+	return nil, errOperands
+}
+
+func arithmetic(op Operator, a, b float64) (Object, error) {
+	if op >= Greater {
+		return NewBool(Compare(op, a, b)), nil
+	}
+	n, err := Arithmetic(op, a, b)
+	if err != nil {
+		return nil, err
+	}
+	return NewNumber(n), nil
+}
+
+// Arithmetic applies one of the operators from Add to Power to two numbers.
+// It lets the VM compute with numbers it holds without boxing them.
+func Arithmetic(op Operator, a, b float64) (float64, error) {
+	switch op {
+	case Add:
+		return a + b, nil
+	case Subtract:
+		return a - b, nil
+	case Multiply:
+		return a * b, nil
+	case Divide:
+		if b == 0 {
+			return 0, errDivideByZero
+		}
+		return a / b, nil
+	case Modulo:
+		if b == 0 {
+			return 0, errDivideByZero
+		}
+		// The result takes the sign of the divisor, matching floor division
+		mod := math.Mod(a, b)
+		if mod != 0 && (mod < 0) != (b < 0) {
+			mod += b
+		}
+		return mod, nil
+	case FloorDivide:
+		if b == 0 {
+			return 0, errDivideByZero
+		}
+		return math.Floor(a / b), nil
+	case Power:
+		return math.Pow(a, b), nil
+	}
+	return 0, fmt.Errorf("unknown operator %d", op)
+}
+
+// Compare applies one of the comparisons from Greater to LessEqual to two
+// numbers.
+func Compare(op Operator, a, b float64) bool {
+	switch op {
+	case Greater:
+		return a > b
+	case GreaterEqual:
+		return a >= b
+	case Less:
+		return a < b
+	case LessEqual:
+		return a <= b
+	}
+	return false
+}
+
+// add implements + for operands that are not both numbers: it concatenates
+// strings, with numbers in the form print shows them, and merges hashes.
+func add(rt Runtime, left, right Object) (Object, error) {
+	var result Object
+	switch l := left.(type) {
+	case *String:
+		switch r := right.(type) {
+		case *String:
+			result = NewString(l.Value + r.Value)
+		case *Number:
+			result = NewString(l.Value + r.Inspect())
+		}
+	case *Number:
+		if r, ok := right.(*String); ok {
+			result = NewString(l.Inspect() + r.Value)
+		}
+	case *Hash:
+		if r, ok := right.(*Hash); ok {
+			result = l.Merge(r)
+		}
+	}
+	if result == nil {
+		return nil, errAddOperands
+	}
+	if err := rt.Alloc(SizeOf(result)); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Negate implements unary minus.
+func Negate(operand Object) (Object, error) {
+	n, ok := operand.(*Number)
+	if !ok {
+		return nil, errOperand
+	}
+	return NewNumber(-n.Value), nil
+}
+
+// IsTruthy implements language truthiness rules.
+func IsTruthy(v Object) bool {
+	if v == nil {
+		return false
+	}
+	switch val := v.(type) {
+	case *Bool:
+		return val.Value
+	case *Nil:
+		return false
+	case *Number:
+		return val.Value != 0
+	case *String:
+		return val.Value != ""
+	case *Array:
+		return len(val.Elements) > 0
+	case *Hash:
+		return val.Len() > 0
+	default:
+		return true
+	}
+}
+
+// IsEqual implements language equality semantics.
+func IsEqual(a, b Object) bool {
+	switch av := a.(type) {
+	case *Nil:
+		_, isNil := b.(*Nil)
+		return isNil
+	case *Number:
+		bv, ok := b.(*Number)
+		return ok && av.Value == bv.Value
+	case *String:
+		bv, ok := b.(*String)
+		return ok && av.Value == bv.Value
+	case *Bool:
+		bv, ok := b.(*Bool)
+		return ok && av.Value == bv.Value
+	default:
+		return a == b
+	}
+}
+
+// Index returns left[index] for an array, a string or a hash. rt computes
+// the keys of instances with a hash method and accounts for the characters
+// read from strings.
+func Index(rt Runtime, left, index Object) (Object, error) {
+	switch l := left.(type) {
+	case *Array:
+		i, err := intIndex(index)
+		if err != nil {
+			return nil, err
+		}
+		return l.Get(i)
+	case *String:
+		i, err := intIndex(index)
+		if err != nil {
+			return nil, err
+		}
+		char, err := l.Get(i)
+		if err != nil {
+			return nil, err
+		}
+		if err := rt.Alloc(SizeOf(char)); err != nil {
+			return nil, err
+		}
+		return char, nil
+	case *Hash:
+		k, err := HashKeyOf(rt, index)
+		if err != nil {
+			return nil, err
+		}
+		value, ok := l.Get(k)
+		if !ok {
+			return nil, fmt.Errorf("Key '%s' not found in hash map.", index.Inspect())
+		}
+		return value, nil
+	}
+	return nil, errIndexTarget
+}
+
+// SetIndex sets left[index] to value for an array or a hash. rt computes
+// the keys of instances with a hash method and accounts for new entries.
+func SetIndex(rt Runtime, left, index, value Object) error {
+	switch l := left.(type) {
+	case *Array:
+		i, err := intIndex(index)
+		if err != nil {
+			return err
+		}
+		return l.Set(i, value)
+	case *Hash:
+		k, err := HashKeyOf(rt, index)
+		if err != nil {
+			return err
+		}
+		if _, ok := l.Get(k); !ok {
+			if err := rt.Alloc(KeySize(index)); err != nil {
+				return err
+			}
+		}
+		l.Set(k, index, value)
+		return nil
+	}
+	return errSetIndexTarget
+}
+
+// intIndex returns an array or string index as an int.
+func intIndex(index Object) (int, error) {
+	n, ok := index.(*Number)
+	if !ok {
+		return 0, errIndexNumber
+	}
+	return IntIndex(n.Value)
+}
+
+// IntIndex returns a number used as an array or string index as an int.
+func IntIndex(n float64) (int, error) {
+	i := int(n)
+	if float64(i) != n {
+		return 0, errIndexInteger
+	}
+	return i, nil
+}
@@ -0,0 +1,70 @@
+package objects
+
+import "unicode/utf8"
+
+// Len returns the number of characters in the string, counting runes.
+func (s *String) Len() int {
+	return utf8.RuneCountInString(s.Value)
+}
+
+// Get returns the character at the given rune index with bounds checking.
+func (s *String) Get(index int) (Object, error) {
+	if index >= 0 {
+		for _, r := range s.Value {
+			if index == 0 {
+				return NewString(string(r)), nil
+			}
+			index--
+		}
+	}
+	return nil, errOutOfBounds
+}
+
+// Slice returns value[start:end] for a string or an array. The bounds are
+// integers, or nil for the start and end of value, and negative bounds count
+// from the end. Strings are sliced by rune and arrays are copied.
+func Slice(value, start, end Object) (Object, error) {
+	switch v := value.(type) {
+	case *String:
+		runes := []rune(v.Value)
+		from, to, err := sliceBounds(start, end, len(runes))
+		if err != nil {
+			return nil, err
+		}
+		return NewString(string(runes[from:to])), nil
+	case *Array:
+		from, to, err := sliceBounds(start, end, len(v.Elements))
+		if err != nil {
+			return nil, err
+		}
+		elements := make([]Object, to-from)
+		copy(elements, v.Elements[from:to])
+		return NewArray(elements), nil
+	}
+	return nil, errSliceTarget
+}
+
+// sliceBounds resolves the bounds of a slice of n items.
+func sliceBounds(start, end Object, n int) (int, int, error) {
+	from, err := sliceBound(start, 0)
+	if err != nil {
+		return 0, 0, err
+	}
+	to, err := sliceBound(end, n)
+	if err != nil {
+		return 0, 0, err
+	}
+	from, to = clampRange(from, to, n)
+	return from, to, nil
+}
+
+func sliceBound(bound Object, omitted int) (int, error) {
+	if bound == nil || bound.Type() == TypeNil {
+		return omitted, nil
+	}
+	n, ok := bound.(*Number)
+	if !ok || n.Value != float64(int(n.Value)) {
+		return 0, errSliceBounds
+	}
+	return int(n.Value), nil
+}
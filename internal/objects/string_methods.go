@@ -0,0 +1,160 @@
+package objects
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"unicode/utf8"
+)
+
+var stringMethods = map[string]*builtinMethod{
+	"split":      {arity: 1, doc: "Splits the string around each occurrence of a separator, or into characters if it is empty.", fn: stringSplit},
+	"join":       {arity: 1, doc: "Joins the elements of an array with the string between them.", fn: stringJoin},
+	"trim":       {arity: 0, doc: "Returns the string without leading and trailing whitespace.", fn: stringTrim},
+	"upper":      {arity: 0, doc: "Returns the string in upper case.", fn: stringUpper},
+	"lower":      {arity: 0, doc: "Returns the string in lower case.", fn: stringLower},
+	"contains":   {arity: 1, doc: "Reports whether the string contains a substring.", fn: stringContains},
+	"startsWith": {arity: 1, doc: "Reports whether the string begins with a prefix.", fn: stringStartsWith},
+	"endsWith":   {arity: 1, doc: "Reports whether the string ends with a suffix.", fn: stringEndsWith},
+	"indexOf":    {arity: 1, doc: "Returns the character index of the first occurrence of a substring, or -1.", fn: stringIndexOf},
+	"replace":    {arity: 2, doc: "Returns the string with every occurrence of a substring replaced.", fn: stringReplace},
+	"repeat":     {arity: 1, doc: "Returns the string repeated a number of times.", fn: stringRepeat},
+	"chars":      {arity: 0, doc: "Returns an array of the characters of the string.", fn: stringChars},
+}
+
+func stringSplit(rt Runtime, receiver Object, args []Object) (Object, error) {
+	sep, err := stringArg("split", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	return newStringArray(rt, strings.Split(receiver.(*String).Value, sep))
+}
+
+func stringJoin(rt Runtime, receiver Object, args []Object) (Object, error) {
+	array, ok := args[0].(*Array)
+	if !ok {
+		return nil, fmt.Errorf("join() expects an array, got %s", Stringify(args[0]))
+	}
+	parts := make([]string, len(array.Elements))
+	for i, element := range array.Elements {
+		parts[i] = Stringify(element)
+	}
+	return newString(rt, strings.Join(parts, receiver.(*String).Value))
+}
+
+func stringTrim(rt Runtime, receiver Object, args []Object) (Object, error) {
+	return newString(rt, strings.TrimSpace(receiver.(*String).Value))
+}
+
+func stringUpper(rt Runtime, receiver Object, args []Object) (Object, error) {
+	return newString(rt, strings.ToUpper(receiver.(*String).Value))
+}
+
+func stringLower(rt Runtime, receiver Object, args []Object) (Object, error) {
+	return newString(rt, strings.ToLower(receiver.(*String).Value))
+}
+
+func stringContains(rt Runtime, receiver Object, args []Object) (Object, error) {
+	sub, err := stringArg("contains", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	return NewBool(strings.Contains(receiver.(*String).Value, sub)), nil
+}
+
+func stringStartsWith(rt Runtime, receiver Object, args []Object) (Object, error) {
+	prefix, err := stringArg("startsWith", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	return NewBool(strings.HasPrefix(receiver.(*String).Value, prefix)), nil
+}
+
+func stringEndsWith(rt Runtime, receiver Object, args []Object) (Object, error) {
+	suffix, err := stringArg("endsWith", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	return NewBool(strings.HasSuffix(receiver.(*String).Value, suffix)), nil
+}
+
+func stringIndexOf(rt Runtime, receiver Object, args []Object) (Object, error) {
+	sub, err := stringArg("indexOf", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	s := receiver.(*String).Value
+	index := strings.Index(s, sub)
+	if index < 0 {
+		return NewNumber(-1), nil
+	}
+	// Count characters rather than bytes
+	return NewNumber(float64(utf8.RuneCountInString(s[:index]))), nil
+}
+
+func stringReplace(rt Runtime, receiver Object, args []Object) (Object, error) {
+	old, err := stringArg("replace", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	replacement, err := stringArg("replace", args, 1)
+	if err != nil {
+		return nil, err
+	}
+	return newString(rt, strings.ReplaceAll(receiver.(*String).Value, old, replacement))
+}
+
+func stringRepeat(rt Runtime, receiver Object, args []Object) (Object, error) {
+	count, err := intArg("repeat", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	s := receiver.(*String).Value
+	if count < 0 {
+		return nil, fmt.Errorf("repeat() count must not be negative: %d", count)
+	}
+	if count > 0 && len(s) > math.MaxInt32/count {
+		return nil, fmt.Errorf("repeat() result too long")
+	}
+	// Account for the result before building it
+	if err := rt.Alloc(StringSize(s) * int64(count)); err != nil {
+		return nil, err
+	}
+	return NewString(strings.Repeat(s, count)), nil
+}
+
+func stringChars(rt Runtime, receiver Object, args []Object) (Object, error) {
+	return newStringArray(rt, strings.Split(receiver.(*String).Value, ""))
+}
+
+// stringArg returns args[i] as a Go string, naming the method in errors.
+func stringArg(method string, args []Object, i int) (string, error) {
+	s, ok := args[i].(*String)
+	if !ok {
+		return "", fmt.Errorf("%s() expects a string, got %s", method, Stringify(args[i]))
+	}
+	return s.Value, nil
+}
+
+// newString returns a string built by a method, accounting for it.
+func newString(rt Runtime, value string) (Object, error) {
+	if err := rt.Alloc(StringSize(value)); err != nil {
+		return nil, err
+	}
+	return NewString(value), nil
+}
+
+// newStringArray returns an array of strings built by a method, accounting
+// for the array and its strings.
+func newStringArray(rt Runtime, values []string) (Object, error) {
+	size := ArraySize(len(values))
+	elements := make([]Object, len(values))
+	for i, value := range values {
+		size += StringSize(value)
+		elements[i] = NewString(value)
+	}
+	if err := rt.Alloc(size); err != nil {
+		return nil, err
+	}
+	return NewArray(elements), nil
+}
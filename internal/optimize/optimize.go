@@ -0,0 +1,363 @@
+// Package optimize rewrites a parsed module into a simpler one that
+// behaves the same. It folds operators applied to constants, removes
+// branches and loops whose conditions are constant and false, drops
+// statements that can never run, and removes double negations from
+// conditions.
+//
+// Operators are folded with the functions the engines run them with, and
+// only when they succeed, so every runtime error is left in place and is
+// still reported at its line.
+package optimize
+
+import (
+	"github.com/harshagw/viri/internal/ast"
+	"github.com/harshagw/viri/internal/objects"
+	"github.com/harshagw/viri/internal/token"
+)
+
+// Module optimizes the statements of mod in place. Statements after a
+// throw at the top level are kept, as they may declare exports that
+// importing modules are compiled against.
+func Module(mod *ast.Module) {
+	result := mod.Statements[:0]
+	for _, s := range mod.Statements {
+		if s = statement(s); s != nil {
+			result = append(result, s)
+		}
+	}
+	mod.Statements = result
+}
+
+// binaryOperators maps the tokens of the arithmetic and comparison
+// operators to the operators they apply.
+var binaryOperators = map[token.Type]objects.Operator{
+	token.PLUS:          objects.Add,
+	token.MINUS:         objects.Subtract,
+	token.STAR:          objects.Multiply,
+	token.SLASH:         objects.Divide,
+	token.PERCENT:       objects.Modulo,
+	token.TILDE_SLASH:   objects.FloorDivide,
+	token.STAR_STAR:     objects.Power,
+	token.GREATER:       objects.Greater,
+	token.GREATER_EQUAL: objects.GreaterEqual,
+	token.LESS:          objects.Less,
+	token.LESS_EQUAL:    objects.LessEqual,
+}
+
+// statements optimizes a list of statements, dropping those that follow a
+// statement that always leaves the list.
+func statements(list []ast.Stmt) []ast.Stmt {
+	result := list[:0]
+	for _, s := range list {
+		s = statement(s)
+		if s == nil {
+			continue
+		}
+		result = append(result, s)
+		if jumps(s) {
+			break
+		}
+	}
+	return result
+}
+
+// jumps reports whether s always leaves the statement list holding it.
+func jumps(s ast.Stmt) bool {
+	switch s.(type) {
+	case *ast.ReturnStmt, *ast.BreakStmt, *ast.ContinueStmt, *ast.ThrowStmt:
+		return true
+	}
+	return false
+}
+
+// statement optimizes s, returning nil if it does nothing.
+func statement(s ast.Stmt) ast.Stmt {
+	switch s := s.(type) {
+	case *ast.ExprStmt:
+		s.Expr = expression(s.Expr)
+	case *ast.PrintStmt:
+		s.Expr = expression(s.Expr)
+	case *ast.VarDeclStmt:
+		if s.Initializer != nil {
+			s.Initializer = expression(s.Initializer)
+		}
+	case *ast.BlockStmt:
+		s.Statements = statements(s.Statements)
+	case *ast.IfStmt:
+		s.Condition = condition(s.Condition)
+		if value, ok := constant(s.Condition); ok {
+			if objects.IsTruthy(value) {
+				return statement(s.ThenBranch)
+			}
+			if s.ElseBranch == nil {
+				return nil
+			}
+			return statement(s.ElseBranch)
+		}
+		s.ThenBranch = body(s.ThenBranch)
+		if s.ElseBranch != nil {
+			s.ElseBranch = statement(s.ElseBranch)
+		}
+	case *ast.WhileStmt:
+		s.Condition = condition(s.Condition)
+		if value, ok := constant(s.Condition); ok && !objects.IsTruthy(value) {
+			return nil
+		}
+		s.Body = body(s.Body)
+	case *ast.ForStmt:
+		if s.Condition != nil {
+			s.Condition = condition(s.Condition)
+			if value, ok := constant(s.Condition); ok && !objects.IsTruthy(value) {
+				// The initializer still runs, in the scope of the loop.
+				if s.Initializer == nil {
+					return nil
+				}
+				return statement(&ast.BlockStmt{Statements: []ast.Stmt{s.Initializer}})
+			}
+		}
+		if s.Initializer != nil {
+			s.Initializer = statement(s.Initializer)
+		}
+		if s.Increment != nil {
+			s.Increment = expression(s.Increment)
+		}
+		s.Body = body(s.Body)
+	case *ast.ForInStmt:
+		s.Iterable = expression(s.Iterable)
+		s.Body = body(s.Body)
+	case *ast.FunctionStmt:
+		s.Body.Statements = statements(s.Body.Statements)
+	case *ast.ReturnStmt:
+		if s.Value != nil {
+			s.Value = expression(s.Value)
+		}
+	case *ast.ClassStmt:
+		for _, method := range s.Methods {
+			method.Body.Statements = statements(method.Body.Statements)
+		}
+	case *ast.TryStmt:
+		s.Body.Statements = statements(s.Body.Statements)
+		if s.CatchBody != nil {
+			s.CatchBody.Statements = statements(s.CatchBody.Statements)
+		}
+		if s.FinallyBody != nil {
+			s.FinallyBody.Statements = statements(s.FinallyBody.Statements)
+		}
+	case *ast.ThrowStmt:
+		s.Value = expression(s.Value)
+	}
+	return s
+}
+
+// body optimizes the body of a branch or loop, which must stay a statement.
+func body(s ast.Stmt) ast.Stmt {
+	if s = statement(s); s == nil {
+		return &ast.BlockStmt{}
+	}
+	return s
+}
+
+// condition optimizes an expression only tested for truthiness, where !!x
+// is the same as x.
+func condition(e ast.Expr) ast.Expr {
+	e = expression(e)
+	for {
+		outer, ok := e.(*ast.UnaryExpr)
+		if !ok || outer.Operator.Type != token.BANG {
+			return e
+		}
+		inner, ok := outer.Expr.(*ast.UnaryExpr)
+		if !ok || inner.Operator.Type != token.BANG {
+			return e
+		}
+		e = inner.Expr
+	}
+}
+
+// expression optimizes e, returning the expression to use in its place.
+func expression(e ast.Expr) ast.Expr {
+	switch e := e.(type) {
+	case *ast.GroupingExpr:
+		e.Expr = expression(e.Expr)
+		if _, ok := e.Expr.(*ast.LiteralExpr); ok {
+			return e.Expr
+		}
+	case *ast.UnaryExpr:
+		return unary(e)
+	case *ast.BinaryExpr:
+		return binary(e)
+	case *ast.LogicalExpr:
+		e.Left = expression(e.Left)
+		e.Right = expression(e.Right)
+		// and gives its left operand if it is falsy, or its right one; or
+		// gives its left operand if it is truthy.
+		if value, ok := constant(e.Left); ok {
+			if objects.IsTruthy(value) == (e.Operator.Type == token.AND) {
+				return e.Right
+			}
+			return e.Left
+		}
+	case *ast.AssignExpr:
+		e.Value = expression(e.Value)
+	case *ast.CallExpr:
+		e.Callee = expression(e.Callee)
+		expressions(e.Arguments)
+	case *ast.GetExpr:
+		e.Object = expression(e.Object)
+	case *ast.SetExpr:
+		e.Object = expression(e.Object)
+		e.Value = expression(e.Value)
+	case *ast.ArrayLiteralExpr:
+		expressions(e.Elements)
+	case *ast.HashLiteralExpr:
+		for i := range e.Pairs {
+			e.Pairs[i].Key = expression(e.Pairs[i].Key)
+			e.Pairs[i].Value = expression(e.Pairs[i].Value)
+		}
+	case *ast.IndexExpr:
+		e.Object = expression(e.Object)
+		e.Index = expression(e.Index)
+	case *ast.SliceExpr:
+		e.Object = expression(e.Object)
+		if e.Start != nil {
+			e.Start = expression(e.Start)
+		}
+		if e.End != nil {
+			e.End = expression(e.End)
+		}
+	case *ast.SetIndexExpr:
+		e.Object = expression(e.Object)
+		e.Index = expression(e.Index)
+		e.Value = expression(e.Value)
+	case *ast.FunctionExpr:
+		e.Body.Statements = statements(e.Body.Statements)
+	case *ast.InterpolationExpr:
+		expressions(e.Parts)
+	}
+	return e
+}
+
+func expressions(list []ast.Expr) {
+	for i, e := range list {
+		list[i] = expression(e)
+	}
+}
+
+func unary(e *ast.UnaryExpr) ast.Expr {
+	e.Expr = expression(e.Expr)
+	switch e.Operator.Type {
+	case token.BANG:
+		if value, ok := constant(e.Expr); ok {
+			return literal(objects.NewBool(!objects.IsTruthy(value)))
+		}
+		// !!x is x when x is already a boolean.
+		if inner, ok := e.Expr.(*ast.UnaryExpr); ok && inner.Operator.Type == token.BANG && boolean(inner.Expr) {
+			return inner.Expr
+		}
+	case token.MINUS:
+		if value, ok := constant(e.Expr); ok {
+			if result, err := objects.Negate(value); err == nil {
+				return literal(result)
+			}
+		}
+	}
+	return e
+}
+
+func binary(e *ast.BinaryExpr) ast.Expr {
+	e.Left = expression(e.Left)
+	e.Right = expression(e.Right)
+	left, ok := constant(e.Left)
+	if !ok {
+		return e
+	}
+	right, ok := constant(e.Right)
+	if !ok {
+		return e
+	}
+
+	switch e.Operator.Type {
+	case token.EQUAL_EQUAL:
+		return literal(objects.NewBool(objects.IsEqual(left, right)))
+	case token.BANG_EQUAL:
+		return literal(objects.NewBool(!objects.IsEqual(left, right)))
+	}
+	op, ok := binaryOperators[e.Operator.Type]
+	if !ok {
+		return e
+	}
+	result, err := objects.Binary(foldRuntime{}, op, left, right)
+	if err != nil {
+		return e
+	}
+	if folded := literal(result); folded != nil {
+		return folded
+	}
+	return e
+}
+
+// boolean reports whether e always evaluates to true or false.
+func boolean(e ast.Expr) bool {
+	switch e := e.(type) {
+	case *ast.LiteralExpr:
+		_, ok := e.Value.(bool)
+		return ok
+	case *ast.GroupingExpr:
+		return boolean(e.Expr)
+	case *ast.UnaryExpr:
+		return e.Operator.Type == token.BANG
+	case *ast.BinaryExpr:
+		switch e.Operator.Type {
+		case token.EQUAL_EQUAL, token.BANG_EQUAL, token.GREATER, token.GREATER_EQUAL, token.LESS, token.LESS_EQUAL:
+			return true
+		}
+	}
+	return false
+}
+
+// constant returns the value of e if it is a literal.
+func constant(e ast.Expr) (objects.Object, bool) {
+	lit, ok := e.(*ast.LiteralExpr)
+	if !ok {
+		return nil, false
+	}
+	switch v := lit.Value.(type) {
+	case float64:
+		return objects.NewNumber(v), true
+	case string:
+		return objects.NewString(v), true
+	case bool:
+		return objects.NewBool(v), true
+	case nil:
+		return objects.NilValue, true
+	}
+	return nil, false
+}
+
+// literal returns a literal holding value, or nil if value has none.
+func literal(value objects.Object) *ast.LiteralExpr {
+	switch v := value.(type) {
+	case *objects.Number:
+		return &ast.LiteralExpr{Value: v.Value}
+	case *objects.String:
+		return &ast.LiteralExpr{Value: v.Value}
+	case *objects.Bool:
+		return &ast.LiteralExpr{Value: v.Value}
+	case *objects.Nil:
+		return &ast.LiteralExpr{Value: nil}
+	}
+	return nil
+}
+
+// foldRuntime is the runtime operators run with while folding. Folding
+// never calls back into a program, and the strings it builds become
+// constants rather than allocations of the running program.
+type foldRuntime struct{}
+
+func (foldRuntime) CallValue(fn objects.Object, args ...objects.Object) (objects.Object, error) {
+	panic("optimize: folding called a function")
+}
+
+func (foldRuntime) Alloc(bytes int64) error {
+	return nil
+}
@@ -0,0 +1,95 @@
+package optimize
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/harshagw/viri/internal/format"
+	"github.com/harshagw/viri/internal/objects"
+	"github.com/harshagw/viri/internal/parser"
+	"github.com/harshagw/viri/internal/scanner"
+)
+
+func TestModule(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			"arithmetic",
+			"print 1 + 2 * 3;\nprint (2 ** 10) ~/ 3 % 5;\nprint -(4 - 6);",
+			"print 7;\nprint 1;\nprint 2;\n",
+		},
+		{
+			"comparisons and equality",
+			"print 1 < 2;\nprint 3 >= 4;\nprint \"a\" == \"a\";\nprint nil != false;",
+			"print true;\nprint false;\nprint true;\nprint true;\n",
+		},
+		{
+			"string concatenation",
+			"print \"a\" + \"b\" + \"c\";",
+			"print \"abc\";\n",
+		},
+		{
+			"operands that are not constant",
+			"print x + 1 + 2;\nprint 1 + 2 + x;",
+			"print x + 1 + 2;\nprint 3 + x;\n",
+		},
+		{
+			"operators that fail are kept",
+			"print 1 + nil;\nprint 1 / 0;\nprint -\"a\";\nprint \"a\" < 1;",
+			"print 1 + nil;\nprint 1 / 0;\nprint -\"a\";\nprint \"a\" < 1;\n",
+		},
+		{
+			"logical operators",
+			"print nil or x;\nprint 1 or x;\nprint false and x;\nprint true and x;\nprint x and false;",
+			"print x;\nprint 1;\nprint false;\nprint x;\nprint x and false;\n",
+		},
+		{
+			"negation",
+			"print !nil;\nprint !!(a == b);\nprint !!a;\nif (!!a) print 1;\nwhile (!!!!a) print 2;",
+			"print true;\nprint (a == b);\nprint !!a;\nif (a) print 1;\nwhile (a) print 2;\n",
+		},
+		{
+			"constant conditions",
+			"if (1 > 2) print 1;\nif (true) print 2; else print 3;\nif (nil) print 4; else print 5;\nwhile (false) print 6;\nfor (var i = 0; false;) print 7;",
+			"print 2;\nprint 5;\n\n{\n    var i = 0;\n}\n",
+		},
+		{
+			"unreachable statements",
+			"fun f() {\n  return 1;\n  print 2;\n}\nwhile (a) {\n  break;\n  print 3;\n}\nfun g() {\n  throw \"e\";\n  print 4;\n}",
+			"fun f() {\n    return 1;\n}\nwhile (a) {\n    break;\n}\nfun g() {\n    throw \"e\";\n}\n",
+		},
+		{
+			"bodies stay statements",
+			"if (a) if (false) print 1;\nwhile (a) while (false) {}",
+			"if (a) {}\nwhile (a) {}\n",
+		},
+		{
+			"top level after throw",
+			"throw \"e\";\nexport var x = 1 + 1;",
+			"throw \"e\";\nexport var x = 2;\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc := scanner.New(bytes.NewBufferString(tt.input), nil)
+			tokens, err := sc.Scan()
+			if err != nil {
+				t.Fatal(err)
+			}
+			diagnostics := &objects.DiagnosticCollector{}
+			mod, err := parser.ParseModule(tokens, "main.viri", diagnostics)
+			if err != nil || len(diagnostics.Errors) > 0 {
+				t.Fatalf("parse failed: %v %v", err, diagnostics.Errors)
+			}
+
+			Module(mod)
+			if got := string(format.Module(mod, nil)); got != tt.expected {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.expected)
+			}
+		})
+	}
+}
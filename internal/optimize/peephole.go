@@ -0,0 +1,326 @@
+package optimize
+
+import (
+	"github.com/harshagw/viri/internal/code"
+	"github.com/harshagw/viri/internal/objects"
+)
+
+// Program runs Peephole over the instructions of every module and function
+// in p, replacing their line tables with ones matching the new code.
+func Program(p *objects.CompiledProgram) {
+	for i := range p.Modules {
+		m := &p.Modules[i]
+		m.Instructions = peepholeEntry(p.DebugInfo, m.DebugInfoIdx, m.Instructions)
+	}
+	for _, constant := range p.Constants {
+		if fn, ok := constant.(*objects.CompiledFunction); ok {
+			fn.Instructions = peepholeEntry(p.DebugInfo, fn.DebugInfoIdx, fn.Instructions)
+		}
+	}
+}
+
+func peepholeEntry(debugInfo *objects.DebugInfo, idx int, ins code.Instructions) code.Instructions {
+	var entry *objects.DebugInfoEntry
+	if debugInfo != nil {
+		entry = debugInfo.Get(idx)
+	}
+	if entry == nil {
+		ins, _ = Peephole(ins, nil)
+		return ins
+	}
+	ins, entry.LineTable = Peephole(ins, entry.LineTable)
+	return ins
+}
+
+// Peephole rewrites short instruction sequences into shorter ones that
+// behave the same, given the instructions of one function or module and
+// the position of each of their bytes. It returns the new instructions and
+// their positions. Rewritten instructions keep the position of the first
+// instruction they replace, so errors are still reported where they were.
+//
+// Jumps to unconditional jumps are threaded to their final target, and
+// jumps to a return are replaced by the return. Jumps to the next
+// instruction, values pushed only to be popped, the reload after storing a
+// variable whose value is discarded and code that can never run are
+// removed. A short-circuit and or or whose result is only tested jumps
+// straight to where the test would. Jumps are made wide or narrow to fit
+// where their targets end up.
+//
+// Instructions that cannot be decoded are returned unchanged.
+func Peephole(ins code.Instructions, lines []objects.Position) (code.Instructions, []objects.Position) {
+	list, ok := decode(ins, lines)
+	if !ok {
+		return ins, lines
+	}
+	for rewrite(list) {
+		list = compact(list)
+	}
+	return encode(list)
+}
+
+// instruction is a decoded instruction. The operand holding an address is
+// the index of the instruction it points to, or the number of instructions
+// for the end of the code.
+type instruction struct {
+	op       code.Opcode
+	operands []int
+	pos      objects.Position
+	removed  bool
+}
+
+// pushes reports whether op only pushes a value, so that popping it right
+// away leaves the program as it was.
+func pushes(op code.Opcode) bool {
+	switch op {
+	case code.OpGetConstant, code.OpTrue, code.OpFalse, code.OpNil, code.OpDup,
+		code.OpGetLocal, code.OpGetGlobal, code.OpGetFree, code.OpGetNative, code.OpGetCurrentClosure:
+		return true
+	}
+	return false
+}
+
+// reloads maps the instructions storing a variable to the ones loading it.
+var reloads = map[code.Opcode]code.Opcode{
+	code.OpSetLocal:    code.OpGetLocal,
+	code.OpDefineLocal: code.OpGetLocal,
+	code.OpSetGlobal:   code.OpGetGlobal,
+	code.OpSetFree:     code.OpGetFree,
+}
+
+// comparisonJumps maps the comparisons to the instructions fusing them with
+// the conditional jump after them.
+var comparisonJumps = map[code.Opcode]code.Opcode{
+	code.OpGreaterThan:  code.OpJumpNotGreater,
+	code.OpGreaterEqual: code.OpJumpNotGreaterEqual,
+	code.OpLess:         code.OpJumpNotLess,
+	code.OpLessEqual:    code.OpJumpNotLessEqual,
+}
+
+// leaves reports whether control never continues to the instruction after
+// one of op.
+func leaves(op code.Opcode) bool {
+	switch op {
+	case code.OpJump, code.OpReturn, code.OpReturnValue, code.OpThrow:
+		return true
+	}
+	return false
+}
+
+func decode(ins code.Instructions, lines []objects.Position) ([]instruction, bool) {
+	var list []instruction
+	indices := make(map[int]int)
+	for offset := 0; offset < len(ins); {
+		op, operands, read, err := code.ReadInstruction(ins[offset:])
+		if err != nil {
+			return nil, false
+		}
+		var pos objects.Position
+		if offset < len(lines) {
+			pos = lines[offset]
+		}
+		indices[offset] = len(list)
+		list = append(list, instruction{op: op, operands: operands, pos: pos})
+		offset += read
+	}
+	indices[len(ins)] = len(list)
+
+	for i := range list {
+		if a := code.Address(list[i].op); a >= 0 {
+			target, ok := indices[list[i].operands[a]]
+			if !ok {
+				return nil, false
+			}
+			list[i].operands[a] = target
+		}
+	}
+	return list, true
+}
+
+func encode(list []instruction) (code.Instructions, []objects.Position) {
+	// Instructions with an address are wide when it is past 64K, which
+	// depends on the size of the instructions before it. Sizes only grow
+	// from one round to the next, so this settles.
+	offsets := make([]int, len(list)+1)
+	for changed := true; changed; {
+		changed = false
+		for i, in := range list {
+			size := len(code.Make(in.op, resolve(in, offsets)...))
+			if offsets[i+1] != offsets[i]+size {
+				offsets[i+1] = offsets[i] + size
+				changed = true
+			}
+		}
+	}
+
+	ins := make(code.Instructions, 0, offsets[len(list)])
+	lines := make([]objects.Position, 0, offsets[len(list)])
+	for _, in := range list {
+		encoded := code.Make(in.op, resolve(in, offsets)...)
+		ins = append(ins, encoded...)
+		for range encoded {
+			lines = append(lines, in.pos)
+		}
+	}
+	return ins, lines
+}
+
+// resolve returns the operands of in with its address, if any, turned from
+// an index into an offset.
+func resolve(in instruction, offsets []int) []int {
+	a := code.Address(in.op)
+	if a < 0 {
+		return in.operands
+	}
+	operands := append([]int(nil), in.operands...)
+	operands[a] = offsets[operands[a]]
+	return operands
+}
+
+// compact drops the removed instructions from list. Instructions are only
+// removed when running them does nothing or they can never run, so jumps to
+// a removed instruction go to the next one kept.
+func compact(list []instruction) []instruction {
+	indices := make([]int, len(list)+1)
+	kept := 0
+	for i, in := range list {
+		indices[i] = kept
+		if !in.removed {
+			kept++
+		}
+	}
+	indices[len(list)] = kept
+
+	result := make([]instruction, 0, kept)
+	for _, in := range list {
+		if in.removed {
+			continue
+		}
+		if a := code.Address(in.op); a >= 0 {
+			in.operands[a] = indices[in.operands[a]]
+		}
+		result = append(result, in)
+	}
+	return result
+}
+
+// rewrite makes one pass of rewrites over list, marking the instructions it
+// removes, and reports whether it changed anything. Sequences are only
+// rewritten when no jump lands inside them, which is checked against the
+// jumps at the start of the pass: rewriting only ever removes jumps or
+// points them at instructions that were already targets.
+func rewrite(list []instruction) bool {
+	targets := make([]bool, len(list)+1)
+	for _, in := range list {
+		if a := code.Address(in.op); a >= 0 {
+			targets[in.operands[a]] = true
+		}
+	}
+	at := func(i int) *instruction {
+		if i < len(list) {
+			return &list[i]
+		}
+		return &instruction{op: code.Opcode(255)}
+	}
+
+	changed := false
+	remove := func(ins ...*instruction) {
+		for _, in := range ins {
+			in.removed = true
+		}
+		changed = true
+	}
+
+	dead := false
+	for i := 0; i < len(list); i++ {
+		in := &list[i]
+		if targets[i] {
+			dead = false
+		}
+		if dead {
+			remove(in)
+			continue
+		}
+
+		if a := code.Address(in.op); a >= 0 {
+			if target := thread(list, in.operands[a]); target != in.operands[a] {
+				in.operands[a] = target
+				changed = true
+			}
+		}
+
+		next, after, third := at(i+1), at(i+2), at(i+3)
+		switch {
+		case in.op == code.OpJump && in.operands[0] == thread(list, i+1):
+			remove(in)
+
+		case in.op == code.OpJumpNotTruthy && in.operands[0] == thread(list, i+1):
+			// Both ways lead to the same place, so all it does is pop
+			in.op, in.operands = code.OpPop, nil
+			changed = true
+
+		case in.op == code.OpJump && in.operands[0] < len(list) &&
+			(list[in.operands[0]].op == code.OpReturn || list[in.operands[0]].op == code.OpReturnValue):
+			in.op, in.operands = list[in.operands[0]].op, nil
+			changed = true
+
+		case (in.op == code.OpTrue || in.op == code.OpFalse || in.op == code.OpNil) &&
+			next.op == code.OpJumpNotTruthy && !targets[i+1]:
+			if in.op == code.OpTrue {
+				remove(in, next)
+			} else {
+				in.op, in.operands = code.OpJump, []int{next.operands[0]}
+				remove(next)
+			}
+			i++
+
+		case pushes(in.op) && next.op == code.OpPop && !targets[i+1]:
+			remove(in, next)
+			i++
+
+		case reloads[in.op] != 0 && next.op == reloads[in.op] && next.operands[0] == in.operands[0] &&
+			after.op == code.OpPop && !targets[i+1] && !targets[i+2]:
+			remove(next, after)
+			i += 2
+
+		case in.op == code.OpGetLocal && next.op == code.OpGetConstant && after.op == code.OpAdd &&
+			third.op == code.OpSetLocal && third.operands[0] == in.operands[0] &&
+			!targets[i+1] && !targets[i+2] && !targets[i+3]:
+			// Only the addition can fail, so the fused instruction reports
+			// its position
+			in.op, in.operands, in.pos = code.OpIncrementLocal, []int{in.operands[0], next.operands[0]}, after.pos
+			remove(next, after, third)
+			i += 3
+
+		case in.op == code.OpGetLocal && next.op == code.OpGetConstant && after.op == code.OpAdd &&
+			!targets[i+1] && !targets[i+2]:
+			in.op, in.operands, in.pos = code.OpAddLocalConstant, []int{in.operands[0], next.operands[0]}, after.pos
+			remove(next, after)
+			i += 2
+
+		case comparisonJumps[in.op] != 0 && next.op == code.OpJumpNotTruthy && !targets[i+1]:
+			in.op, in.operands = comparisonJumps[in.op], next.operands
+			remove(next)
+			i++
+
+		case in.op == code.OpDup && next.op == code.OpJumpNotTruthy && after.op == code.OpPop &&
+			!targets[i+1] && !targets[i+2] &&
+			next.operands[0] < len(list) && list[next.operands[0]].op == code.OpJumpNotTruthy:
+			// The value is falsy when the jump is taken, so the test it
+			// lands on jumps too
+			next.operands[0] = list[next.operands[0]].operands[0]
+			remove(in, after)
+			i += 2
+		}
+		dead = !in.removed && leaves(in.op)
+	}
+	return changed
+}
+
+// thread follows a chain of unconditional jumps from target to the
+// instruction it ends at.
+func thread(list []instruction, target int) int {
+	for steps := 0; target < len(list) && list[target].op == code.OpJump && steps < len(list); steps++ {
+		target = list[target].operands[0]
+	}
+	return target
+}
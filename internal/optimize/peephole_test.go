@@ -0,0 +1,422 @@
+package optimize
+
+import (
+	"testing"
+
+	"github.com/harshagw/viri/internal/code"
+	"github.com/harshagw/viri/internal/objects"
+)
+
+func concat(instructions ...[]byte) code.Instructions {
+	var out code.Instructions
+	for _, ins := range instructions {
+		out = append(out, ins...)
+	}
+	return out
+}
+
+func TestPeephole(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    code.Instructions
+		expected string
+	}{
+		{
+			"jump chains are threaded",
+			concat(
+				code.Make(code.OpGetLocal, 0),       // 0000
+				code.Make(code.OpJumpNotTruthy, 11), // 0002
+				code.Make(code.OpGetLocal, 1),       // 0005
+				code.Make(code.OpPrint),             // 0007
+				code.Make(code.OpJump, 14),          // 0008
+				code.Make(code.OpJump, 17),          // 0011
+				code.Make(code.OpJump, 17),          // 0014
+				code.Make(code.OpGetLocal, 2),       // 0017
+				code.Make(code.OpJumpNotTruthy, 0),  // 0019
+				code.Make(code.OpReturn),            // 0022
+			),
+			"0000 OpGetLocal 0\n" +
+				"0002 OpJumpNotTruthy 8\n" +
+				"0005 OpGetLocal 1\n" +
+				"0007 OpPrint\n" +
+				"0008 OpGetLocal 2\n" +
+				"0010 OpJumpNotTruthy 0\n" +
+				"0013 OpReturn\n",
+		},
+		{
+			"jumps to a return",
+			concat(
+				code.Make(code.OpGetLocal, 0),      // 0000
+				code.Make(code.OpJumpNotTruthy, 8), // 0002
+				code.Make(code.OpJump, 11),         // 0005
+				code.Make(code.OpGetLocal, 1),      // 0008
+				code.Make(code.OpPrint),            // 0010
+				code.Make(code.OpReturn),           // 0011
+			),
+			"0000 OpGetLocal 0\n" +
+				"0002 OpJumpNotTruthy 6\n" +
+				"0005 OpReturn\n" +
+				"0006 OpGetLocal 1\n" +
+				"0008 OpPrint\n" +
+				"0009 OpReturn\n",
+		},
+		{
+			"stored values that are discarded",
+			concat(
+				code.Make(code.OpGetConstant, 0),
+				code.Make(code.OpSetLocal, 1),
+				code.Make(code.OpGetLocal, 1),
+				code.Make(code.OpPop),
+				code.Make(code.OpGetLocal, 1),
+				code.Make(code.OpSetGlobal, 2),
+				code.Make(code.OpGetGlobal, 2),
+				code.Make(code.OpPop),
+				code.Make(code.OpGetLocal, 1),
+				code.Make(code.OpSetFree, 0),
+				code.Make(code.OpGetFree, 0),
+				code.Make(code.OpPrint),
+				code.Make(code.OpReturn),
+			),
+			"0000 OpGetConstant 0\n" +
+				"0003 OpSetLocal 1\n" +
+				"0005 OpGetLocal 1\n" +
+				"0007 OpSetGlobal 2\n" +
+				"0010 OpGetLocal 1\n" +
+				"0012 OpSetFree 0\n" +
+				"0014 OpGetFree 0\n" +
+				"0016 OpPrint\n" +
+				"0017 OpReturn\n",
+		},
+		{
+			"values pushed and popped",
+			concat(
+				code.Make(code.OpGetGlobal, 1),
+				code.Make(code.OpPop),
+				code.Make(code.OpDup),
+				code.Make(code.OpPop),
+				code.Make(code.OpGetLocal, 0),
+				code.Make(code.OpCall, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpReturn),
+			),
+			"0000 OpGetLocal 0\n" +
+				"0002 OpCall 0\n" +
+				"0004 OpPop\n" +
+				"0005 OpReturn\n",
+		},
+		{
+			"unreachable code",
+			concat(
+				code.Make(code.OpGetLocal, 0),      // 0000
+				code.Make(code.OpJumpNotTruthy, 9), // 0002
+				code.Make(code.OpGetLocal, 1),      // 0005
+				code.Make(code.OpReturnValue),      // 0007
+				code.Make(code.OpReturn),           // 0008
+				code.Make(code.OpGetLocal, 2),      // 0009
+				code.Make(code.OpThrow),            // 0011
+				code.Make(code.OpGetLocal, 3),      // 0012
+				code.Make(code.OpPrint),            // 0014
+				code.Make(code.OpReturn),           // 0015
+			),
+			"0000 OpGetLocal 0\n" +
+				"0002 OpJumpNotTruthy 8\n" +
+				"0005 OpGetLocal 1\n" +
+				"0007 OpReturnValue\n" +
+				"0008 OpGetLocal 2\n" +
+				"0010 OpThrow\n",
+		},
+		{
+			"jumps to the next instruction",
+			concat(
+				code.Make(code.OpGetLocal, 0),      // 0000
+				code.Make(code.OpJumpNotTruthy, 5), // 0002
+				code.Make(code.OpJump, 8),          // 0005
+				code.Make(code.OpReturn),           // 0008
+			),
+			"0000 OpReturn\n",
+		},
+		{
+			"constant conditions",
+			concat(
+				code.Make(code.OpTrue),              // 0000
+				code.Make(code.OpJumpNotTruthy, 10), // 0001
+				code.Make(code.OpGetLocal, 0),       // 0004
+				code.Make(code.OpPrint),             // 0006
+				code.Make(code.OpJump, 0),           // 0007
+				code.Make(code.OpNil),               // 0010
+				code.Make(code.OpJumpNotTruthy, 0),  // 0011
+				code.Make(code.OpReturn),            // 0014
+			),
+			"0000 OpGetLocal 0\n" +
+				"0002 OpPrint\n" +
+				"0003 OpJump 0\n",
+		},
+		{
+			"and tested by a condition",
+			concat(
+				code.Make(code.OpGetLocal, 0),       // 0000
+				code.Make(code.OpDup),               // 0002
+				code.Make(code.OpJumpNotTruthy, 9),  // 0003
+				code.Make(code.OpPop),               // 0006
+				code.Make(code.OpGetLocal, 1),       // 0007
+				code.Make(code.OpJumpNotTruthy, 16), // 0009
+				code.Make(code.OpGetLocal, 2),       // 0012
+				code.Make(code.OpPrint),             // 0014
+				code.Make(code.OpNil),               // 0015
+				code.Make(code.OpReturnValue),       // 0016
+			),
+			"0000 OpGetLocal 0\n" +
+				"0002 OpJumpNotTruthy 14\n" +
+				"0005 OpGetLocal 1\n" +
+				"0007 OpJumpNotTruthy 14\n" +
+				"0010 OpGetLocal 2\n" +
+				"0012 OpPrint\n" +
+				"0013 OpNil\n" +
+				"0014 OpReturnValue\n",
+		},
+		{
+			"jumps into a sequence keep it",
+			concat(
+				code.Make(code.OpGetLocal, 0),      // 0000
+				code.Make(code.OpJumpNotTruthy, 7), // 0002
+				code.Make(code.OpGetLocal, 1),      // 0005
+				code.Make(code.OpPop),              // 0007
+				code.Make(code.OpReturn),           // 0008
+			),
+			"0000 OpGetLocal 0\n" +
+				"0002 OpJumpNotTruthy 7\n" +
+				"0005 OpGetLocal 1\n" +
+				"0007 OpPop\n" +
+				"0008 OpReturn\n",
+		},
+		{
+			"handlers and loops",
+			concat(
+				code.Make(code.OpTry, 16, 0),   // 0000
+				code.Make(code.OpGetLocal, 0),  // 0004
+				code.Make(code.OpIter, 1),      // 0006
+				code.Make(code.OpIterNext, 16), // 0008
+				code.Make(code.OpPop),          // 0011
+				code.Make(code.OpPop),          // 0012
+				code.Make(code.OpJump, 8),      // 0013
+				code.Make(code.OpPop),          // 0016
+				code.Make(code.OpEndTry),       // 0017
+				code.Make(code.OpReturn),       // 0018
+			),
+			"0000 OpTry 16 0\n" +
+				"0004 OpGetLocal 0\n" +
+				"0006 OpIter 1\n" +
+				"0008 OpIterNext 16\n" +
+				"0011 OpPop\n" +
+				"0012 OpPop\n" +
+				"0013 OpJump 8\n" +
+				"0016 OpPop\n" +
+				"0017 OpEndTry\n" +
+				"0018 OpReturn\n",
+		},
+		{
+			"local plus constant",
+			concat(
+				code.Make(code.OpGetLocal, 0),
+				code.Make(code.OpGetConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpReturnValue),
+			),
+			"0000 OpAddLocalConstant 0 1\n" +
+				"0004 OpReturnValue\n",
+		},
+		{
+			"incremented local",
+			concat(
+				code.Make(code.OpGetLocal, 2),
+				code.Make(code.OpGetConstant, 0),
+				code.Make(code.OpAdd),
+				code.Make(code.OpSetLocal, 2),
+				code.Make(code.OpGetLocal, 2),
+				code.Make(code.OpPop),
+				code.Make(code.OpGetLocal, 2),
+				code.Make(code.OpGetConstant, 0),
+				code.Make(code.OpAdd),
+				code.Make(code.OpSetLocal, 3),
+				code.Make(code.OpReturn),
+			),
+			"0000 OpIncrementLocal 2 0\n" +
+				"0004 OpAddLocalConstant 2 0\n" +
+				"0008 OpSetLocal 3\n" +
+				"0010 OpReturn\n",
+		},
+		{
+			"comparisons and jumps",
+			concat(
+				code.Make(code.OpGetLocal, 0),       // 0000
+				code.Make(code.OpGetLocal, 1),       // 0002
+				code.Make(code.OpLess),              // 0004
+				code.Make(code.OpJumpNotTruthy, 23), // 0005
+				code.Make(code.OpGetLocal, 0),       // 0008
+				code.Make(code.OpGetLocal, 1),       // 0010
+				code.Make(code.OpGreaterEqual),      // 0012
+				code.Make(code.OpJumpNotTruthy, 23), // 0013
+				code.Make(code.OpGetLocal, 0),       // 0016
+				code.Make(code.OpGetLocal, 1),       // 0018
+				code.Make(code.OpEqual),             // 0020
+				code.Make(code.OpPrint),             // 0021
+				code.Make(code.OpReturn),            // 0022
+				code.Make(code.OpGetLocal, 0),       // 0023
+				code.Make(code.OpGetLocal, 1),       // 0025
+				code.Make(code.OpLessEqual),         // 0027
+				code.Make(code.OpReturnValue),       // 0028
+			),
+			"0000 OpGetLocal 0\n" +
+				"0002 OpGetLocal 1\n" +
+				"0004 OpJumpNotLess 21\n" +
+				"0007 OpGetLocal 0\n" +
+				"0009 OpGetLocal 1\n" +
+				"0011 OpJumpNotGreaterEqual 21\n" +
+				"0014 OpGetLocal 0\n" +
+				"0016 OpGetLocal 1\n" +
+				"0018 OpEqual\n" +
+				"0019 OpPrint\n" +
+				"0020 OpReturn\n" +
+				"0021 OpGetLocal 0\n" +
+				"0023 OpGetLocal 1\n" +
+				"0025 OpLessEqual\n" +
+				"0026 OpReturnValue\n",
+		},
+		{
+			"wide instructions",
+			concat(
+				code.Make(code.OpGetLocal, 300),
+				code.Make(code.OpGetConstant, 70000),
+				code.Make(code.OpAdd),
+				code.Make(code.OpSetLocal, 300),
+				code.Make(code.OpGetLocal, 300),
+				code.Make(code.OpPop),
+				code.Make(code.OpReturn),
+			),
+			"0000 OpWide OpIncrementLocal 300 70000\n" +
+				"0008 OpReturn\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _ := Peephole(tt.input, nil)
+			if got.String() != tt.expected {
+				t.Errorf("got\n%swant\n%s", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestPeepholeLineTable(t *testing.T) {
+	type line struct {
+		ins  []byte
+		line int
+	}
+	tests := []struct {
+		name  string
+		input []line
+		want  []int // line of each byte of the result
+	}{
+		{
+			"removed instructions",
+			[]line{
+				{code.Make(code.OpGetConstant, 0), 1},
+				{code.Make(code.OpSetLocal, 0), 1},
+				{code.Make(code.OpGetLocal, 0), 1},
+				{code.Make(code.OpPop), 1},
+				{code.Make(code.OpGetLocal, 0), 2},
+				{code.Make(code.OpGetLocal, 1), 2},
+				{code.Make(code.OpAdd), 3},
+				{code.Make(code.OpPrint), 3},
+			},
+			[]int{1, 1, 1, 1, 1, 2, 2, 2, 2, 3, 3},
+		},
+		{
+			"fused instructions",
+			[]line{
+				{code.Make(code.OpGetLocal, 0), 1},
+				{code.Make(code.OpGetConstant, 0), 2},
+				{code.Make(code.OpAdd), 3},
+				{code.Make(code.OpGetConstant, 1), 4},
+				{code.Make(code.OpLess), 5},
+				{code.Make(code.OpJumpNotTruthy, 0), 6},
+			},
+			[]int{3, 3, 3, 3, 4, 4, 4, 5, 5, 5},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ins code.Instructions
+			var lines []objects.Position
+			for _, in := range tt.input {
+				ins = append(ins, in.ins...)
+				for range in.ins {
+					lines = append(lines, objects.Position{Line: in.line})
+				}
+			}
+
+			got, gotLines := Peephole(ins, lines)
+			if len(got) != len(tt.want) || len(gotLines) != len(tt.want) {
+				t.Fatalf("%d positions for %d bytes, want %d\n%s", len(gotLines), len(got), len(tt.want), got)
+			}
+			for offset, line := range tt.want {
+				if gotLines[offset].Line != line {
+					t.Errorf("offset %d at line %d, want %d\n%s", offset, gotLines[offset].Line, line, got)
+				}
+			}
+		})
+	}
+}
+
+func TestPeepholeFarJumps(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		prints    int // statements jumped over
+		unreached int // bytes of unreachable code jumped over
+		wide      bool
+	}{
+		{"jumps past 64K stay wide", 22000, 0, true},
+		{"jumps brought within 64K are narrowed", 21800, 6000, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var body []byte
+			for i := 0; i < tt.prints; i++ {
+				body = append(body, code.Make(code.OpGetLocal, 0)...)
+				body = append(body, code.Make(code.OpPrint)...)
+			}
+			unreached := make([]byte, tt.unreached)
+			for i := range unreached {
+				unreached[i] = byte(code.OpPop)
+			}
+			target := 6 + len(body) + 1 + len(unreached)
+			ins := concat(
+				code.Make(code.OpJumpNotTruthy, target), // wide: 6 bytes
+				body,
+				code.Make(code.OpReturn),
+				unreached,
+				code.Make(code.OpReturn),
+			)
+
+			got, _ := Peephole(ins, nil)
+			op, operands, n, err := code.ReadInstruction(got)
+			if err != nil || op != code.OpJumpNotTruthy || operands[0] != len(got)-1 || (n == 6) != tt.wide {
+				t.Errorf("jump = %d %v, %d bytes (%v), want OpJumpNotTruthy %d, wide %v", op, operands, n, err, len(got)-1, tt.wide)
+			}
+		})
+	}
+}
+
+func TestPeepholeMalformed(t *testing.T) {
+	tests := []code.Instructions{
+		{255},
+		concat(code.Make(code.OpJump, 0))[:2],
+		concat(code.Make(code.OpJump, 1)),
+	}
+	for _, ins := range tests {
+		if got, _ := Peephole(ins, nil); string(got) != string(ins) {
+			t.Errorf("Peephole(%v) = %v, want it unchanged", ins, got)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package parser
+
+import (
+	"bytes"
+	"testing"
+	"testing/fstest"
+
+	"github.com/harshagw/viri/internal/objects"
+	"github.com/harshagw/viri/internal/scanner"
+	"github.com/harshagw/viri/internal/testutil"
+)
+
+func FuzzParse(f *testing.F) {
+	testutil.Seed(f)
+	f.Add("class A < { }")
+	f.Add("fun (")
+
+	f.Fuzz(func(t *testing.T, src string) {
+		tokens, err := scanner.New(bytes.NewBufferString(src), nil).Scan()
+		if err != nil {
+			return
+		}
+		diagnostics := &objects.DiagnosticCollector{}
+		mod, err := ParseModule(tokens, "main.viri", diagnostics)
+		if mod == nil {
+			t.Fatalf("no module for %q", src)
+		}
+		if (err != nil) != (len(diagnostics.Errors) > 0) {
+			t.Fatalf("Parse() error = %v with %d diagnostics for %q", err, len(diagnostics.Errors), src)
+		}
+	})
+}
+
+func FuzzResolve(f *testing.F) {
+	files := testutil.Seed(f)
+	f.Add("import \"module_math.viri\" as m; print m.missing;")
+
+	f.Fuzz(func(t *testing.T, src string) {
+		fsys := fstest.MapFS{"main.viri": &fstest.MapFile{Data: []byte(src)}}
+		for name, file := range files {
+			if name != "main.viri" {
+				fsys[name] = file
+			}
+		}
+		loader := FSLoader{FS: fsys}
+
+		diagnostics := &objects.DiagnosticCollector{}
+		mod, err := LoadModule(loader, "main.viri", diagnostics)
+		if err != nil {
+			return
+		}
+		res := NewResolver(diagnostics)
+		res.SetLoader(loader)
+		if _, err := res.Resolve(mod); (err != nil) != (len(diagnostics.Errors) > 0) {
+			t.Fatalf("Resolve() error = %v with %d diagnostics for %q", err, len(diagnostics.Errors), src)
+		}
+	})
+}
@@ -3,7 +3,9 @@ package parser
 import (
 	"bytes"
 	"fmt"
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
 
 	"github.com/harshagw/viri/internal/ast"
@@ -29,8 +31,53 @@ func ResolveModulePath(baseDir, importPath string) (string, error) {
 	return absPath, nil
 }
 
+// ModuleLoader finds and reads the modules of a program, so programs can be
+// loaded from somewhere other than the operating system's files.
+type ModuleLoader interface {
+	// ResolveImport returns the path of the module imported as importPath by
+	// the module at fromPath.
+	ResolveImport(fromPath, importPath string) (string, error)
+	// ReadModule returns the source of the module at path.
+	ReadModule(path string) ([]byte, error)
+}
+
+// FileLoader loads modules from the operating system's files, naming them by
+// absolute path.
+type FileLoader struct{}
+
+func (FileLoader) ResolveImport(fromPath, importPath string) (string, error) {
+	return ResolveModulePath(filepath.Dir(fromPath), importPath)
+}
+
+func (FileLoader) ReadModule(path string) ([]byte, error) {
+	return os.ReadFile(path)
+}
+
+// FSLoader loads modules from a file system, naming them by their slash
+// separated path from its root.
+type FSLoader struct {
+	FS fs.FS
+}
+
+func (l FSLoader) ResolveImport(fromPath, importPath string) (string, error) {
+	target := path.Join(path.Dir(fromPath), importPath)
+	if !fs.ValidPath(target) {
+		return "", fmt.Errorf("failed to resolve path '%s': outside the module file system", importPath)
+	}
+	return target, nil
+}
+
+func (l FSLoader) ReadModule(path string) ([]byte, error) {
+	return fs.ReadFile(l.FS, path)
+}
+
 func LoadModuleFile(path string, diagnosticHandler objects.DiagnosticHandler) (*ast.Module, error) {
-	code, err := os.ReadFile(path)
+	return LoadModule(FileLoader{}, path, diagnosticHandler)
+}
+
+// LoadModule reads the module at path with loader and parses it.
+func LoadModule(loader ModuleLoader, path string, diagnosticHandler objects.DiagnosticHandler) (*ast.Module, error) {
+	code, err := loader.ReadModule(path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read module '%s': %w", path, err)
 	}
@@ -3,6 +3,7 @@ package parser
 import (
 	"path/filepath"
 	"testing"
+	"testing/fstest"
 )
 
 func TestResolveModulePath(t *testing.T) {
@@ -33,3 +34,33 @@ func TestResolveModulePath(t *testing.T) {
 		})
 	}
 }
+
+func TestFSLoaderResolveImport(t *testing.T) {
+	tests := []struct {
+		name       string
+		fromPath   string
+		importPath string
+		output     string
+	}{
+		{"same dir", "app/main.viri", "./mod.viri", "app/mod.viri"},
+		{"parent dir", "app/main.viri", "../lib/mod.viri", "lib/mod.viri"},
+		{"from root", "main.viri", "lib/mod.viri", "lib/mod.viri"},
+		{"outside root", "app/main.viri", "../../mod.viri", ""},
+	}
+
+	loader := FSLoader{FS: fstest.MapFS{}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := loader.ResolveImport(tt.fromPath, tt.importPath)
+			if tt.output == "" {
+				if err == nil {
+					t.Errorf("ResolveImport() = %s, want an error", got)
+				}
+				return
+			}
+			if err != nil || got != tt.output {
+				t.Errorf("ResolveImport() = %s, %v, want %s", got, err, tt.output)
+			}
+		})
+	}
+}
@@ -12,12 +12,20 @@ var (
 	ErrParse = errors.New("parse error")
 )
 
+// maxNesting bounds how deeply statements and expressions nest. Every stage
+// after the parser walks the tree recursively, so a deeper program could
+// exhaust their stacks.
+const maxNesting = 1000
+
 type Parser struct {
 	tokens            []token.Token
 	current           int
 	diagnosticHandler objects.DiagnosticHandler
 	hadError          bool
 	filePath          string
+
+	depth     int  // statements and expressions being parsed
+	abandoned bool // nesting went past maxNesting and the rest was skipped
 }
 
 func NewParser(tokens []token.Token, diagnosticHandler objects.DiagnosticHandler) *Parser {
@@ -76,6 +84,11 @@ func (p *Parser) parseDeclaration() ast.Stmt {
 		exported bool
 	)
 
+	if err := p.enter(p.peekCurrent()); err != nil {
+		return nil
+	}
+	defer p.leave()
+
 	// Check for export keyword
 	if p.match(token.EXPORT) {
 		exported = true
@@ -166,6 +179,12 @@ func (p *Parser) parseStmt() (ast.Stmt, error) {
 	if p.match(token.RETURN) {
 		return p.parseReturnStmt()
 	}
+	if p.match(token.TRY) {
+		return p.parseTryStmt()
+	}
+	if p.match(token.THROW) {
+		return p.parseThrowStmt()
+	}
 
 	return p.parseExprStmt()
 }
@@ -206,7 +225,8 @@ func (p *Parser) parseClass() (ast.Stmt, error) {
 			Name: superClassName,
 		}
 	}
-	if _, err = p.consume(token.LEFT_BRACE, "Expect '{' before class body."); err != nil {
+	leftBrace, err := p.consume(token.LEFT_BRACE, "Expect '{' before class body.")
+	if err != nil {
 		return nil, err
 	}
 	methods := make([]*ast.FunctionStmt, 0)
@@ -217,13 +237,16 @@ func (p *Parser) parseClass() (ast.Stmt, error) {
 		}
 		methods = append(methods, method.(*ast.FunctionStmt))
 	}
-	if _, err = p.consume(token.RIGHT_BRACE, "Expect '}' after class body."); err != nil {
+	rightBrace, err := p.consume(token.RIGHT_BRACE, "Expect '}' after class body.")
+	if err != nil {
 		return nil, err
 	}
 	return &ast.ClassStmt{
 		Name:       name,
 		Methods:    methods,
 		SuperClass: superclass,
+		LeftBrace:  leftBrace,
+		RightBrace: rightBrace,
 	}, nil
 }
 
@@ -299,10 +322,19 @@ func (p *Parser) parseWhileStmt() (ast.Stmt, error) {
 }
 
 func (p *Parser) parseForStmt() (ast.Stmt, error) {
+	keyword := p.peekPrevious()
 	if _, err := p.consume(token.LEFT_PAREN, "Expect '(' after for."); err != nil {
 		return nil, err
 	}
 
+	// "var name in" or "var name," starts a for-in loop
+	if p.check(token.VAR) && p.checkNext(token.IDENTIFIER) && p.current+2 < len(p.tokens) {
+		if next := p.tokens[p.current+2].Type; next == token.IN || next == token.COMMA {
+			p.advance()
+			return p.parseForInStmt(keyword)
+		}
+	}
+
 	var initializer ast.Stmt
 	var err error
 
@@ -362,6 +394,47 @@ func (p *Parser) parseForStmt() (ast.Stmt, error) {
 	}, nil
 }
 
+func (p *Parser) parseForInStmt(keyword *token.Token) (ast.Stmt, error) {
+	name, err := p.consume(token.IDENTIFIER, "Expect variable name.")
+	if err != nil {
+		return nil, err
+	}
+	variables := []*token.Token{name}
+
+	if p.match(token.COMMA) {
+		name, err = p.consume(token.IDENTIFIER, "Expect variable name after ','.")
+		if err != nil {
+			return nil, err
+		}
+		variables = append(variables, name)
+	}
+
+	if _, err = p.consume(token.IN, "Expect 'in' after for-in variables."); err != nil {
+		return nil, err
+	}
+
+	iterable, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = p.consume(token.RIGHT_PAREN, "Expect ')' after for-in iterable."); err != nil {
+		return nil, err
+	}
+
+	body, err := p.parseStmt()
+	if err != nil {
+		return nil, err
+	}
+
+	return &ast.ForInStmt{
+		Keyword:   keyword,
+		Variables: variables,
+		Iterable:  iterable,
+		Body:      body,
+	}, nil
+}
+
 func (p *Parser) parseIfStmt() (ast.Stmt, error) {
 	if _, err := p.consume(token.LEFT_PAREN, "Expect '(' after if."); err != nil {
 		return nil, err
@@ -394,7 +467,9 @@ func (p *Parser) parseIfStmt() (ast.Stmt, error) {
 	}, nil
 }
 
+// parseBlockStmt parses the rest of a block after its '{'.
 func (p *Parser) parseBlockStmt() (*ast.BlockStmt, error) {
+	leftBrace := p.peekPrevious()
 	statements := []ast.Stmt{}
 	for !p.isAtEnd() && !p.check(token.RIGHT_BRACE) {
 		stmt := p.parseDeclaration()
@@ -402,11 +477,14 @@ func (p *Parser) parseBlockStmt() (*ast.BlockStmt, error) {
 			statements = append(statements, stmt)
 		}
 	}
-	if _, err := p.consume(token.RIGHT_BRACE, "Expect '}' after block."); err != nil {
+	rightBrace, err := p.consume(token.RIGHT_BRACE, "Expect '}' after block.")
+	if err != nil {
 		return nil, err
 	}
 	return &ast.BlockStmt{
 		Statements: statements,
+		LeftBrace:  leftBrace,
+		RightBrace: rightBrace,
 	}, nil
 }
 
@@ -443,6 +521,71 @@ func (p *Parser) parseContinueStmt() (ast.Stmt, error) {
 	}, nil
 }
 
+func (p *Parser) parseTryStmt() (ast.Stmt, error) {
+	keyword := p.peekPrevious()
+	if _, err := p.consume(token.LEFT_BRACE, "Expect '{' after try."); err != nil {
+		return nil, err
+	}
+	body, err := p.parseBlockStmt()
+	if err != nil {
+		return nil, err
+	}
+	stmt := &ast.TryStmt{
+		Keyword: keyword,
+		Body:    body,
+	}
+
+	if p.match(token.CATCH) {
+		if _, err = p.consume(token.LEFT_PAREN, "Expect '(' after catch."); err != nil {
+			return nil, err
+		}
+		stmt.CatchParam, err = p.consume(token.IDENTIFIER, "Expect exception variable name.")
+		if err != nil {
+			return nil, err
+		}
+		if _, err = p.consume(token.RIGHT_PAREN, "Expect ')' after exception variable."); err != nil {
+			return nil, err
+		}
+		if _, err = p.consume(token.LEFT_BRACE, "Expect '{' before catch body."); err != nil {
+			return nil, err
+		}
+		stmt.CatchBody, err = p.parseBlockStmt()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if p.match(token.FINALLY) {
+		if _, err = p.consume(token.LEFT_BRACE, "Expect '{' after finally."); err != nil {
+			return nil, err
+		}
+		stmt.FinallyBody, err = p.parseBlockStmt()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if stmt.CatchBody == nil && stmt.FinallyBody == nil {
+		return nil, p.error(keyword, "Expect 'catch' or 'finally' after try block.")
+	}
+	return stmt, nil
+}
+
+func (p *Parser) parseThrowStmt() (ast.Stmt, error) {
+	keyword := p.peekPrevious()
+	value, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if _, err = p.consume(token.SEMICOLON, "Expect ';' after throw value."); err != nil {
+		return nil, err
+	}
+	return &ast.ThrowStmt{
+		Keyword: keyword,
+		Value:   value,
+	}, nil
+}
+
 func (p *Parser) parseExprStmt() (ast.Stmt, error) {
 	expr, err := p.parseExpr()
 	if err != nil {
@@ -544,12 +687,30 @@ func (p *Parser) consume(tokenType token.Type, message string) (*token.Token, er
 
 func (p *Parser) error(tok *token.Token, message string) error {
 	p.hadError = true
-	if tok != nil && p.diagnosticHandler != nil {
+	if tok != nil && p.diagnosticHandler != nil && !p.abandoned {
 		p.diagnosticHandler.Error(*tok, message)
 	}
 	return ErrParse
 }
 
+// enter starts parsing a nested statement or expression at tok. Past
+// maxNesting it reports an error and skips the rest of the tokens, as every
+// enclosing level would otherwise report its own error at the end.
+func (p *Parser) enter(tok *token.Token) error {
+	if p.depth >= maxNesting {
+		err := p.error(tok, "Too much nesting.")
+		p.current = len(p.tokens)
+		p.abandoned = true
+		return err
+	}
+	p.depth++
+	return nil
+}
+
+func (p *Parser) leave() {
+	p.depth--
+}
+
 func (p *Parser) synchronize() {
 	p.advance()
 
@@ -559,7 +720,7 @@ func (p *Parser) synchronize() {
 		}
 
 		switch p.peekCurrent().Type {
-		case token.CLASS, token.FOR, token.FUN, token.IF, token.PRINT, token.RETURN, token.VAR, token.CONST, token.WHILE:
+		case token.CLASS, token.FOR, token.FUN, token.IF, token.PRINT, token.RETURN, token.VAR, token.CONST, token.WHILE, token.TRY, token.THROW:
 			return
 		}
 
@@ -789,6 +789,116 @@ func TestParseForStmt(t *testing.T) {
 	}
 }
 
+func TestParseForInStmt(t *testing.T) {
+	tests := []struct {
+		name    string
+		tokens  []token.Token
+		wantErr bool
+		checkFn func(*testing.T, *ast.Module)
+	}{
+		{
+			name: "single variable",
+			// for (var x in items) print x;
+			tokens: []token.Token{
+				token.New(token.FOR, "for", nil, 1, nil),
+				token.New(token.LEFT_PAREN, "(", nil, 1, nil),
+				token.New(token.VAR, "var", nil, 1, nil),
+				token.New(token.IDENTIFIER, "x", nil, 1, nil),
+				token.New(token.IN, "in", nil, 1, nil),
+				token.New(token.IDENTIFIER, "items", nil, 1, nil),
+				token.New(token.RIGHT_PAREN, ")", nil, 1, nil),
+				token.New(token.PRINT, "print", nil, 1, nil),
+				token.New(token.IDENTIFIER, "x", nil, 1, nil),
+				token.New(token.SEMICOLON, ";", nil, 1, nil),
+				token.New(token.EOF, "", nil, 1, nil),
+			},
+			wantErr: false,
+			checkFn: func(t *testing.T, mod *ast.Module) {
+				forIn, ok := mod.Statements[0].(*ast.ForInStmt)
+				if !ok {
+					t.Fatalf("expected ForInStmt, got %T", mod.Statements[0])
+				}
+				if len(forIn.Variables) != 1 || forIn.Variables[0].Lexeme != "x" {
+					t.Errorf("variables = %v, want [x]", forIn.Variables)
+				}
+				if _, ok := forIn.Iterable.(*ast.VariableExpr); !ok {
+					t.Errorf("expected VariableExpr iterable, got %T", forIn.Iterable)
+				}
+				if _, ok := forIn.Body.(*ast.PrintStmt); !ok {
+					t.Errorf("expected PrintStmt body, got %T", forIn.Body)
+				}
+			},
+		},
+		{
+			name: "key and value",
+			// for (var k, v in h) print v;
+			tokens: []token.Token{
+				token.New(token.FOR, "for", nil, 1, nil),
+				token.New(token.LEFT_PAREN, "(", nil, 1, nil),
+				token.New(token.VAR, "var", nil, 1, nil),
+				token.New(token.IDENTIFIER, "k", nil, 1, nil),
+				token.New(token.COMMA, ",", nil, 1, nil),
+				token.New(token.IDENTIFIER, "v", nil, 1, nil),
+				token.New(token.IN, "in", nil, 1, nil),
+				token.New(token.IDENTIFIER, "h", nil, 1, nil),
+				token.New(token.RIGHT_PAREN, ")", nil, 1, nil),
+				token.New(token.PRINT, "print", nil, 1, nil),
+				token.New(token.IDENTIFIER, "v", nil, 1, nil),
+				token.New(token.SEMICOLON, ";", nil, 1, nil),
+				token.New(token.EOF, "", nil, 1, nil),
+			},
+			wantErr: false,
+			checkFn: func(t *testing.T, mod *ast.Module) {
+				forIn, ok := mod.Statements[0].(*ast.ForInStmt)
+				if !ok {
+					t.Fatalf("expected ForInStmt, got %T", mod.Statements[0])
+				}
+				if len(forIn.Variables) != 2 || forIn.Variables[0].Lexeme != "k" || forIn.Variables[1].Lexeme != "v" {
+					t.Errorf("variables = %v, want [k v]", forIn.Variables)
+				}
+			},
+		},
+		{
+			name: "missing in",
+			// for (var k, v h) print v;
+			tokens: []token.Token{
+				token.New(token.FOR, "for", nil, 1, nil),
+				token.New(token.LEFT_PAREN, "(", nil, 1, nil),
+				token.New(token.VAR, "var", nil, 1, nil),
+				token.New(token.IDENTIFIER, "k", nil, 1, nil),
+				token.New(token.COMMA, ",", nil, 1, nil),
+				token.New(token.IDENTIFIER, "v", nil, 1, nil),
+				token.New(token.IDENTIFIER, "h", nil, 1, nil),
+				token.New(token.RIGHT_PAREN, ")", nil, 1, nil),
+				token.New(token.PRINT, "print", nil, 1, nil),
+				token.New(token.IDENTIFIER, "v", nil, 1, nil),
+				token.New(token.SEMICOLON, ";", nil, 1, nil),
+				token.New(token.EOF, "", nil, 1, nil),
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, collector := createParserFromTokens(tt.tokens)
+			mod, err := p.Parse()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if len(collector.Errors) == 0 {
+					t.Error("expected errors but got none")
+				}
+				return
+			}
+			if tt.checkFn != nil {
+				tt.checkFn(t, mod)
+			}
+		})
+	}
+}
+
 func TestParseBreakStmt(t *testing.T) {
 	// break;
 	tokens := []token.Token{
@@ -1388,3 +1498,174 @@ func TestParseInvalidSyntax(t *testing.T) {
 		})
 	}
 }
+
+func TestParseTryStmt(t *testing.T) {
+	tests := []struct {
+		name    string
+		tokens  []token.Token
+		wantErr bool
+		checkFn func(*testing.T, *ast.TryStmt)
+	}{
+		{
+			name: "try catch finally",
+			// try { } catch (e) { } finally { }
+			tokens: []token.Token{
+				token.New(token.TRY, "try", nil, 1, nil),
+				token.New(token.LEFT_BRACE, "{", nil, 1, nil),
+				token.New(token.RIGHT_BRACE, "}", nil, 1, nil),
+				token.New(token.CATCH, "catch", nil, 1, nil),
+				token.New(token.LEFT_PAREN, "(", nil, 1, nil),
+				token.New(token.IDENTIFIER, "e", nil, 1, nil),
+				token.New(token.RIGHT_PAREN, ")", nil, 1, nil),
+				token.New(token.LEFT_BRACE, "{", nil, 1, nil),
+				token.New(token.RIGHT_BRACE, "}", nil, 1, nil),
+				token.New(token.FINALLY, "finally", nil, 1, nil),
+				token.New(token.LEFT_BRACE, "{", nil, 1, nil),
+				token.New(token.RIGHT_BRACE, "}", nil, 1, nil),
+				token.New(token.EOF, "", nil, 1, nil),
+			},
+			checkFn: func(t *testing.T, stmt *ast.TryStmt) {
+				if stmt.CatchParam == nil || stmt.CatchParam.Lexeme != "e" {
+					t.Errorf("catch param = %v, want e", stmt.CatchParam)
+				}
+				if stmt.CatchBody == nil || stmt.FinallyBody == nil {
+					t.Errorf("expected catch and finally bodies")
+				}
+			},
+		},
+		{
+			name: "try finally",
+			// try { } finally { }
+			tokens: []token.Token{
+				token.New(token.TRY, "try", nil, 1, nil),
+				token.New(token.LEFT_BRACE, "{", nil, 1, nil),
+				token.New(token.RIGHT_BRACE, "}", nil, 1, nil),
+				token.New(token.FINALLY, "finally", nil, 1, nil),
+				token.New(token.LEFT_BRACE, "{", nil, 1, nil),
+				token.New(token.RIGHT_BRACE, "}", nil, 1, nil),
+				token.New(token.EOF, "", nil, 1, nil),
+			},
+			checkFn: func(t *testing.T, stmt *ast.TryStmt) {
+				if stmt.CatchParam != nil || stmt.CatchBody != nil {
+					t.Errorf("expected no catch clause")
+				}
+				if stmt.FinallyBody == nil {
+					t.Errorf("expected finally body")
+				}
+			},
+		},
+		{
+			name: "try without catch or finally",
+			// try { }
+			tokens: []token.Token{
+				token.New(token.TRY, "try", nil, 1, nil),
+				token.New(token.LEFT_BRACE, "{", nil, 1, nil),
+				token.New(token.RIGHT_BRACE, "}", nil, 1, nil),
+				token.New(token.EOF, "", nil, 1, nil),
+			},
+			wantErr: true,
+		},
+		{
+			name: "catch without variable",
+			// try { } catch { }
+			tokens: []token.Token{
+				token.New(token.TRY, "try", nil, 1, nil),
+				token.New(token.LEFT_BRACE, "{", nil, 1, nil),
+				token.New(token.RIGHT_BRACE, "}", nil, 1, nil),
+				token.New(token.CATCH, "catch", nil, 1, nil),
+				token.New(token.LEFT_BRACE, "{", nil, 1, nil),
+				token.New(token.RIGHT_BRACE, "}", nil, 1, nil),
+				token.New(token.EOF, "", nil, 1, nil),
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, collector := createParserFromTokens(tt.tokens)
+			mod, err := p.Parse()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if len(collector.Errors) == 0 {
+					t.Error("expected errors but got none")
+				}
+				return
+			}
+			stmt, ok := mod.Statements[0].(*ast.TryStmt)
+			if !ok {
+				t.Fatalf("expected TryStmt, got %T", mod.Statements[0])
+			}
+			tt.checkFn(t, stmt)
+		})
+	}
+}
+
+func TestParseThrowStmt(t *testing.T) {
+	// throw "oops";
+	tokens := []token.Token{
+		token.New(token.THROW, "throw", nil, 1, nil),
+		token.New(token.STRING, "\"oops\"", "oops", 1, nil),
+		token.New(token.SEMICOLON, ";", nil, 1, nil),
+		token.New(token.EOF, "", nil, 1, nil),
+	}
+	p, _ := createParserFromTokens(tokens)
+	mod, err := p.Parse()
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	stmt, ok := mod.Statements[0].(*ast.ThrowStmt)
+	if !ok {
+		t.Fatalf("expected ThrowStmt, got %T", mod.Statements[0])
+	}
+	lit, ok := stmt.Value.(*ast.LiteralExpr)
+	if !ok || lit.Value != "oops" {
+		t.Errorf("throw value = %v, want oops", stmt.Value)
+	}
+}
+
+func TestParseNesting(t *testing.T) {
+	// nested wraps inner in depth pairs of open and close, as a statement.
+	nested := func(open, close token.Type, inner []token.Token, depth int) []token.Token {
+		var tokens []token.Token
+		for i := 0; i < depth; i++ {
+			tokens = append(tokens, token.New(open, "", nil, 1, nil))
+		}
+		tokens = append(tokens, inner...)
+		for i := 0; i < depth; i++ {
+			tokens = append(tokens, token.New(close, "", nil, 1, nil))
+		}
+		if open == token.LEFT_PAREN {
+			tokens = append(tokens, token.New(token.SEMICOLON, ";", nil, 1, nil))
+		}
+		return append(tokens, token.New(token.EOF, "", nil, 1, nil))
+	}
+	one := []token.Token{token.New(token.NUMBER, "1", 1.0, 1, nil)}
+
+	tests := []struct {
+		name    string
+		tokens  []token.Token
+		wantErr bool
+	}{
+		// The statement and the innermost literal take a level each.
+		{"parentheses at the limit", nested(token.LEFT_PAREN, token.RIGHT_PAREN, one, maxNesting-2), false},
+		{"parentheses past the limit", nested(token.LEFT_PAREN, token.RIGHT_PAREN, one, 10*maxNesting), true},
+		{"blocks at the limit", nested(token.LEFT_BRACE, token.RIGHT_BRACE, nil, maxNesting), false},
+		{"blocks past the limit", nested(token.LEFT_BRACE, token.RIGHT_BRACE, nil, 10*maxNesting), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, collector := createParserFromTokens(tt.tokens)
+			_, err := p.Parse()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && (len(collector.Errors) != 1 || collector.Errors[0].Message != "Too much nesting.") {
+				t.Errorf("diagnostics = %v, want a single nesting error", collector.Errors)
+			}
+		})
+	}
+}
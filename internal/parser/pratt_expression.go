@@ -20,6 +20,7 @@ const (
 	precTerm
 	precFactor
 	precUnary
+	precExponent
 	precCall
 )
 
@@ -37,6 +38,9 @@ var infixPrecedence = map[token.Type]precedence{
 	token.PLUS:          precTerm,
 	token.SLASH:         precFactor,
 	token.STAR:          precFactor,
+	token.PERCENT:       precFactor,
+	token.TILDE_SLASH:   precFactor,
+	token.STAR_STAR:     precExponent,
 	token.LEFT_PAREN:    precCall,
 	token.DOT:           precCall,
 	token.LEFT_BRACKET:  precCall,
@@ -58,6 +62,10 @@ func (p *Parser) parseExpr() (ast.Expr, error) {
 // any expression which has precedence lower than we allow, we stop parsing and returns the expression.
 func (p *Parser) parseExpression(minPrec precedence) (ast.Expr, error) {
 	tok := p.peekCurrent()
+	if err := p.enter(tok); err != nil {
+		return nil, err
+	}
+	defer p.leave()
 	p.advance()
 	left, err := p.parsePrefix(tok)
 	if err != nil {
@@ -86,7 +94,7 @@ func (p *Parser) parseExpression(minPrec precedence) (ast.Expr, error) {
 func (p *Parser) parsePrefix(tok *token.Token) (ast.Expr, error) {
 	switch tok.Type {
 	case token.NUMBER, token.STRING, token.TRUE, token.FALSE, token.NIL:
-		return &ast.LiteralExpr{Value: tok.Literal}, nil
+		return &ast.LiteralExpr{Value: tok.Literal, Token: tok}, nil
 	case token.IDENTIFIER:
 		return &ast.VariableExpr{Name: tok}, nil
 	case token.THIS:
@@ -100,6 +108,8 @@ func (p *Parser) parsePrefix(tok *token.Token) (ast.Expr, error) {
 			return nil, err
 		}
 		return &ast.SuperExpr{Keyword: tok, Method: method}, nil
+	case token.INTERPOLATION:
+		return p.parseInterpolation(tok)
 	case token.BANG, token.MINUS:
 		right, err := p.parseExpression(precUnary)
 		if err != nil {
@@ -135,10 +145,11 @@ func (p *Parser) parsePrefix(tok *token.Token) (ast.Expr, error) {
 				}
 			}
 		}
-		if _, err := p.consume(token.RIGHT_BRACKET, "Expected ']' after expression."); err != nil {
+		rightBracket, err := p.consume(token.RIGHT_BRACKET, "Expected ']' after expression.")
+		if err != nil {
 			return nil, err
 		}
-		return &ast.ArrayLiteralExpr{Elements: elements}, nil
+		return &ast.ArrayLiteralExpr{Elements: elements, Bracket: tok, RightBracket: rightBracket}, nil
 	case token.LEFT_BRACE:
 		pairs := make([]ast.HashPair, 0)
 		if !p.check(token.RIGHT_BRACE) {
@@ -163,10 +174,11 @@ func (p *Parser) parsePrefix(tok *token.Token) (ast.Expr, error) {
 				}
 			}
 		}
-		if _, err := p.consume(token.RIGHT_BRACE, "Expect '}' after hash literal."); err != nil {
+		rightBrace, err := p.consume(token.RIGHT_BRACE, "Expect '}' after hash literal.")
+		if err != nil {
 			return nil, err
 		}
-		return &ast.HashLiteralExpr{Pairs: pairs, Brace: tok}, nil
+		return &ast.HashLiteralExpr{Pairs: pairs, Brace: tok, RightBrace: rightBrace}, nil
 	default:
 		return nil, p.error(tok, "Expect expression.")
 	}
@@ -205,17 +217,31 @@ func (p *Parser) parseInfix(left ast.Expr, operator *token.Token) (ast.Expr, err
 		return &ast.LogicalExpr{Left: left, Operator: operator, Right: right}, nil
 	case token.EQUAL_EQUAL, token.BANG_EQUAL,
 		token.GREATER, token.GREATER_EQUAL, token.LESS, token.LESS_EQUAL,
-		token.MINUS, token.PLUS, token.SLASH, token.STAR:
+		token.MINUS, token.PLUS, token.SLASH, token.STAR, token.PERCENT, token.TILDE_SLASH:
 		right, err := p.parseExpression(infixBindingPower(operator.Type))
 		if err != nil {
 			return nil, err
 		}
 		return &ast.BinaryExpr{Left: left, Right: right, Operator: operator}, nil
-	case token.LEFT_BRACKET:
-		right, err := p.parseExpression(precNone)
+	case token.STAR_STAR:
+		// -1 because exponent is right associative; it binds tighter than unary minus on its left
+		right, err := p.parseExpression(infixBindingPower(operator.Type) - 1)
 		if err != nil {
 			return nil, err
 		}
+		return &ast.BinaryExpr{Left: left, Right: right, Operator: operator}, nil
+	case token.LEFT_BRACKET:
+		var right ast.Expr
+		if !p.check(token.COLON) {
+			var err error
+			right, err = p.parseExpression(precNone)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if p.match(token.COLON) {
+			return p.parseSlice(left, right)
+		}
 		closing, err := p.consume(token.RIGHT_BRACKET, "Expect ']' after expression.")
 		if err != nil {
 			return nil, err
@@ -226,6 +252,53 @@ func (p *Parser) parseInfix(left ast.Expr, operator *token.Token) (ast.Expr, err
 	}
 }
 
+// parseSlice parses the rest of object[start:end] after the colon. Either
+// bound may be left out.
+func (p *Parser) parseSlice(object, start ast.Expr) (ast.Expr, error) {
+	var end ast.Expr
+	if !p.check(token.RIGHT_BRACKET) {
+		var err error
+		end, err = p.parseExpression(precNone)
+		if err != nil {
+			return nil, err
+		}
+	}
+	closing, err := p.consume(token.RIGHT_BRACKET, "Expect ']' after slice.")
+	if err != nil {
+		return nil, err
+	}
+	return &ast.SliceExpr{Object: object, Start: start, End: end, Bracket: closing}, nil
+}
+
+// parseInterpolation lowers the token run of an interpolated string into the
+// string segments and the embedded expressions between them.
+func (p *Parser) parseInterpolation(first *token.Token) (ast.Expr, error) {
+	parts := make([]ast.Expr, 0)
+	segment := first
+	for {
+		if text, _ := segment.Literal.(string); text != "" {
+			parts = append(parts, &ast.LiteralExpr{Value: text, Token: segment})
+		}
+		if segment.Type == token.STRING {
+			break
+		}
+
+		expr, err := p.parseExpression(precNone)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, expr)
+
+		if !p.match(token.INTERPOLATION) {
+			if _, err := p.consume(token.STRING, "Expect '}' after interpolated expression."); err != nil {
+				return nil, err
+			}
+		}
+		segment = p.peekPrevious()
+	}
+	return &ast.InterpolationExpr{Parts: parts, Token: first}, nil
+}
+
 func (p *Parser) finishCall(callee ast.Expr) (ast.Expr, error) {
 	arguments := make([]ast.Expr, 0)
 
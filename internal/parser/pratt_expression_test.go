@@ -246,6 +246,110 @@ func TestParsePrecedence(t *testing.T) {
 	})
 }
 
+func TestParseExponentPrecedence(t *testing.T) {
+	t.Run("exponent is right associative", func(t *testing.T) {
+		// 2 ** 3 ** 2
+		tokens := []token.Token{
+			token.New(token.NUMBER, "2", 2.0, 1, nil),
+			token.New(token.STAR_STAR, "**", nil, 1, nil),
+			token.New(token.NUMBER, "3", 3.0, 1, nil),
+			token.New(token.STAR_STAR, "**", nil, 1, nil),
+			token.New(token.NUMBER, "2", 2.0, 1, nil),
+			token.New(token.EOF, "", nil, 1, nil),
+		}
+		expr, _, err := parseExpressionFromTokens(tokens)
+		if err != nil {
+			t.Fatalf("parseExpr() error = %v", err)
+		}
+
+		// (2 ** (3 ** 2))
+		_, left, right := assertBinary(t, expr, token.STAR_STAR)
+		assertLiteral(t, left, 2.0)
+		_, rLeft, rRight := assertBinary(t, right, token.STAR_STAR)
+		assertLiteral(t, rLeft, 3.0)
+		assertLiteral(t, rRight, 2.0)
+	})
+
+	t.Run("exponent binds tighter than unary minus", func(t *testing.T) {
+		// -2 ** 2
+		tokens := []token.Token{
+			token.New(token.MINUS, "-", nil, 1, nil),
+			token.New(token.NUMBER, "2", 2.0, 1, nil),
+			token.New(token.STAR_STAR, "**", nil, 1, nil),
+			token.New(token.NUMBER, "2", 2.0, 1, nil),
+			token.New(token.EOF, "", nil, 1, nil),
+		}
+		expr, _, err := parseExpressionFromTokens(tokens)
+		if err != nil {
+			t.Fatalf("parseExpr() error = %v", err)
+		}
+
+		// -(2 ** 2)
+		_, operand := assertUnary(t, expr, token.MINUS)
+		_, left, right := assertBinary(t, operand, token.STAR_STAR)
+		assertLiteral(t, left, 2.0)
+		assertLiteral(t, right, 2.0)
+	})
+
+	t.Run("modulo and floor division bind like multiplication", func(t *testing.T) {
+		// 1 + 7 ~/ 2 % 3
+		tokens := []token.Token{
+			token.New(token.NUMBER, "1", 1.0, 1, nil),
+			token.New(token.PLUS, "+", nil, 1, nil),
+			token.New(token.NUMBER, "7", 7.0, 1, nil),
+			token.New(token.TILDE_SLASH, "~/", nil, 1, nil),
+			token.New(token.NUMBER, "2", 2.0, 1, nil),
+			token.New(token.PERCENT, "%", nil, 1, nil),
+			token.New(token.NUMBER, "3", 3.0, 1, nil),
+			token.New(token.EOF, "", nil, 1, nil),
+		}
+		expr, _, err := parseExpressionFromTokens(tokens)
+		if err != nil {
+			t.Fatalf("parseExpr() error = %v", err)
+		}
+
+		// (1 + ((7 ~/ 2) % 3))
+		_, left, right := assertBinary(t, expr, token.PLUS)
+		assertLiteral(t, left, 1.0)
+		_, rLeft, rRight := assertBinary(t, right, token.PERCENT)
+		assertLiteral(t, rRight, 3.0)
+		_, fLeft, fRight := assertBinary(t, rLeft, token.TILDE_SLASH)
+		assertLiteral(t, fLeft, 7.0)
+		assertLiteral(t, fRight, 2.0)
+	})
+}
+
+func TestParseInterpolation(t *testing.T) {
+	// "a ${x + 1} b ${y}"
+	tokens := []token.Token{
+		token.New(token.INTERPOLATION, "\"a ${", "a ", 1, nil),
+		token.New(token.IDENTIFIER, "x", "x", 1, nil),
+		token.New(token.PLUS, "+", nil, 1, nil),
+		token.New(token.NUMBER, "1", 1.0, 1, nil),
+		token.New(token.INTERPOLATION, "} b ${", " b ", 1, nil),
+		token.New(token.IDENTIFIER, "y", "y", 1, nil),
+		token.New(token.STRING, "}\"", "", 1, nil),
+		token.New(token.EOF, "", nil, 1, nil),
+	}
+	expr, _, err := parseExpressionFromTokens(tokens)
+	if err != nil {
+		t.Fatalf("parseExpr() error = %v", err)
+	}
+
+	interp, ok := expr.(*ast.InterpolationExpr)
+	if !ok {
+		t.Fatalf("expected InterpolationExpr, got %T", expr)
+	}
+	// The empty trailing segment is dropped
+	if len(interp.Parts) != 4 {
+		t.Fatalf("expected 4 parts, got %d", len(interp.Parts))
+	}
+	assertLiteral(t, interp.Parts[0], "a ")
+	assertBinary(t, interp.Parts[1], token.PLUS)
+	assertLiteral(t, interp.Parts[2], " b ")
+	assertVariable(t, interp.Parts[3], "y")
+}
+
 func TestParseLogicalExpressions(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -519,6 +623,62 @@ func TestParseIndexExpression(t *testing.T) {
 	assertLiteral(t, index, 0.0)
 }
 
+func TestParseSliceExpression(t *testing.T) {
+	tests := []struct {
+		name       string
+		start, end interface{} // nil when the bound is left out
+	}{
+		{"s[1:3]", 1.0, 3.0},
+		{"s[:3]", nil, 3.0},
+		{"s[1:]", 1.0, nil},
+		{"s[:]", nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens := []token.Token{
+				token.New(token.IDENTIFIER, "s", nil, 1, nil),
+				token.New(token.LEFT_BRACKET, "[", nil, 1, nil),
+			}
+			if tt.start != nil {
+				tokens = append(tokens, token.New(token.NUMBER, "1", tt.start, 1, nil))
+			}
+			tokens = append(tokens, token.New(token.COLON, ":", nil, 1, nil))
+			if tt.end != nil {
+				tokens = append(tokens, token.New(token.NUMBER, "3", tt.end, 1, nil))
+			}
+			tokens = append(tokens,
+				token.New(token.RIGHT_BRACKET, "]", nil, 1, nil),
+				token.New(token.EOF, "", nil, 1, nil),
+			)
+
+			expr, _, err := parseExpressionFromTokens(tokens)
+			if err != nil {
+				t.Fatalf("parseExpr() error = %v", err)
+			}
+			slice, ok := expr.(*ast.SliceExpr)
+			if !ok {
+				t.Fatalf("expected SliceExpr, got %T", expr)
+			}
+			assertVariable(t, slice.Object, "s")
+			if tt.start == nil {
+				if slice.Start != nil {
+					t.Errorf("expected no start, got %T", slice.Start)
+				}
+			} else {
+				assertLiteral(t, slice.Start, tt.start)
+			}
+			if tt.end == nil {
+				if slice.End != nil {
+					t.Errorf("expected no end, got %T", slice.End)
+				}
+			} else {
+				assertLiteral(t, slice.End, tt.end)
+			}
+		})
+	}
+}
+
 func TestParseSetIndexExpression(t *testing.T) {
 	// arr[0] = 42
 	tokens := []token.Token{
@@ -44,9 +44,11 @@ type Resolver struct {
 	loopDepth         int
 	scopes            []map[string]*VariableInfo
 	locals            map[ast.Expr]int
+	declarations      map[*token.Token]*token.Token
 	hadError          bool
 	resolutionStack   []string
 	resolvedModules   map[string]*ast.Module
+	loader            ModuleLoader
 }
 
 func NewResolver(diagnosticHandler objects.DiagnosticHandler) *Resolver {
@@ -56,15 +58,29 @@ func NewResolver(diagnosticHandler objects.DiagnosticHandler) *Resolver {
 		currentFunction:   FunctionTypeNone,
 		currentClass:      ClassTypeNone,
 		locals:            make(map[ast.Expr]int),
+		declarations:      make(map[*token.Token]*token.Token),
 		resolutionStack:   []string{},
 		resolvedModules:   make(map[string]*ast.Module),
+		loader:            FileLoader{},
 	}
 }
 
+// SetLoader sets how imported modules are found and read.
+func (r *Resolver) SetLoader(loader ModuleLoader) {
+	r.loader = loader
+}
+
 func (r *Resolver) GetResolvedModules() map[string]*ast.Module {
 	return r.resolvedModules
 }
 
+// GetDeclarations maps each name the resolver bound to the token that
+// declared it. Names left to runtime lookup, such as natives or globals used
+// before their declaration, are absent.
+func (r *Resolver) GetDeclarations() map[*token.Token]*token.Token {
+	return r.declarations
+}
+
 func (r *Resolver) GetCurrentModule() string {
 	if len(r.resolutionStack) == 0 {
 		return ""
@@ -109,6 +125,8 @@ func (r *Resolver) resolveStmt(stmt ast.Stmt) {
 		r.visitWhileStmt(s)
 	case *ast.ForStmt:
 		r.visitForStmt(s)
+	case *ast.ForInStmt:
+		r.visitForInStmt(s)
 	case *ast.BreakStmt:
 		if r.loopDepth == 0 {
 			r.reportError(s.Keyword, "break statement must be inside a loop.")
@@ -119,6 +137,10 @@ func (r *Resolver) resolveStmt(stmt ast.Stmt) {
 		}
 	case *ast.ReturnStmt:
 		r.visitReturnStmt(s)
+	case *ast.TryStmt:
+		r.visitTryStmt(s)
+	case *ast.ThrowStmt:
+		r.resolveExpr(s.Value)
 	default:
 		panic(fmt.Sprintf("unknown statement type: %T", s))
 	}
@@ -170,6 +192,18 @@ func (r *Resolver) resolveExpr(expr ast.Expr) {
 	case *ast.IndexExpr:
 		r.resolveExpr(e.Object)
 		r.resolveExpr(e.Index)
+	case *ast.SliceExpr:
+		r.resolveExpr(e.Object)
+		if e.Start != nil {
+			r.resolveExpr(e.Start)
+		}
+		if e.End != nil {
+			r.resolveExpr(e.End)
+		}
+	case *ast.InterpolationExpr:
+		for _, part := range e.Parts {
+			r.resolveExpr(part)
+		}
 	default:
 		panic(fmt.Sprintf("unknown expression type: %T", e))
 	}
@@ -241,8 +275,9 @@ func (r *Resolver) resolveLocal(expr ast.Expr, name *token.Token) {
 		if name == nil {
 			continue
 		}
-		if _, ok := r.scopes[i][name.Lexeme]; ok {
+		if info, ok := r.scopes[i][name.Lexeme]; ok {
 			r.locals[expr] = len(r.scopes) - i - 1
+			r.declarations[name] = info.token
 			return
 		}
 	}
@@ -366,6 +401,37 @@ func (r *Resolver) visitForStmt(forStmt *ast.ForStmt) {
 	}
 }
 
+func (r *Resolver) visitForInStmt(forIn *ast.ForInStmt) {
+	r.resolveExpr(forIn.Iterable)
+	// The loop variables live in their own scope wrapping the body.
+	r.beginScope()
+	for _, variable := range forIn.Variables {
+		r.declare(variable)
+		r.define(variable)
+	}
+	r.loopDepth++
+	r.resolveStmt(forIn.Body)
+	r.loopDepth--
+	r.endScope()
+}
+
+func (r *Resolver) visitTryStmt(tryStmt *ast.TryStmt) {
+	r.visitBlock(tryStmt.Body)
+	if tryStmt.CatchBody != nil {
+		// The exception variable lives in its own scope wrapping the catch body.
+		r.beginScope()
+		r.declare(tryStmt.CatchParam)
+		r.define(tryStmt.CatchParam)
+		for _, statement := range tryStmt.CatchBody.Statements {
+			r.resolveStmt(statement)
+		}
+		r.endScope()
+	}
+	if tryStmt.FinallyBody != nil {
+		r.visitBlock(tryStmt.FinallyBody)
+	}
+}
+
 func (r *Resolver) visitReturnStmt(returnStmt *ast.ReturnStmt) {
 	if r.currentFunction == FunctionTypeNone {
 		r.reportError(returnStmt.Keyword, "Can't return from top-level code.")
@@ -518,8 +584,7 @@ func (r *Resolver) resolveImportStmt(stmt *ast.ImportStmt) {
 	}
 
 	currentModule := r.GetCurrentModule()
-	baseDir := filepath.Dir(currentModule)
-	targetPath, err := ResolveModulePath(baseDir, importPath)
+	targetPath, err := r.loader.ResolveImport(currentModule, importPath)
 	if err != nil {
 		r.reportError(stmt.Path, fmt.Sprintf("Failed to resolve import path: %s", err.Error()))
 		return
@@ -538,7 +603,7 @@ func (r *Resolver) resolveImportStmt(stmt *ast.ImportStmt) {
 	r.resolutionStack = append(r.resolutionStack, targetPath)
 
 	if _, ok := r.resolvedModules[targetPath]; !ok {
-		mod, err := LoadModuleFile(targetPath, r.diagnosticHandler)
+		mod, err := LoadModule(r.loader, targetPath, r.diagnosticHandler)
 		if err != nil {
 			r.reportError(stmt.Path, fmt.Sprintf("Failed to load module: %s", err.Error()))
 			r.resolutionStack = r.resolutionStack[:len(r.resolutionStack)-1]
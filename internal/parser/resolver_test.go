@@ -611,6 +611,102 @@ func TestResolveFunctionExpr(t *testing.T) {
 	assertResolved(t, locals, varExpr, "x", 0)
 }
 
+func TestResolveCatchParameter(t *testing.T) {
+	// Represents: try { } catch (e) { print e; }
+	eTok := token.Token{Type: token.IDENTIFIER, Lexeme: "e", Literal: nil, Line: 1, FilePath: nil}
+	mod := &ast.Module{
+		Statements: []ast.Stmt{
+			&ast.TryStmt{
+				Keyword:    &token.Token{Type: token.TRY, Lexeme: "try"},
+				Body:       &ast.BlockStmt{},
+				CatchParam: &eTok,
+				CatchBody: &ast.BlockStmt{
+					Statements: []ast.Stmt{
+						&ast.PrintStmt{Expr: &ast.VariableExpr{Name: &eTok}},
+					},
+				},
+			},
+		},
+	}
+	resolver, _ := createResolverFromAST()
+	locals, err := resolver.Resolve(mod)
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	// e is declared in the scope wrapping the catch body
+	tryStmt := mod.Statements[0].(*ast.TryStmt)
+	varExpr := tryStmt.CatchBody.Statements[0].(*ast.PrintStmt).Expr.(*ast.VariableExpr)
+	assertResolved(t, locals, varExpr, "e", 0)
+}
+
+func TestResolveForInVariables(t *testing.T) {
+	// Represents: for (var k, v in items) { print v; break; }
+	kTok := token.Token{Type: token.IDENTIFIER, Lexeme: "k", Literal: nil, Line: 1, FilePath: nil}
+	vTok := token.Token{Type: token.IDENTIFIER, Lexeme: "v", Literal: nil, Line: 1, FilePath: nil}
+	mod := &ast.Module{
+		Statements: []ast.Stmt{
+			&ast.ForInStmt{
+				Keyword:   &token.Token{Type: token.FOR, Lexeme: "for"},
+				Variables: []*token.Token{&kTok, &vTok},
+				Iterable:  &ast.VariableExpr{Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "items"}},
+				Body: &ast.BlockStmt{
+					Statements: []ast.Stmt{
+						&ast.PrintStmt{Expr: &ast.VariableExpr{Name: &vTok}},
+						&ast.BreakStmt{Keyword: &token.Token{Type: token.BREAK, Lexeme: "break"}},
+					},
+				},
+			},
+		},
+	}
+	resolver, _ := createResolverFromAST()
+	locals, err := resolver.Resolve(mod)
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	// v is declared in the loop scope, one level above the body block
+	forIn := mod.Statements[0].(*ast.ForInStmt)
+	varExpr := forIn.Body.(*ast.BlockStmt).Statements[0].(*ast.PrintStmt).Expr.(*ast.VariableExpr)
+	assertResolved(t, locals, varExpr, "v", 1)
+	assertNotResolved(t, locals, forIn.Iterable, "items")
+}
+
+func TestResolveDeclarations(t *testing.T) {
+	// Represents: var x = 1; { var x = 2; print x; } print x; print len;
+	outerX := token.Token{Type: token.IDENTIFIER, Lexeme: "x", Line: 1}
+	innerX := token.Token{Type: token.IDENTIFIER, Lexeme: "x", Line: 1}
+	innerUse := token.Token{Type: token.IDENTIFIER, Lexeme: "x", Line: 1}
+	outerUse := token.Token{Type: token.IDENTIFIER, Lexeme: "x", Line: 1}
+	nativeUse := token.Token{Type: token.IDENTIFIER, Lexeme: "len", Line: 1}
+	mod := &ast.Module{
+		Statements: []ast.Stmt{
+			&ast.VarDeclStmt{Name: &outerX, Initializer: &ast.LiteralExpr{Value: 1.0}},
+			&ast.BlockStmt{
+				Statements: []ast.Stmt{
+					&ast.VarDeclStmt{Name: &innerX, Initializer: &ast.LiteralExpr{Value: 2.0}},
+					&ast.PrintStmt{Expr: &ast.VariableExpr{Name: &innerUse}},
+				},
+			},
+			&ast.PrintStmt{Expr: &ast.VariableExpr{Name: &outerUse}},
+			&ast.PrintStmt{Expr: &ast.VariableExpr{Name: &nativeUse}},
+		},
+	}
+	resolver, _ := createResolverFromAST()
+	if _, err := resolver.Resolve(mod); err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+
+	declarations := resolver.GetDeclarations()
+	if declarations[&innerUse] != &innerX {
+		t.Errorf("expected the x in the block to be declared by the inner var")
+	}
+	if declarations[&outerUse] != &outerX {
+		t.Errorf("expected the x after the block to be declared by the outer var")
+	}
+	if _, ok := declarations[&nativeUse]; ok {
+		t.Errorf("expected len to be left to runtime lookup")
+	}
+}
+
 func assertResolved(t *testing.T, locals map[ast.Expr]int, expr ast.Expr, name string, expectedDepth int) {
 	t.Helper()
 	depth, found := locals[expr]
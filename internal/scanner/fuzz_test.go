@@ -0,0 +1,31 @@
+package scanner
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/harshagw/viri/internal/testutil"
+	"github.com/harshagw/viri/internal/token"
+)
+
+func FuzzScan(f *testing.F) {
+	testutil.Seed(f)
+	f.Add("\"\\u{110000}\"")
+	f.Add("1.e")
+
+	f.Fuzz(func(t *testing.T, src string) {
+		sc := New(bytes.NewBufferString(src), nil)
+		tokens, err := sc.Scan()
+		if err != nil {
+			return
+		}
+		if len(tokens) == 0 || tokens[len(tokens)-1].Type != token.EOF {
+			t.Fatalf("tokens of %q do not end with EOF", src)
+		}
+		for _, tok := range tokens {
+			if tok.Offset < 0 || tok.Offset > len(src) {
+				t.Fatalf("token %q of %q at offset %d", tok.Lexeme, src, tok.Offset)
+			}
+		}
+	})
+}
@@ -4,7 +4,9 @@ import (
 	"bytes"
 	"errors"
 	"strconv"
+	"strings"
 	"unicode"
+	"unicode/utf8"
 
 	"github.com/harshagw/viri/internal/token"
 )
@@ -15,7 +17,17 @@ type Scanner struct {
 	start    int
 	line     int
 	tokens   []token.Token
+	comments []token.Token
 	filePath *string
+
+	// interpolations holds, for each open "${", the number of unclosed
+	// braces inside it so the matching "}" resumes scanning the string.
+	interpolations []int
+	stringLine     int // line on which the string being scanned started
+
+	// colOffset and col are the last offset column was asked for and its
+	// column, from which the column of a later offset is counted.
+	colOffset, col int
 }
 
 func New(source *bytes.Buffer, filePath *string) *Scanner {
@@ -25,6 +37,7 @@ func New(source *bytes.Buffer, filePath *string) *Scanner {
 		start:    0,
 		line:     1,
 		tokens:   []token.Token{},
+		col:      1,
 		filePath: filePath,
 	}
 }
@@ -37,11 +50,32 @@ func (s *Scanner) Scan() ([]token.Token, error) {
 		}
 	}
 
+	if len(s.interpolations) > 0 {
+		return nil, errors.New("unterminated string interpolation start at line: " + strconv.Itoa(s.stringLine))
+	}
+
 	s.start = s.current
 	s.addToken(token.EOF)
 	return s.tokens, nil
 }
 
+// Position returns the line and column where scanning stopped, which is where
+// the error returned by Scan was found.
+func (s *Scanner) Position() (line, column int) {
+	return s.line, s.column(s.current)
+}
+
+// Offset returns the byte offset where scanning stopped.
+func (s *Scanner) Offset() int {
+	return s.current
+}
+
+// Comments returns the line comments seen by Scan, in source order. They are
+// kept out of the token stream so only tools such as the formatter see them.
+func (s *Scanner) Comments() []token.Token {
+	return s.comments
+}
+
 func (s *Scanner) isAtEnd() bool {
 	return s.current >= s.source.Len()
 }
@@ -55,8 +89,19 @@ func (s *Scanner) scanToken() error {
 	case ')':
 		s.addToken(token.RIGHT_PAREN)
 	case '{':
+		if len(s.interpolations) > 0 {
+			s.interpolations[len(s.interpolations)-1]++
+		}
 		s.addToken(token.LEFT_BRACE)
 	case '}':
+		if n := len(s.interpolations); n > 0 {
+			if s.interpolations[n-1] == 0 {
+				// End of an embedded expression, the rest is string content
+				s.interpolations = s.interpolations[:n-1]
+				return s.scanStringContent()
+			}
+			s.interpolations[n-1]--
+		}
 		s.addToken(token.RIGHT_BRACE)
 	case '[':
 		s.addToken(token.LEFT_BRACKET)
@@ -75,7 +120,18 @@ func (s *Scanner) scanToken() error {
 	case ';':
 		s.addToken(token.SEMICOLON)
 	case '*':
-		s.addToken(token.STAR)
+		if s.match('*') {
+			s.addToken(token.STAR_STAR)
+		} else {
+			s.addToken(token.STAR)
+		}
+	case '%':
+		s.addToken(token.PERCENT)
+	case '~':
+		if !s.match('/') {
+			return errors.New("unexpected character: ~")
+		}
+		s.addToken(token.TILDE_SLASH)
 	case '!':
 		if s.match('=') {
 			s.addToken(token.BANG_EQUAL)
@@ -105,6 +161,7 @@ func (s *Scanner) scanToken() error {
 			for s.peek() != '\n' && !s.isAtEnd() {
 				s.advance()
 			}
+			s.addComment()
 		} else {
 			s.addToken(token.SLASH)
 		}
@@ -112,7 +169,8 @@ func (s *Scanner) scanToken() error {
 	case '\n':
 		s.line++
 	case '"':
-		if err := s.scanString(); err != nil {
+		s.stringLine = s.line
+		if err := s.scanStringContent(); err != nil {
 			return err
 		}
 	default:
@@ -162,29 +220,100 @@ func (s *Scanner) peekNext() byte {
 	return s.source.Bytes()[s.current+1]
 }
 
-func (s *Scanner) scanString() error {
-	startLine := s.line
+// scanStringContent scans string content up to the closing quote or the next
+// "${". A string with interpolations becomes a series of INTERPOLATION tokens,
+// each followed by the tokens of its embedded expression, and ends with a
+// STRING token holding the trailing content.
+func (s *Scanner) scanStringContent() error {
+	var value strings.Builder
 
-	for s.peek() != '"' && !s.isAtEnd() {
-		if s.peek() == '\n' {
-			s.line++
+	for {
+		if s.isAtEnd() {
+			return errors.New("unterminated string start at line: " + strconv.Itoa(s.stringLine))
+		}
+
+		c := s.advance()
+		switch {
+		case c == '"':
+			s.addTokenWithLiteral(token.STRING, value.String())
+			return nil
+		case c == '$' && s.peek() == '{':
+			s.advance()
+			s.addTokenWithLiteral(token.INTERPOLATION, value.String())
+			s.interpolations = append(s.interpolations, 0)
+			return nil
+		case c == '\\':
+			if err := s.scanEscape(&value); err != nil {
+				return err
+			}
+		default:
+			if c == '\n' {
+				s.line++
+			}
+			value.WriteByte(c)
 		}
-		s.advance()
 	}
+}
 
+// scanEscape decodes the escape sequence following a backslash.
+func (s *Scanner) scanEscape(value *strings.Builder) error {
 	if s.isAtEnd() {
-		return errors.New("unterminated string start at line: " + strconv.Itoa(startLine))
+		return errors.New("unterminated string start at line: " + strconv.Itoa(s.stringLine))
 	}
 
-	// The closing quote
-	s.advance()
-
-	// Trim the surrounding quotes
-	value := string(s.source.Bytes()[s.start+1 : s.current-1])
-	s.addTokenWithLiteral(token.STRING, value)
+	c := s.advance()
+	switch c {
+	case 'n':
+		value.WriteByte('\n')
+	case 't':
+		value.WriteByte('\t')
+	case 'r':
+		value.WriteByte('\r')
+	case '0':
+		value.WriteByte(0)
+	case '"', '\\', '$':
+		value.WriteByte(c)
+	case 'u':
+		r, err := s.scanUnicodeEscape()
+		if err != nil {
+			return err
+		}
+		value.WriteRune(r)
+	default:
+		return errors.New("invalid escape sequence '\\" + string(c) + "' at line: " + strconv.Itoa(s.line))
+	}
 	return nil
 }
 
+// scanUnicodeEscape decodes \uXXXX or \u{X...} into a rune.
+func (s *Scanner) scanUnicodeEscape() (rune, error) {
+	invalid := errors.New("invalid unicode escape sequence at line: " + strconv.Itoa(s.line))
+
+	var digits string
+	if s.match('{') {
+		start := s.current
+		for s.peek() != '}' && !s.isAtEnd() && s.current-start < 6 {
+			s.advance()
+		}
+		digits = string(s.source.Bytes()[start:s.current])
+		if !s.match('}') {
+			return 0, invalid
+		}
+	} else {
+		if s.current+4 > s.source.Len() {
+			return 0, invalid
+		}
+		digits = string(s.source.Bytes()[s.current : s.current+4])
+		s.current += 4
+	}
+
+	code, err := strconv.ParseUint(digits, 16, 32)
+	if err != nil || digits == "" || !utf8.ValidRune(rune(code)) {
+		return 0, invalid
+	}
+	return rune(code), nil
+}
+
 func (s *Scanner) scanNumber() {
 	for unicode.IsDigit(rune(s.peek())) {
 		s.advance()
@@ -234,9 +363,37 @@ func (s *Scanner) addToken(tokenType token.Type) {
 func (s *Scanner) addTokenWithLiteral(tokenType token.Type, literal interface{}) {
 	text := s.getLexeme()
 	tok := token.New(tokenType, text, literal, s.line, s.filePath)
+	tok.Column, tok.Offset = s.column(s.start), s.start
 	s.tokens = append(s.tokens, tok)
 }
 
+func (s *Scanner) addComment() {
+	text := strings.TrimRight(s.getLexeme(), "\r")
+	tok := token.New(token.COMMENT, text, nil, s.line, s.filePath)
+	tok.Column, tok.Offset = s.column(s.start), s.start
+	s.comments = append(s.comments, tok)
+}
+
+// column returns the 1-based column of the byte at offset, counting
+// characters rather than bytes so multi-byte text lines up. Columns are
+// asked for in source order, so each is counted on from the last one,
+// which keeps scanning a long line linear.
+func (s *Scanner) column(offset int) int {
+	buf := s.source.Bytes()
+	if offset > len(buf) {
+		offset = len(buf)
+	}
+	if offset < s.colOffset {
+		s.colOffset, s.col = 0, 1
+	}
+	if newline := bytes.LastIndexByte(buf[s.colOffset:offset], '\n'); newline >= 0 {
+		s.colOffset, s.col = s.colOffset+newline+1, 1
+	}
+	s.col += utf8.RuneCount(buf[s.colOffset:offset])
+	s.colOffset = offset
+	return s.col
+}
+
 // Returns the string starting from start to current.
 func (s *Scanner) getLexeme() string {
 	buf := s.source.Bytes()
@@ -31,6 +31,10 @@ func TestScanner(t *testing.T) {
 		{"semicolon", ";", nil, []token.Token{{Type: token.SEMICOLON, Lexeme: ";", Line: 1}, {Type: token.EOF, Lexeme: "", Line: 1}}, false},
 		{"star", "*", nil, []token.Token{{Type: token.STAR, Lexeme: "*", Line: 1}, {Type: token.EOF, Lexeme: "", Line: 1}}, false},
 		{"slash", "/", nil, []token.Token{{Type: token.SLASH, Lexeme: "/", Line: 1}, {Type: token.EOF, Lexeme: "", Line: 1}}, false},
+		{"percent", "%", nil, []token.Token{{Type: token.PERCENT, Lexeme: "%", Line: 1}, {Type: token.EOF, Lexeme: "", Line: 1}}, false},
+		{"star star", "**", nil, []token.Token{{Type: token.STAR_STAR, Lexeme: "**", Line: 1}, {Type: token.EOF, Lexeme: "", Line: 1}}, false},
+		{"tilde slash", "~/", nil, []token.Token{{Type: token.TILDE_SLASH, Lexeme: "~/", Line: 1}, {Type: token.EOF, Lexeme: "", Line: 1}}, false},
+		{"lone tilde", "~", nil, nil, true},
 		{"bang equal", "!=", nil, []token.Token{{Type: token.BANG_EQUAL, Lexeme: "!=", Line: 1}, {Type: token.EOF, Lexeme: "", Line: 1}}, false},
 		{"bang", "!", nil, []token.Token{{Type: token.BANG, Lexeme: "!", Line: 1}, {Type: token.EOF, Lexeme: "", Line: 1}}, false},
 		{"equal equal", "==", nil, []token.Token{{Type: token.EQUAL_EQUAL, Lexeme: "==", Line: 1}, {Type: token.EOF, Lexeme: "", Line: 1}}, false},
@@ -44,6 +48,37 @@ func TestScanner(t *testing.T) {
 		{"string with spaces", `"hello world"`, nil, []token.Token{{Type: token.STRING, Lexeme: `"hello world"`, Literal: "hello world", Line: 1}, {Type: token.EOF, Lexeme: "", Line: 1}}, false},
 		{"multiline string", "\"hello\nworld\"", nil, []token.Token{{Type: token.STRING, Lexeme: "\"hello\nworld\"", Literal: "hello\nworld", Line: 2}, {Type: token.EOF, Lexeme: "", Line: 2}}, false},
 		{"unterminated string", `"hello`, nil, nil, true},
+		{"escape sequences", `"a\tb\n\"c\"\\\$"`, nil, []token.Token{{Type: token.STRING, Lexeme: `"a\tb\n\"c\"\\\$"`, Literal: "a\tb\n\"c\"\\$", Line: 1}, {Type: token.EOF, Lexeme: "", Line: 1}}, false},
+		{"unicode escapes", `"é\u{1F600}"`, nil, []token.Token{{Type: token.STRING, Lexeme: `"é\u{1F600}"`, Literal: "é😀", Line: 1}, {Type: token.EOF, Lexeme: "", Line: 1}}, false},
+		{"invalid escape", `"\q"`, nil, nil, true},
+		{"invalid unicode escape", `"\u{zz}"`, nil, nil, true},
+		{"dollar without brace", `"$5"`, nil, []token.Token{{Type: token.STRING, Lexeme: `"$5"`, Literal: "$5", Line: 1}, {Type: token.EOF, Lexeme: "", Line: 1}}, false},
+		{"interpolation", `"a ${x} b"`, nil, []token.Token{
+			{Type: token.INTERPOLATION, Lexeme: `"a ${`, Literal: "a ", Line: 1},
+			{Type: token.IDENTIFIER, Lexeme: "x", Literal: "x", Line: 1},
+			{Type: token.STRING, Lexeme: `} b"`, Literal: " b", Line: 1},
+			{Type: token.EOF, Lexeme: "", Line: 1},
+		}, false},
+		{"interpolation with braces", `"${ {"k": 1}["k"] }"`, nil, []token.Token{
+			{Type: token.INTERPOLATION, Lexeme: `"${`, Literal: "", Line: 1},
+			{Type: token.LEFT_BRACE, Lexeme: "{", Line: 1},
+			{Type: token.STRING, Lexeme: `"k"`, Literal: "k", Line: 1},
+			{Type: token.COLON, Lexeme: ":", Line: 1},
+			{Type: token.NUMBER, Lexeme: "1", Literal: 1.0, Line: 1},
+			{Type: token.RIGHT_BRACE, Lexeme: "}", Line: 1},
+			{Type: token.LEFT_BRACKET, Lexeme: "[", Line: 1},
+			{Type: token.STRING, Lexeme: `"k"`, Literal: "k", Line: 1},
+			{Type: token.RIGHT_BRACKET, Lexeme: "]", Line: 1},
+			{Type: token.STRING, Lexeme: `}"`, Literal: "", Line: 1},
+			{Type: token.EOF, Lexeme: "", Line: 1},
+		}, false},
+		{"interpolation line numbers", "\"a\n${x}\"", nil, []token.Token{
+			{Type: token.INTERPOLATION, Lexeme: "\"a\n${", Literal: "a\n", Line: 2},
+			{Type: token.IDENTIFIER, Lexeme: "x", Literal: "x", Line: 2},
+			{Type: token.STRING, Lexeme: "}\"", Literal: "", Line: 2},
+			{Type: token.EOF, Lexeme: "", Line: 2},
+		}, false},
+		{"unterminated interpolation", `"a ${x`, nil, nil, true},
 		{"integer", "123", nil, []token.Token{{Type: token.NUMBER, Lexeme: "123", Literal: 123.0, Line: 1}, {Type: token.EOF, Lexeme: "", Line: 1}}, false},
 		{"float", "123.456", nil, []token.Token{{Type: token.NUMBER, Lexeme: "123.456", Literal: 123.456, Line: 1}, {Type: token.EOF, Lexeme: "", Line: 1}}, false},
 		{"identifier", "foo", nil, []token.Token{{Type: token.IDENTIFIER, Lexeme: "foo", Literal: "foo", Line: 1}, {Type: token.EOF, Lexeme: "", Line: 1}}, false},
@@ -142,3 +177,76 @@ func TestScanner(t *testing.T) {
 		})
 	}
 }
+
+func TestScannerColumns(t *testing.T) {
+	input := "var x = 1;\n\tprint \"é\" + x;\n"
+
+	type position struct {
+		lexeme         string
+		line, col, off int
+	}
+	expected := []position{
+		{"var", 1, 1, 0},
+		{"x", 1, 5, 4},
+		{"=", 1, 7, 6},
+		{"1", 1, 9, 8},
+		{";", 1, 10, 9},
+		{"print", 2, 2, 12},
+		{`"é"`, 2, 8, 18},
+		// Columns count characters, offsets count bytes
+		{"+", 2, 12, 23},
+		{"x", 2, 14, 25},
+		{";", 2, 15, 26},
+		{"", 3, 1, 28},
+	}
+
+	tokens, err := New(bytes.NewBufferString(input), nil).Scan()
+	if err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	if len(tokens) != len(expected) {
+		t.Fatalf("expected %d tokens, got %d", len(expected), len(tokens))
+	}
+	for i, exp := range expected {
+		tok := tokens[i]
+		got := position{tok.Lexeme, tok.Line, tok.Column, tok.Offset}
+		if got != exp {
+			t.Errorf("token[%d] = %+v, want %+v", i, got, exp)
+		}
+	}
+}
+
+func TestScannerComments(t *testing.T) {
+	input := "// header\r\nvar x = 1; // trailing\nprint \"// not a comment\";\n"
+
+	sc := New(bytes.NewBufferString(input), nil)
+	tokens, err := sc.Scan()
+	if err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	for _, tok := range tokens {
+		if tok.Type == token.COMMENT {
+			t.Errorf("comment %q in the token stream", tok.Lexeme)
+		}
+	}
+
+	type comment struct {
+		lexeme         string
+		line, col, off int
+	}
+	expected := []comment{
+		{"// header", 1, 1, 0},
+		{"// trailing", 2, 12, 22},
+	}
+	comments := sc.Comments()
+	if len(comments) != len(expected) {
+		t.Fatalf("expected %d comments, got %v", len(expected), comments)
+	}
+	for i, exp := range expected {
+		tok := comments[i]
+		got := comment{tok.Lexeme, tok.Line, tok.Column, tok.Offset}
+		if tok.Type != token.COMMENT || got != exp {
+			t.Errorf("comment[%d] = %v %+v, want %+v", i, tok.Type, got, exp)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+// Package testutil holds helpers shared by the tests of other packages. Only
+// _test.go files import it.
+package testutil
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"testing/fstest"
+)
+
+// testdata returns the directory of the end-to-end test programs, found
+// from this file so it does not depend on the test's working directory.
+func testdata() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Join(filepath.Dir(file), "..", "..", "test", "testdata")
+}
+
+// Seed adds the programs of the end-to-end tests to the seed corpus of f and
+// returns them by file name, so fuzzed programs can import the modules among
+// them.
+func Seed(f *testing.F) fstest.MapFS {
+	f.Helper()
+	paths, err := filepath.Glob(filepath.Join(testdata(), "*.viri"))
+	if err != nil || len(paths) == 0 {
+		f.Fatalf("no test programs found: %v", err)
+	}
+	files := fstest.MapFS{}
+	for _, path := range paths {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			f.Fatal(err)
+		}
+		files[filepath.Base(path)] = &fstest.MapFile{Data: src}
+		f.Add(string(src))
+	}
+	return files
+}
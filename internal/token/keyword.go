@@ -11,6 +11,7 @@ var keywordLookup = map[string]Type{
 	"else":     ELSE,
 	"for":      FOR,
 	"while":    WHILE,
+	"in":       IN,
 	"true":     TRUE,
 	"false":    FALSE,
 	"nil":      NIL,
@@ -21,6 +22,10 @@ var keywordLookup = map[string]Type{
 	"this":     THIS,
 	"continue": CONTINUE,
 	"break":    BREAK,
+	"try":      TRY,
+	"catch":    CATCH,
+	"finally":  FINALLY,
+	"throw":    THROW,
 	"import":   IMPORT,
 	"export":   EXPORT,
 	"as":       AS,
@@ -21,6 +21,7 @@ const (
 	SLASH
 	STAR
 	COLON
+	PERCENT
 
 	// One or two character tokens.
 	BANG
@@ -31,10 +32,13 @@ const (
 	GREATER_EQUAL
 	LESS
 	LESS_EQUAL
+	STAR_STAR
+	TILDE_SLASH
 
 	// Literals.
 	IDENTIFIER
 	STRING
+	INTERPOLATION // string content before a "${"
 	NUMBER
 
 	// Keywords.
@@ -48,6 +52,7 @@ const (
 	ELSE
 	FOR
 	WHILE
+	IN
 
 	TRUE
 	FALSE
@@ -61,10 +66,18 @@ const (
 	CONTINUE
 	BREAK
 
+	TRY
+	CATCH
+	FINALLY
+	THROW
+
 	IMPORT
 	EXPORT
 	AS
 
+	// Trivia, reported by the scanner apart from the token stream.
+	COMMENT
+
 	EOF
 )
 
@@ -98,6 +111,8 @@ func (tt Type) String() string {
 		return "STAR"
 	case COLON:
 		return "COLON"
+	case PERCENT:
+		return "PERCENT"
 	case BANG:
 		return "BANG"
 	case BANG_EQUAL:
@@ -114,10 +129,16 @@ func (tt Type) String() string {
 		return "LESS"
 	case LESS_EQUAL:
 		return "LESS_EQUAL"
+	case STAR_STAR:
+		return "STAR_STAR"
+	case TILDE_SLASH:
+		return "TILDE_SLASH"
 	case IDENTIFIER:
 		return "IDENTIFIER"
 	case STRING:
 		return "STRING"
+	case INTERPOLATION:
+		return "INTERPOLATION"
 	case NUMBER:
 		return "NUMBER"
 	case AND:
@@ -138,6 +159,8 @@ func (tt Type) String() string {
 		return "FOR"
 	case WHILE:
 		return "WHILE"
+	case IN:
+		return "IN"
 	case TRUE:
 		return "TRUE"
 	case FALSE:
@@ -158,12 +181,22 @@ func (tt Type) String() string {
 		return "CONTINUE"
 	case BREAK:
 		return "BREAK"
+	case TRY:
+		return "TRY"
+	case CATCH:
+		return "CATCH"
+	case FINALLY:
+		return "FINALLY"
+	case THROW:
+		return "THROW"
 	case IMPORT:
 		return "IMPORT"
 	case EXPORT:
 		return "EXPORT"
 	case AS:
 		return "AS"
+	case COMMENT:
+		return "COMMENT"
 	case EOF:
 		return "EOF"
 	default:
@@ -177,6 +210,8 @@ type Token struct {
 	Lexeme   string
 	Literal  interface{}
 	Line     int
+	Column   int // 1-based column of the first character, 0 if unknown
+	Offset   int // byte offset of the first character in the source
 	FilePath *string
 }
 
@@ -0,0 +1,113 @@
+package vm
+
+import (
+	"io"
+	"testing"
+	"testing/fstest"
+
+	"github.com/harshagw/viri/internal/compiler"
+	"github.com/harshagw/viri/internal/objects"
+	"github.com/harshagw/viri/internal/parser"
+)
+
+// Loop-heavy programs, run with and without the optimizer to show what its
+// comparison jumps and fused instructions save. Their allocations show
+// that arithmetic on numbers held by the VM does not allocate.
+var benchmarkPrograms = []struct {
+	name string
+	src  string
+}{
+	{"counting loop", `
+fun run() {
+    var sum = 0;
+    for (var i = 0; i < 100000; i = i + 1) {
+        sum = sum + i;
+    }
+    return sum;
+}
+run();
+`},
+	{"nested loops", `
+fun run() {
+    var count = 0;
+    for (var i = 0; i < 300; i = i + 1) {
+        for (var j = 0; j <= i; j = j + 1) {
+            if (j >= 100) count = count + 1;
+        }
+    }
+    return count;
+}
+run();
+`},
+	{"while countdown", `
+fun run() {
+    var n = 100000;
+    var steps = 0;
+    while (n > 0) {
+        n = n - 1;
+        steps = steps + 1;
+    }
+    return steps;
+}
+run();
+`},
+	{"recursion", `
+fun fib(n) {
+    if (n < 2) return n;
+    return fib(n - 1) + fib(n - 2);
+}
+fib(20);
+`},
+	{"array sum", `
+fun run() {
+    var a = [];
+    for (var i = 0; i < 1000; i = i + 1) a.push(i);
+    var total = 0;
+    for (var round = 0; round < 50; round = round + 1) {
+        var i = 0;
+        while (i < len(a)) {
+            total = total + a[i];
+            i = i + 1;
+        }
+    }
+    return total;
+}
+run();
+`},
+}
+
+func BenchmarkPrograms(b *testing.B) {
+	for _, bm := range benchmarkPrograms {
+		for _, optimize := range []bool{false, true} {
+			name := bm.name + "/O0"
+			if optimize {
+				name = bm.name + "/O1"
+			}
+			b.Run(name, func(b *testing.B) {
+				program := compileBenchmark(b, bm.src, optimize)
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					machine := New(program)
+					machine.SetStdout(io.Discard)
+					if err := machine.RunProgram(); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func compileBenchmark(b *testing.B, src string, optimize bool) *objects.CompiledProgram {
+	b.Helper()
+	diagnostics := &objects.DiagnosticCollector{}
+	comp := compiler.New(diagnostics)
+	comp.SetOptimize(optimize)
+	comp.SetLoader(parser.FSLoader{FS: fstest.MapFS{"main.viri": &fstest.MapFile{Data: []byte(src)}}})
+	program, err := comp.CompileProgram("main.viri")
+	if err != nil || len(diagnostics.Errors) > 0 {
+		b.Fatalf("compile failed: %v %v", err, diagnostics.Errors)
+	}
+	return program
+}
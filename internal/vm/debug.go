@@ -62,15 +62,18 @@ func (vm *VM) GetState() *VMState {
 
 	if ip >= 0 && ip < len(ins) {
 		opCode = code.Opcode(ins[ip])
-		if def, err := code.Lookup(byte(opCode)); err == nil {
+		if op, ops, _, err := code.ReadInstruction(ins[ip:]); err == nil {
+			def, _ := code.Lookup(byte(op))
 			opName = def.Name
-			operands, _ = code.ReadOperands(def, ins[ip+1:])
+			if opCode == code.OpWide {
+				opName = "OpWide " + def.Name
+			}
+			operands = ops
 		}
 	}
 
 	// Copy stack (only active portion)
-	stack := make([]objects.Object, vm.sp)
-	copy(stack, vm.stack[:vm.sp])
+	stack := objectsOf(vm.stack[:vm.sp])
 
 	// Build frame info
 	frames := make([]FrameInfo, vm.framesIndex)
@@ -96,9 +99,7 @@ func (vm *VM) GetState() *VMState {
 	// Collect globals from all modules
 	moduleGlobals := make([][]objects.Object, len(vm.modules))
 	for i, mod := range vm.modules {
-		globals := make([]objects.Object, len(mod.Globals))
-		copy(globals, mod.Globals)
-		moduleGlobals[i] = globals
+		moduleGlobals[i] = objectsOf(mod.Globals)
 	}
 
 	// Current module's globals for convenience
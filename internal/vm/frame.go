@@ -5,11 +5,19 @@ import (
 	"github.com/harshagw/viri/internal/objects"
 )
 
+// handler is an active exception handler installed by OpTry
+type handler struct {
+	catchIP int  // address of the catch or finally code
+	sp      int  // stack pointer to restore before jumping to catchIP
+	finally bool // true if the handler runs a finally block and rethrows
+}
+
 // Frame represents a call frame for function execution
 type Frame struct {
 	cl          *objects.Closure
-	ip          int // instruction pointer within this frame
-	basePointer int // points to the bottom of the stack for this frame
+	ip          int       // instruction pointer within this frame
+	basePointer int       // points to the bottom of the stack for this frame
+	handlers    []handler // exception handlers, innermost last
 }
 
 func NewFrame(cl *objects.Closure, basePointer int) *Frame {
@@ -1,17 +1,6 @@
 package vm
 
-import (
-	"github.com/harshagw/viri/internal/code"
-	"github.com/harshagw/viri/internal/objects"
-)
-
-// unwrapCell returns the value inside a Cell, or the object itself if not a Cell
-func unwrapCell(o objects.Object) objects.Object {
-	if cell, ok := o.(*objects.Cell); ok {
-		return cell.Value
-	}
-	return o
-}
+import "github.com/harshagw/viri/internal/code"
 
 // readUint16 reads a 2-byte big-endian operand at ip+1
 func readUint16(ins code.Instructions, ip int) int {
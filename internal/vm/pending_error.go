@@ -0,0 +1,12 @@
+package vm
+
+import "github.com/harshagw/viri/internal/objects"
+
+// pendingError holds an error on the stack while a finally block runs before
+// the error is rethrown by OpThrow.
+type pendingError struct {
+	err *objects.VMRuntimeError
+}
+
+func (p *pendingError) Type() objects.Type { return "PENDING_ERROR" }
+func (p *pendingError) Inspect() string    { return "<pending error: " + p.err.Message + ">" }
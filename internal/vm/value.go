@@ -0,0 +1,96 @@
+package vm
+
+import "github.com/harshagw/viri/internal/objects"
+
+// Value is a value held by the VM on its stack, in globals and in its
+// copy of the constants. Numbers are kept inline so that arithmetic does
+// not allocate; every other value is a heap object. A number only becomes
+// an *objects.Number when it leaves the VM's registers, for example when it
+// is stored in an array, captured by a closure or passed to a native.
+//
+// The zero Value holds no object at all, like a nil interface.
+type Value struct {
+	obj objects.Object // the object, or inlineNumber{} if num holds the value
+	num float64
+}
+
+// inlineNumber marks a Value holding a number in num.
+type inlineNumber struct{}
+
+func (inlineNumber) Type() objects.Type { return objects.TypeNumber }
+func (inlineNumber) Inspect() string    { return "<inline number>" }
+
+// number returns a Value holding n.
+func number(n float64) Value {
+	return Value{obj: inlineNumber{}, num: n}
+}
+
+// boolean returns a Value holding b.
+func boolean(b bool) Value {
+	return Value{obj: objects.NewBool(b)}
+}
+
+// ValueOf returns the Value holding o, unboxing numbers.
+func ValueOf(o objects.Object) Value {
+	if n, ok := o.(*objects.Number); ok {
+		return number(n.Value)
+	}
+	return Value{obj: o}
+}
+
+// isNumber reports whether v holds a number.
+func (v Value) isNumber() bool {
+	_, ok := v.obj.(inlineNumber)
+	return ok
+}
+
+// Object returns the object v holds, boxing a number into a new
+// *objects.Number.
+func (v Value) Object() objects.Object {
+	if v.isNumber() {
+		return objects.NewNumber(v.num)
+	}
+	return v.obj
+}
+
+// unwrap returns the value inside a Cell, or v itself if it is not one.
+func (v Value) unwrap() Value {
+	if cell, ok := v.obj.(*objects.Cell); ok {
+		return ValueOf(cell.Value)
+	}
+	return v
+}
+
+// truthy implements objects.IsTruthy for values.
+func (v Value) truthy() bool {
+	if v.isNumber() {
+		return v.num != 0
+	}
+	return objects.IsTruthy(v.obj)
+}
+
+// equal implements objects.IsEqual for values.
+func equal(a, b Value) bool {
+	if a.isNumber() || b.isNumber() {
+		return a.isNumber() && b.isNumber() && a.num == b.num
+	}
+	return objects.IsEqual(a.obj, b.obj)
+}
+
+// valuesOf converts objects to values.
+func valuesOf(objs []objects.Object) []Value {
+	values := make([]Value, len(objs))
+	for i, o := range objs {
+		values[i] = ValueOf(o)
+	}
+	return values
+}
+
+// objectsOf converts values to objects.
+func objectsOf(values []Value) []objects.Object {
+	objs := make([]objects.Object, len(values))
+	for i, v := range values {
+		objs[i] = v.Object()
+	}
+	return objs
+}
@@ -1,7 +1,11 @@
 package vm
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"os"
+	"strings"
 
 	"github.com/harshagw/viri/internal/code"
 	"github.com/harshagw/viri/internal/objects"
@@ -13,7 +17,7 @@ const MaxFrames = 1024
 
 // ModuleInstance represents a module at runtime
 type ModuleInstance struct {
-	Globals      []objects.Object // module-local globals
+	Globals      []Value          // module-local globals
 	Exports      []int            // export index -> global slot mapping
 	MainFn       *objects.Closure // pre-created main closure for this module
 	DebugInfoIdx int              // index into DebugInfo for line table and file path
@@ -21,9 +25,11 @@ type ModuleInstance struct {
 
 type VM struct {
 	constants []objects.Object
+	values    []Value            // the constants as values, for OpGetConstant
 	debugInfo *objects.DebugInfo // debug information (line tables, file paths)
+	natives   *objects.NativeRegistry
 
-	stack []objects.Object
+	stack []Value
 	sp    int // Always points to the next value. Top of stack is stack[sp-1]
 
 	modules       []ModuleInstance // module instances with per-module globals
@@ -32,24 +38,38 @@ type VM struct {
 
 	frames      []*Frame
 	framesIndex int // Always points to the next frame to be used. Top of frame is frames[framesIndex-1]
+	baseFrame   int // frames below this index belong to an outer run loop (see CallValue)
+
+	limits  objects.Limits
+	checker objects.LimitChecker
+	slice   int64 // length of the current slice of instructions (see checkStep)
+	ticks   int64 // instructions left in the current slice
 
 	onStep func()   // Debug callback, called before each opcode execution
 	output []string // Capture print output
+	stdout io.Writer
 }
 
 func New(program *objects.CompiledProgram) *VM {
+	return NewWithNatives(program, nil)
+}
+
+// NewWithNatives returns a VM running program with the natives it was
+// compiled with. A nil registry means the builtins.
+func NewWithNatives(program *objects.CompiledProgram, natives *objects.NativeRegistry) *VM {
 	numModules := len(program.Modules)
 
 	modules := make([]ModuleInstance, numModules)
 	for i, compiledMod := range program.Modules {
 		mainFn := &objects.CompiledFunction{
 			Instructions: compiledMod.Instructions,
+			NumLocals:    compiledMod.NumLocals,
 			DebugInfoIdx: compiledMod.DebugInfoIdx,
 		}
 		mainClosure := objects.NewClosure(mainFn, nil)
 
 		modules[i] = ModuleInstance{
-			Globals:      make([]objects.Object, compiledMod.NumGlobals),
+			Globals:      make([]Value, compiledMod.NumGlobals),
 			Exports:      compiledMod.Exports,
 			MainFn:       mainClosure,
 			DebugInfoIdx: compiledMod.DebugInfoIdx,
@@ -58,18 +78,22 @@ func New(program *objects.CompiledProgram) *VM {
 
 	vm := &VM{
 		constants:   program.Constants,
+		values:      valuesOf(program.Constants),
 		debugInfo:   program.DebugInfo,
-		stack:       make([]objects.Object, StackSize),
+		natives:     objects.NativesOrDefault(natives),
+		stack:       make([]Value, StackSize),
 		sp:          0,
 		modules:     modules,
 		numModules:  numModules,
 		frames:      make([]*Frame, MaxFrames),
 		framesIndex: 0,
+		stdout:      os.Stdout,
 	}
 
 	if numModules > 0 {
 		vm.frames[0] = NewFrame(modules[0].MainFn, 0)
 		vm.framesIndex = 1
+		vm.sp = modules[0].MainFn.Fn.NumLocals
 	}
 
 	return vm
@@ -79,12 +103,39 @@ func (vm *VM) SetOnStep(fn func()) {
 	vm.onStep = fn
 }
 
-// GetModuleGlobals returns the globals array for a specific module
+func (vm *VM) SetStdout(w io.Writer) {
+	vm.stdout = w
+}
+
+// SetLimits bounds the resources of the runs started afterwards.
+func (vm *VM) SetLimits(limits objects.Limits) {
+	vm.limits = limits
+}
+
+// maxCallDepth returns how deep calls may nest, which is never more than
+// the frames available.
+func (vm *VM) maxCallDepth() int {
+	if vm.limits.MaxCallDepth > 0 && vm.limits.MaxCallDepth < MaxFrames-1 {
+		return vm.limits.MaxCallDepth
+	}
+	return MaxFrames - 1
+}
+
+// GetModuleGlobals returns a copy of the globals of a specific module
 func (vm *VM) GetModuleGlobals(moduleIdx int) []objects.Object {
 	if moduleIdx < 0 || moduleIdx >= len(vm.modules) {
 		return nil
 	}
-	return vm.modules[moduleIdx].Globals
+	return objectsOf(vm.modules[moduleIdx].Globals)
+}
+
+// SetModuleGlobal sets a global of a specific module, letting a host define
+// globals before the program runs
+func (vm *VM) SetModuleGlobal(moduleIdx, slot int, value objects.Object) {
+	if moduleIdx < 0 || moduleIdx >= len(vm.modules) {
+		return
+	}
+	vm.modules[moduleIdx].Globals[slot] = ValueOf(value)
 }
 
 func (vm *VM) currentFrame() *Frame {
@@ -105,32 +156,37 @@ func (vm *VM) StackTop() objects.Object {
 	if vm.sp == 0 {
 		return nil
 	}
-	return unwrapCell(vm.stack[vm.sp-1])
+	return vm.stack[vm.sp-1].unwrap().Object()
 }
 
 func (vm *VM) push(o objects.Object) error {
+	return vm.pushValue(ValueOf(o))
+}
+
+func (vm *VM) pushValue(v Value) error {
 	if vm.sp >= StackSize {
 		return vm.runtimeError("stack overflow")
 	}
 
-	vm.stack[vm.sp] = o
+	vm.stack[vm.sp] = v
 	vm.sp++
 
 	return nil
 }
 
 func (vm *VM) pop() objects.Object {
-	o := vm.stack[vm.sp-1]
+	return vm.popValue().Object()
+}
+
+func (vm *VM) popValue() Value {
+	v := vm.stack[vm.sp-1]
 	vm.sp--
 	// Unwrap Cell if needed (for free variables)
-	if cell, ok := o.(*objects.Cell); ok {
-		return cell.Value
-	}
-	return o
+	return v.unwrap()
 }
 
 func (vm *VM) LastPoppedStackElem() objects.Object {
-	return unwrapCell(vm.stack[vm.sp])
+	return vm.stack[vm.sp].unwrap().Object()
 }
 
 func (vm *VM) runtimeError(message string) error {
@@ -138,32 +194,177 @@ func (vm *VM) runtimeError(message string) error {
 	ip := frame.ip
 	debugIdx := frame.cl.Fn.DebugInfoIdx
 
-	line := vm.debugInfo.GetLine(debugIdx, ip)
+	pos := vm.debugInfo.GetPosition(debugIdx, ip)
 	filePath := vm.debugInfo.GetFilePath(debugIdx)
 
 	return &objects.VMRuntimeError{
 		Message:  message,
-		Line:     line,
+		Line:     pos.Line,
+		Column:   pos.Column,
 		FilePath: filePath,
+		Trace:    vm.stackTrace(),
+	}
+}
+
+// stackTrace returns the location of every active frame, outermost first.
+func (vm *VM) stackTrace() []objects.StackFrame {
+	trace := make([]objects.StackFrame, 0, vm.framesIndex)
+	for i := 0; i < vm.framesIndex; i++ {
+		frame := vm.frames[i]
+		fn := frame.cl.Fn
+		if fn == hostFunction {
+			continue
+		}
+
+		name := fn.Name
+		if i == 0 {
+			name = "<script>"
+		} else if name == "" {
+			name = "<anonymous>"
+		}
+
+		trace = append(trace, objects.StackFrame{
+			Function: name,
+			FilePath: vm.debugInfo.GetFilePath(fn.DebugInfoIdx),
+			Line:     vm.debugInfo.GetLine(fn.DebugInfoIdx, frame.ip),
+		})
 	}
+	return trace
 }
 
 func (vm *VM) RunProgram() error {
+	return vm.RunProgramContext(context.Background())
+}
+
+// RunProgramContext runs the program, stopping with a *objects.CanceledError
+// once ctx is done or with another limit error once a limit set by SetLimits
+// is exceeded.
+func (vm *VM) RunProgramContext(ctx context.Context) error {
+	vm.start(ctx)
+
 	// Execute each module in topological order
 	for moduleIdx := 0; moduleIdx < vm.numModules; moduleIdx++ {
 		vm.currentModule = moduleIdx
 
 		vm.frames[0] = NewFrame(vm.modules[moduleIdx].MainFn, 0)
 		vm.framesIndex = 1
-		vm.sp = 0
+		vm.sp = vm.modules[moduleIdx].MainFn.Fn.NumLocals
 
-		if err := vm.runModule(moduleIdx); err != nil {
-			return err
+		for {
+			err := vm.runModule(moduleIdx)
+			if err == nil {
+				break
+			}
+			if !vm.handleError(err) {
+				return err
+			}
 		}
 	}
 	return nil
 }
 
+// handleError unwinds to the innermost frame with an exception handler and
+// resumes execution there. It returns false if the error is uncaught, in
+// which case the VM state is left untouched.
+func (vm *VM) handleError(err error) bool {
+	if objects.IsLimitError(err) {
+		return false
+	}
+	rtErr, ok := err.(*objects.VMRuntimeError)
+	if !ok {
+		rtErr = vm.runtimeError(err.Error()).(*objects.VMRuntimeError)
+	}
+
+	for i := vm.framesIndex - 1; i >= vm.baseFrame; i-- {
+		frame := vm.frames[i]
+		if len(frame.handlers) == 0 {
+			continue
+		}
+
+		h := frame.handlers[len(frame.handlers)-1]
+		frame.handlers = frame.handlers[:len(frame.handlers)-1]
+		vm.framesIndex = i + 1
+		vm.sp = h.sp
+
+		var value objects.Object
+		if h.finally {
+			value = &pendingError{err: rtErr}
+		} else if rtErr.Thrown != nil {
+			value = rtErr.Thrown
+		} else {
+			errValue := objects.NewError(rtErr.Message, rtErr.FilePath, rtErr.Line)
+			errValue.Column = rtErr.Column
+			errValue.Trace = rtErr.Trace
+			value = errValue
+		}
+		vm.stack[vm.sp] = ValueOf(value)
+		vm.sp++
+
+		frame.ip = h.catchIP - 1
+		return true
+	}
+	return false
+}
+
+// throw converts a value popped by OpThrow into the error to propagate.
+func (vm *VM) throw(value objects.Object) error {
+	switch v := value.(type) {
+	case *pendingError:
+		return v.err
+	case *objects.Error:
+		// Rethrowing a caught error keeps its original location and stack
+		return &objects.VMRuntimeError{
+			Message:  v.Message,
+			Line:     v.Line,
+			Column:   v.Column,
+			FilePath: v.FilePath,
+			Trace:    v.Trace,
+		}
+	}
+	rtErr := vm.runtimeError("Uncaught exception: " + objects.Stringify(value)).(*objects.VMRuntimeError)
+	rtErr.Thrown = value
+	return rtErr
+}
+
+// MemoryStats returns the allocations of the current or last run.
+func (vm *VM) MemoryStats() objects.MemoryStats {
+	return vm.checker.MemoryStats()
+}
+
+// Alloc accounts for bytes allocated by the program, raising a runtime
+// error once the allocation limit is exceeded.
+func (vm *VM) Alloc(bytes int64) error {
+	if err := vm.checker.Alloc(bytes); err != nil {
+		rtErr := vm.runtimeError(err.Error()).(*objects.VMRuntimeError)
+		rtErr.Err = err
+		return rtErr
+	}
+	return nil
+}
+
+// start prepares the limit checks for a run under ctx.
+func (vm *VM) start(ctx context.Context) {
+	vm.checker.Start(ctx, vm.limits)
+	vm.slice, vm.ticks = 0, 0
+}
+
+// checkStep runs before an instruction whenever the current slice of
+// instructions is used up. It checks the limits and calls the debug
+// callback, keeping both off the common path of the dispatch loop.
+func (vm *VM) checkStep() error {
+	n, err := vm.checker.Next(vm.slice)
+	if err != nil {
+		vm.slice = 0
+		return err
+	}
+	if vm.onStep != nil {
+		vm.onStep()
+		n = 1
+	}
+	vm.slice, vm.ticks = n, n
+	return nil
+}
+
 func (vm *VM) runModule(moduleIdx int) error {
 	var ip int
 	var ins code.Instructions
@@ -179,19 +380,22 @@ func (vm *VM) runModule(moduleIdx int) error {
 		ip = frame.ip
 		op = code.Opcode(ins[ip])
 
-		if vm.onStep != nil {
-			vm.onStep()
+		if vm.ticks == 0 {
+			if err := vm.checkStep(); err != nil {
+				return err
+			}
 		}
+		vm.ticks--
 
 		switch op {
 		case code.OpGetConstant:
 			constIndex := readUint16(ins, ip)
 			frame.ip += 2
-			if err := vm.push(vm.constants[constIndex]); err != nil {
+			if err := vm.pushValue(vm.values[constIndex]); err != nil {
 				return err
 			}
 
-		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv:
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpMod, code.OpFloorDiv, code.OpPow:
 			if err := vm.executeBinaryOperation(op); err != nil {
 				return err
 			}
@@ -211,7 +415,7 @@ func (vm *VM) runModule(moduleIdx int) error {
 				return err
 			}
 
-		case code.OpEqual, code.OpNotEqual, code.OpGreaterThan:
+		case code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpGreaterEqual, code.OpLess, code.OpLessEqual:
 			if err := vm.executeComparison(op); err != nil {
 				return err
 			}
@@ -233,29 +437,40 @@ func (vm *VM) runModule(moduleIdx int) error {
 		case code.OpJumpNotTruthy:
 			pos := readUint16(ins, ip)
 			frame.ip += 2
-			condition := vm.pop()
-			if !objects.IsTruthy(condition) {
+			condition := vm.popValue()
+			if !condition.truthy() {
+				frame.ip = pos - 1
+			}
+
+		case code.OpJumpNotGreater, code.OpJumpNotGreaterEqual, code.OpJumpNotLess, code.OpJumpNotLessEqual:
+			pos := readUint16(ins, ip)
+			frame.ip += 2
+			jump, err := vm.executeComparisonJump(op)
+			if err != nil {
+				return err
+			}
+			if jump {
 				frame.ip = pos - 1
 			}
 
 		case code.OpPop:
-			vm.pop()
+			vm.popValue()
 
 		case code.OpDup:
 			// Don't unwrap - we want to duplicate the exact value (including Cells)
-			if err := vm.push(vm.stack[vm.sp-1]); err != nil {
+			if err := vm.pushValue(vm.stack[vm.sp-1]); err != nil {
 				return err
 			}
 
 		case code.OpSetGlobal:
 			globalIndex := readUint16(ins, ip)
 			frame.ip += 2
-			moduleGlobals[globalIndex] = vm.pop()
+			moduleGlobals[globalIndex] = vm.popValue()
 
 		case code.OpGetGlobal:
 			globalIndex := readUint16(ins, ip)
 			frame.ip += 2
-			if err := vm.push(moduleGlobals[globalIndex]); err != nil {
+			if err := vm.pushValue(moduleGlobals[globalIndex]); err != nil {
 				return err
 			}
 
@@ -267,51 +482,108 @@ func (vm *VM) runModule(moduleIdx int) error {
 			// Look up the global slot for this export
 			slot := vm.modules[targetModuleIdx].Exports[exportIdx]
 			value := vm.modules[targetModuleIdx].Globals[slot]
-			if err := vm.push(value); err != nil {
+			if err := vm.pushValue(value); err != nil {
 				return err
 			}
 
 		case code.OpSetLocal:
 			localIndex := readUint8(ins, ip)
 			frame.ip += 1
-			vm.stack[frame.basePointer+localIndex] = vm.pop()
+			vm.setLocal(frame.basePointer+localIndex, vm.popValue())
+
+		case code.OpDefineLocal:
+			localIndex := readUint8(ins, ip)
+			frame.ip += 1
+			vm.stack[frame.basePointer+localIndex] = vm.popValue()
 
 		case code.OpGetLocal:
 			localIndex := readUint8(ins, ip)
 			frame.ip += 1
-			if err := vm.push(vm.stack[frame.basePointer+localIndex]); err != nil {
+			if err := vm.pushValue(vm.stack[frame.basePointer+localIndex]); err != nil {
 				return err
 			}
 
+		case code.OpAddLocalConstant:
+			localIndex := readUint8(ins, ip)
+			constIndex := readUint16(ins, ip+1)
+			frame.ip += 3
+			local := vm.stack[frame.basePointer+localIndex].unwrap()
+			result, err := vm.binary(objects.Add, local, vm.values[constIndex])
+			if err != nil {
+				return err
+			}
+			if err := vm.pushValue(result); err != nil {
+				return err
+			}
+
+		case code.OpIncrementLocal:
+			localIndex := readUint8(ins, ip)
+			constIndex := readUint16(ins, ip+1)
+			frame.ip += 3
+			slot := frame.basePointer + localIndex
+			result, err := vm.binary(objects.Add, vm.stack[slot].unwrap(), vm.values[constIndex])
+			if err != nil {
+				return err
+			}
+			vm.setLocal(slot, result)
+
 		case code.OpArray:
 			numElements := readUint16(ins, ip)
 			frame.ip += 2
-			array := vm.buildArray(vm.sp-numElements, vm.sp)
-			vm.sp -= numElements
-			if err := vm.push(array); err != nil {
+			if err := vm.executeArray(numElements); err != nil {
 				return err
 			}
 
 		case code.OpHash:
 			numElements := readUint16(ins, ip)
 			frame.ip += 2
-			hash, err := vm.buildHash(vm.sp-numElements, vm.sp)
-			if err != nil {
+			if err := vm.executeHash(numElements); err != nil {
 				return err
 			}
-			vm.sp -= numElements
-			if err := vm.push(hash); err != nil {
+
+		case code.OpInterpolate:
+			numParts := readUint16(ins, ip)
+			frame.ip += 2
+			if err := vm.executeInterpolation(numParts); err != nil {
 				return err
 			}
 
+		case code.OpIter:
+			numVars := readUint8(ins, ip)
+			frame.ip += 1
+			if err := vm.executeIter(numVars); err != nil {
+				return err
+			}
+
+		case code.OpIterNext:
+			pos := readUint16(ins, ip)
+			frame.ip += 2
+
+			more, err := vm.iterNext(vm.stack[vm.sp-1].Object())
+			if err != nil {
+				return err
+			}
+			if !more {
+				frame.ip = pos - 1
+			}
+
 		case code.OpIndex:
-			index := vm.pop()
+			index := vm.popValue()
 			left := vm.pop()
 
 			if err := vm.executeIndexExpression(left, index); err != nil {
 				return err
 			}
 
+		case code.OpSlice:
+			end := vm.pop()
+			start := vm.pop()
+			left := vm.pop()
+
+			if err := vm.executeSliceExpression(left, start, end); err != nil {
+				return err
+			}
+
 		case code.OpSetIndex:
 			value := vm.pop()
 			index := vm.pop()
@@ -329,11 +601,11 @@ func (vm *VM) runModule(moduleIdx int) error {
 				vm.output = append(vm.output, output)
 			} else {
 				// Normal mode - print to stdout
-				fmt.Println(output)
+				fmt.Fprintln(vm.stdout, output)
 			}
 
 		case code.OpReturnValue:
-			returnValue := vm.pop()
+			returnValue := vm.popValue()
 
 			poppedFrame := vm.popFrame()
 			// Check if we're returning to the module's main frame
@@ -344,9 +616,13 @@ func (vm *VM) runModule(moduleIdx int) error {
 			frame = vm.currentFrame()
 			vm.sp = poppedFrame.basePointer - 1
 
-			if err := vm.push(returnValue); err != nil {
+			if err := vm.pushValue(returnValue); err != nil {
 				return err
 			}
+			if vm.framesIndex == vm.baseFrame {
+				// Returning from a call made by CallValue
+				return nil
+			}
 			ins = frame.cl.Fn.Instructions
 
 		case code.OpReturn:
@@ -362,18 +638,16 @@ func (vm *VM) runModule(moduleIdx int) error {
 			if err := vm.push(objects.NilValue); err != nil {
 				return err
 			}
+			if vm.framesIndex == vm.baseFrame {
+				// Returning from a call made by CallValue
+				return nil
+			}
 			ins = frame.cl.Fn.Instructions
 
 		case code.OpGetNative:
-			nativeIndex := readUint8(ins, ip)
-			frame.ip += 1
-
-			nativeFn := objects.GetNativeFunctionByIndex(nativeIndex)
-			if nativeFn == nil {
-				return vm.runtimeError(fmt.Sprintf("native function index out of bounds: %d", nativeIndex))
-			}
-
-			if err := vm.push(nativeFn); err != nil {
+			nativeIndex := readUint16(ins, ip)
+			frame.ip += 2
+			if err := vm.executeGetNative(nativeIndex); err != nil {
 				return err
 			}
 
@@ -401,21 +675,8 @@ func (vm *VM) runModule(moduleIdx int) error {
 			localIndex := readUint8(ins, ip)
 			frame.ip += 1
 
-			slotIdx := frame.basePointer + localIndex
-			obj := vm.stack[slotIdx]
-
-			// If already a Cell, just push it
-			if cell, ok := obj.(*objects.Cell); ok {
-				if err := vm.push(cell); err != nil {
-					return err
-				}
-			} else {
-				// Wrap in a new Cell, store it back, and push it
-				cell := objects.NewCell(obj)
-				vm.stack[slotIdx] = cell
-				if err := vm.push(cell); err != nil {
-					return err
-				}
+			if err := vm.executeMakeCell(frame.basePointer + localIndex); err != nil {
+				return err
 			}
 
 		case code.OpGetClosure:
@@ -445,34 +706,7 @@ func (vm *VM) runModule(moduleIdx int) error {
 			numMethods := readUint8(ins, ip+2)
 			frame.ip += 3
 
-			// Get class name from constants
-			className := vm.constants[nameIdx].(*objects.String).Value
-
-			// Pop methods from stack (they have names in CompiledFunction)
-			methods := make(map[string]*objects.Closure)
-			for i := 0; i < numMethods; i++ {
-				closure := vm.stack[vm.sp-numMethods+i].(*objects.Closure)
-				methods[closure.Fn.Name] = closure
-			}
-			vm.sp -= numMethods
-
-			// Pop superclass (nil or CompiledClass)
-			var superClass *objects.CompiledClass
-			superObj := vm.pop()
-			if _, ok := superObj.(*objects.Nil); !ok {
-				var ok bool
-				superClass, ok = superObj.(*objects.CompiledClass)
-				if !ok {
-					return vm.runtimeError(fmt.Sprintf("superclass must be a class, got %s", superObj.Type()))
-				}
-			}
-
-			class := &objects.CompiledClass{
-				Name:       className,
-				Methods:    methods,
-				SuperClass: superClass,
-			}
-			if err := vm.push(class); err != nil {
+			if err := vm.executeClass(nameIdx, numMethods); err != nil {
 				return err
 			}
 
@@ -480,73 +714,353 @@ func (vm *VM) runModule(moduleIdx int) error {
 			nameIdx := readUint16(ins, ip)
 			frame.ip += 2
 
-			name := vm.constants[nameIdx].(*objects.String).Value
-			obj := vm.pop()
-
-			switch target := obj.(type) {
-			case *objects.CompiledInstance:
-				// Check fields first
-				if val, ok := target.Fields[name]; ok {
-					if err := vm.push(val); err != nil {
-						return err
-					}
-				} else if method, ok := target.Class.LookupMethod(name); ok {
-					// Bind method to instance
-					bound := &objects.BoundMethod{Receiver: target, Method: method}
-					if err := vm.push(bound); err != nil {
-						return err
-					}
-				} else {
-					return vm.runtimeError(fmt.Sprintf("undefined property '%s' on %s instance",
-						name, target.Class.Name))
-				}
-			default:
-				return vm.runtimeError(fmt.Sprintf("only instances have properties, got %s", obj.Type()))
+			if err := vm.executeGetProperty(nameIdx); err != nil {
+				return err
 			}
 
 		case code.OpSetProperty:
 			nameIdx := readUint16(ins, ip)
 			frame.ip += 2
 
-			name := vm.constants[nameIdx].(*objects.String).Value
-			value := vm.pop()
-			obj := vm.pop()
-
-			instance, ok := obj.(*objects.CompiledInstance)
-			if !ok {
-				return vm.runtimeError(fmt.Sprintf("only instances have fields, got %s", obj.Type()))
+			if err := vm.executeSetProperty(nameIdx); err != nil {
+				return err
 			}
 
-			instance.Fields[name] = value
-			if err := vm.push(value); err != nil {
+		case code.OpTry:
+			catchIP := readUint16(ins, ip)
+			kind := readUint8(ins, ip+2)
+			frame.ip += 3
+			frame.handlers = append(frame.handlers, handler{catchIP: catchIP, sp: vm.sp, finally: kind == 1})
+
+		case code.OpEndTry:
+			frame.handlers = frame.handlers[:len(frame.handlers)-1]
+
+		case code.OpThrow:
+			return vm.throw(vm.pop())
+
+		case code.OpWide:
+			if err := vm.executeWide(frame, ins, ip); err != nil {
 				return err
 			}
+			// A wide OpCall enters a new frame
+			frame = vm.currentFrame()
+			ins = frame.cl.Fn.Instructions
 
 		case code.OpGetSuper:
 			nameIdx := readUint16(ins, ip)
 			frame.ip += 2
 
-			name := vm.constants[nameIdx].(*objects.String).Value
-			instance := vm.pop().(*objects.CompiledInstance)
+			if err := vm.executeGetSuper(nameIdx); err != nil {
+				return err
+			}
 
-			// Compiler guarantees: superclass exists (validated at compile time)
-			superClass := instance.Class.SuperClass
+		}
+	}
 
-			method, ok := superClass.LookupMethod(name)
-			if !ok {
-				return vm.runtimeError(fmt.Sprintf("undefined method '%s' in superclass %s",
-					name, superClass.Name))
-			}
+	return nil
+}
 
-			bound := &objects.BoundMethod{Receiver: instance, Method: method}
-			if err := vm.push(bound); err != nil {
-				return err
+// executeWide runs the instruction at ip, an OpWide prefix followed by an
+// instruction whose operands are twice their usual width. Instructions
+// that call into a new frame leave it to the caller to switch to it.
+func (vm *VM) executeWide(frame *Frame, ins code.Instructions, ip int) error {
+	op, operands, width, err := code.ReadInstruction(ins[ip:])
+	if err != nil {
+		return vm.runtimeError(err.Error())
+	}
+	frame.ip = ip + width - 1
+
+	switch op {
+	case code.OpGetConstant:
+		return vm.pushValue(vm.values[operands[0]])
+
+	case code.OpJump:
+		frame.ip = operands[0] - 1
+
+	case code.OpJumpNotTruthy:
+		if !vm.popValue().truthy() {
+			frame.ip = operands[0] - 1
+		}
+
+	case code.OpJumpNotGreater, code.OpJumpNotGreaterEqual, code.OpJumpNotLess, code.OpJumpNotLessEqual:
+		jump, err := vm.executeComparisonJump(op)
+		if err != nil {
+			return err
+		}
+		if jump {
+			frame.ip = operands[0] - 1
+		}
+
+	case code.OpSetGlobal:
+		vm.modules[vm.currentModule].Globals[operands[0]] = vm.popValue()
+
+	case code.OpGetGlobal:
+		return vm.pushValue(vm.modules[vm.currentModule].Globals[operands[0]])
+
+	case code.OpGetModuleExport:
+		target := vm.modules[operands[0]]
+		return vm.pushValue(target.Globals[target.Exports[operands[1]]])
+
+	case code.OpSetLocal:
+		vm.setLocal(frame.basePointer+operands[0], vm.popValue())
+
+	case code.OpDefineLocal:
+		vm.stack[frame.basePointer+operands[0]] = vm.popValue()
+
+	case code.OpGetLocal:
+		return vm.pushValue(vm.stack[frame.basePointer+operands[0]])
+
+	case code.OpAddLocalConstant:
+		local := vm.stack[frame.basePointer+operands[0]].unwrap()
+		result, err := vm.binary(objects.Add, local, vm.values[operands[1]])
+		if err != nil {
+			return err
+		}
+		return vm.pushValue(result)
+
+	case code.OpIncrementLocal:
+		slot := frame.basePointer + operands[0]
+		result, err := vm.binary(objects.Add, vm.stack[slot].unwrap(), vm.values[operands[1]])
+		if err != nil {
+			return err
+		}
+		vm.setLocal(slot, result)
+
+	case code.OpArray:
+		return vm.executeArray(operands[0])
+
+	case code.OpHash:
+		return vm.executeHash(operands[0])
+
+	case code.OpInterpolate:
+		return vm.executeInterpolation(operands[0])
+
+	case code.OpIter:
+		return vm.executeIter(operands[0])
+
+	case code.OpIterNext:
+		more, err := vm.iterNext(vm.stack[vm.sp-1].Object())
+		if err != nil {
+			return err
+		}
+		if !more {
+			frame.ip = operands[0] - 1
+		}
+
+	case code.OpGetNative:
+		return vm.executeGetNative(operands[0])
+
+	case code.OpGetFree:
+		return vm.push(frame.cl.Free[operands[0]])
+
+	case code.OpSetFree:
+		frame.cl.Free[operands[0]].Value = vm.pop()
+
+	case code.OpMakeCell:
+		return vm.executeMakeCell(frame.basePointer + operands[0])
+
+	case code.OpGetClosure:
+		return vm.executeClosure(operands[0], operands[1])
+
+	case code.OpCall:
+		_, err := vm.executeCall(operands[0])
+		return err
+
+	case code.OpClass:
+		return vm.executeClass(operands[0], operands[1])
+
+	case code.OpGetProperty:
+		return vm.executeGetProperty(operands[0])
+
+	case code.OpSetProperty:
+		return vm.executeSetProperty(operands[0])
+
+	case code.OpGetSuper:
+		return vm.executeGetSuper(operands[0])
+
+	case code.OpTry:
+		frame.handlers = append(frame.handlers, handler{catchIP: operands[0], sp: vm.sp, finally: operands[1] == 1})
+
+	default:
+		def, _ := code.Lookup(byte(op))
+		return vm.runtimeError(fmt.Sprintf("%s has no wide form", def.Name))
+	}
+	return nil
+}
+
+// executeComparisonJump pops the operands of a fused compare-and-jump
+// instruction and reports whether it jumps.
+func (vm *VM) executeComparisonJump(op code.Opcode) (bool, error) {
+	right := vm.popValue()
+	left := vm.popValue()
+	result, err := vm.binary(jumpComparisons[op], left, right)
+	if err != nil {
+		return false, err
+	}
+	return !result.truthy(), nil
+}
+
+func (vm *VM) executeArray(numElements int) error {
+	if err := vm.Alloc(objects.ArraySize(numElements)); err != nil {
+		return err
+	}
+	array := vm.buildArray(vm.sp-numElements, vm.sp)
+	vm.sp -= numElements
+	return vm.push(array)
+}
+
+func (vm *VM) executeHash(numElements int) error {
+	hash, err := vm.buildHash(vm.sp-numElements, vm.sp)
+	if err != nil {
+		return err
+	}
+	vm.sp -= numElements
+	return vm.push(hash)
+}
+
+func (vm *VM) executeInterpolation(numParts int) error {
+	str, err := vm.buildInterpolation(vm.sp-numParts, vm.sp)
+	if err != nil {
+		return err
+	}
+	vm.sp -= numParts
+	return vm.push(str)
+}
+
+func (vm *VM) executeIter(numVars int) error {
+	iterator, err := vm.iterator(vm.pop(), numVars == 2)
+	if err != nil {
+		return err
+	}
+	return vm.push(iterator)
+}
+
+func (vm *VM) executeGetNative(nativeIndex int) error {
+	nativeFn := vm.natives.Get(nativeIndex)
+	if nativeFn == nil {
+		return vm.runtimeError(fmt.Sprintf("native function index out of bounds: %d", nativeIndex))
+	}
+	return vm.push(nativeFn)
+}
+
+// executeMakeCell wraps the local in slotIdx in a Cell, stores it back and
+// pushes it.
+// setLocal assigns v to the local in slot. Once closures captured the local
+// it lives in a Cell, which the assignment goes through so they see it.
+func (vm *VM) setLocal(slot int, v Value) {
+	if cell, ok := vm.stack[slot].obj.(*objects.Cell); ok {
+		cell.Value = v.Object()
+		return
+	}
+	vm.stack[slot] = v
+}
+
+func (vm *VM) executeMakeCell(slotIdx int) error {
+	local := vm.stack[slotIdx]
+
+	// If already a Cell, just push it
+	if cell, ok := local.obj.(*objects.Cell); ok {
+		return vm.push(cell)
+	}
+	cell := objects.NewCell(local.Object())
+	vm.stack[slotIdx] = Value{obj: cell}
+	return vm.push(cell)
+}
+
+func (vm *VM) executeClass(nameIdx, numMethods int) error {
+	// Get class name from constants
+	className := vm.constants[nameIdx].(*objects.String).Value
+
+	// Pop methods from stack (they have names in CompiledFunction)
+	methods := make(map[string]*objects.Closure)
+	for i := 0; i < numMethods; i++ {
+		closure := vm.stack[vm.sp-numMethods+i].obj.(*objects.Closure)
+		methods[closure.Fn.Name] = closure
+	}
+	vm.sp -= numMethods
+
+	// Pop superclass (nil or CompiledClass)
+	var superClass *objects.CompiledClass
+	superObj := vm.pop()
+	if _, ok := superObj.(*objects.Nil); !ok {
+		var ok bool
+		superClass, ok = superObj.(*objects.CompiledClass)
+		if !ok {
+			return vm.runtimeError(objects.ErrSuperclass.Error())
+		}
+	}
+
+	class := &objects.CompiledClass{
+		Name:       className,
+		Methods:    methods,
+		SuperClass: superClass,
+	}
+	return vm.push(class)
+}
+
+func (vm *VM) executeGetProperty(nameIdx int) error {
+	name := vm.constants[nameIdx].(*objects.String).Value
+	obj := vm.pop()
+
+	switch target := obj.(type) {
+	case *objects.CompiledInstance:
+		// Check fields first
+		if val, ok := target.Fields[name]; ok {
+			return vm.push(val)
+		}
+		if method, ok := target.Class.LookupMethod(name); ok {
+			// Bind method to instance
+			return vm.push(&objects.BoundMethod{Receiver: target, Method: method})
+		}
+		return vm.runtimeError(fmt.Sprintf("Undefined property '%s'.", name))
+	case *objects.Error:
+		val, ok := target.Get(name)
+		if !ok {
+			return vm.runtimeError(fmt.Sprintf("Undefined property '%s'.", name))
+		}
+		return vm.push(val)
+	default:
+		method, ok := objects.Method(obj, name)
+		if !ok {
+			if objects.HasMethods(obj) {
+				return vm.runtimeError(fmt.Sprintf("Undefined method '%s'.", name))
 			}
+			return vm.runtimeError("Only instances and namespaces have properties.")
+		}
+		return vm.push(method)
+	}
+}
+
+func (vm *VM) executeSetProperty(nameIdx int) error {
+	name := vm.constants[nameIdx].(*objects.String).Value
+	value := vm.pop()
+	obj := vm.pop()
+
+	instance, ok := obj.(*objects.CompiledInstance)
+	if !ok {
+		return vm.runtimeError("Only instances have fields.")
+	}
 
+	if _, ok := instance.Fields[name]; !ok {
+		if err := vm.Alloc(objects.EntrySize(name)); err != nil {
+			return err
 		}
 	}
+	instance.Fields[name] = value
+	return vm.push(value)
+}
 
-	return nil
+func (vm *VM) executeGetSuper(nameIdx int) error {
+	name := vm.constants[nameIdx].(*objects.String).Value
+	superClass := vm.pop().(*objects.CompiledClass)
+	instance := vm.pop().(*objects.CompiledInstance)
+
+	method, ok := superClass.LookupMethod(name)
+	if !ok {
+		return vm.runtimeError(fmt.Sprintf("Undefined property '%s'.", name))
+	}
+
+	return vm.push(&objects.BoundMethod{Receiver: instance, Method: method})
 }
 
 func (vm *VM) executeClosure(constIndex int, numFree int) error {
@@ -559,13 +1073,13 @@ func (vm *VM) executeClosure(constIndex int, numFree int) error {
 	// Collect free variables from the stack
 	free := make([]*objects.Cell, numFree)
 	for i := 0; i < numFree; i++ {
-		obj := vm.stack[vm.sp-numFree+i]
-		if cell, ok := obj.(*objects.Cell); ok {
+		v := vm.stack[vm.sp-numFree+i]
+		if cell, ok := v.obj.(*objects.Cell); ok {
 			// Reuse the existing cell
 			free[i] = cell
 		} else {
 			// Wrap in a new cell (for local variables)
-			free[i] = objects.NewCell(obj)
+			free[i] = objects.NewCell(v.Object())
 		}
 	}
 	vm.sp = vm.sp - numFree
@@ -575,7 +1089,7 @@ func (vm *VM) executeClosure(constIndex int, numFree int) error {
 }
 
 func (vm *VM) executeCall(numArgs int) (*Frame, error) {
-	callee := unwrapCell(vm.stack[vm.sp-1-numArgs])
+	callee := vm.stack[vm.sp-1-numArgs].unwrap().Object()
 
 	switch fn := callee.(type) {
 	case *objects.Closure:
@@ -587,20 +1101,24 @@ func (vm *VM) executeCall(numArgs int) (*Frame, error) {
 	case *objects.BoundMethod:
 		return vm.callBoundMethod(fn, numArgs)
 	default:
-		return nil, vm.runtimeError(fmt.Sprintf("cannot call %s", callee.Type()))
+		return nil, vm.runtimeError(objects.ErrNotCallable.Error())
 	}
 }
 
 func (vm *VM) callNativeFunction(fn *objects.NativeFunction, numArgs int) error {
+	if err := objects.CheckArity(fn.NumArgs, numArgs); err != nil {
+		return vm.runtimeError(err.Error())
+	}
+
 	// Unwrap any Cell arguments
 	args := make([]objects.Object, numArgs)
 	for i := 0; i < numArgs; i++ {
-		args[i] = unwrapCell(vm.stack[vm.sp-numArgs+i])
+		args[i] = vm.stack[vm.sp-numArgs+i].unwrap().Object()
 	}
 
-	result, err := fn.Fn(args...)
+	result, err := fn.Fn(vm, args...)
 	if err != nil {
-		return err
+		return vm.nativeError(err)
 	}
 
 	vm.sp = vm.sp - numArgs - 1 // pop arguments and the function itself
@@ -611,12 +1129,24 @@ func (vm *VM) callNativeFunction(fn *objects.NativeFunction, numArgs int) error
 	return vm.push(objects.NilValue)
 }
 
+// nativeError turns an error from Go code into a runtime error. Errors
+// raised by program code that Go code called back into are kept as they are.
+func (vm *VM) nativeError(err error) error {
+	if _, ok := err.(*objects.VMRuntimeError); ok || objects.IsLimitError(err) {
+		return err
+	}
+	return vm.runtimeError(err.Error())
+}
+
 func (vm *VM) callClosure(cl *objects.Closure, numArgs int) (*Frame, error) {
 	fn := cl.Fn
-	if numArgs != fn.NumParameters {
-		return nil, vm.runtimeError(fmt.Sprintf("wrong number of arguments: want=%d, got=%d",
-			fn.NumParameters, numArgs))
+	if err := objects.CheckArity(fn.NumParameters, numArgs); err != nil {
+		return nil, vm.runtimeError(err.Error())
+	}
+	if vm.framesIndex > vm.maxCallDepth() {
+		return nil, &objects.CallDepthError{Limit: vm.maxCallDepth()}
 	}
+	vm.unwrapArgs(numArgs)
 
 	frame := NewFrame(cl, vm.sp-numArgs)
 	vm.pushFrame(frame)
@@ -625,21 +1155,32 @@ func (vm *VM) callClosure(cl *objects.Closure, numArgs int) (*Frame, error) {
 	return frame, nil
 }
 
+// unwrapArgs replaces the cells of captured variables among the arguments
+// on top of the stack with their values, so the parameters they become do
+// not share the caller's variables.
+func (vm *VM) unwrapArgs(numArgs int) {
+	for i := vm.sp - numArgs; i < vm.sp; i++ {
+		vm.stack[i] = vm.stack[i].unwrap()
+	}
+}
+
 func (vm *VM) callClass(class *objects.CompiledClass, numArgs int) (*Frame, error) {
+	if err := vm.Alloc(objects.InstanceSize); err != nil {
+		return nil, err
+	}
 	instance := objects.NewCompiledInstance(class)
 
 	// Check for init method (including inherited)
 	if init, ok := class.LookupMethod("init"); ok {
-		expectedArgs := init.Fn.NumParameters - 1 // -1 for 'this'
-		if expectedArgs != numArgs {
-			return nil, vm.runtimeError(fmt.Sprintf("%s.init() expected %d arguments but got %d",
-				class.Name, expectedArgs, numArgs))
+		// -1 for 'this'
+		if err := objects.CheckArity(init.Fn.NumParameters-1, numArgs); err != nil {
+			return nil, vm.runtimeError(err.Error())
 		}
 
 		bound := objects.NewBoundMethod(instance, init)
 
 		// Replace class on stack with bound method
-		vm.stack[vm.sp-1-numArgs] = bound
+		vm.stack[vm.sp-1-numArgs] = Value{obj: bound}
 
 		// Call init - it will return nil but we'll fix that below
 		frame, err := vm.callBoundMethod(bound, numArgs)
@@ -651,9 +1192,8 @@ func (vm *VM) callClass(class *objects.CompiledClass, numArgs int) (*Frame, erro
 	}
 
 	// No init method - must have zero arguments
-	if numArgs != 0 {
-		return nil, vm.runtimeError(fmt.Sprintf("%s() takes no arguments (%d given)",
-			class.Name, numArgs))
+	if err := objects.CheckArity(0, numArgs); err != nil {
+		return nil, vm.runtimeError(err.Error())
 	}
 
 	// Replace class with instance on stack
@@ -666,11 +1206,13 @@ func (vm *VM) callClass(class *objects.CompiledClass, numArgs int) (*Frame, erro
 
 // callBoundMethod calls a method with its bound receiver.
 func (vm *VM) callBoundMethod(bm *objects.BoundMethod, numArgs int) (*Frame, error) {
-	expectedArgs := bm.Method.Fn.NumParameters - 1
-	if expectedArgs != numArgs {
-		return nil, vm.runtimeError(fmt.Sprintf("%s() expected %d arguments but got %d",
-			bm.Method.Fn.Name, expectedArgs, numArgs))
+	if err := objects.CheckArity(bm.Method.Fn.NumParameters-1, numArgs); err != nil {
+		return nil, vm.runtimeError(err.Error())
+	}
+	if vm.framesIndex > vm.maxCallDepth() {
+		return nil, &objects.CallDepthError{Limit: vm.maxCallDepth()}
 	}
+	vm.unwrapArgs(numArgs)
 
 	// Shift everything (including bound_method slot) up by 1
 	for i := numArgs; i >= 0; i-- {
@@ -680,7 +1222,7 @@ func (vm *VM) callBoundMethod(bm *objects.BoundMethod, numArgs int) (*Frame, err
 
 	// Replace bound_method with this
 	thisSlot := vm.sp - numArgs - 1
-	vm.stack[thisSlot] = bm.Receiver
+	vm.stack[thisSlot] = ValueOf(bm.Receiver)
 
 	// basePointer = thisSlot, so local 0 = this
 	frame := NewFrame(bm.Method, thisSlot)
@@ -690,239 +1232,317 @@ func (vm *VM) callBoundMethod(bm *objects.BoundMethod, numArgs int) (*Frame, err
 	return frame, nil
 }
 
-func (vm *VM) executeBinaryOperation(op code.Opcode) error {
-	right := vm.pop()
-	left := vm.pop()
-
-	leftType := left.Type()
-	rightType := right.Type()
+// CallValue calls fn with the given arguments and runs it to completion,
+// returning its result. It lets opcodes and natives call back into user
+// code.
+func (vm *VM) CallValue(fn objects.Object, args ...objects.Object) (objects.Object, error) {
+	if err := vm.push(fn); err != nil {
+		return nil, err
+	}
+	for _, arg := range args {
+		if err := vm.push(arg); err != nil {
+			return nil, err
+		}
+	}
 
-	if leftType == objects.TypeNumber && rightType == objects.TypeNumber {
-		return vm.executeBinaryIntegerOperation(op, left, right)
+	frame, err := vm.executeCall(len(args))
+	if err != nil {
+		return nil, err
+	}
+	if frame != nil {
+		previousBase := vm.baseFrame
+		vm.baseFrame = vm.framesIndex - 1
+		defer func() { vm.baseFrame = previousBase }()
+
+		for {
+			err := vm.runModule(vm.currentModule)
+			if err == nil {
+				break
+			}
+			if !vm.handleError(err) {
+				return nil, err
+			}
+		}
 	}
+	return vm.pop(), nil
+}
+
+// hostFunction is the bottom frame of calls made by Call, standing in for
+// the Go code that made them. It has no code and no stack trace entry.
+var hostFunction = &objects.CompiledFunction{Name: "<host>", DebugInfoIdx: -1}
+
+// Call calls fn, a value taken from the globals of a program that has run,
+// with the given arguments and returns its result. It lets a Go program
+// embedding the VM call back into Viri code.
+func (vm *VM) Call(fn objects.Object, args ...objects.Object) (objects.Object, error) {
+	return vm.CallContext(context.Background(), fn, args...)
+}
 
-	if leftType == objects.TypeString && rightType == objects.TypeString {
-		return vm.executeBinaryStringOperation(op, left, right)
+// CallContext is like Call but stops once ctx is done, as RunProgramContext
+// does. The call gets limits of its own, apart from the program's run.
+func (vm *VM) CallContext(ctx context.Context, fn objects.Object, args ...objects.Object) (objects.Object, error) {
+	vm.start(ctx)
+	vm.currentModule = vm.numModules - 1
+	vm.frames[0] = NewFrame(objects.NewClosure(hostFunction, nil), 0)
+	vm.framesIndex = 1
+	vm.baseFrame = 0
+	vm.sp = 0
+	return vm.CallValue(fn, args...)
+}
+
+// iterator creates the iterator for a for-in loop. Instances are iterated
+// through their hasNext() and next() methods, after calling iterator() first
+// if they define it.
+func (vm *VM) iterator(value objects.Object, pairs bool) (objects.Object, error) {
+	if instance, ok := value.(*objects.CompiledInstance); ok {
+		if method, ok := instance.Class.LookupMethod("iterator"); ok {
+			result, err := vm.callIteratorMethod(instance, method)
+			if err != nil {
+				return nil, err
+			}
+			value = result
+		}
 	}
 
-	// Mixed type addition: number + string or string + number
-	if op == code.OpAdd {
-		if leftType == objects.TypeNumber && rightType == objects.TypeString {
-			return vm.executeBinaryNumberStringOperation(left, right)
+	if instance, ok := value.(*objects.CompiledInstance); ok {
+		_, hasNext := instance.Class.LookupMethod("hasNext")
+		_, hasValue := instance.Class.LookupMethod("next")
+		if !hasNext || !hasValue {
+			return nil, vm.runtimeError(objects.ErrIteratorMethods.Error())
 		}
-		if leftType == objects.TypeString && rightType == objects.TypeNumber {
-			return vm.executeBinaryStringNumberOperation(left, right)
+		if pairs {
+			return nil, vm.runtimeError(objects.ErrIteratorPairs.Error())
 		}
+		return instance, nil
 	}
 
-	return vm.runtimeError("Operands must be numbers.")
-}
-
-func (vm *VM) executeBinaryStringOperation(op code.Opcode, left, right objects.Object) error {
-	if op != code.OpAdd {
-		return vm.runtimeError(fmt.Sprintf("unknown string operator: %d", op))
+	it, ok := objects.NewIterator(value, pairs)
+	if !ok {
+		return nil, vm.runtimeError(objects.ErrNotIterable.Error())
 	}
+	return it, nil
+}
 
-	leftVal := left.(*objects.String).Value
-	rightVal := right.(*objects.String).Value
+// iterNext pushes the next value(s) of a for-in loop, returning false once
+// the iterator is exhausted.
+func (vm *VM) iterNext(iterator objects.Object) (bool, error) {
+	switch it := iterator.(type) {
+	case *objects.Iterator:
+		key, value, ok := it.Next()
+		if !ok {
+			return false, nil
+		}
+		if it.Pairs() {
+			if err := vm.push(key); err != nil {
+				return false, err
+			}
+		}
+		return true, vm.push(value)
 
-	return vm.push(&objects.String{Value: leftVal + rightVal})
+	case *objects.CompiledInstance:
+		hasNext, _ := it.Class.LookupMethod("hasNext")
+		more, err := vm.callIteratorMethod(it, hasNext)
+		if err != nil || !objects.IsTruthy(more) {
+			return false, err
+		}
+		next, _ := it.Class.LookupMethod("next")
+		value, err := vm.callIteratorMethod(it, next)
+		if err != nil {
+			return false, err
+		}
+		return true, vm.push(value)
+	}
+	return false, vm.runtimeError(fmt.Sprintf("not an iterator: %s", objects.TypeName(iterator)))
 }
 
-func (vm *VM) executeBinaryNumberStringOperation(left, right objects.Object) error {
-	leftVal := left.(*objects.Number)
-	rightVal := right.(*objects.String)
-	return vm.push(&objects.String{Value: leftVal.Inspect() + rightVal.Value})
+// callIteratorMethod calls one of the zero-argument iterator protocol
+// methods of instance.
+func (vm *VM) callIteratorMethod(instance *objects.CompiledInstance, method *objects.Closure) (objects.Object, error) {
+	if err := objects.CheckIteratorMethod(method.Fn.Name, method.Fn.NumParameters-1); err != nil {
+		return nil, vm.runtimeError(err.Error())
+	}
+	return vm.CallValue(objects.NewBoundMethod(instance, method))
 }
 
-func (vm *VM) executeBinaryStringNumberOperation(left, right objects.Object) error {
-	leftVal := left.(*objects.String)
-	rightVal := right.(*objects.Number)
-	return vm.push(&objects.String{Value: leftVal.Value + rightVal.Inspect()})
+// binaryOperators maps the arithmetic and comparison opcodes to the
+// operators they apply.
+var binaryOperators = map[code.Opcode]objects.Operator{
+	code.OpAdd:          objects.Add,
+	code.OpSub:          objects.Subtract,
+	code.OpMul:          objects.Multiply,
+	code.OpDiv:          objects.Divide,
+	code.OpMod:          objects.Modulo,
+	code.OpFloorDiv:     objects.FloorDivide,
+	code.OpPow:          objects.Power,
+	code.OpGreaterThan:  objects.Greater,
+	code.OpGreaterEqual: objects.GreaterEqual,
+	code.OpLess:         objects.Less,
+	code.OpLessEqual:    objects.LessEqual,
 }
 
-func (vm *VM) executeBinaryIntegerOperation(op code.Opcode, left, right objects.Object) error {
-	leftVal := left.(*objects.Number).Value
-	rightVal := right.(*objects.Number).Value
+// jumpComparisons maps the fused compare-and-jump opcodes to the
+// comparisons they test.
+var jumpComparisons = map[code.Opcode]objects.Operator{
+	code.OpJumpNotGreater:      objects.Greater,
+	code.OpJumpNotGreaterEqual: objects.GreaterEqual,
+	code.OpJumpNotLess:         objects.Less,
+	code.OpJumpNotLessEqual:    objects.LessEqual,
+}
 
-	var result float64
+func (vm *VM) executeBinaryOperation(op code.Opcode) error {
+	right := vm.popValue()
+	left := vm.popValue()
 
-	switch op {
-	case code.OpAdd:
-		result = leftVal + rightVal
-	case code.OpSub:
-		result = leftVal - rightVal
-	case code.OpMul:
-		result = leftVal * rightVal
-	case code.OpDiv:
-		result = leftVal / rightVal
-	default:
-		return vm.runtimeError(fmt.Sprintf("unknown integer operator: %d", op))
+	result, err := vm.binary(binaryOperators[op], left, right)
+	if err != nil {
+		return err
 	}
-
-	return vm.push(&objects.Number{Value: result})
+	return vm.pushValue(result)
 }
 
-func (vm *VM) executeComparison(op code.Opcode) error {
-	right := vm.pop()
-	left := vm.pop()
-
-	if left.Type() == objects.TypeNumber && right.Type() == objects.TypeNumber {
-		return vm.executeIntegerComparison(op, left, right)
+// binary applies op to two values, computing with numbers in place and
+// leaving every other operand to objects.Binary.
+func (vm *VM) binary(op objects.Operator, left, right Value) (Value, error) {
+	if left.isNumber() && right.isNumber() {
+		if op >= objects.Greater {
+			return boolean(objects.Compare(op, left.num, right.num)), nil
+		}
+		n, err := objects.Arithmetic(op, left.num, right.num)
+		if err != nil {
+			return Value{}, vm.nativeError(err)
+		}
+		return number(n), nil
 	}
 
-	switch op {
-	case code.OpEqual:
-		return vm.push(objects.NewBool(objects.IsEqual(left, right)))
-	case code.OpNotEqual:
-		return vm.push(objects.NewBool(!objects.IsEqual(left, right)))
-	default:
-		return vm.runtimeError(fmt.Sprintf("unknown operator: %d (%s %s)", op, left.Type(), right.Type()))
+	result, err := objects.Binary(vm, op, left.Object(), right.Object())
+	if err != nil {
+		return Value{}, vm.nativeError(err)
 	}
+	return ValueOf(result), nil
 }
 
-func (vm *VM) executeIntegerComparison(op code.Opcode, left, right objects.Object) error {
-	leftVal := left.(*objects.Number).Value
-	rightVal := right.(*objects.Number).Value
-
+func (vm *VM) executeComparison(op code.Opcode) error {
 	switch op {
 	case code.OpEqual:
-		return vm.push(objects.NewBool(leftVal == rightVal))
+		right := vm.popValue()
+		left := vm.popValue()
+		return vm.pushValue(boolean(equal(left, right)))
 	case code.OpNotEqual:
-		return vm.push(objects.NewBool(leftVal != rightVal))
-	case code.OpGreaterThan:
-		return vm.push(objects.NewBool(leftVal > rightVal))
+		right := vm.popValue()
+		left := vm.popValue()
+		return vm.pushValue(boolean(!equal(left, right)))
 	default:
-		return vm.runtimeError(fmt.Sprintf("unknown operator: %d", op))
+		return vm.executeBinaryOperation(op)
 	}
 }
 
 func (vm *VM) executeBangOperator() error {
-	operand := vm.pop()
-	return vm.push(objects.NewBool(!objects.IsTruthy(operand)))
+	operand := vm.popValue()
+	return vm.pushValue(boolean(!operand.truthy()))
 }
 
 func (vm *VM) executeMinusOperator() error {
-	operand := vm.pop()
-
-	if operand.Type() != objects.TypeNumber {
-		return vm.runtimeError(fmt.Sprintf("unsupported type for negation: %s", operand.Type()))
+	operand := vm.popValue()
+	if operand.isNumber() {
+		return vm.pushValue(number(-operand.num))
 	}
-
-	value := operand.(*objects.Number).Value
-	return vm.push(&objects.Number{Value: -value})
+	result, err := objects.Negate(operand.Object())
+	if err != nil {
+		return vm.nativeError(err)
+	}
+	return vm.push(result)
 }
 
 func (vm *VM) buildArray(startIndex, endIndex int) objects.Object {
 	elements := make([]objects.Object, endIndex-startIndex)
 
 	for i := startIndex; i < endIndex; i++ {
-		elements[i-startIndex] = vm.stack[i]
+		elements[i-startIndex] = vm.stack[i].unwrap().Object()
 	}
 
 	return &objects.Array{Elements: elements}
 }
 
+func (vm *VM) buildInterpolation(startIndex, endIndex int) (objects.Object, error) {
+	var sb strings.Builder
+
+	for i := startIndex; i < endIndex; i++ {
+		sb.WriteString(objects.Stringify(vm.stack[i].unwrap().Object()))
+	}
+
+	str := sb.String()
+	if err := vm.Alloc(objects.StringSize(str)); err != nil {
+		return nil, err
+	}
+	return &objects.String{Value: str}, nil
+}
+
 func (vm *VM) buildHash(startIndex, endIndex int) (objects.Object, error) {
+	if err := vm.Alloc(objects.HashSize); err != nil {
+		return nil, err
+	}
 	hash := objects.NewHash()
 
 	for i := startIndex; i < endIndex; i += 2 {
-		key := vm.stack[i]
-		value := vm.stack[i+1]
+		key := vm.stack[i].unwrap().Object()
+		value := vm.stack[i+1].unwrap().Object()
 
-		keyStr, err := vm.hashKey(key)
+		k, err := vm.hashKey(key)
 		if err != nil {
 			return nil, err
 		}
+		if _, ok := hash.Get(k); !ok {
+			if err := vm.Alloc(objects.KeySize(key)); err != nil {
+				return nil, err
+			}
+		}
 
-		hash.Set(keyStr, value)
+		hash.Set(k, key, value)
 	}
 
 	return hash, nil
 }
 
-func (vm *VM) hashKey(key objects.Object) (string, error) {
-	switch k := key.(type) {
-	case *objects.String:
-		return k.Value, nil
-	case *objects.Number:
-		return k.Inspect(), nil
-	case *objects.Bool:
-		return k.Inspect(), nil
-	default:
-		return "", vm.runtimeError(fmt.Sprintf("unusable as hash key: %s", key.Type()))
+func (vm *VM) hashKey(key objects.Object) (objects.HashKey, error) {
+	k, err := objects.HashKeyOf(vm, key)
+	if err != nil {
+		return k, vm.nativeError(err)
 	}
+	return k, nil
 }
 
-func (vm *VM) executeIndexExpression(left, index objects.Object) error {
-	switch {
-	case left.Type() == objects.TypeArray && index.Type() == objects.TypeNumber:
-		return vm.executeArrayIndex(left, index)
-	case left.Type() == objects.TypeHash:
-		return vm.executeHashIndex(left, index)
-	default:
-		return vm.runtimeError(fmt.Sprintf("index operator not supported: %s[%s]", left.Type(), index.Type()))
+func (vm *VM) executeIndexExpression(left objects.Object, index Value) error {
+	var result objects.Object
+	var err error
+	if array, ok := left.(*objects.Array); ok && index.isNumber() {
+		// Arrays are indexed without boxing the index
+		var i int
+		if i, err = objects.IntIndex(index.num); err == nil {
+			result, err = array.Get(i)
+		}
+	} else {
+		result, err = objects.Index(vm, left, index.Object())
 	}
-}
-
-func (vm *VM) executeArrayIndex(array, index objects.Object) error {
-	arrayObj := array.(*objects.Array)
-	idx := int(index.(*objects.Number).Value)
-
-	if idx < 0 || idx >= len(arrayObj.Elements) {
-		return vm.runtimeError("index out of bounds")
+	if err != nil {
+		return vm.nativeError(err)
 	}
-
-	return vm.push(arrayObj.Elements[idx])
+	return vm.push(result)
 }
 
-func (vm *VM) executeHashIndex(hash, index objects.Object) error {
-	hashObj := hash.(*objects.Hash)
-
-	key, err := vm.hashKey(index)
+func (vm *VM) executeSliceExpression(left, start, end objects.Object) error {
+	result, err := objects.Slice(left, start, end)
 	if err != nil {
-		return err
+		return vm.runtimeError(err.Error())
 	}
-
-	value, ok := hashObj.Get(key)
-	if !ok {
-		return vm.runtimeError(fmt.Sprintf("key '%s' not found in hash map", key))
+	if err := vm.Alloc(objects.SizeOf(result)); err != nil {
+		return err
 	}
-
-	return vm.push(value)
+	return vm.push(result)
 }
 
 func (vm *VM) executeSetIndexExpression(left, index, value objects.Object) error {
-	switch {
-	case left.Type() == objects.TypeArray && index.Type() == objects.TypeNumber:
-		return vm.executeArraySetIndex(left, index, value)
-	case left.Type() == objects.TypeHash:
-		return vm.executeHashSetIndex(left, index, value)
-	default:
-		return vm.runtimeError(fmt.Sprintf("index assignment not supported: %s[%s]", left.Type(), index.Type()))
+	if err := objects.SetIndex(vm, left, index, value); err != nil {
+		return vm.nativeError(err)
 	}
-}
-
-func (vm *VM) executeArraySetIndex(array, index, value objects.Object) error {
-	arrayObj := array.(*objects.Array)
-	idx := int(index.(*objects.Number).Value)
-
-	if idx < 0 || idx >= len(arrayObj.Elements) {
-		return vm.runtimeError(fmt.Sprintf("index out of bounds: %d", idx))
-	}
-
-	arrayObj.Elements[idx] = value
-	return vm.push(value)
-}
-
-func (vm *VM) executeHashSetIndex(hash, index, value objects.Object) error {
-	hashObj := hash.(*objects.Hash)
-
-	key, err := vm.hashKey(index)
-	if err != nil {
-		return err
-	}
-
-	hashObj.Set(key, value)
 	return vm.push(value)
 }
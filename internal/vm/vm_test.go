@@ -1,7 +1,9 @@
 package vm
 
 import (
+	"context"
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/harshagw/viri/internal/ast"
@@ -51,6 +53,27 @@ func TestIntegerArithmetic(t *testing.T) {
 				Operator: &token.Token{Type: token.STAR},
 			},
 		}, 25},
+		{&ast.ExprStmt{
+			Expr: &ast.BinaryExpr{
+				Left:     &ast.LiteralExpr{Value: -7},
+				Right:    &ast.LiteralExpr{Value: 3},
+				Operator: &token.Token{Type: token.PERCENT},
+			},
+		}, 2}, // Modulo takes the sign of the divisor
+		{&ast.ExprStmt{
+			Expr: &ast.BinaryExpr{
+				Left:     &ast.LiteralExpr{Value: -7},
+				Right:    &ast.LiteralExpr{Value: 2},
+				Operator: &token.Token{Type: token.TILDE_SLASH},
+			},
+		}, -4},
+		{&ast.ExprStmt{
+			Expr: &ast.BinaryExpr{
+				Left:     &ast.LiteralExpr{Value: 2},
+				Right:    &ast.LiteralExpr{Value: 10},
+				Operator: &token.Token{Type: token.STAR_STAR},
+			},
+		}, 1024},
 	}
 
 	runVmTests(t, tests)
@@ -310,13 +333,13 @@ func testExpectedObject(t *testing.T, expected interface{}, actual objects.Objec
 			t.Errorf("object is not Hash. got=%T (%+v)", actual, actual)
 			return
 		}
-		if len(hash.Pairs) != len(expected) {
+		if hash.Len() != len(expected) {
 			t.Errorf("wrong number of pairs. want=%d, got=%d",
-				len(expected), len(hash.Pairs))
+				len(expected), hash.Len())
 			return
 		}
 		for key, expectedVal := range expected {
-			val, ok := hash.Pairs[key]
+			val, ok := hash.Get(objects.StringKey(key))
 			if !ok {
 				t.Errorf("no value for key %q in hash", key)
 				continue
@@ -675,6 +698,21 @@ func TestStringExpressions(t *testing.T) {
 				Operator: &token.Token{Type: token.PLUS},
 			},
 		}, "3.14 is pi"},
+		// "Hello ${"Ana"}, ${1 + 2}"
+		{&ast.ExprStmt{
+			Expr: &ast.InterpolationExpr{
+				Parts: []ast.Expr{
+					&ast.LiteralExpr{Value: "Hello "},
+					&ast.LiteralExpr{Value: "Ana"},
+					&ast.LiteralExpr{Value: ", "},
+					&ast.BinaryExpr{
+						Left:     &ast.LiteralExpr{Value: 1},
+						Right:    &ast.LiteralExpr{Value: 2},
+						Operator: &token.Token{Type: token.PLUS},
+					},
+				},
+			},
+		}, "Hello Ana, 3"},
 	}
 
 	runVmTests(t, tests)
@@ -878,7 +916,7 @@ func TestIndexOutOfBoundsError(t *testing.T) {
 		t.Fatalf("expected error for out of bounds index, got none")
 	}
 
-	expected := "index out of bounds"
+	expected := "Index out of bounds."
 	if err.Error() != expected {
 		t.Fatalf("wrong error. want=%q, got=%q", expected, err.Error())
 	}
@@ -909,7 +947,7 @@ func TestHashKeyNotFoundError(t *testing.T) {
 		t.Fatalf("expected error for missing key, got none")
 	}
 
-	expected := "key 'missing' not found in hash map"
+	expected := "Key 'missing' not found in hash map."
 	if err.Error() != expected {
 		t.Fatalf("wrong error. want=%q, got=%q", expected, err.Error())
 	}
@@ -2624,6 +2662,72 @@ func TestClockNativeFunction(t *testing.T) {
 	}
 }
 
+func TestNativeRegistry(t *testing.T) {
+	// More natives than fit in a byte, then a variadic one
+	natives, err := objects.NewNativeRegistry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 300; i++ {
+		value := objects.NewNumber(float64(i))
+		natives.Register(&objects.NativeFunction{
+			Name:    fmt.Sprintf("n%d", i),
+			NumArgs: 0,
+			Fn:      func(rt objects.Runtime, args ...objects.Object) (objects.Object, error) { return value, nil },
+		})
+	}
+	natives.Register(&objects.NativeFunction{
+		Name:    "count",
+		NumArgs: -1,
+		Fn: func(rt objects.Runtime, args ...objects.Object) (objects.Object, error) {
+			return objects.NewNumber(float64(len(args))), nil
+		},
+	})
+
+	call := func(name string, args ...ast.Expr) ast.Stmt {
+		return &ast.ExprStmt{Expr: &ast.CallExpr{
+			Callee:    &ast.VariableExpr{Name: &token.Token{Type: token.IDENTIFIER, Lexeme: name}},
+			Arguments: args,
+		}}
+	}
+	run := func(stmt ast.Stmt) (objects.Object, error) {
+		comp := compiler.NewWithNatives(nil, natives)
+		if err := comp.Compile(stmt); err != nil {
+			return nil, err
+		}
+		machine := NewWithNatives(comp.Result(), natives)
+		if err := machine.RunProgram(); err != nil {
+			return nil, err
+		}
+		return machine.LastPoppedStackElem(), nil
+	}
+
+	tests := []struct {
+		input    ast.Stmt
+		expected int
+	}{
+		{call("n0"), 0},
+		{call("n299"), 299},
+		{call("count"), 0},
+		{call("count", &ast.LiteralExpr{Value: 1}, &ast.LiteralExpr{Value: "a"}), 2},
+	}
+	for _, tt := range tests {
+		result, err := run(tt.input)
+		if err != nil {
+			t.Fatalf("error: %s", err)
+		}
+		testExpectedObject(t, tt.expected, result)
+	}
+
+	if _, err := run(call("n1", &ast.LiteralExpr{Value: 1})); err == nil || !strings.Contains(err.Error(), "Expected 0 arguments but got 1.") {
+		t.Errorf("expected an arity error, got %v", err)
+	}
+	// The builtins are not part of this registry
+	if _, err := run(call("clock")); err == nil || !strings.Contains(err.Error(), "undefined variable clock") {
+		t.Errorf("expected clock to be undefined, got %v", err)
+	}
+}
+
 func TestClosures(t *testing.T) {
 	tests := []vmTestCase{
 		// Simple closure that captures a variable
@@ -5018,3 +5122,439 @@ func TestClassInheritFromNonClass(t *testing.T) {
 		t.Fatalf("expected error for inheriting from non-class, got none")
 	}
 }
+
+func TestTryCatch(t *testing.T) {
+	tests := []vmTestCase{
+		// try { [1][5]; } catch (e) { e.message; }
+		{&ast.TryStmt{
+			Keyword: &token.Token{Type: token.TRY},
+			Body: &ast.BlockStmt{
+				Statements: []ast.Stmt{
+					&ast.ExprStmt{
+						Expr: &ast.IndexExpr{
+							Object: &ast.ArrayLiteralExpr{Elements: []ast.Expr{&ast.LiteralExpr{Value: 1}}},
+							Index:  &ast.LiteralExpr{Value: 5},
+						},
+					},
+				},
+			},
+			CatchParam: &token.Token{Type: token.IDENTIFIER, Lexeme: "e"},
+			CatchBody: &ast.BlockStmt{
+				Statements: []ast.Stmt{
+					&ast.ExprStmt{
+						Expr: &ast.GetExpr{
+							Object: &ast.VariableExpr{Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "e"}},
+							Name:   &token.Token{Type: token.IDENTIFIER, Lexeme: "message"},
+						},
+					},
+				},
+			},
+		}, "Index out of bounds."},
+		// fun fail() { var x = 1; throw "boom"; } try { fail(); } catch (e) { e; }
+		{&ast.BlockStmt{
+			Statements: []ast.Stmt{
+				&ast.FunctionStmt{
+					Name:   &token.Token{Type: token.IDENTIFIER, Lexeme: "fail"},
+					Params: []*token.Token{},
+					Body: &ast.BlockStmt{
+						Statements: []ast.Stmt{
+							&ast.VarDeclStmt{
+								Name:        &token.Token{Type: token.IDENTIFIER, Lexeme: "x"},
+								Initializer: &ast.LiteralExpr{Value: 1},
+							},
+							&ast.ThrowStmt{
+								Keyword: &token.Token{Type: token.THROW},
+								Value:   &ast.LiteralExpr{Value: "boom"},
+							},
+						},
+					},
+				},
+				&ast.TryStmt{
+					Keyword: &token.Token{Type: token.TRY},
+					Body: &ast.BlockStmt{
+						Statements: []ast.Stmt{
+							&ast.ExprStmt{
+								Expr: &ast.CallExpr{
+									Callee:    &ast.VariableExpr{Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "fail"}},
+									Arguments: []ast.Expr{},
+								},
+							},
+						},
+					},
+					CatchParam: &token.Token{Type: token.IDENTIFIER, Lexeme: "e"},
+					CatchBody: &ast.BlockStmt{
+						Statements: []ast.Stmt{
+							&ast.ExprStmt{
+								Expr: &ast.VariableExpr{Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "e"}},
+							},
+						},
+					},
+				},
+			},
+		}, "boom"},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestTryFinallyRethrows(t *testing.T) {
+	// var cleaned = false; try { throw "boom"; } finally { cleaned = true; }
+	stmts := []ast.Stmt{
+		&ast.VarDeclStmt{
+			Name:        &token.Token{Type: token.IDENTIFIER, Lexeme: "cleaned"},
+			Initializer: &ast.LiteralExpr{Value: false},
+		},
+		&ast.TryStmt{
+			Keyword: &token.Token{Type: token.TRY},
+			Body: &ast.BlockStmt{
+				Statements: []ast.Stmt{
+					&ast.ThrowStmt{
+						Keyword: &token.Token{Type: token.THROW},
+						Value:   &ast.LiteralExpr{Value: "boom"},
+					},
+				},
+			},
+			FinallyBody: &ast.BlockStmt{
+				Statements: []ast.Stmt{
+					&ast.ExprStmt{
+						Expr: &ast.AssignExpr{
+							Name:  &token.Token{Type: token.IDENTIFIER, Lexeme: "cleaned"},
+							Value: &ast.LiteralExpr{Value: true},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	comp := compiler.New(nil)
+	for _, stmt := range stmts {
+		if err := comp.Compile(stmt); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+	}
+
+	vm := New(comp.Result())
+	err := vm.RunProgram()
+	if err == nil {
+		t.Fatalf("expected uncaught exception, got none")
+	}
+
+	expected := "Uncaught exception: boom"
+	if err.Error() != expected {
+		t.Fatalf("wrong error. want=%q, got=%q", expected, err.Error())
+	}
+
+	cleaned := vm.GetModuleGlobals(0)[0]
+	if err := testBooleanObject(true, cleaned); err != nil {
+		t.Fatalf("finally block did not run: %s", err)
+	}
+}
+
+func TestForInLoops(t *testing.T) {
+	tests := []vmTestCase{
+		// var total = 0; for (var k, v in {"a": 1, "b": 2}) total = total + v; total;
+		{&ast.BlockStmt{
+			Statements: []ast.Stmt{
+				&ast.VarDeclStmt{
+					Name:        &token.Token{Type: token.IDENTIFIER, Lexeme: "total"},
+					Initializer: &ast.LiteralExpr{Value: 0},
+				},
+				&ast.ForInStmt{
+					Keyword: &token.Token{Type: token.FOR},
+					Variables: []*token.Token{
+						{Type: token.IDENTIFIER, Lexeme: "k"},
+						{Type: token.IDENTIFIER, Lexeme: "v"},
+					},
+					Iterable: &ast.HashLiteralExpr{Pairs: []ast.HashPair{
+						{Key: &ast.LiteralExpr{Value: "a"}, Value: &ast.LiteralExpr{Value: 1}},
+						{Key: &ast.LiteralExpr{Value: "b"}, Value: &ast.LiteralExpr{Value: 2}},
+					}},
+					Body: &ast.ExprStmt{
+						Expr: &ast.AssignExpr{
+							Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "total"},
+							Value: &ast.BinaryExpr{
+								Left:     &ast.VariableExpr{Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "total"}},
+								Operator: &token.Token{Type: token.PLUS},
+								Right:    &ast.VariableExpr{Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "v"}},
+							},
+						},
+					},
+				},
+				&ast.ExprStmt{Expr: &ast.VariableExpr{Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "total"}}},
+			},
+		}, 3},
+		// var s = ""; for (var c in "abc") s = c + s; s;
+		{&ast.BlockStmt{
+			Statements: []ast.Stmt{
+				&ast.VarDeclStmt{
+					Name:        &token.Token{Type: token.IDENTIFIER, Lexeme: "s"},
+					Initializer: &ast.LiteralExpr{Value: ""},
+				},
+				&ast.ForInStmt{
+					Keyword:   &token.Token{Type: token.FOR},
+					Variables: []*token.Token{{Type: token.IDENTIFIER, Lexeme: "c"}},
+					Iterable:  &ast.LiteralExpr{Value: "abc"},
+					Body: &ast.ExprStmt{
+						Expr: &ast.AssignExpr{
+							Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "s"},
+							Value: &ast.BinaryExpr{
+								Left:     &ast.VariableExpr{Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "c"}},
+								Operator: &token.Token{Type: token.PLUS},
+								Right:    &ast.VariableExpr{Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "s"}},
+							},
+						},
+					},
+				},
+				&ast.ExprStmt{Expr: &ast.VariableExpr{Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "s"}}},
+			},
+		}, "cba"},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestForInUserIterator(t *testing.T) {
+	nTok := &token.Token{Type: token.IDENTIFIER, Lexeme: "n"}
+	thisN := func() ast.Expr {
+		return &ast.GetExpr{Object: &ast.ThisExpr{Keyword: &token.Token{Type: token.THIS, Lexeme: "this"}}, Name: nTok}
+	}
+
+	// class Countdown {
+	//   hasNext() { return this.n; }
+	//   next() { this.n = this.n - 1; return this.n; }
+	// }
+	// var c = Countdown(); c.n = 3;
+	// var total = 0; for (var x in c) total = total + x; total;
+	tests := []vmTestCase{
+		{&ast.BlockStmt{
+			Statements: []ast.Stmt{
+				&ast.ClassStmt{
+					Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "Countdown"},
+					Methods: []*ast.FunctionStmt{
+						{
+							Name:   &token.Token{Type: token.IDENTIFIER, Lexeme: "hasNext"},
+							Params: []*token.Token{},
+							Body: &ast.BlockStmt{Statements: []ast.Stmt{
+								&ast.ReturnStmt{Keyword: &token.Token{Type: token.RETURN}, Value: thisN()},
+							}},
+						},
+						{
+							Name:   &token.Token{Type: token.IDENTIFIER, Lexeme: "next"},
+							Params: []*token.Token{},
+							Body: &ast.BlockStmt{Statements: []ast.Stmt{
+								&ast.ExprStmt{Expr: &ast.SetExpr{
+									Object: &ast.ThisExpr{Keyword: &token.Token{Type: token.THIS, Lexeme: "this"}},
+									Name:   nTok,
+									Value: &ast.BinaryExpr{
+										Left:     thisN(),
+										Operator: &token.Token{Type: token.MINUS},
+										Right:    &ast.LiteralExpr{Value: 1},
+									},
+								}},
+								&ast.ReturnStmt{Keyword: &token.Token{Type: token.RETURN}, Value: thisN()},
+							}},
+						},
+					},
+				},
+				&ast.VarDeclStmt{
+					Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "c"},
+					Initializer: &ast.CallExpr{
+						Callee:    &ast.VariableExpr{Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "Countdown"}},
+						Arguments: []ast.Expr{},
+					},
+				},
+				&ast.ExprStmt{Expr: &ast.SetExpr{
+					Object: &ast.VariableExpr{Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "c"}},
+					Name:   nTok,
+					Value:  &ast.LiteralExpr{Value: 3},
+				}},
+				&ast.VarDeclStmt{
+					Name:        &token.Token{Type: token.IDENTIFIER, Lexeme: "total"},
+					Initializer: &ast.LiteralExpr{Value: 0},
+				},
+				&ast.ForInStmt{
+					Keyword:   &token.Token{Type: token.FOR},
+					Variables: []*token.Token{{Type: token.IDENTIFIER, Lexeme: "x"}},
+					Iterable:  &ast.VariableExpr{Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "c"}},
+					Body: &ast.ExprStmt{
+						Expr: &ast.AssignExpr{
+							Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "total"},
+							Value: &ast.BinaryExpr{
+								Left:     &ast.VariableExpr{Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "total"}},
+								Operator: &token.Token{Type: token.PLUS},
+								Right:    &ast.VariableExpr{Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "x"}},
+							},
+						},
+					},
+				},
+				&ast.ExprStmt{Expr: &ast.VariableExpr{Name: &token.Token{Type: token.IDENTIFIER, Lexeme: "total"}}},
+			},
+		}, 3},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestRuntimeErrorStackTrace(t *testing.T) {
+	// fun fail() {
+	//   return nil - 1;
+	// }
+	// fail();
+	failTok := &token.Token{Type: token.IDENTIFIER, Lexeme: "fail", Line: 1}
+	input := &ast.BlockStmt{
+		Statements: []ast.Stmt{
+			&ast.FunctionStmt{
+				Name:   failTok,
+				Params: []*token.Token{},
+				Body: &ast.BlockStmt{
+					Statements: []ast.Stmt{
+						&ast.ReturnStmt{
+							Keyword: &token.Token{Type: token.RETURN, Line: 2},
+							Value: &ast.BinaryExpr{
+								Left:     &ast.LiteralExpr{Value: nil},
+								Operator: &token.Token{Type: token.MINUS, Line: 2, Column: 14},
+								Right:    &ast.LiteralExpr{Value: 1},
+							},
+						},
+					},
+				},
+			},
+			&ast.ExprStmt{
+				Expr: &ast.CallExpr{
+					Callee:       &ast.VariableExpr{Name: failTok},
+					ClosingParen: &token.Token{Type: token.RIGHT_PAREN, Line: 4},
+					Arguments:    []ast.Expr{},
+				},
+			},
+		},
+	}
+
+	comp := compiler.New(nil)
+	if err := comp.Compile(input); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	err := New(comp.Result()).RunProgram()
+	rtErr, ok := err.(*objects.VMRuntimeError)
+	if !ok {
+		t.Fatalf("expected VMRuntimeError, got %T (%v)", err, err)
+	}
+
+	// The error points at the operator, not at the last operand compiled
+	if rtErr.Line != 2 || rtErr.Column != 14 {
+		t.Errorf("error at %d:%d, want 2:14", rtErr.Line, rtErr.Column)
+	}
+
+	want := []objects.StackFrame{
+		{Function: "<script>", Line: 4},
+		{Function: "fail", Line: 2},
+	}
+	if len(rtErr.Trace) != len(want) {
+		t.Fatalf("trace has %d frames, want %d: %v", len(rtErr.Trace), len(want), rtErr.Trace)
+	}
+	for i, frame := range want {
+		if rtErr.Trace[i] != frame {
+			t.Errorf("frame %d = %+v, want %+v", i, rtErr.Trace[i], frame)
+		}
+	}
+}
+
+func TestExecutionLimits(t *testing.T) {
+	// try { while (true) {} } catch (e) {}
+	spin := &ast.TryStmt{
+		Keyword: &token.Token{Type: token.TRY},
+		Body: &ast.BlockStmt{
+			Statements: []ast.Stmt{
+				&ast.WhileStmt{
+					Condition: &ast.LiteralExpr{Value: true},
+					Body:      &ast.BlockStmt{},
+				},
+			},
+		},
+		CatchParam: &token.Token{Type: token.IDENTIFIER, Lexeme: "e"},
+		CatchBody:  &ast.BlockStmt{},
+	}
+	// fun f() { return f(); } f();
+	fTok := &token.Token{Type: token.IDENTIFIER, Lexeme: "f"}
+	callF := &ast.CallExpr{Callee: &ast.VariableExpr{Name: fTok}, Arguments: []ast.Expr{}}
+	recurse := &ast.BlockStmt{
+		Statements: []ast.Stmt{
+			&ast.FunctionStmt{
+				Name:   fTok,
+				Params: []*token.Token{},
+				Body: &ast.BlockStmt{
+					Statements: []ast.Stmt{&ast.ReturnStmt{Keyword: &token.Token{Type: token.RETURN}, Value: callF}},
+				},
+			},
+			&ast.ExprStmt{Expr: callF},
+		},
+	}
+
+	compile := func(stmt ast.Stmt) *VM {
+		comp := compiler.New(nil)
+		if err := comp.Compile(stmt); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		return New(comp.Result())
+	}
+
+	machine := compile(spin)
+	machine.SetLimits(objects.Limits{MaxSteps: 5000})
+	err := machine.RunProgram()
+	if stepErr, ok := err.(*objects.StepLimitError); !ok || stepErr.Limit != 5000 {
+		t.Errorf("expected a step limit error, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = compile(spin).RunProgramContext(ctx)
+	if cancelErr, ok := err.(*objects.CanceledError); !ok || cancelErr.Err != context.Canceled {
+		t.Errorf("expected a canceled error, got %v", err)
+	}
+
+	machine = compile(recurse)
+	machine.SetLimits(objects.Limits{MaxCallDepth: 100})
+	err = machine.RunProgram()
+	if depthErr, ok := err.(*objects.CallDepthError); !ok || depthErr.Limit != 100 {
+		t.Errorf("expected a call depth error, got %v", err)
+	}
+	// Without a limit the frames available still bound the depth
+	err = compile(recurse).RunProgram()
+	if depthErr, ok := err.(*objects.CallDepthError); !ok || depthErr.Limit != MaxFrames-1 {
+		t.Errorf("expected a call depth error, got %v", err)
+	}
+}
+
+func TestMemoryStats(t *testing.T) {
+	// {"a": [1, 2], "b": "x" + "y"}
+	input := &ast.ExprStmt{Expr: &ast.HashLiteralExpr{
+		Pairs: []ast.HashPair{
+			{Key: &ast.LiteralExpr{Value: "a"}, Value: &ast.ArrayLiteralExpr{
+				Elements: []ast.Expr{&ast.LiteralExpr{Value: 1}, &ast.LiteralExpr{Value: 2}},
+			}},
+			{Key: &ast.LiteralExpr{Value: "b"}, Value: &ast.BinaryExpr{
+				Left:     &ast.LiteralExpr{Value: "x"},
+				Operator: &token.Token{Type: token.PLUS},
+				Right:    &ast.LiteralExpr{Value: "y"},
+			}},
+		},
+	}}
+
+	comp := compiler.New(nil)
+	if err := comp.Compile(input); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	machine := New(comp.Result())
+	if err := machine.RunProgram(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	want := objects.MemoryStats{
+		Allocations: 5,
+		Bytes:       objects.ArraySize(2) + objects.StringSize("xy") + objects.HashSize + 2*objects.EntrySize("a"),
+	}
+	if stats := machine.MemoryStats(); stats != want {
+		t.Errorf("MemoryStats() = %+v, want %+v", stats, want)
+	}
+}
@@ -0,0 +1,185 @@
+package viri
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/harshagw/viri/internal/objects"
+)
+
+// Diagnostic is an error or warning found in a program before it runs.
+type Diagnostic struct {
+	File    string
+	Line    int
+	Column  int
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	if d.File == "" {
+		return fmt.Sprintf("%d:%d: %s", d.Line, d.Column, d.Message)
+	}
+	return fmt.Sprintf("%s:%d:%d: %s", d.File, d.Line, d.Column, d.Message)
+}
+
+// CompileError is returned when a program cannot be compiled, because of
+// syntax errors or a module that cannot be loaded.
+type CompileError struct {
+	Diagnostics []Diagnostic // empty when Err is not about the source
+	Err         error
+}
+
+func (e *CompileError) Error() string {
+	if len(e.Diagnostics) == 0 {
+		return e.Err.Error()
+	}
+	msg := e.Diagnostics[0].String()
+	if n := len(e.Diagnostics) - 1; n == 1 {
+		msg += " (and 1 more error)"
+	} else if n > 1 {
+		msg += fmt.Sprintf(" (and %d more errors)", n)
+	}
+	return msg
+}
+
+func (e *CompileError) Unwrap() error {
+	return e.Err
+}
+
+// Frame is one entry in the stack trace of a runtime error.
+type Frame struct {
+	Function string // function name, "<script>" for top-level code
+	File     string
+	Line     int
+}
+
+// RuntimeError is an error raised, and not caught, while a program runs.
+type RuntimeError struct {
+	Message string
+	File    string
+	Line    int // 0 when the position is unknown
+	Column  int
+	Trace   []Frame // active calls when the error was raised, outermost first
+	Err     error   // cause, such as ErrAllocationLimit; nil for other errors
+}
+
+func (e *RuntimeError) Error() string {
+	var b strings.Builder
+	if e.File != "" {
+		b.WriteString(e.File + ":")
+	}
+	if e.Line > 0 {
+		fmt.Fprintf(&b, "%d:%d: ", e.Line, e.Column)
+	} else if b.Len() > 0 {
+		b.WriteString(" ")
+	}
+	b.WriteString(e.Message)
+	return b.String()
+}
+
+func (e *RuntimeError) Unwrap() error {
+	return e.Err
+}
+
+// StepLimitError is returned when a program takes more steps than
+// Limits.MaxSteps allows.
+type StepLimitError struct {
+	Limit int64
+}
+
+func (e *StepLimitError) Error() string {
+	return fmt.Sprintf("step limit of %d exceeded", e.Limit)
+}
+
+// TimeoutError is returned when a program runs for longer than
+// Limits.Timeout allows. It matches context.DeadlineExceeded.
+type TimeoutError struct {
+	Timeout time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("timed out after %s", e.Timeout)
+}
+
+func (e *TimeoutError) Unwrap() error { return context.DeadlineExceeded }
+
+// CallDepthError is returned when a program nests more calls than
+// Limits.MaxCallDepth allows.
+type CallDepthError struct {
+	Limit int
+}
+
+func (e *CallDepthError) Error() string {
+	return fmt.Sprintf("maximum call depth of %d exceeded", e.Limit)
+}
+
+// CanceledError is returned when the context given to RunContext or
+// CallContext is done. It wraps the context's error.
+type CanceledError struct {
+	Err error
+}
+
+func (e *CanceledError) Error() string { return "execution canceled: " + e.Err.Error() }
+func (e *CanceledError) Unwrap() error { return e.Err }
+
+func compileError(diagnostics *objects.DiagnosticCollector, err error) *CompileError {
+	return &CompileError{Diagnostics: toDiagnostics(diagnostics.Errors), Err: err}
+}
+
+func toDiagnostics(diagnostics []objects.Diagnostic) []Diagnostic {
+	result := make([]Diagnostic, len(diagnostics))
+	for i, d := range diagnostics {
+		result[i] = Diagnostic{Line: d.Token.Line, Column: d.Token.Column, Message: d.Message}
+		if d.Token.FilePath != nil {
+			result[i].File = *d.Token.FilePath
+		}
+	}
+	return result
+}
+
+// toError converts the errors of both engines to a *RuntimeError, or to
+// one of the limit errors.
+func toError(err error) error {
+	switch err := err.(type) {
+	case nil:
+		return nil
+	case *objects.StepLimitError:
+		return &StepLimitError{Limit: err.Limit}
+	case *objects.TimeoutError:
+		return &TimeoutError{Timeout: err.Timeout}
+	case *objects.CallDepthError:
+		return &CallDepthError{Limit: err.Limit}
+	case *objects.CanceledError:
+		return &CanceledError{Err: err.Err}
+	case *objects.VMRuntimeError:
+		return &RuntimeError{
+			Message: err.Message,
+			File:    err.FilePath,
+			Line:    err.Line,
+			Column:  err.Column,
+			Trace:   toFrames(err.Trace),
+			Err:     err.Err,
+		}
+	case *objects.RuntimeError:
+		rtErr := &RuntimeError{Message: err.Message, Trace: toFrames(err.Trace), Err: err.Err}
+		if err.Token != nil {
+			rtErr.Line, rtErr.Column = err.Token.Line, err.Token.Column
+			if err.Token.FilePath != nil {
+				rtErr.File = *err.Token.FilePath
+			}
+		}
+		return rtErr
+	default:
+		return &RuntimeError{Message: err.Error()}
+	}
+}
+
+func toFrames(trace []objects.StackFrame) []Frame {
+	frames := make([]Frame, len(trace))
+	for i, frame := range trace {
+		frames[i] = Frame{Function: frame.Function, File: frame.FilePath, Line: frame.Line}
+	}
+	return frames
+}
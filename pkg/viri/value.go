@@ -0,0 +1,322 @@
+package viri
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/harshagw/viri/internal/objects"
+)
+
+var errStaleValue = errors.New("functions and objects cannot be used outside the program run that made them")
+
+// Kind is the type of a Value.
+type Kind int
+
+const (
+	KindNil Kind = iota
+	KindBool
+	KindNumber
+	KindString
+	KindArray
+	KindMap
+	KindFunction // functions, methods and classes
+	KindObject   // instances, modules and errors
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindNil:
+		return "nil"
+	case KindBool:
+		return "bool"
+	case KindNumber:
+		return "number"
+	case KindString:
+		return "string"
+	case KindArray:
+		return "array"
+	case KindMap:
+		return "map"
+	case KindFunction:
+		return "function"
+	case KindObject:
+		return "object"
+	}
+	return "unknown kind"
+}
+
+// Value is a Viri value. Its zero value is nil. Values can be passed back
+// to Set and Call, except that functions and objects, or arrays and maps
+// holding them, belong to the program run that made them: they can only be
+// passed to Call before the next run.
+type Value struct {
+	obj objects.Object
+	run int // the run the value came from
+}
+
+func (v Value) Kind() Kind {
+	switch v.obj.(type) {
+	case nil, *objects.Nil:
+		return KindNil
+	case *objects.Bool:
+		return KindBool
+	case *objects.Number:
+		return KindNumber
+	case *objects.String:
+		return KindString
+	case *objects.Array:
+		return KindArray
+	case *objects.Hash:
+		return KindMap
+	case objects.Callable, *objects.Closure, *objects.CompiledClass, *objects.BoundMethod:
+		return KindFunction
+	default:
+		return KindObject
+	}
+}
+
+func (v Value) IsNil() bool {
+	return v.Kind() == KindNil
+}
+
+// Truthy reports whether the value counts as true in a condition.
+func (v Value) Truthy() bool {
+	return objects.IsTruthy(v.obj)
+}
+
+func (v Value) AsBool() (bool, bool) {
+	b, ok := v.obj.(*objects.Bool)
+	if !ok {
+		return false, false
+	}
+	return b.Value, true
+}
+
+func (v Value) AsFloat() (float64, bool) {
+	n, ok := v.obj.(*objects.Number)
+	if !ok {
+		return 0, false
+	}
+	return n.Value, true
+}
+
+// AsInt returns a number that is a whole number within the range of int.
+func (v Value) AsInt() (int, bool) {
+	f, ok := v.AsFloat()
+	if !ok || f != float64(int(f)) {
+		return 0, false
+	}
+	return int(f), true
+}
+
+func (v Value) AsString() (string, bool) {
+	s, ok := v.obj.(*objects.String)
+	if !ok {
+		return "", false
+	}
+	return s.Value, true
+}
+
+func (v Value) AsArray() ([]Value, bool) {
+	arr, ok := v.obj.(*objects.Array)
+	if !ok {
+		return nil, false
+	}
+	values := make([]Value, len(arr.Elements))
+	for i, elem := range arr.Elements {
+		values[i] = Value{obj: elem, run: v.run}
+	}
+	return values, true
+}
+
+// AsMap returns the entries of a hash. Keys that are not strings are
+// converted to the form print shows them in. It returns false if two keys
+// convert to the same string, such as 1 and "1"; AsEntries keeps them apart.
+func (v Value) AsMap() (map[string]Value, bool) {
+	hash, ok := v.obj.(*objects.Hash)
+	if !ok {
+		return nil, false
+	}
+	values := make(map[string]Value, hash.Len())
+	for _, entry := range hash.Entries() {
+		key := mapKey(entry.Key)
+		if _, ok := values[key]; ok {
+			return nil, false
+		}
+		values[key] = Value{obj: entry.Value, run: v.run}
+	}
+	return values, true
+}
+
+// Entry is a key and its value in a hash.
+type Entry struct {
+	Key   Value
+	Value Value
+}
+
+// AsEntries returns the entries of a hash in insertion order, with keys
+// of the types the program used.
+func (v Value) AsEntries() ([]Entry, bool) {
+	hash, ok := v.obj.(*objects.Hash)
+	if !ok {
+		return nil, false
+	}
+	entries := make([]Entry, 0, hash.Len())
+	for _, entry := range hash.Entries() {
+		entries = append(entries, Entry{
+			Key:   Value{obj: entry.Key, run: v.run},
+			Value: Value{obj: entry.Value, run: v.run},
+		})
+	}
+	return entries, true
+}
+
+// Interface returns the value as nil, bool, float64, string,
+// []interface{} or map[string]interface{}, converting hash keys as AsMap
+// does. Functions and objects are returned as a Value, as are hashes whose
+// keys AsMap cannot convert.
+func (v Value) Interface() interface{} {
+	switch obj := v.obj.(type) {
+	case nil, *objects.Nil:
+		return nil
+	case *objects.Bool:
+		return obj.Value
+	case *objects.Number:
+		return obj.Value
+	case *objects.String:
+		return obj.Value
+	case *objects.Array:
+		values := make([]interface{}, len(obj.Elements))
+		for i, elem := range obj.Elements {
+			values[i] = Value{obj: elem, run: v.run}.Interface()
+		}
+		return values
+	case *objects.Hash:
+		entries, ok := v.AsMap()
+		if !ok {
+			return v
+		}
+		values := make(map[string]interface{}, len(entries))
+		for key, value := range entries {
+			values[key] = value.Interface()
+		}
+		return values
+	default:
+		return v
+	}
+}
+
+// String returns the value as print would show it.
+func (v Value) String() string {
+	return objects.Stringify(v.obj)
+}
+
+// toObject converts a Go value to a Viri value for use in the given run.
+func toObject(value interface{}, run int) (objects.Object, error) {
+	switch v := value.(type) {
+	case nil:
+		return objects.NilValue, nil
+	case Value:
+		if v.obj == nil {
+			return objects.NilValue, nil
+		}
+		if v.run != run && holdsCode(v.obj, map[objects.Object]bool{}) {
+			return nil, errStaleValue
+		}
+		return v.obj, nil
+	case bool:
+		return objects.NewBool(v), nil
+	case string:
+		return objects.NewString(v), nil
+	case float64:
+		return objects.NewNumber(v), nil
+	case int:
+		return objects.NewNumber(float64(v)), nil
+	}
+
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return objects.NewNumber(float64(rv.Int())), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return objects.NewNumber(float64(rv.Uint())), nil
+	case reflect.Float32, reflect.Float64:
+		return objects.NewNumber(rv.Float()), nil
+	case reflect.Bool:
+		return objects.NewBool(rv.Bool()), nil
+	case reflect.String:
+		return objects.NewString(rv.String()), nil
+	case reflect.Slice, reflect.Array:
+		elements := make([]objects.Object, rv.Len())
+		for i := range elements {
+			elem, err := toObject(rv.Index(i).Interface(), run)
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = elem
+		}
+		return objects.NewArray(elements), nil
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("unsupported map key type %s", rv.Type().Key())
+		}
+		// Go maps are unordered, so keys are set in sorted order
+		keys := rv.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+		hash := objects.NewHash()
+		for _, key := range keys {
+			elem, err := toObject(rv.MapIndex(key).Interface(), run)
+			if err != nil {
+				return nil, err
+			}
+			hash.Set(objects.StringKey(key.String()), objects.NewString(key.String()), elem)
+		}
+		return hash, nil
+	case reflect.Pointer, reflect.Interface:
+		if rv.IsNil() {
+			return objects.NilValue, nil
+		}
+		return toObject(rv.Elem().Interface(), run)
+	}
+	return nil, fmt.Errorf("unsupported type %T", value)
+}
+
+// mapKey returns the Go map key for a hash key.
+func mapKey(key objects.Object) string {
+	if s, ok := key.(*objects.String); ok {
+		return s.Value
+	}
+	return key.Inspect()
+}
+
+// holdsCode reports whether obj is, or contains, a value other than nil, a
+// bool, a number or a string.
+func holdsCode(obj objects.Object, seen map[objects.Object]bool) bool {
+	if seen[obj] {
+		return false
+	}
+	seen[obj] = true
+
+	switch obj := obj.(type) {
+	case *objects.Nil, *objects.Bool, *objects.Number, *objects.String:
+		return false
+	case *objects.Array:
+		for _, elem := range obj.Elements {
+			if holdsCode(elem, seen) {
+				return true
+			}
+		}
+		return false
+	case *objects.Hash:
+		for _, entry := range obj.Entries() {
+			if holdsCode(entry.Key, seen) || holdsCode(entry.Value, seen) {
+				return true
+			}
+		}
+		return false
+	default:
+		return true
+	}
+}
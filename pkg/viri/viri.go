@@ -0,0 +1,405 @@
+// Package viri embeds the Viri language in Go programs.
+//
+// A Runtime compiles and runs programs on either the tree-walking
+// interpreter or the bytecode VM. Globals can be set from Go before a
+// program runs, read back after it has run, and functions it defines can be
+// called with Go values:
+//
+//	rt := viri.New(&viri.Config{Engine: viri.VM})
+//	rt.Set("name", "world")
+//	if err := rt.RunString(`fun greet(greeting) { return greeting + ", " + name; }`); err != nil {
+//		return err
+//	}
+//	v, err := rt.Call("greet", "hello")
+//	s, _ := v.AsString() // "hello, world"
+//
+// Errors are returned as *CompileError or *RuntimeError values rather than
+// printed. Config.Limits bounds the steps, time and call depth of untrusted
+// programs, and RunContext and CallContext stop them when a context is done.
+// A Runtime is not safe for concurrent use.
+package viri
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/harshagw/viri/internal/ast"
+	"github.com/harshagw/viri/internal/compiler"
+	"github.com/harshagw/viri/internal/interp"
+	"github.com/harshagw/viri/internal/objects"
+	"github.com/harshagw/viri/internal/parser"
+	"github.com/harshagw/viri/internal/vm"
+)
+
+// Engine selects how programs are run.
+type Engine string
+
+const (
+	Interpreter Engine = "interpreter" // walks the syntax tree
+	VM          Engine = "vm"          // compiles to bytecode for the virtual machine
+)
+
+// StringPath is the file name given to programs run from a string, used in
+// errors. Their imports are resolved from the root of Config.FS, or from the
+// working directory.
+const StringPath = "<string>"
+
+var (
+	ErrUndefined = errors.New("undefined global")
+	ErrNotRun    = errors.New("no program has run")
+	// ErrAllocationLimit matches the *RuntimeError raised when a program
+	// allocates more than Limits.MaxAllocatedBytes.
+	ErrAllocationLimit = objects.ErrAllocationLimit
+)
+
+type Config struct {
+	Engine     Engine    // Interpreter when empty
+	Stdout     io.Writer // where print writes, os.Stdout when nil
+	FS         fs.FS     // modules are read from FS rather than the operating system when set
+	NoBuiltins bool      // leave out builtins such as len and clock, for sandboxing
+	Limits     Limits    // bounds every Run and Call
+}
+
+// Limits bounds the resources a program may use. Each Run and Call gets the
+// full limits. A zero field means no limit, except for MaxCallDepth.
+type Limits struct {
+	// MaxSteps is the number of steps a run may take: bytecode instructions
+	// on the VM, statements and expressions evaluated by the interpreter.
+	// Exceeding it returns a *StepLimitError.
+	MaxSteps int64
+	// Timeout is the wall-clock time a run may take. Exceeding it returns
+	// a *TimeoutError.
+	Timeout time.Duration
+	// MaxCallDepth is the number of nested calls a run may make, 1023 when
+	// zero. Exceeding it returns a *CallDepthError. The VM allows at most
+	// 1023 whatever the limit.
+	MaxCallDepth int
+	// MaxAllocatedBytes is the estimated number of bytes a run may allocate
+	// for arrays, hashes, strings and instances, counting every allocation
+	// the run makes rather than the memory in use at any time. Exceeding
+	// it raises a runtime error the program can catch, and which matches
+	// ErrAllocationLimit if it is not caught.
+	MaxAllocatedBytes int64
+}
+
+// Function is a Go function that programs can call like a builtin.
+type Function struct {
+	Name  string
+	Arity int // number of arguments, -1 for any number
+	Doc   string
+	Fn    func(args []Value) (interface{}, error)
+}
+
+// Runtime compiles and runs Viri programs, keeping the globals of the last
+// program run for Get and Call.
+type Runtime struct {
+	config  Config
+	globals map[string]objects.Object // set by the host
+	natives *objects.NativeRegistry
+	runs    int // number of programs run, numbering their values
+
+	// State of the last program run
+	program     *Program
+	machine     *vm.VM
+	interpreter *interp.Interpreter
+	environment *objects.Environment
+}
+
+// Program is a compiled program, ready to be run by the runtime that
+// compiled it.
+type Program struct {
+	runtime  *Runtime
+	warnings []Diagnostic
+
+	// Interpreter programs
+	module   *ast.Module
+	locals   map[ast.Expr]int
+	resolved map[string]*ast.Module
+	loader   parser.ModuleLoader
+
+	natives *objects.NativeRegistry // the natives when compiled
+
+	// VM programs
+	compiled    *objects.CompiledProgram
+	hostGlobals []string       // host globals, in their global slots
+	entry       map[string]int // entry module global slots
+}
+
+// Warnings returns the warnings found while compiling the program, such as
+// unused variables.
+func (p *Program) Warnings() []Diagnostic {
+	return p.warnings
+}
+
+func New(config *Config) *Runtime {
+	r := &Runtime{globals: make(map[string]objects.Object)}
+	if config != nil {
+		r.config = *config
+	}
+	if r.config.Engine == "" {
+		r.config.Engine = Interpreter
+	}
+	if r.config.Stdout == nil {
+		r.config.Stdout = os.Stdout
+	}
+	if r.config.NoBuiltins {
+		r.natives, _ = objects.NewNativeRegistry()
+	} else {
+		r.natives = objects.DefaultNatives()
+	}
+	return r
+}
+
+// Register adds a Go function for the programs compiled afterwards to call.
+// Its arguments and result are converted as for Call.
+func (r *Runtime) Register(fn Function) error {
+	if fn.Fn == nil {
+		return fmt.Errorf("function %s has no implementation", fn.Name)
+	}
+	return r.natives.Register(&objects.NativeFunction{
+		Name:    fn.Name,
+		NumArgs: fn.Arity,
+		Doc:     fn.Doc,
+		Fn: func(_ objects.Runtime, args ...objects.Object) (objects.Object, error) {
+			values := make([]Value, len(args))
+			for i, arg := range args {
+				values[i] = Value{obj: arg, run: r.runs}
+			}
+			result, err := fn.Fn(values)
+			if err != nil {
+				return nil, err
+			}
+			return toObject(result, r.runs)
+		},
+	})
+}
+
+// Set defines a global for the programs compiled afterwards, converting
+// value as described for Call.
+func (r *Runtime) Set(name string, value interface{}) error {
+	// Values from no run at all can only hold data
+	obj, err := toObject(value, 0)
+	if err != nil {
+		return fmt.Errorf("cannot set %s: %w", name, err)
+	}
+	r.globals[name] = obj
+	return nil
+}
+
+// CompileString compiles a program from source, naming it StringPath.
+func (r *Runtime) CompileString(src string) (*Program, error) {
+	return r.compile(stringLoader{ModuleLoader: r.loader(), src: []byte(src)}, StringPath)
+}
+
+// CompileFile compiles the program at path, read from Config.FS when set.
+func (r *Runtime) CompileFile(path string) (*Program, error) {
+	return r.compile(r.loader(), path)
+}
+
+// RunString compiles and runs a program from source.
+func (r *Runtime) RunString(src string) error {
+	program, err := r.CompileString(src)
+	if err != nil {
+		return err
+	}
+	return r.Run(program)
+}
+
+// RunFile compiles and runs the program at path.
+func (r *Runtime) RunFile(path string) error {
+	program, err := r.CompileFile(path)
+	if err != nil {
+		return err
+	}
+	return r.Run(program)
+}
+
+func (r *Runtime) loader() parser.ModuleLoader {
+	if r.config.FS != nil {
+		return parser.FSLoader{FS: r.config.FS}
+	}
+	return parser.FileLoader{}
+}
+
+func (r *Runtime) compile(loader parser.ModuleLoader, path string) (*Program, error) {
+	diagnostics := &objects.DiagnosticCollector{}
+	natives, err := objects.NewNativeRegistry(r.natives.Functions()...)
+	if err != nil {
+		return nil, err
+	}
+	program := &Program{runtime: r, natives: natives}
+
+	switch r.config.Engine {
+	case Interpreter:
+		mod, err := parser.LoadModule(loader, path, diagnostics)
+		if err != nil || len(diagnostics.Errors) > 0 {
+			return nil, compileError(diagnostics, err)
+		}
+		res := parser.NewResolver(diagnostics)
+		res.SetLoader(loader)
+		locals, err := res.Resolve(mod)
+		if err != nil || len(diagnostics.Errors) > 0 {
+			return nil, compileError(diagnostics, err)
+		}
+		program.module = mod
+		program.locals = locals
+		program.resolved = res.GetResolvedModules()
+		program.loader = loader
+	case VM:
+		program.hostGlobals = make([]string, 0, len(r.globals))
+		for name := range r.globals {
+			program.hostGlobals = append(program.hostGlobals, name)
+		}
+		sort.Strings(program.hostGlobals)
+
+		comp := compiler.NewWithNatives(diagnostics, natives)
+		comp.SetLoader(loader)
+		comp.SetHostGlobals(program.hostGlobals)
+		compiled, err := comp.CompileProgram(path)
+		if err != nil || len(diagnostics.Errors) > 0 {
+			return nil, compileError(diagnostics, err)
+		}
+		program.compiled = compiled
+		program.entry = comp.EntryGlobals()
+	default:
+		return nil, fmt.Errorf("unknown engine %q", r.config.Engine)
+	}
+
+	program.warnings = toDiagnostics(diagnostics.Warnings)
+	return program, nil
+}
+
+// Run runs a program compiled by this runtime, replacing the globals of the
+// last program run.
+func (r *Runtime) Run(program *Program) error {
+	return r.RunContext(context.Background(), program)
+}
+
+// RunContext is like Run but stops the program with a *CanceledError once
+// ctx is done.
+func (r *Runtime) RunContext(ctx context.Context, program *Program) error {
+	if program.runtime != r {
+		return errors.New("program was compiled by another runtime")
+	}
+	r.program = program
+	r.machine, r.interpreter, r.environment = nil, nil, nil
+	r.runs++
+
+	if program.compiled != nil {
+		r.machine = vm.NewWithNatives(program.compiled, program.natives)
+		r.machine.SetStdout(r.config.Stdout)
+		r.machine.SetLimits(r.limits())
+		entry := len(program.compiled.Modules) - 1
+		for slot, name := range program.hostGlobals {
+			r.machine.SetModuleGlobal(entry, slot, r.globals[name])
+		}
+		return toError(r.machine.RunProgramContext(ctx))
+	}
+
+	r.environment = objects.NewEnvironment(nil)
+	r.interpreter = interp.NewInterpreter(r.environment, program.natives)
+	for name, value := range r.globals {
+		r.environment.Define(name, value)
+	}
+	r.interpreter.SetStdout(r.config.Stdout)
+	r.interpreter.SetLimits(r.limits())
+	r.interpreter.SetLoader(program.loader)
+	r.interpreter.SetLocals(program.locals)
+	r.interpreter.SetResolvedModules(program.resolved)
+	r.interpreter.SetCurrentModule(program.module.Path)
+	_, err := r.interpreter.InterpretContext(ctx, program.module.GetAllStatements())
+	return toError(err)
+}
+
+func (r *Runtime) limits() objects.Limits {
+	return objects.Limits{
+		MaxSteps:          r.config.Limits.MaxSteps,
+		Timeout:           r.config.Limits.Timeout,
+		MaxCallDepth:      r.config.Limits.MaxCallDepth,
+		MaxAllocatedBytes: r.config.Limits.MaxAllocatedBytes,
+	}
+}
+
+// Get returns a global of the last program run.
+func (r *Runtime) Get(name string) (Value, error) {
+	obj, err := r.global(name)
+	if err != nil {
+		return Value{}, err
+	}
+	return Value{obj: obj, run: r.runs}, nil
+}
+
+func (r *Runtime) global(name string) (objects.Object, error) {
+	switch {
+	case r.machine != nil:
+		if slot, ok := r.program.entry[name]; ok {
+			globals := r.machine.GetModuleGlobals(len(r.program.compiled.Modules) - 1)
+			if obj := globals[slot]; obj != nil {
+				return obj, nil
+			}
+		}
+	case r.environment != nil:
+		// Natives live among the interpreter's globals but are not the program's
+		obj, err := r.environment.Get(name)
+		if _, native := obj.(*objects.NativeFunction); err == nil && !native {
+			return obj, nil
+		}
+	default:
+		return nil, ErrNotRun
+	}
+	return nil, fmt.Errorf("%w %s", ErrUndefined, name)
+}
+
+// Call calls the function, class or method held in a global of the last
+// program run. Arguments are converted from Go: nil, bools, numbers,
+// strings, slices, maps with string keys and Values are supported.
+func (r *Runtime) Call(name string, args ...interface{}) (Value, error) {
+	return r.CallContext(context.Background(), name, args...)
+}
+
+// CallContext is like Call but stops the call with a *CanceledError once
+// ctx is done.
+func (r *Runtime) CallContext(ctx context.Context, name string, args ...interface{}) (Value, error) {
+	fn, err := r.global(name)
+	if err != nil {
+		return Value{}, err
+	}
+
+	objs := make([]objects.Object, len(args))
+	for i, arg := range args {
+		if objs[i], err = toObject(arg, r.runs); err != nil {
+			return Value{}, fmt.Errorf("argument %d: %w", i, err)
+		}
+	}
+
+	var result objects.Object
+	if r.machine != nil {
+		result, err = r.machine.CallContext(ctx, fn, objs...)
+	} else {
+		result, err = r.interpreter.CallContext(ctx, fn, objs)
+	}
+	if err != nil {
+		return Value{}, toError(err)
+	}
+	return Value{obj: result, run: r.runs}, nil
+}
+
+// stringLoader loads a program given as a string, reading its imports with
+// the wrapped loader.
+type stringLoader struct {
+	parser.ModuleLoader
+	src []byte
+}
+
+func (l stringLoader) ReadModule(path string) ([]byte, error) {
+	if path == StringPath {
+		return l.src, nil
+	}
+	return l.ModuleLoader.ReadModule(path)
+}
@@ -0,0 +1,666 @@
+package viri
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/harshagw/viri/internal/objects"
+)
+
+var engines = []Engine{Interpreter, VM}
+
+func TestRunString(t *testing.T) {
+	for _, engine := range engines {
+		t.Run(string(engine), func(t *testing.T) {
+			var out bytes.Buffer
+			rt := New(&Config{Engine: engine, Stdout: &out})
+			if err := rt.RunString("var x = 1 + 2;\nprint \"x is ${x}\";\n"); err != nil {
+				t.Fatalf("RunString() error = %v", err)
+			}
+			if out.String() != "x is 3\n" {
+				t.Errorf("output = %q, want %q", out.String(), "x is 3\n")
+			}
+
+			x, err := rt.Get("x")
+			if err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+			if n, ok := x.AsInt(); !ok || n != 3 {
+				t.Errorf("x = %v, want 3", x)
+			}
+			if _, err := rt.Get("missing"); !errors.Is(err, ErrUndefined) {
+				t.Errorf("Get(missing) error = %v, want %v", err, ErrUndefined)
+			}
+			if _, err := rt.Get("len"); !errors.Is(err, ErrUndefined) {
+				t.Errorf("Get(len) error = %v, want %v", err, ErrUndefined)
+			}
+		})
+	}
+}
+
+func TestSetAndCall(t *testing.T) {
+	src := `
+var calls = 0;
+fun describe(user, tags) {
+    calls = calls + 1;
+    return {"greeting": greeting + ", " + user["name"], "first": tags[0], "count": len(tags), "limit": limit};
+}
+class Counter {
+    init(start) { this.n = start; }
+    next() { this.n = this.n + 1; return this.n; }
+}
+fun advance(counter) {
+    return counter.next();
+}
+`
+	for _, engine := range engines {
+		t.Run(string(engine), func(t *testing.T) {
+			rt := New(&Config{Engine: engine})
+			if err := rt.Set("greeting", "hello"); err != nil {
+				t.Fatal(err)
+			}
+			if err := rt.Set("limit", uint8(10)); err != nil {
+				t.Fatal(err)
+			}
+			if err := rt.RunString(src); err != nil {
+				t.Fatalf("RunString() error = %v", err)
+			}
+
+			result, err := rt.Call("describe", map[string]string{"name": "ada"}, []interface{}{"admin", true})
+			if err != nil {
+				t.Fatalf("Call() error = %v", err)
+			}
+			want := map[string]interface{}{"greeting": "hello, ada", "first": "admin", "count": 2.0, "limit": 10.0}
+			if got := result.Interface(); !reflect.DeepEqual(got, want) {
+				t.Errorf("Call() = %v, want %v", got, want)
+			}
+			if calls, _ := rt.Get("calls"); calls.String() != "1" {
+				t.Errorf("calls = %v, want 1", calls)
+			}
+
+			counter, err := rt.Call("Counter", 41)
+			if err != nil {
+				t.Fatalf("Call(Counter) error = %v", err)
+			}
+			if counter.Kind() != KindObject {
+				t.Errorf("Counter() kind = %v, want %v", counter.Kind(), KindObject)
+			}
+			if answer, err := rt.Call("advance", counter); err != nil || answer.String() != "42" {
+				t.Errorf("Call(advance) = %v, %v, want 42", answer, err)
+			}
+
+			// Objects cannot outlive their run
+			if err := rt.Set("counter", []interface{}{counter}); !errors.Is(err, errStaleValue) {
+				t.Errorf("Set() error = %v, want %v", err, errStaleValue)
+			}
+			if err := rt.RunString("fun advance(c) { return c; }"); err != nil {
+				t.Fatalf("RunString() error = %v", err)
+			}
+			if _, err := rt.Call("advance", counter); !errors.Is(err, errStaleValue) {
+				t.Errorf("Call() error = %v, want %v", err, errStaleValue)
+			}
+		})
+	}
+}
+
+func TestCallErrors(t *testing.T) {
+	src := "fun f(x) {\n    return x - 1;\n}\nvar n = 1;\n"
+	for _, engine := range engines {
+		t.Run(string(engine), func(t *testing.T) {
+			rt := New(&Config{Engine: engine})
+			if _, err := rt.Call("f"); !errors.Is(err, ErrNotRun) {
+				t.Errorf("Call() before Run error = %v, want %v", err, ErrNotRun)
+			}
+			if err := rt.RunString(src); err != nil {
+				t.Fatalf("RunString() error = %v", err)
+			}
+
+			_, err := rt.Call("f", "a")
+			var rtErr *RuntimeError
+			if !errors.As(err, &rtErr) {
+				t.Fatalf("Call() error = %v, want a *RuntimeError", err)
+			}
+			wantTrace := []Frame{{Function: "f", File: StringPath, Line: 2}}
+			if rtErr.File != StringPath || rtErr.Line != 2 || rtErr.Column != 14 || !reflect.DeepEqual(rtErr.Trace, wantTrace) {
+				t.Errorf("unexpected error %+v", rtErr)
+			}
+
+			if _, err := rt.Call("f"); !errors.As(err, &rtErr) {
+				t.Errorf("Call() with too few arguments error = %v, want a *RuntimeError", err)
+			}
+			if _, err := rt.Call("n"); !errors.As(err, &rtErr) {
+				t.Errorf("Call() of a number error = %v, want a *RuntimeError", err)
+			}
+			if _, err := rt.Call("f", struct{}{}); err == nil {
+				t.Errorf("expected an error converting a struct")
+			}
+
+			// The runtime is still usable after an error
+			if v, err := rt.Call("f", 3); err != nil || v.String() != "2" {
+				t.Errorf("Call() = %v, %v, want 2", v, err)
+			}
+		})
+	}
+}
+
+func TestRegister(t *testing.T) {
+	for _, engine := range engines {
+		t.Run(string(engine), func(t *testing.T) {
+			var out bytes.Buffer
+			rt := New(&Config{Engine: engine, Stdout: &out, NoBuiltins: true})
+			err := rt.Register(Function{Name: "words", Arity: -1, Fn: func(args []Value) (interface{}, error) {
+				words := make([]string, len(args))
+				for i, arg := range args {
+					words[i] = arg.String()
+				}
+				return words, nil
+			}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = rt.Register(Function{Name: "fail", Arity: 0, Fn: func(args []Value) (interface{}, error) {
+				return nil, errors.New("failed in Go")
+			}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := rt.Register(Function{Name: "fail", Fn: func(args []Value) (interface{}, error) { return nil, nil }}); err == nil {
+				t.Errorf("expected an error registering fail twice")
+			}
+
+			if err := rt.RunString("print words(1, \"a\", nil);\nprint words();"); err != nil {
+				t.Fatalf("RunString() error = %v", err)
+			}
+			if out.String() != "[1, a, nil]\n[]\n" {
+				t.Errorf("output = %q", out.String())
+			}
+
+			var rtErr *RuntimeError
+			if err := rt.RunString("fail();"); !errors.As(err, &rtErr) || rtErr.Message != "failed in Go" {
+				t.Errorf("RunString() error = %v, want failed in Go", err)
+			}
+			// Builtins were left out
+			if err := rt.RunString("len(\"a\");"); err == nil {
+				t.Errorf("expected len to be undefined")
+			}
+		})
+	}
+}
+
+func TestCompileError(t *testing.T) {
+	for _, engine := range engines {
+		t.Run(string(engine), func(t *testing.T) {
+			var out bytes.Buffer
+			rt := New(&Config{Engine: engine, Stdout: &out})
+			err := rt.RunString("print 1;\nprint 1 +;\n")
+			var compileErr *CompileError
+			if !errors.As(err, &compileErr) {
+				t.Fatalf("RunString() error = %v, want a *CompileError", err)
+			}
+			want := Diagnostic{File: StringPath, Line: 2, Column: 10, Message: "Expect expression."}
+			if len(compileErr.Diagnostics) == 0 || compileErr.Diagnostics[0] != want {
+				t.Errorf("diagnostics = %v, want %v first", compileErr.Diagnostics, want)
+			}
+			if out.Len() != 0 {
+				t.Errorf("program ran despite errors, printing %q", out.String())
+			}
+
+			if _, err := rt.CompileFile("/no/such/file.viri"); !errors.As(err, &compileErr) {
+				t.Errorf("CompileFile() error = %v, want a *CompileError", err)
+			}
+		})
+	}
+}
+
+func TestRunFileFromFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"app/main.viri":      {Data: []byte("import \"../lib/math.viri\" as math;\nvar result = math.square(base);\nprint result;\n")},
+		"lib/math.viri":      {Data: []byte("export fun square(x) {\n    return x * x;\n}\n")},
+		"escape/main.viri":   {Data: []byte("import \"../../outside.viri\" as o;\n")},
+		"warnings/main.viri": {Data: []byte("fun f() {\n    var unused = 1;\n}\nf();\n")},
+	}
+
+	for _, engine := range engines {
+		t.Run(string(engine), func(t *testing.T) {
+			var out bytes.Buffer
+			rt := New(&Config{Engine: engine, Stdout: &out, FS: fsys})
+			if err := rt.Set("base", 7); err != nil {
+				t.Fatal(err)
+			}
+			if err := rt.RunFile("app/main.viri"); err != nil {
+				t.Fatalf("RunFile() error = %v", err)
+			}
+			if out.String() != "49\n" {
+				t.Errorf("output = %q, want %q", out.String(), "49\n")
+			}
+
+			// Programs from strings import from the root of the file system
+			if err := rt.RunString("import \"lib/math.viri\" as m;\nprint m.square(3);\n"); err != nil {
+				t.Fatalf("RunString() error = %v", err)
+			}
+			if out.String() != "49\n9\n" {
+				t.Errorf("output = %q, want %q", out.String(), "49\n9\n")
+			}
+
+			if err := rt.RunFile("escape/main.viri"); err == nil {
+				t.Errorf("expected an error importing outside the file system")
+			}
+		})
+	}
+
+	program, err := New(&Config{FS: fsys}).CompileFile("warnings/main.viri")
+	if err != nil {
+		t.Fatalf("CompileFile() error = %v", err)
+	}
+	if len(program.Warnings()) != 1 || program.Warnings()[0].Line != 2 {
+		t.Errorf("Warnings() = %v, want one on line 2", program.Warnings())
+	}
+}
+
+func TestProgramReuse(t *testing.T) {
+	for _, engine := range engines {
+		t.Run(string(engine), func(t *testing.T) {
+			var out bytes.Buffer
+			rt := New(&Config{Engine: engine, Stdout: &out})
+			if err := rt.Set("n", 1); err != nil {
+				t.Fatal(err)
+			}
+			program, err := rt.CompileString("print n * 2;")
+			if err != nil {
+				t.Fatalf("CompileString() error = %v", err)
+			}
+			for _, n := range []int{1, 2, 3} {
+				if err := rt.Set("n", n); err != nil {
+					t.Fatal(err)
+				}
+				if err := rt.Run(program); err != nil {
+					t.Fatalf("Run() error = %v", err)
+				}
+			}
+			if out.String() != "2\n4\n6\n" {
+				t.Errorf("output = %q, want %q", out.String(), "2\n4\n6\n")
+			}
+
+			if err := New(&Config{Engine: engine}).Run(program); err == nil {
+				t.Errorf("expected an error running a program compiled by another runtime")
+			}
+		})
+	}
+}
+
+func TestLimits(t *testing.T) {
+	for _, engine := range engines {
+		t.Run(string(engine), func(t *testing.T) {
+			// Limit errors cannot be caught by the program
+			rt := New(&Config{Engine: engine, Limits: Limits{MaxSteps: 10000}})
+			err := rt.RunString("try { while (true) {} } catch (e) { print e; }")
+			var stepErr *StepLimitError
+			if !errors.As(err, &stepErr) || stepErr.Limit != 10000 {
+				t.Errorf("RunString() error = %v, want a *StepLimitError", err)
+			}
+			if err := rt.RunString("var total = 0; for (var i = 0; i < 10; i = i + 1) total = total + i;"); err != nil {
+				t.Errorf("RunString() within the limit error = %v", err)
+			}
+
+			rt = New(&Config{Engine: engine, Limits: Limits{Timeout: 20 * time.Millisecond}})
+			err = rt.RunString("while (true) {}")
+			var timeoutErr *TimeoutError
+			if !errors.As(err, &timeoutErr) || !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("RunString() error = %v, want a *TimeoutError", err)
+			}
+
+			rt = New(&Config{Engine: engine, Limits: Limits{MaxCallDepth: 50}})
+			err = rt.RunString("fun down(n) { if (n == 0) return 0; return down(n - 1); } down(49);")
+			if err != nil {
+				t.Errorf("RunString() at the call depth limit error = %v", err)
+			}
+			err = rt.RunString("fun down(n) { if (n == 0) return 0; return down(n - 1); } down(50);")
+			var depthErr *CallDepthError
+			if !errors.As(err, &depthErr) || depthErr.Limit != 50 {
+				t.Errorf("RunString() error = %v, want a *CallDepthError", err)
+			}
+		})
+	}
+}
+
+func TestDefaultCallDepth(t *testing.T) {
+	for _, engine := range engines {
+		t.Run(string(engine), func(t *testing.T) {
+			rt := New(&Config{Engine: engine})
+			err := rt.RunString("fun up(n) { return up(n + 1); } up(0);")
+			var depthErr *CallDepthError
+			if !errors.As(err, &depthErr) || depthErr.Limit != 1023 {
+				t.Errorf("RunString() error = %v, want a *CallDepthError with limit 1023", err)
+			}
+		})
+	}
+}
+
+func TestAllocationLimit(t *testing.T) {
+	src := `
+var caught = nil;
+var s = "";
+try {
+    while (true) s = s + "xxxxxxxxxx";
+} catch (e) {
+    caught = e.message;
+}
+`
+	for _, engine := range engines {
+		t.Run(string(engine), func(t *testing.T) {
+			rt := New(&Config{Engine: engine, Limits: Limits{MaxAllocatedBytes: 1 << 16}})
+			if err := rt.RunString(src); err != nil {
+				t.Fatalf("RunString() error = %v", err)
+			}
+			if caught, _ := rt.Get("caught"); caught.String() != "memory limit exceeded" {
+				t.Errorf("caught = %v, want the allocation limit error", caught)
+			}
+
+			err := rt.RunString("var items = []; while (true) items = [items, {\"n\": 1}];")
+			var rtErr *RuntimeError
+			if !errors.As(err, &rtErr) || !errors.Is(err, ErrAllocationLimit) {
+				t.Errorf("RunString() error = %v, want %v", err, ErrAllocationLimit)
+			}
+
+			// Values that are no longer used still count against the budget
+			rt = New(&Config{Engine: engine, Limits: Limits{MaxAllocatedBytes: 1 << 20}})
+			err = rt.RunString("for (var i = 0; i < 100000; i = i + 1) { var b = [1, 2, 3, 4, 5, 6, 7, 8]; }")
+			if !errors.As(err, &rtErr) || !errors.Is(err, ErrAllocationLimit) {
+				t.Fatalf("RunString() error = %v, want %v", err, ErrAllocationLimit)
+			}
+			if rtErr.Line != 1 || rtErr.Column != 50 {
+				t.Errorf("error at %d:%d, want 1:50", rtErr.Line, rtErr.Column)
+			}
+		})
+	}
+}
+
+func TestRunContext(t *testing.T) {
+	for _, engine := range engines {
+		t.Run(string(engine), func(t *testing.T) {
+			rt := New(&Config{Engine: engine})
+			program, err := rt.CompileString("fun spin() { while (true) {} } spin();")
+			if err != nil {
+				t.Fatalf("CompileString() error = %v", err)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			time.AfterFunc(20*time.Millisecond, cancel)
+			err = rt.RunContext(ctx, program)
+			var cancelErr *CanceledError
+			if !errors.As(err, &cancelErr) || !errors.Is(err, context.Canceled) {
+				t.Errorf("RunContext() error = %v, want a *CanceledError", err)
+			}
+
+			if err := rt.RunString("fun spin() { while (true) {} }"); err != nil {
+				t.Fatalf("RunString() error = %v", err)
+			}
+			ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+			defer cancel()
+			if _, err := rt.CallContext(ctx, "spin"); !errors.As(err, &cancelErr) || !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("CallContext() error = %v, want a *CanceledError", err)
+			}
+		})
+	}
+}
+
+func TestArrayMethods(t *testing.T) {
+	src := `
+var xs = [3, 1, 2];
+xs.push(4);
+var total = xs.map(fun (x) { return x * 10; }).filter(fun (x) { return x > 10; }).reduce(fun (a, b) { return a + b; }, 0);
+var sorted = xs.sort(fun (a, b) { return b - a; });
+fun check(x) {
+    return x - "a";
+}
+fun checkAll() {
+    return [1].map(check);
+}
+`
+	for _, engine := range engines {
+		t.Run(string(engine), func(t *testing.T) {
+			rt := New(&Config{Engine: engine})
+			if err := rt.RunString(src); err != nil {
+				t.Fatalf("RunString() error = %v", err)
+			}
+			if total, _ := rt.Get("total"); total.String() != "90" {
+				t.Errorf("total = %v, want 90", total)
+			}
+			sorted, _ := rt.Get("sorted")
+			if got, want := sorted.Interface(), []interface{}{4.0, 3.0, 2.0, 1.0}; !reflect.DeepEqual(got, want) {
+				t.Errorf("sorted = %v, want %v", got, want)
+			}
+
+			// Errors raised by callbacks keep the callback in their trace
+			_, err := rt.Call("checkAll")
+			var rtErr *RuntimeError
+			if !errors.As(err, &rtErr) {
+				t.Fatalf("Call() error = %v, want a *RuntimeError", err)
+			}
+			wantTrace := []Frame{{Function: "checkAll", File: StringPath, Line: 10}, {Function: "check", File: StringPath, Line: 7}}
+			if rtErr.Line != 7 || !reflect.DeepEqual(rtErr.Trace, wantTrace) {
+				t.Errorf("unexpected error %+v", rtErr)
+			}
+
+			err = rt.RunString("[].pop();")
+			if !errors.As(err, &rtErr) || rtErr.Message != "pop() from empty array" {
+				t.Errorf("RunString() error = %v, want the empty array error", err)
+			}
+
+			rt = New(&Config{Engine: engine, Limits: Limits{MaxAllocatedBytes: 1 << 12}})
+			err = rt.RunString("var xs = []; while (true) xs.push(1);")
+			if !errors.Is(err, ErrAllocationLimit) {
+				t.Errorf("RunString() error = %v, want %v", err, ErrAllocationLimit)
+			}
+		})
+	}
+}
+
+func TestStringMethods(t *testing.T) {
+	src := `
+var s = "añb";
+var parts = [len(s), s[1], s[1:], s.upper(), s.indexOf("b"), "x,y".split(","), num("2.5"), str(1.5)];
+`
+	for _, engine := range engines {
+		t.Run(string(engine), func(t *testing.T) {
+			rt := New(&Config{Engine: engine})
+			if err := rt.RunString(src); err != nil {
+				t.Fatalf("RunString() error = %v", err)
+			}
+			parts, _ := rt.Get("parts")
+			want := []interface{}{3.0, "ñ", "ñb", "AÑB", 2.0, []interface{}{"x", "y"}, 2.5, "1.5"}
+			if got := parts.Interface(); !reflect.DeepEqual(got, want) {
+				t.Errorf("parts = %v, want %v", got, want)
+			}
+
+			err := rt.RunString(`"abc".repeat(-1);`)
+			var rtErr *RuntimeError
+			if !errors.As(err, &rtErr) || rtErr.Message != "repeat() count must not be negative: -1" {
+				t.Errorf("RunString() error = %v, want the negative count error", err)
+			}
+
+			rt = New(&Config{Engine: engine, Limits: Limits{MaxAllocatedBytes: 1 << 12}})
+			if err := rt.RunString(`"abc".repeat(10000);`); !errors.Is(err, ErrAllocationLimit) {
+				t.Errorf("RunString() error = %v, want %v", err, ErrAllocationLimit)
+			}
+		})
+	}
+}
+
+func TestHashMethods(t *testing.T) {
+	src := `
+var h = {"z": 1, "a": 2} + {"m": 3, "z": 4};
+h.delete("a");
+h["a"] = 5;
+var keys = h.keys();
+var missing = [h.has("q"), h.get("q"), h.get("q", 0)];
+var shown = "${h}";
+`
+	for _, engine := range engines {
+		t.Run(string(engine), func(t *testing.T) {
+			rt := New(&Config{Engine: engine})
+			if err := rt.RunString(src); err != nil {
+				t.Fatalf("RunString() error = %v", err)
+			}
+			keys, _ := rt.Get("keys")
+			if got, want := keys.Interface(), []interface{}{"z", "m", "a"}; !reflect.DeepEqual(got, want) {
+				t.Errorf("keys = %v, want %v", got, want)
+			}
+			missing, _ := rt.Get("missing")
+			if got, want := missing.Interface(), []interface{}{false, nil, 0.0}; !reflect.DeepEqual(got, want) {
+				t.Errorf("missing = %v, want %v", got, want)
+			}
+			if shown, _ := rt.Get("shown"); shown.String() != `{"z": 4, "m": 3, "a": 5}` {
+				t.Errorf(`shown = %v, want {"z": 4, "m": 3, "a": 5}`, shown)
+			}
+		})
+	}
+}
+
+func TestHashKeys(t *testing.T) {
+	src := `
+class Key {
+    init(id) { this.id = id; }
+    hash() { return this.id; }
+}
+var h = {1: "a", "1": "b", true: "c"};
+h[Key(1)] = "d";
+var found = [h[1], h["1"], h[true], h[Key(1)], len(h)];
+`
+	for _, engine := range engines {
+		t.Run(string(engine), func(t *testing.T) {
+			rt := New(&Config{Engine: engine})
+			if err := rt.RunString(src); err != nil {
+				t.Fatalf("RunString() error = %v", err)
+			}
+			found, _ := rt.Get("found")
+			if got, want := found.Interface(), []interface{}{"a", "b", "c", "d", 4.0}; !reflect.DeepEqual(got, want) {
+				t.Errorf("found = %v, want %v", got, want)
+			}
+
+			h, _ := rt.Get("h")
+			// 1 and "1" are both "1" in a Go map
+			if m, ok := h.AsMap(); ok {
+				t.Errorf("AsMap() = %v, want colliding keys reported", m)
+			}
+			if got, ok := h.Interface().(Value); !ok || got.Kind() != KindMap {
+				t.Errorf("Interface() = %v, want the hash as a Value", h.Interface())
+			}
+			entries, ok := h.AsEntries()
+			if !ok || len(entries) != 4 {
+				t.Fatalf("AsEntries() = %v, %v", entries, ok)
+			}
+			for i, want := range []interface{}{1.0, "1", true} {
+				if got := entries[i].Key.Interface(); got != want {
+					t.Errorf("key %d = %#v, want %#v", i, got, want)
+				}
+			}
+			if got := entries[3].Value.String(); got != "d" {
+				t.Errorf("value of Key(1) = %s, want d", got)
+			}
+
+			if _, ok := found.AsEntries(); ok {
+				t.Error("AsEntries() of an array succeeded")
+			}
+		})
+	}
+}
+
+func TestOperators(t *testing.T) {
+	values := []struct {
+		src  string
+		want string
+	}{
+		{"1 + 2", "3"},
+		{`"n=" + 1.5`, "n=1.5"},
+		{`10 ** 21 + "!"`, "1000000000000000000000!"},
+		{"-7 % 3", "2"},
+		{"7 ~/ -2", "-4"},
+		{"1 < 2 and 2 <= 2 and 3 > 2 and 3 >= 3", "true"},
+		{`"héllo"[1]`, "é"},
+		{`{1: "a"}[1]`, "a"},
+	}
+	errs := []struct {
+		src  string
+		want string
+	}{
+		{"1 / 0", "Division by zero."},
+		{"1 % 0", "Division by zero."},
+		{"1 ~/ 0", "Division by zero."},
+		{`"a" - 1`, "Operands must be numbers."},
+		{`"a" < "b"`, "Operands must be numbers."},
+		{"true + 1", "Operands to '+' must be two numbers, two strings, a string and a number, or two hashes."},
+		{`-"a"`, "Operand must be a number."},
+		{`[1]["0"]`, "Index must be a number."},
+		{"[1][0.5]", "Index must be an integer."},
+		{"[1][1]", "Index out of bounds."},
+		{`"ab"[-1]`, "Index out of bounds."},
+		{`var h = {}; h["a"]`, "Key 'a' not found in hash map."},
+		{"1[0]", "Indexing target must be an array, string or hash map."},
+		{`var s = "a"; s[0] = "b"`, "Index assignment target must be an array or hash map."},
+	}
+	for _, engine := range engines {
+		t.Run(string(engine), func(t *testing.T) {
+			rt := New(&Config{Engine: engine})
+			for _, tt := range values {
+				if err := rt.RunString("var result = " + tt.src + ";"); err != nil {
+					t.Errorf("%s: RunString() error = %v", tt.src, err)
+					continue
+				}
+				if result, _ := rt.Get("result"); result.String() != tt.want {
+					t.Errorf("%s = %v, want %s", tt.src, result, tt.want)
+				}
+			}
+			for _, tt := range errs {
+				err := rt.RunString(tt.src + ";")
+				var rtErr *RuntimeError
+				if !errors.As(err, &rtErr) || rtErr.Message != tt.want || rtErr.Line != 1 {
+					t.Errorf("%s: RunString() error = %v, want %q at line 1", tt.src, err, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestValue(t *testing.T) {
+	tests := []struct {
+		in   interface{}
+		kind Kind
+		want interface{}
+	}{
+		{nil, KindNil, nil},
+		{true, KindBool, true},
+		{int64(-3), KindNumber, -3.0},
+		{float32(0.5), KindNumber, 0.5},
+		{"hi", KindString, "hi"},
+		{[]int{1, 2}, KindArray, []interface{}{1.0, 2.0}},
+		{map[string][]string{"a": {"b"}}, KindMap, map[string]interface{}{"a": []interface{}{"b"}}},
+		{(*int)(nil), KindNil, nil},
+	}
+
+	for _, tt := range tests {
+		obj, err := toObject(tt.in, 0)
+		if err != nil {
+			t.Fatalf("toObject(%v) error = %v", tt.in, err)
+		}
+		v := Value{obj: obj}
+		if v.Kind() != tt.kind || !reflect.DeepEqual(v.Interface(), tt.want) {
+			t.Errorf("toObject(%v) = %v of kind %v, want %v of kind %v", tt.in, v.Interface(), v.Kind(), tt.want, tt.kind)
+		}
+	}
+
+	if _, err := toObject(map[int]int{1: 1}, 0); err == nil {
+		t.Errorf("expected an error converting a map with number keys")
+	}
+	if n, ok := (Value{obj: objects.NewNumber(1.5)}).AsInt(); ok {
+		t.Errorf("AsInt() of 1.5 = %d, want not ok", n)
+	}
+	if !(Value{}).IsNil() || (Value{}).String() != "nil" {
+		t.Errorf("the zero Value should be nil")
+	}
+}
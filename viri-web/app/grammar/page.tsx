@@ -152,7 +152,8 @@ export default function GrammarPage() {
                   <RuleLink href="#exprStmt">exprStmt</RuleLink> | <RuleLink href="#forStmt">forStmt</RuleLink> | <RuleLink href="#ifStmt">ifStmt</RuleLink> |{" "}
                   <RuleLink href="#printStmt">printStmt</RuleLink> | <RuleLink href="#returnStmt">returnStmt</RuleLink> |{" "}
                   <RuleLink href="#whileStmt">whileStmt</RuleLink> | <RuleLink href="#breakStmt">breakStmt</RuleLink> |{" "}
-                  <RuleLink href="#continueStmt">continueStmt</RuleLink> | <RuleLink href="#block">block</RuleLink>
+                  <RuleLink href="#continueStmt">continueStmt</RuleLink> | <RuleLink href="#tryStmt">tryStmt</RuleLink> |{" "}
+                  <RuleLink href="#throwStmt">throwStmt</RuleLink> | <RuleLink href="#block">block</RuleLink>
                 </>
               }
               referencedBy={["declaration", "forStmt", "ifStmt", "whileStmt"]}
@@ -166,7 +167,7 @@ export default function GrammarPage() {
                   <Token>{"{"}</Token> {"{"} <RuleLink href="#declaration">declaration</RuleLink> {"}"} <Token>{"}"}</Token>
                 </>
               }
-              referencedBy={["function", "functionExpr", "statement"]}
+              referencedBy={["function", "functionExpr", "statement", "tryStmt"]}
             />
 
             <GrammarRule
@@ -234,6 +235,9 @@ export default function GrammarPage() {
                   <Token>for</Token> <Token>(</Token> ( <RuleLink href="#varDecl">varDecl</RuleLink> | <RuleLink href="#constDecl">constDecl</RuleLink> |{" "}
                   <RuleLink href="#exprStmt">exprStmt</RuleLink> | <Token>;</Token> ) [ <RuleLink href="#expression">expression</RuleLink> ] <Token>;</Token> [{" "}
                   <RuleLink href="#expression">expression</RuleLink> ] <Token>)</Token> <RuleLink href="#statement">statement</RuleLink>
+                  <br />
+                  | <Token>for</Token> <Token>(</Token> <Token>var</Token> <Lexical>IDENTIFIER</Lexical> [ <Token>,</Token> <Lexical>IDENTIFIER</Lexical> ]{" "}
+                  <Token>in</Token> <RuleLink href="#expression">expression</RuleLink> <Token>)</Token> <RuleLink href="#statement">statement</RuleLink>
                 </>
               }
               referencedBy={["statement"]}
@@ -261,6 +265,29 @@ export default function GrammarPage() {
               referencedBy={["statement"]}
             />
 
+            <GrammarRule
+              id="tryStmt"
+              name="tryStmt"
+              definition={
+                <>
+                  <Token>try</Token> <RuleLink href="#block">block</RuleLink> [ <Token>catch</Token> <Token>(</Token> <Lexical>IDENTIFIER</Lexical>{" "}
+                  <Token>)</Token> <RuleLink href="#block">block</RuleLink> ] [ <Token>finally</Token> <RuleLink href="#block">block</RuleLink> ]
+                </>
+              }
+              referencedBy={["statement"]}
+            />
+
+            <GrammarRule
+              id="throwStmt"
+              name="throwStmt"
+              definition={
+                <>
+                  <Token>throw</Token> <RuleLink href="#expression">expression</RuleLink> <Token>;</Token>
+                </>
+              }
+              referencedBy={["statement"]}
+            />
+
             {/* Expressions */}
             <p className="text-sm text-muted-foreground uppercase tracking-wider pt-8">expressions</p>
 
@@ -281,6 +308,7 @@ export default function GrammarPage() {
                 "whileStmt",
                 "printStmt",
                 "returnStmt",
+                "throwStmt",
                 "call",
                 "arrayLiteral",
                 "hashEntry",
@@ -362,7 +390,7 @@ export default function GrammarPage() {
               name="factor"
               definition={
                 <>
-                  <RuleLink href="#unary">unary</RuleLink> {"{"} ( <Token>/</Token> | <Token>*</Token> ) <RuleLink href="#unary">unary</RuleLink> {"}"}
+                  <RuleLink href="#unary">unary</RuleLink> {"{"} ( <Token>/</Token> | <Token>*</Token> | <Token>%</Token> | <Token>~/</Token> ) <RuleLink href="#unary">unary</RuleLink> {"}"}
                 </>
               }
               referencedBy={["term"]}
@@ -373,10 +401,21 @@ export default function GrammarPage() {
               name="unary"
               definition={
                 <>
-                  ( <Token>!</Token> | <Token>-</Token> ) <RuleLink href="#unary">unary</RuleLink> | <RuleLink href="#call">call</RuleLink>
+                  ( <Token>!</Token> | <Token>-</Token> ) <RuleLink href="#unary">unary</RuleLink> | <RuleLink href="#exponent">exponent</RuleLink>
+                </>
+              }
+              referencedBy={["factor", "exponent"]}
+            />
+
+            <GrammarRule
+              id="exponent"
+              name="exponent"
+              definition={
+                <>
+                  <RuleLink href="#call">call</RuleLink> [ <Token>**</Token> <RuleLink href="#unary">unary</RuleLink> ]
                 </>
               }
-              referencedBy={["factor"]}
+              referencedBy={["unary"]}
             />
 
             <GrammarRule
@@ -388,7 +427,7 @@ export default function GrammarPage() {
                   <Token>.</Token> <Lexical>IDENTIFIER</Lexical> | <Token>[</Token> <RuleLink href="#expression">expression</RuleLink> <Token>]</Token> {"}"}
                 </>
               }
-              referencedBy={["unary", "assignment"]}
+              referencedBy={["exponent", "assignment"]}
             />
 
             <GrammarRule
@@ -472,6 +511,10 @@ export default function GrammarPage() {
             <p className="text-sm text-muted-foreground">
               <Lexical>IDENTIFIER</Lexical>, <Lexical>NUMBER</Lexical>, <Lexical>STRING</Lexical>, <Lexical>EOF</Lexical> are lexical tokens.
             </p>
+            <p className="text-sm text-muted-foreground mt-2">
+              A <Lexical>STRING</Lexical> may contain the escapes <code>\n \t \r \0 \" \\ \$ \uXXXX \u{"{"}X...{"}"}</code> and
+              interpolations <code>${"{"}expression{"}"}</code>, whose values are converted to strings and concatenated.
+            </p>
           </div>
         </div>
       </main>
@@ -7,7 +7,7 @@ export const registerViri = () => {
       greedy: true,
     },
     string: {
-      pattern: /"[^"]*"/,
+      pattern: /"(?:\\.|[^"\\])*"/,
       greedy: true,
     },
     "class-name": {
@@ -17,11 +17,11 @@ export const registerViri = () => {
     function: {
       pattern: /\b[a-zA-Z_]\w*(?=\()/,
     },
-    keyword: /\b(?:and|or|if|else|for|while|return|break|var|fun|class|print|init|this|super|import|as)\b/,
+    keyword: /\b(?:and|or|if|else|for|in|while|return|break|try|catch|finally|throw|var|fun|class|print|init|this|super|import|as)\b/,
     boolean: /\b(?:true|false)\b/,
     nil: /\bnil\b/,
     number: /\b\d+(?:\.\d+)?\b/,
-    operator: /==|!=|<=|>=|[=!<>\+\-\*\/]/,
+    operator: /==|!=|<=|>=|\*\*|~\/|[=!<>\+\-\*\/%]/,
     punctuation: /[{}[\];(),.:]/,
   };
 };